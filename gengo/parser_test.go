@@ -246,3 +246,258 @@ func TestMD5_sensor_msgs(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMessage_ROS2(t *testing.T) {
+	const text string = `
+# ROS 2 definitions add default values and bounded types.
+int32 X=5
+string NAME="constant"
+int32 i32 42
+float64 f64 -1.5
+bool b true
+string s "Lorem # Ipsum" # Comment is ignored
+string<=10 bs 'bounded'
+wstring ws
+int32[3] fa [1, 2, 3]
+int32[<=4] ba [5, 6]
+string<=5[<=2] bsa ["a", "b,c"]
+builtin_interfaces/Time stamp
+`
+
+	ctx, e := libgengo.NewPkgContext(nil)
+	if e != nil {
+		t.Fatalf("Failed to create MsgContext.")
+	}
+	spec, e := ctx.LoadMsgFromString(text, "foo/Foo")
+	if e != nil {
+		t.Fatalf("Failed to parse: %v", e)
+	}
+	if len(spec.Constants) != 2 || len(spec.Fields) != 10 {
+		t.Fatalf("Expected 2 constants and 10 fields, got %d and %d", len(spec.Constants), len(spec.Fields))
+	}
+
+	fields := make(map[string]*libgengo.Field)
+	for i, f := range spec.Fields {
+		fields[f.Name] = &spec.Fields[i]
+	}
+	assertEqual(t, fields["i32"].Default, int32(42))
+	assertEqual(t, fields["f64"].Default, float64(-1.5))
+	assertEqual(t, fields["b"].Default, true)
+	assertEqual(t, fields["s"].Default, "Lorem # Ipsum")
+	assertEqual(t, fields["bs"].Default, "bounded")
+	assertEqual(t, fields["bs"].StringBound, 10)
+	assertEqual(t, fields["bs"].String(), "string<=10 bs")
+	assertEqual(t, fields["ws"].Type, "string")
+	assertEqual(t, fields["ws"].Default, nil)
+	assertEqual(t, fields["i32"].ZeroValue, "42")
+	assertEqual(t, fields["s"].ZeroValue, `"Lorem # Ipsum"`)
+
+	if !reflect.DeepEqual(fields["fa"].Default, []interface{}{int32(1), int32(2), int32(3)}) {
+		t.Errorf("Unexpected fixed array default %v", fields["fa"].Default)
+	}
+	assertEqual(t, fields["ba"].ArrayLen, -1)
+	assertEqual(t, fields["ba"].ArrayBound, 4)
+	assertEqual(t, fields["ba"].String(), "int32[<=4] ba")
+	if !reflect.DeepEqual(fields["bsa"].Default, []interface{}{"a", "b,c"}) {
+		t.Errorf("Unexpected bounded string array default %v", fields["bsa"].Default)
+	}
+	assertEqual(t, fields["bsa"].String(), "string<=5[<=2] bsa")
+	assertEqual(t, fields["stamp"].Package, "builtin_interfaces")
+}
+
+func TestParseMessage_ROS2Errors(t *testing.T) {
+	var tests = []string{
+		"int32[3] fa [1, 2]",
+		"int32[<=1] ba [1, 2]",
+		"string<=2 s \"too long\"",
+		"time t 5",
+		"foo/Bar b 1",
+		"int8 i 300",
+		"int32[] a 1",
+		"string<=0 s",
+	}
+
+	ctx, e := libgengo.NewPkgContext(nil)
+	if e != nil {
+		t.Fatalf("Failed to create MsgContext.")
+	}
+	for _, test := range tests {
+		if _, e := ctx.LoadMsgFromString(test, "foo/Foo"); e == nil {
+			t.Errorf("INPUT(%s) | should fail but succeeded", test)
+		}
+	}
+}
+
+const testIDL string = `// generated from rosidl_adapter/resource/msg.idl.em
+// with input from foo_msgs/msg/Foo.msg
+// generated code does not contain a copyright notice
+
+#include "builtin_interfaces/msg/Time.idl"
+
+module foo_msgs {
+  module msg {
+    typedef double double__9[9];
+    module Foo_Constants {
+      const uint8 MODE_A = 0;
+      const int32 OFFSET = -4;
+      const string NAME = "foo"
+        "bar";
+      const boolean ENABLED = TRUE;
+    };
+    @verbatim (language="comment", text=
+      "A test message." "\n"
+      "Second line.")
+    struct Foo {
+      @verbatim (language="comment", text=
+        "Time of the sample.")
+      builtin_interfaces::msg::Time stamp;
+
+      @default (value=3)
+      int32 count;
+
+      @default (value="bar")
+      string<16> label;
+
+      double__9 covariance;
+      sequence<octet> data;
+      sequence<float, 4> bounded;
+      unsigned long long big;
+      boolean flag;
+      Bar bar;
+      @default (value="(1, 2)")
+      sequence<int16> defaults;
+    };
+  };
+};
+`
+
+func TestParseIDL(t *testing.T) {
+	structs, e := libgengo.ParseIDL(testIDL, "foo_msgs/Foo")
+	if e != nil {
+		t.Fatalf("Failed to parse: %v", e)
+	}
+	if len(structs) != 1 {
+		t.Fatalf("Expected 1 struct, got %d", len(structs))
+	}
+	foo := libgengo.FindIDLStruct(structs, "Foo")
+	if foo == nil {
+		t.Fatalf("Struct Foo not found")
+	}
+	assertEqual(t, foo.Package, "foo_msgs")
+	assertEqual(t, foo.Kind, "msg")
+
+	expected := `# A test message.
+# Second line.
+uint8 MODE_A=0
+int32 OFFSET=-4
+string NAME=foobar
+bool ENABLED=true
+# Time of the sample.
+builtin_interfaces/Time stamp
+int32 count 3
+string<=16 label "bar"
+float64[9] covariance
+byte[] data
+float32[<=4] bounded
+uint64 big
+bool flag
+foo_msgs/Bar bar
+int16[] defaults [1, 2]
+`
+	assertEqual(t, foo.Text, expected)
+
+	ctx, e := libgengo.NewPkgContext(nil)
+	if e != nil {
+		t.Fatalf("Failed to create MsgContext.")
+	}
+	spec, e := ctx.LoadMsgFromIDLString(testIDL, "foo_msgs/Foo")
+	if e != nil {
+		t.Fatalf("Failed to load: %v", e)
+	}
+	if len(spec.Constants) != 4 || len(spec.Fields) != 10 {
+		t.Fatalf("Expected 4 constants and 10 fields, got %d and %d", len(spec.Constants), len(spec.Fields))
+	}
+	assertEqual(t, spec.Fields[2].StringBound, 16)
+	assertEqual(t, spec.Fields[3].ArrayLen, 9)
+	assertEqual(t, spec.Fields[5].ArrayBound, 4)
+}
+
+func TestParseIDL_Service(t *testing.T) {
+	const text string = `
+module foo_srvs {
+  module srv {
+    struct AddTwoInts_Request {
+      int64 a;
+      int64 b;
+    };
+    struct AddTwoInts_Response {
+      int64 sum;
+    };
+  };
+};
+`
+	ctx, e := libgengo.NewPkgContext(nil)
+	if e != nil {
+		t.Fatalf("Failed to create MsgContext.")
+	}
+	spec, e := ctx.LoadSrvFromIDLString(text, "foo_srvs/AddTwoInts")
+	if e != nil {
+		t.Fatalf("Failed to load: %v", e)
+	}
+	assertEqual(t, len(spec.Request.Fields), 2)
+	assertEqual(t, len(spec.Response.Fields), 1)
+	assertEqual(t, spec.Response.FullName, "foo_srvs/AddTwoIntsResponse")
+}
+
+func TestParseIDL_Errors(t *testing.T) {
+	var tests = []string{
+		"module foo { struct Foo { int32 x; }; ",
+		"module foo { struct Foo { int32 x }; };",
+		"module foo { struct Foo { long double x; }; };",
+		"module foo { struct Foo { double x[2][2]; }; };",
+		"module foo { interface Foo { }; };",
+		"module foo { struct Foo { string x = 1; }; };",
+	}
+
+	for _, test := range tests {
+		if _, e := libgengo.ParseIDL(test, "foo/Foo"); e == nil {
+			t.Errorf("INPUT(%s) | should fail but succeeded", test)
+		}
+	}
+}
+
+func TestPkgContext_FindIDL(t *testing.T) {
+	dir := t.TempDir()
+	pkgDir := dir + "/foo_msgs"
+	if e := os.MkdirAll(pkgDir+"/msg", 0775); e != nil {
+		t.Fatal(e)
+	}
+	files := map[string]string{
+		"/package.xml": "<package><name>foo_msgs</name></package>",
+		"/msg/Foo.idl": testIDL,
+		"/msg/Bar.msg": "int32 x 7",
+		"/msg/Bar.idl": "module foo_msgs { module msg { struct Bar { int32 y; }; }; };",
+	}
+	for name, content := range files {
+		if e := os.WriteFile(pkgDir+name, []byte(content), 0664); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	ctx, e := libgengo.NewPkgContext([]string{dir})
+	if e != nil {
+		t.Fatalf("Failed to create MsgContext.")
+	}
+	bar, e := ctx.LoadMsg("foo_msgs/Bar")
+	if e != nil {
+		t.Fatalf("Failed to load Bar: %v", e)
+	}
+	// The native definition takes precedence over the generated one.
+	assertEqual(t, bar.Fields[0].Name, "x")
+
+	foo, e := ctx.LoadMsg("foo_msgs/Foo")
+	if e != nil {
+		t.Fatalf("Failed to load Foo: %v", e)
+	}
+	assertEqual(t, len(foo.Fields), 10)
+}
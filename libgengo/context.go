@@ -70,6 +70,18 @@ func findPackages(pkgType string, rosPkgPaths []string) (map[string]string, erro
 						pkgs[fullname] = p
 					}
 
+					// ROS 2 packages also install the rosidl generated .idl files, which are only used when there is no native definition.
+					idlPaths, err := filepath.Glob(pkgPath + "/*" + ExtIDL)
+					if err != nil {
+						return nil
+					}
+					for _, p := range idlPaths {
+						fullname := pkgName + "/" + strings.TrimSuffix(filepath.Base(p), ExtIDL)
+						if _, ok := pkgs[fullname]; !ok {
+							pkgs[fullname] = p
+						}
+					}
+
 					// No point checking INSIDE this one, since it's already a package.
 					return filepath.SkipDir
 				}
@@ -175,7 +187,7 @@ func (ctx *PkgContext) LoadMsgFromString(text string, fullname string) (*MsgSpec
 		if len(cleanLine) == 0 {
 			// Skip empty line
 			continue
-		} else if strings.Contains(cleanLine, ConstChar) {
+		} else if isConstantLine(cleanLine) {
 			constant, e := loadConstantLine(origLine)
 			if e != nil {
 				return nil, NewSyntaxError(fullname, lineno, e.Error())
@@ -206,9 +218,29 @@ func (ctx *PkgContext) LoadMsgFromFile(filePath string, fullname string) (*MsgSp
 		return nil, e
 	}
 	text := string(bytes)
+	if filepath.Ext(filePath) == ExtIDL {
+		return ctx.LoadMsgFromIDLString(text, fullname)
+	}
 	return ctx.LoadMsgFromString(text, fullname)
 }
 
+// LoadMsgFromIDLString loads a message from a ROS 2 interface definition (.idl), which must declare a structure named after the message.
+func (ctx *PkgContext) LoadMsgFromIDLString(text string, fullname string) (*MsgSpec, error) {
+	_, shortName, err := packageResourceName(fullname)
+	if err != nil {
+		return nil, err
+	}
+	structs, err := ParseIDL(text, fullname)
+	if err != nil {
+		return nil, err
+	}
+	msg := FindIDLStruct(structs, shortName)
+	if msg == nil {
+		return nil, fmt.Errorf("IDL definition of `%s` does not declare struct %s", fullname, shortName)
+	}
+	return ctx.LoadMsgFromString(msg.Text, fullname)
+}
+
 func (ctx *PkgContext) LoadMsg(fullname string) (*MsgSpec, error) {
 	ctx.msgRegistryLock.RLock()
 	if spec, ok := ctx.msgRegistry[fullname]; ok {
@@ -233,18 +265,37 @@ func (ctx *PkgContext) LoadMsg(fullname string) (*MsgSpec, error) {
 }
 
 func (ctx *PkgContext) LoadSrvFromString(text string, fullname string) (*SrvSpec, error) {
-	packageName, shortName, err := packageResourceName(fullname)
-	if err != nil {
-		return nil, err
-	}
-
 	components := strings.Split(text, "---")
 	if len(components) != 2 {
 		return nil, fmt.Errorf("Syntax error: missing '---'")
 	}
+	return ctx.loadSrvFromComponents(components[0], components[1], text, fullname)
+}
+
+// LoadSrvFromIDLString loads a service from a ROS 2 interface definition (.idl), which must declare the `<Name>_Request` and
+// `<Name>_Response` structures.
+func (ctx *PkgContext) LoadSrvFromIDLString(text string, fullname string) (*SrvSpec, error) {
+	_, shortName, err := packageResourceName(fullname)
+	if err != nil {
+		return nil, err
+	}
+	structs, err := ParseIDL(text, fullname)
+	if err != nil {
+		return nil, err
+	}
+	req := FindIDLStruct(structs, shortName+"_Request")
+	res := FindIDLStruct(structs, shortName+"_Response")
+	if req == nil || res == nil {
+		return nil, fmt.Errorf("IDL definition of `%s` does not declare its request and response", fullname)
+	}
+	return ctx.loadSrvFromComponents(req.Text, res.Text, req.Text+IoDelim+"\n"+res.Text, fullname)
+}
 
-	reqText := components[0]
-	resText := components[1]
+func (ctx *PkgContext) loadSrvFromComponents(reqText string, resText string, text string, fullname string) (*SrvSpec, error) {
+	packageName, shortName, err := packageResourceName(fullname)
+	if err != nil {
+		return nil, err
+	}
 
 	reqSpec, err := ctx.LoadMsgFromString(reqText, fullname+"Request")
 	if err != nil {
@@ -273,6 +324,9 @@ func (ctx *PkgContext) LoadSrvFromFile(filePath string, fullname string) (*SrvSp
 		return nil, e
 	}
 	text := string(bytes)
+	if filepath.Ext(filePath) == ExtIDL {
+		return ctx.LoadSrvFromIDLString(text, fullname)
+	}
 	return ctx.LoadSrvFromString(text, fullname)
 }
 
@@ -290,19 +344,40 @@ func (ctx *PkgContext) LoadSrv(fullname string) (*SrvSpec, error) {
 }
 
 func (ctx *PkgContext) LoadActionFromString(text string, fullname string) (*ActionSpec, error) {
-	packageName, shortName, err := packageResourceName(fullname)
+	components := strings.Split(text, "---")
+	if len(components) != 3 {
+		return nil, fmt.Errorf("Syntax error: missing '---'")
+	}
+	return ctx.loadActionFromComponents(components[0], components[1], components[2], text, fullname)
+}
+
+// LoadActionFromIDLString loads an action from a ROS 2 interface definition (.idl), which must declare the `<Name>_Goal`,
+// `<Name>_Result` and `<Name>_Feedback` structures.
+func (ctx *PkgContext) LoadActionFromIDLString(text string, fullname string) (*ActionSpec, error) {
+	_, shortName, err := packageResourceName(fullname)
+	if err != nil {
+		return nil, err
+	}
+	structs, err := ParseIDL(text, fullname)
 	if err != nil {
 		return nil, err
 	}
+	goal := FindIDLStruct(structs, shortName+"_Goal")
+	result := FindIDLStruct(structs, shortName+"_Result")
+	feedback := FindIDLStruct(structs, shortName+"_Feedback")
+	if goal == nil || result == nil || feedback == nil {
+		return nil, fmt.Errorf("IDL definition of `%s` does not declare its goal, result and feedback", fullname)
+	}
+	text = goal.Text + IoDelim + "\n" + result.Text + IoDelim + "\n" + feedback.Text
+	return ctx.loadActionFromComponents(goal.Text, result.Text, feedback.Text, text, fullname)
+}
 
-	components := strings.Split(text, "---")
-	if len(components) != 3 {
-		return nil, fmt.Errorf("Syntax error: missing '---'")
+func (ctx *PkgContext) loadActionFromComponents(goalText string, resultText string, feedbackText string, text string, fullname string) (*ActionSpec, error) {
+	packageName, shortName, err := packageResourceName(fullname)
+	if err != nil {
+		return nil, err
 	}
 
-	goalText := components[0]
-	resultText := components[1]
-	feedbackText := components[2]
 	goalSpec, err := ctx.LoadMsgFromString(goalText, fullname+"Goal")
 	if err != nil {
 		return nil, err
@@ -359,6 +434,9 @@ func (ctx *PkgContext) LoadActionFromFile(filePath string, fullname string) (*Ac
 		return nil, e
 	}
 	text := string(bytes)
+	if filepath.Ext(filePath) == ExtIDL {
+		return ctx.LoadActionFromIDLString(text, fullname)
+	}
 	return ctx.LoadActionFromString(text, fullname)
 }
 
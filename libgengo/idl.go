@@ -0,0 +1,649 @@
+package libgengo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// IDLStruct is a structure declared in a ROS 2 interface definition (.idl) file, converted to the equivalent .msg definition so
+// that it can be loaded like any other message.
+type IDLStruct struct {
+	Package string // ROS package, the outermost module.
+	Kind    string // Interface kind, the module nested in the package: "msg", "srv" or "action".
+	Name    string // Structure name as declared, e.g. "Header" or "AddTwoInts_Request".
+	Text    string // Equivalent .msg definition.
+}
+
+// idlPrimitiveTypes maps IDL primitive type names onto ROS message primitive types.
+var idlPrimitiveTypes = map[string]string{
+	"boolean":            "bool",
+	"octet":              "byte",
+	"char":               "char",
+	"wchar":              "uint16",
+	"float":              "float32",
+	"double":             "float64",
+	"short":              "int16",
+	"unsigned short":     "uint16",
+	"long":               "int32",
+	"unsigned long":      "uint32",
+	"long long":          "int64",
+	"unsigned long long": "uint64",
+	"int8":               "int8",
+	"uint8":              "uint8",
+	"int16":              "int16",
+	"uint16":             "uint16",
+	"int32":              "int32",
+	"uint32":             "uint32",
+	"int64":              "int64",
+	"uint64":             "uint64",
+	"string":             "string",
+	"wstring":            "wstring",
+}
+
+type idlTokenKind int
+
+const (
+	idlIdent idlTokenKind = iota
+	idlNumber
+	idlString
+	idlPunct
+	idlEOF
+)
+
+type idlToken struct {
+	kind idlTokenKind
+	text string
+	line int
+}
+
+// idlType is a resolved IDL type expressed with ROS message type names.
+type idlType struct {
+	name        string // ROS type name, e.g. "float64" or "geometry_msgs/Point".
+	stringBound int    // Bound of a bounded string, 0 if unbounded.
+	isSequence  bool   // Sequences map onto dynamic (or bounded) arrays.
+	seqBound    int    // Bound of a bounded sequence, 0 if unbounded.
+	arrayLen    int    // Length of a fixed array declared through a typedef, 0 if none.
+}
+
+// idlAnnotation holds the parameters of an annotation, e.g. @default (value=0).
+type idlAnnotation struct {
+	name   string
+	params map[string]idlToken
+}
+
+type idlConstant struct {
+	typ   idlType
+	name  string
+	value idlToken
+}
+
+type idlMember struct {
+	typ         idlType
+	name        string
+	annotations []idlAnnotation
+}
+
+type idlStructDef struct {
+	modules     []string
+	name        string
+	annotations []idlAnnotation
+	members     []idlMember
+}
+
+type idlParser struct {
+	fullname  string
+	tokens    []idlToken
+	pos       int
+	modules   []string
+	typedefs  map[string]idlType
+	structs   []*idlStructDef
+	constants map[string][]idlConstant // Keyed by the '::' joined module path of the constants module.
+}
+
+// ParseIDL parses the OMG IDL subset emitted by rosidl and returns the structures it declares in declaration order. Constants declared
+// in a `<Name>_Constants` module are attached to the structure `<Name>`. The fullname is only used to report syntax errors.
+func ParseIDL(text string, fullname string) ([]IDLStruct, error) {
+	tokens, err := tokenizeIDL(text, fullname)
+	if err != nil {
+		return nil, err
+	}
+	p := &idlParser{
+		fullname:  fullname,
+		tokens:    tokens,
+		typedefs:  make(map[string]idlType),
+		constants: make(map[string][]idlConstant),
+	}
+	for p.peek().kind != idlEOF {
+		if err := p.parseDefinition(); err != nil {
+			return nil, err
+		}
+	}
+
+	structs := make([]IDLStruct, 0, len(p.structs))
+	for _, def := range p.structs {
+		s, err := p.convertStruct(def)
+		if err != nil {
+			return nil, err
+		}
+		structs = append(structs, s)
+	}
+	return structs, nil
+}
+
+// FindIDLStruct returns the structure with the given name, or nil if it is not declared.
+func FindIDLStruct(structs []IDLStruct, name string) *IDLStruct {
+	for i := range structs {
+		if structs[i].Name == name {
+			return &structs[i]
+		}
+	}
+	return nil
+}
+
+func tokenizeIDL(text string, fullname string) ([]idlToken, error) {
+	var tokens []idlToken
+	line := 1
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(c):
+			i++
+		case c == '#':
+			// Preprocessor directives (#include, #pragma) only reference other files, which are looked up by name instead.
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := line
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i+1 >= len(runes) {
+				return nil, NewSyntaxError(fullname, start, "unterminated comment")
+			}
+			i += 2
+		case c == '"':
+			start := i
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' {
+					i++
+				} else if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, NewSyntaxError(fullname, line, "unterminated string")
+			}
+			i++
+			tokens = append(tokens, idlToken{idlString, string(runes[start:i]), line})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, idlToken{idlIdent, string(runes[start:i]), line})
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '.' ||
+				((runes[i] == '+' || runes[i] == '-') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, idlToken{idlNumber, string(runes[start:i]), line})
+		case c == ':' && i+1 < len(runes) && runes[i+1] == ':':
+			tokens = append(tokens, idlToken{idlPunct, "::", line})
+			i += 2
+		case strings.ContainsRune("{}()<>[];,=@-+", c):
+			tokens = append(tokens, idlToken{idlPunct, string(c), line})
+			i++
+		default:
+			return nil, NewSyntaxError(fullname, line, fmt.Sprintf("unexpected character '%c'", c))
+		}
+	}
+	tokens = append(tokens, idlToken{idlEOF, "", line})
+	return tokens, nil
+}
+
+// unquoteIDLString decodes an IDL string literal, which uses C style escapes.
+func unquoteIDLString(literal string) string {
+	if value, err := strconv.Unquote(literal); err == nil {
+		return value
+	}
+	return strings.Trim(literal, `"`)
+}
+
+func (p *idlParser) peek() idlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *idlParser) next() idlToken {
+	t := p.tokens[p.pos]
+	if t.kind != idlEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *idlParser) errorf(t idlToken, format string, args ...interface{}) error {
+	return NewSyntaxError(p.fullname, t.line, fmt.Sprintf(format, args...))
+}
+
+func (p *idlParser) expect(text string) error {
+	t := p.next()
+	if t.text != text || t.kind == idlString {
+		return p.errorf(t, "expected '%s', found '%s'", text, t.text)
+	}
+	return nil
+}
+
+func (p *idlParser) expectIdent() (string, error) {
+	t := p.next()
+	if t.kind != idlIdent {
+		return "", p.errorf(t, "expected an identifier, found '%s'", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *idlParser) expectInt() (int, error) {
+	t := p.next()
+	if t.kind != idlNumber {
+		return 0, p.errorf(t, "expected an integer, found '%s'", t.text)
+	}
+	value, err := strconv.ParseInt(t.text, 0, 32)
+	if err != nil {
+		return 0, p.errorf(t, "invalid integer '%s'", t.text)
+	}
+	return int(value), nil
+}
+
+func (p *idlParser) parseDefinition() error {
+	annotations, err := p.parseAnnotations()
+	if err != nil {
+		return err
+	}
+	t := p.next()
+	switch t.text {
+	case "module":
+		return p.parseModule()
+	case "struct":
+		return p.parseStruct(annotations)
+	case "const":
+		return p.parseConst()
+	case "typedef":
+		return p.parseTypedef()
+	case ";":
+		return nil
+	default:
+		return p.errorf(t, "unsupported definition '%s'", t.text)
+	}
+}
+
+func (p *idlParser) parseAnnotations() ([]idlAnnotation, error) {
+	var annotations []idlAnnotation
+	for p.peek().text == "@" {
+		p.next()
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		annotation := idlAnnotation{name: name, params: make(map[string]idlToken)}
+		if p.peek().text == "(" {
+			p.next()
+			for p.peek().text != ")" {
+				key, err := p.expectIdent()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect("="); err != nil {
+					return nil, err
+				}
+				value, err := p.parseLiteral()
+				if err != nil {
+					return nil, err
+				}
+				annotation.params[key] = value
+				if p.peek().text == "," {
+					p.next()
+				}
+			}
+			p.next()
+		}
+		annotations = append(annotations, annotation)
+	}
+	return annotations, nil
+}
+
+// parseLiteral parses a constant or annotation value. Adjacent string literals are concatenated and a leading sign is folded into numbers.
+func (p *idlParser) parseLiteral() (idlToken, error) {
+	t := p.next()
+	switch {
+	case t.kind == idlString:
+		value := unquoteIDLString(t.text)
+		for p.peek().kind == idlString {
+			value += unquoteIDLString(p.next().text)
+		}
+		return idlToken{idlString, value, t.line}, nil
+	case t.kind == idlPunct && (t.text == "-" || t.text == "+"):
+		n := p.next()
+		if n.kind != idlNumber {
+			return t, p.errorf(n, "expected a number after '%s'", t.text)
+		}
+		if t.text == "-" {
+			n.text = "-" + n.text
+		}
+		return n, nil
+	case t.kind == idlNumber || t.kind == idlIdent:
+		return t, nil
+	default:
+		return t, p.errorf(t, "expected a literal, found '%s'", t.text)
+	}
+}
+
+func (p *idlParser) parseModule() error {
+	name, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	p.modules = append(p.modules, name)
+	for p.peek().text != "}" {
+		if p.peek().kind == idlEOF {
+			return p.errorf(p.peek(), "unterminated module '%s'", name)
+		}
+		if err := p.parseDefinition(); err != nil {
+			return err
+		}
+	}
+	p.next()
+	p.modules = p.modules[:len(p.modules)-1]
+	return p.expect(";")
+}
+
+func (p *idlParser) parseStruct(annotations []idlAnnotation) error {
+	name, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	def := &idlStructDef{
+		modules:     append([]string{}, p.modules...),
+		name:        name,
+		annotations: annotations,
+	}
+	for p.peek().text != "}" {
+		if p.peek().kind == idlEOF {
+			return p.errorf(p.peek(), "unterminated struct '%s'", name)
+		}
+		member, err := p.parseMember()
+		if err != nil {
+			return err
+		}
+		def.members = append(def.members, member)
+	}
+	p.next()
+	p.structs = append(p.structs, def)
+	return p.expect(";")
+}
+
+func (p *idlParser) parseMember() (idlMember, error) {
+	annotations, err := p.parseAnnotations()
+	if err != nil {
+		return idlMember{}, err
+	}
+	typ, err := p.parseType()
+	if err != nil {
+		return idlMember{}, err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return idlMember{}, err
+	}
+	if typ, err = p.parseArrayDeclarator(typ); err != nil {
+		return idlMember{}, err
+	}
+	if err := p.expect(";"); err != nil {
+		return idlMember{}, err
+	}
+	return idlMember{typ: typ, name: name, annotations: annotations}, nil
+}
+
+func (p *idlParser) parseConst() error {
+	typ, err := p.parseType()
+	if err != nil {
+		return err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	value, err := p.parseLiteral()
+	if err != nil {
+		return err
+	}
+	key := strings.Join(p.modules, "::")
+	p.constants[key] = append(p.constants[key], idlConstant{typ: typ, name: name, value: value})
+	return p.expect(";")
+}
+
+func (p *idlParser) parseTypedef() error {
+	typ, err := p.parseType()
+	if err != nil {
+		return err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	if typ, err = p.parseArrayDeclarator(typ); err != nil {
+		return err
+	}
+	p.typedefs[name] = typ
+	return p.expect(";")
+}
+
+// parseArrayDeclarator parses an optional fixed array length following a declarator, e.g. `double covariance[36]`.
+func (p *idlParser) parseArrayDeclarator(typ idlType) (idlType, error) {
+	if p.peek().text != "[" {
+		return typ, nil
+	}
+	t := p.next()
+	length, err := p.expectInt()
+	if err != nil {
+		return typ, err
+	}
+	if err := p.expect("]"); err != nil {
+		return typ, err
+	}
+	if typ.isSequence || typ.arrayLen > 0 || p.peek().text == "[" {
+		return typ, p.errorf(t, "multi-dimensional arrays are not supported")
+	}
+	typ.arrayLen = length
+	return typ, nil
+}
+
+func (p *idlParser) parseType() (idlType, error) {
+	t := p.next()
+	if t.kind != idlIdent {
+		return idlType{}, p.errorf(t, "expected a type, found '%s'", t.text)
+	}
+	switch t.text {
+	case "sequence":
+		if err := p.expect("<"); err != nil {
+			return idlType{}, err
+		}
+		element, err := p.parseType()
+		if err != nil {
+			return idlType{}, err
+		}
+		if element.isSequence || element.arrayLen > 0 {
+			return idlType{}, p.errorf(t, "nested sequences are not supported")
+		}
+		element.isSequence = true
+		if p.peek().text == "," {
+			p.next()
+			if element.seqBound, err = p.expectInt(); err != nil {
+				return idlType{}, err
+			}
+		}
+		return element, p.expect(">")
+	case "string", "wstring":
+		typ := idlType{name: idlPrimitiveTypes[t.text]}
+		if p.peek().text == "<" {
+			p.next()
+			var err error
+			if typ.stringBound, err = p.expectInt(); err != nil {
+				return idlType{}, err
+			}
+			if err := p.expect(">"); err != nil {
+				return idlType{}, err
+			}
+		}
+		return typ, nil
+	case "unsigned", "long":
+		// Multi-word primitive types.
+		words := []string{t.text}
+		for p.peek().text == "long" || p.peek().text == "short" || p.peek().text == "double" {
+			words = append(words, p.next().text)
+		}
+		name := strings.Join(words, " ")
+		if rosType, ok := idlPrimitiveTypes[name]; ok {
+			return idlType{name: rosType}, nil
+		}
+		return idlType{}, p.errorf(t, "unsupported type '%s'", name)
+	}
+	if rosType, ok := idlPrimitiveTypes[t.text]; ok {
+		return idlType{name: rosType}, nil
+	}
+
+	// Otherwise it is a scoped name of a typedef or another interface, e.g. geometry_msgs::msg::Point.
+	scope := []string{t.text}
+	for p.peek().text == "::" {
+		p.next()
+		name, err := p.expectIdent()
+		if err != nil {
+			return idlType{}, err
+		}
+		scope = append(scope, name)
+	}
+	if len(scope) == 1 {
+		if typ, ok := p.typedefs[scope[0]]; ok {
+			return typ, nil
+		}
+		if len(p.modules) > 0 {
+			return idlType{name: p.modules[0] + "/" + scope[0]}, nil
+		}
+		return idlType{name: scope[0]}, nil
+	}
+	return idlType{name: scope[0] + "/" + scope[len(scope)-1]}, nil
+}
+
+// convertStruct renders a parsed structure as an equivalent .msg definition.
+func (p *idlParser) convertStruct(def *idlStructDef) (IDLStruct, error) {
+	var lines []string
+	lines = appendIDLComments(lines, def.annotations)
+
+	// rosidl declares the constants of `Foo` in a sibling module `Foo_Constants`.
+	constantsKey := strings.Join(append(append([]string{}, def.modules...), def.name+"_Constants"), "::")
+	for _, c := range p.constants[constantsKey] {
+		value := c.value.text
+		if c.value.kind == idlIdent {
+			// Boolean literals are spelled TRUE and FALSE in IDL.
+			value = strings.ToLower(value)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s=%s", c.typ.msgType(), c.name, value))
+	}
+
+	for _, member := range def.members {
+		lines = appendIDLComments(lines, member.annotations)
+		line := member.typ.msgType() + " " + member.name
+		for _, annotation := range member.annotations {
+			if value, ok := annotation.params["value"]; ok && annotation.name == "default" {
+				line += " " + member.typ.msgDefault(value)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	s := IDLStruct{Name: def.name, Text: strings.Join(lines, "\n") + "\n"}
+	if len(def.modules) > 0 {
+		s.Package = def.modules[0]
+	}
+	if len(def.modules) > 1 {
+		s.Kind = def.modules[1]
+	}
+	return s, nil
+}
+
+// appendIDLComments converts @verbatim (language="comment") annotations back into message comments.
+func appendIDLComments(lines []string, annotations []idlAnnotation) []string {
+	for _, annotation := range annotations {
+		if annotation.name != "verbatim" || annotation.params["language"].text != "comment" {
+			continue
+		}
+		for _, line := range strings.Split(annotation.params["text"].text, "\n") {
+			lines = append(lines, strings.TrimRight(CommentChar+" "+line, " "))
+		}
+	}
+	return lines
+}
+
+// msgType returns the type as written in a .msg definition.
+func (t idlType) msgType() string {
+	name := t.name
+	if t.stringBound > 0 {
+		name = fmt.Sprintf("%s<=%d", name, t.stringBound)
+	}
+	switch {
+	case t.isSequence && t.seqBound > 0:
+		return fmt.Sprintf("%s[<=%d]", name, t.seqBound)
+	case t.isSequence:
+		return name + "[]"
+	case t.arrayLen > 0:
+		return fmt.Sprintf("%s[%d]", name, t.arrayLen)
+	}
+	return name
+}
+
+// msgDefault converts a @default annotation value into .msg default value syntax.
+func (t idlType) msgDefault(value idlToken) string {
+	if t.isSequence || t.arrayLen > 0 {
+		// rosidl writes array defaults as a string holding a Python style tuple or list.
+		text := strings.TrimSpace(value.text)
+		if strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+			text = "[" + text[1:len(text)-1] + "]"
+		}
+		if !strings.HasPrefix(text, "[") {
+			text = "[" + text + "]"
+		}
+		return text
+	}
+	if value.kind == idlString {
+		return strconv.Quote(value.text)
+	}
+	if value.kind == idlIdent {
+		return strings.ToLower(value.text)
+	}
+	return value.text
+}
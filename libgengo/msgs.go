@@ -5,7 +5,6 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
 const (
@@ -46,6 +45,8 @@ var PrimitiveTypes = []string{
 	"bool",
 	// deprecated:
 	"char", "byte",
+	// ROS 2:
+	"wstring",
 }
 
 var BuiltinTypes = append([]string{TimeType, DurationType}, PrimitiveTypes...)
@@ -54,6 +55,12 @@ var ResourceNameLegalCharsPattern = regexp.MustCompile(`^[A-Za-z][\w_\/]*$`)
 
 var BaseResourceNameLegalCharsPattern = regexp.MustCompile(`"[A-Za-z][\w_]*$`)
 
+// ArraySuffixPattern matches the array part of a field type, including ROS 2 bounded arrays (`[<=N]`).
+var ArraySuffixPattern = regexp.MustCompile(`^(\[\d*\]|\[<=\d+\])*$`)
+
+// StringBoundPattern matches the ROS 2 upper bound of a bounded string type (`string<=N`).
+var StringBoundPattern = regexp.MustCompile(`<=(\d+)$`)
+
 func isValidConsantType(t string) bool {
 	for _, e := range PrimitiveTypes {
 		if e == t {
@@ -114,58 +121,73 @@ func splitType(t string) (string, string) {
 	}
 }
 
-func parseType(msgType string) (pkg string, baseType string, isArray bool, arrayLen int, err error) {
+func parseType(msgType string) (pkg string, baseType string, isArray bool, arrayLen int, arrayBound int, err error) {
 	index := strings.Index(msgType, "[")
 	if index < 0 {
 		pkg, name := splitType(msgType)
-		return pkg, name, false, 0, nil
+		return pkg, name, false, 0, 0, nil
 	} else {
 		if msgType[len(msgType)-1] == ']' {
 			base := msgType[:index]
 			rest := msgType[index:]
 			pkg, name := splitType(base)
 			if rest == "[]" {
-				return pkg, name, true, -1, nil
+				return pkg, name, true, -1, 0, nil
+			} else if strings.HasPrefix(rest, "[<=") {
+				// ROS 2 bounded arrays are sized on the wire like any other dynamic array.
+				value64, err := strconv.ParseInt(rest[3:len(rest)-1], 10, 32)
+				if err != nil {
+					return pkg, name, false, 0, 0, err
+				}
+				return pkg, name, true, -1, int(value64), nil
 			} else {
 				value64, err := strconv.ParseInt(rest[1:len(rest)-1], 10, 32)
 				if err != nil {
-					return pkg, name, false, 0, err
+					return pkg, name, false, 0, 0, err
 				}
 				value := int(value64)
-				return pkg, name, true, value, nil
+				return pkg, name, true, value, 0, nil
 			}
 		} else {
-			return "", msgType, false, 0, fmt.Errorf("missing ']'")
+			return "", msgType, false, 0, 0, fmt.Errorf("missing ']'")
 		}
 	}
 }
 
+// splitStringBound separates the upper bound from a ROS 2 bounded string type, e.g. `string<=10`.
+func splitStringBound(t string) (string, int, error) {
+	match := StringBoundPattern.FindStringSubmatchIndex(t)
+	if match == nil {
+		return t, 0, nil
+	}
+	bound, err := strconv.ParseInt(t[match[2]:match[3]], 10, 32)
+	if err != nil {
+		return t, 0, err
+	}
+	return t[:match[0]], int(bound), nil
+}
+
 func isValidMsgType(t string) bool {
 	if t != strings.TrimSpace(t) {
 		return false
 	}
 	base := baseMsgType(t)
+	suffix := t[len(base):]
+	if StringBoundPattern.MatchString(base) {
+		var bound int
+		base, bound, _ = splitStringBound(base)
+		if !isStringType(base) || bound <= 0 {
+			return false
+		}
+	}
 	if !isLegalResourceBaseName(base) {
 		return false
 	}
+	return ArraySuffixPattern.MatchString(suffix)
+}
 
-	x := t[len(base):]
-	state := 0
-	for _, c := range x {
-		if state == 0 {
-			if c != '[' {
-				return false
-			}
-			state = 1
-		} else if state == 1 {
-			if c == ']' {
-				state = 0
-			} else if !unicode.IsDigit(c) {
-				return false
-			}
-		}
-	}
-	return state == 0
+func isStringType(t string) bool {
+	return t == "string" || t == "wstring"
 }
 
 func isValidConstantType(t string) bool {
@@ -217,7 +239,7 @@ func ToGoType(pkg string, typeName string) string {
 		goType = "float32"
 	case "float64":
 		goType = "float64"
-	case "string":
+	case "string", "wstring":
 		goType = "string"
 	case "bool":
 		goType = "bool"
@@ -258,7 +280,7 @@ func ToBuiltInType(typeName string) BuiltInType {
 		builtInType = Float32
 	case "float64":
 		builtInType = Float64
-	case "string":
+	case "string", "wstring":
 		builtInType = String
 	case "bool":
 		builtInType = Bool
@@ -315,7 +337,7 @@ func GetZeroValue(pkg string, typeName string) string {
 		zeroValue = "0.0"
 	case "float64":
 		zeroValue = "0.0"
-	case "string":
+	case "string", "wstring":
 		zeroValue = "\"\""
 	case "bool":
 		zeroValue = "false"
@@ -353,6 +375,12 @@ type Field struct {
 	GoName      string
 	GoType      string
 	ZeroValue   string
+
+	// ROS 2 extensions; all of them are zero for ROS 1 definitions.
+	ArrayBound  int         // Upper bound of a bounded array (`T[<=N]`), which is otherwise a dynamic array.
+	StringBound int         // Upper bound of a bounded string (`string<=N`).
+	Default     interface{} // Default value, a Go value for scalars and a slice for arrays; nil if none was declared.
+	DefaultText string      // Default value as written in the definition.
 }
 
 func NewField(pkg string, fieldType string, name string, isArray bool, arrayLen int) *Field {
@@ -361,16 +389,33 @@ func NewField(pkg string, fieldType string, name string, isArray bool, arrayLen
 	goName := ToGoName(name, false)
 	zeroValue := GetZeroValue(pkg, fieldType)
 	isBuiltin := builtInType != Invalid
-	return &Field{pkg, fieldType, name, isBuiltin, builtInType, isArray, arrayLen, goName, goType, zeroValue}
+	return &Field{
+		Package:     pkg,
+		Type:        fieldType,
+		Name:        name,
+		IsBuiltin:   isBuiltin,
+		BuiltInType: builtInType,
+		IsArray:     isArray,
+		ArrayLen:    arrayLen,
+		GoName:      goName,
+		GoType:      goType,
+		ZeroValue:   zeroValue,
+	}
 }
 
 func (f *Field) String() string {
-	if f.IsArray && f.ArrayLen > -1 {
-		return fmt.Sprintf("%s[%d] %s", f.Type, f.ArrayLen, f.Name)
+	typeName := f.Type
+	if f.StringBound > 0 {
+		typeName = fmt.Sprintf("%s<=%d", typeName, f.StringBound)
+	}
+	if f.IsArray && f.ArrayBound > 0 {
+		return fmt.Sprintf("%s[<=%d] %s", typeName, f.ArrayBound, f.Name)
+	} else if f.IsArray && f.ArrayLen > -1 {
+		return fmt.Sprintf("%s[%d] %s", typeName, f.ArrayLen, f.Name)
 	} else if f.IsArray {
-		return fmt.Sprintf("%s[] %s", f.Type, f.Name)
+		return fmt.Sprintf("%s[] %s", typeName, f.Name)
 	} else {
-		return fmt.Sprintf("%s %s", f.Type, f.Name)
+		return fmt.Sprintf("%s %s", typeName, f.Name)
 	}
 }
 
@@ -13,6 +13,7 @@ const (
 	SrvDir = "srv"
 	ExtMsg = ".msg"
 	ExtSrv = ".msg"
+	ExtIDL = ".idl"
 
 	ConstChar   = "="
 	CommentChar = "#"
@@ -83,9 +84,10 @@ func convertConstantValue(fieldType string, valueLiteral string) (interface{}, e
 	case "bool":
 		// The spec of ROS message doesn't specify boolean literal exactly.
 		// genmsg implementation determines true/false based Python's eval() and accepts any valid Python expression.
-		if valueLiteral == "None" || valueLiteral == "False" {
+		// ROS 2 definitions use the lowercase literals.
+		if valueLiteral == "None" || valueLiteral == "False" || valueLiteral == "false" {
 			return false, nil
-		} else if valueLiteral == "True" {
+		} else if valueLiteral == "True" || valueLiteral == "true" {
 			return true, nil
 		} else if val, e := strconv.ParseUint(valueLiteral, 10, 0); e == nil {
 			return val != 0, nil
@@ -119,6 +121,45 @@ func stripComment(line string) string {
 	return strings.TrimSpace(strings.Split(line, CommentChar)[0])
 }
 
+// stripFieldComment removes a trailing comment from a field line, ignoring comment characters inside quoted ROS 2 default values.
+func stripFieldComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && string(c) == CommentChar:
+			return strings.TrimSpace(line[:i])
+		}
+	}
+	return strings.TrimSpace(line)
+}
+
+// splitDeclaration splits the first whitespace separated token from the rest of a definition line.
+func splitDeclaration(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	sepIndex := strings.IndexFunc(line, unicode.IsSpace)
+	if sepIndex < 0 {
+		return line, ""
+	}
+	return line[:sepIndex], strings.TrimSpace(line[sepIndex:])
+}
+
+// isConstantLine reports whether a definition line declares a constant. Checking for '=' alone is not enough, since ROS 2 bounds
+// (`string<=10`) and default values may contain it too.
+func isConstantLine(cleanLine string) bool {
+	_, rest := splitDeclaration(cleanLine)
+	nameEnd := strings.IndexFunc(rest, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+	})
+	if nameEnd < 0 {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(rest[nameEnd:]), ConstChar)
+}
+
 func loadConstantLine(line string) (*Constant, error) {
 	cleanLine := stripComment(line)
 	sepIndex := strings.IndexFunc(cleanLine, unicode.IsSpace)
@@ -130,6 +171,10 @@ func loadConstantLine(line string) (*Constant, error) {
 	if !isValidConsantType(fieldType) {
 		return nil, fmt.Errorf("[%s] is not a legal constant type", fieldType)
 	}
+	if fieldType == "wstring" {
+		// There are no wide strings on the wire, they are carried as UTF-8 strings.
+		fieldType = "string"
+	}
 
 	var name, valueText string
 	if fieldType == "string" {
@@ -163,19 +208,32 @@ func loadConstantLine(line string) (*Constant, error) {
 }
 
 func loadFieldLine(line string, packageName string) (*Field, error) {
-	cleanLine := stripComment(line)
-	lineSplits := strings.SplitN(cleanLine, " ", 2)
-	if len(lineSplits) != 2 {
+	cleanLine := stripFieldComment(line)
+	fieldType, rest := splitDeclaration(cleanLine)
+	name, defaultText := splitDeclaration(rest)
+	if len(fieldType) == 0 || len(name) == 0 {
 		return nil, fmt.Errorf("Invalid declaration: %s", line)
 	}
-	fieldType := strings.TrimSpace(lineSplits[0])
-	name := strings.TrimSpace(lineSplits[1])
 	if !isValidMsgFieldName(name) {
 		return nil, fmt.Errorf("%s is not a legal message field name", name)
 	}
 	if !isValidMsgType(fieldType) {
 		return nil, fmt.Errorf("%s is not a legal message field type", fieldType)
 	}
+
+	// ROS 2 bounded strings carry their bound on the base type, e.g. `string<=10[<=5]`.
+	base := baseMsgType(fieldType)
+	arraySuffix := fieldType[len(base):]
+	base, stringBound, err := splitStringBound(base)
+	if err != nil {
+		return nil, err
+	}
+	if base == "wstring" {
+		// There are no wide strings on the wire, they are carried as UTF-8 strings.
+		base = "string"
+	}
+	fieldType = base + arraySuffix
+
 	if len(packageName) > 0 && !strings.Contains(fieldType, Sep) {
 		if fieldType == HeaderType {
 			fieldType = HeaderFullName
@@ -185,10 +243,122 @@ func loadFieldLine(line string, packageName string) (*Field, error) {
 	} else if fieldType == HeaderType {
 		fieldType = HeaderFullName
 	}
-	pkg, baseType, isArray, arrayLen, err := parseType(fieldType)
+	pkg, baseType, isArray, arrayLen, arrayBound, err := parseType(fieldType)
+	if err != nil {
+		return nil, err
+	}
+
+	field := NewField(pkg, baseType, name, isArray, arrayLen)
+	field.ArrayBound = arrayBound
+	field.StringBound = stringBound
+
+	if len(defaultText) > 0 {
+		if !field.IsBuiltin || field.BuiltInType == Time || field.BuiltInType == Duration {
+			return nil, fmt.Errorf("%s cannot have a default value", fieldType)
+		}
+		value, err := convertDefaultValue(field, defaultText)
+		if err != nil {
+			return nil, err
+		}
+		field.Default = value
+		field.DefaultText = defaultText
+		if !isArray {
+			field.ZeroValue = goLiteral(value)
+		}
+	}
+
+	return field, nil
+}
+
+// convertDefaultValue converts the default value of a ROS 2 field into a Go value, or a []interface{} of Go values for arrays.
+func convertDefaultValue(field *Field, valueText string) (interface{}, error) {
+	if !field.IsArray {
+		return convertDefaultScalar(field, valueText)
+	}
+
+	if !strings.HasPrefix(valueText, "[") || !strings.HasSuffix(valueText, "]") {
+		return nil, fmt.Errorf("Array default values must be enclosed in '[]': %s", valueText)
+	}
+	elements, err := splitDefaultArray(valueText[1 : len(valueText)-1])
 	if err != nil {
 		return nil, err
 	}
+	if field.ArrayLen > -1 && len(elements) != field.ArrayLen {
+		return nil, fmt.Errorf("Default value has %d elements, expected %d", len(elements), field.ArrayLen)
+	}
+	if field.ArrayBound > 0 && len(elements) > field.ArrayBound {
+		return nil, fmt.Errorf("Default value has %d elements, bound is %d", len(elements), field.ArrayBound)
+	}
+
+	values := make([]interface{}, 0, len(elements))
+	for _, element := range elements {
+		value, err := convertDefaultScalar(field, element)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func convertDefaultScalar(field *Field, valueText string) (interface{}, error) {
+	if field.BuiltInType != String {
+		// Convert by Go type, so that byte and char defaults have the unsigned type of the field.
+		return convertConstantValue(field.GoType, valueText)
+	}
+	value := valueText
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		var err error
+		if value, err = unquoteDefault(value); err != nil {
+			return nil, err
+		}
+	}
+	if field.StringBound > 0 && len(value) > field.StringBound {
+		return nil, fmt.Errorf("Default value [%s] exceeds the string bound %d", value, field.StringBound)
+	}
+	return value, nil
+}
+
+// unquoteDefault removes the quotes from a single or double quoted string literal.
+func unquoteDefault(literal string) (string, error) {
+	if literal[0] == '\'' {
+		inner := strings.ReplaceAll(literal[1:len(literal)-1], `\'`, `'`)
+		literal = strconv.Quote(inner)
+	}
+	return strconv.Unquote(literal)
+}
 
-	return NewField(pkg, baseType, name, isArray, arrayLen), nil
+// splitDefaultArray splits the comma separated elements of an array default value, ignoring commas inside quoted strings.
+func splitDefaultArray(text string) ([]string, error) {
+	var elements []string
+	var quote rune
+	start := 0
+	for i, c := range text {
+		switch {
+		case quote != 0 && c == quote && (i == 0 || text[i-1] != '\\'):
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			elements = append(elements, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Unterminated string in default value: %s", text)
+	}
+	if last := strings.TrimSpace(text[start:]); len(last) > 0 {
+		elements = append(elements, last)
+	} else if len(elements) > 0 {
+		return nil, fmt.Errorf("Empty element in default value: %s", text)
+	}
+	return elements, nil
+}
+
+// goLiteral formats a scalar default value as Go source for the generated message constructor.
+func goLiteral(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return strconv.Quote(str)
+	}
+	return fmt.Sprintf("%v", value)
 }
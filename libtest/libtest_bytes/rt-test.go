@@ -40,7 +40,9 @@ func RTTest(t *testing.T) {
 	exampleMsg := "geometry_msgs/Twist::map[angular:geometry_msgs/Vector3::map[x:1.00000 y:2.00000 z:3.00000] linear:geometry_msgs/Vector3::map[x:1.00000 y:2.00000 z:3.00000]]"
 
 	//Example schema
-	exampleSchema := `{"$id":"/ros/testy","$schema":"https://json-schema.org/draft-07/schema#","properties":{"x":{"type":"number"},"y":{"type":"number"},"z":{"type":"number"}},"type":"object"}`
+	exampleSchema := `{"$id":"/ros/testy","$schema":"https://json-schema.org/draft-07/schema#",` +
+		`"description":"This represents a vector in free space.\nIt is only meant to represent a direction. Therefore, it does not\nmake sense to apply a translation to it (e.g., when applying a\ngeneric rigid transformation to a Vector3, tf2 will only apply the\nrotation). If you want your data to be translatable too, use the\ngeometry_msgs/Point message instead.",` +
+		`"properties":{"x":{"type":"number"},"y":{"type":"number"},"z":{"type":"number"}},"required":["x","y","z"],"title":"geometry_msgs/Vector3","type":"object"}`
 	//Generating a schema for geometry_msgs/Vector3 on topic chatty
 	schema, err := nestedMsgType.GenerateJSONSchema("/ros/", "testy")
 	if err != nil {
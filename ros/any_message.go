@@ -0,0 +1,65 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"bytes"
+	"io/ioutil"
+)
+
+// DEFINE PUBLIC STRUCTURES.
+
+// AnyMessageType is a MessageType which matches messages of any type, as rospy's AnyMsg does.  Subscribers of it accept publishers of any type, and get
+// their messages as AnyMessages, which NewDynamicMessageTypeFromHeader can make sense of using the MessageEvent passed with them.
+type AnyMessageType struct{}
+
+// AnyMessage is a message of any type, held as it was serialized.
+type AnyMessage struct {
+	Bytes []byte
+}
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	AnyMessageType
+
+// Text returns an empty definition, as the message type has no definition of its own; required for ros.MessageType.
+func (AnyMessageType) Text() string {
+	return ""
+}
+
+// MD5Sum returns "*", which matches any MD5 sum; required for ros.MessageType.
+func (AnyMessageType) MD5Sum() string {
+	return "*"
+}
+
+// Name returns "*", which matches any message type; required for ros.MessageType.
+func (AnyMessageType) Name() string {
+	return "*"
+}
+
+// NewMessage creates an empty AnyMessage; required for ros.MessageType.
+func (AnyMessageType) NewMessage() Message {
+	return &AnyMessage{}
+}
+
+//	AnyMessage
+
+// Type returns AnyMessageType; required for ros.Message.
+func (m *AnyMessage) Type() MessageType {
+	return AnyMessageType{}
+}
+
+// Serialize writes the bytes of the message as they are; required for ros.Message.
+func (m *AnyMessage) Serialize(buf *bytes.Buffer) error {
+	_, err := buf.Write(m.Bytes)
+	return err
+}
+
+// Deserialize takes the rest of buf as the bytes of the message; required for ros.Message.
+func (m *AnyMessage) Deserialize(buf *bytes.Reader) error {
+	var err error
+	m.Bytes, err = ioutil.ReadAll(buf)
+	return err
+}
+
+// ALL DONE.
@@ -0,0 +1,96 @@
+package ros
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestAnyMessage_Decode(t *testing.T) {
+	msgType, err := NewDynamicMessageTypeFromDefinition("geometry_msgs/PointStamped", pointStampedDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := msgType.NewDynamicMessage()
+	if err := msg.Set("header.frame_id", "map"); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.Set("point.y", 2.5); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := msg.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := AnyMessageType{}.NewMessage()
+	if err := raw.Deserialize(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := raw.Serialize(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), buf.Bytes()) {
+		t.Fatalf("expected %v, got %v", buf.Bytes(), out.Bytes())
+	}
+
+	header := map[string]string{
+		"type":               "geometry_msgs/PointStamped",
+		"md5sum":             msgType.MD5Sum(),
+		"message_definition": pointStampedDefinition,
+	}
+	decodedType, err := NewDynamicMessageTypeFromHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := decodedType.NewDynamicMessage()
+	if err := decoded.Deserialize(bytes.NewReader(raw.(*AnyMessage).Bytes)); err != nil {
+		t.Fatal(err)
+	}
+	if frame, _ := decoded.Get("header.frame_id"); frame != "map" {
+		t.Fatalf("unexpected frame_id %v", frame)
+	}
+
+	header["md5sum"] = "00112233445566778899aabbccddeeff"
+	if _, err := NewDynamicMessageTypeFromHeader(header); err == nil {
+		t.Fatalf("expected an error for a mismatched MD5 sum")
+	}
+	if _, err := NewDynamicMessageTypeFromHeader(map[string]string{"type": "*", "md5sum": "*"}); err == nil {
+		t.Fatalf("expected an error for a header without a definition")
+	}
+}
+
+// Subscriptions of AnyMessageType accept publishers of any type.
+func TestSubscription_HeaderExchange_AcceptsAnyType(t *testing.T) {
+	pubConn, subConn := net.Pipe()
+	defer pubConn.Close()
+	msgChan := make(chan messageEvent)
+	subscription := newDefaultSubscription("fakeUri:12345", "/test/topic", AnyMessageType{}, "testNode", msgChan, make(chan string))
+	subscription.dialer = &TCPRosDialerFake{conn: subConn}
+	ctx := newFakeContext()
+	defer ctx.cleanUp()
+	subscription.startWithContext(ctx, zerolog.New(os.Stdout).With().Logger())
+
+	if _, err := readConnectionHeader(pubConn); err != nil {
+		t.Fatal(err)
+	}
+	replyHeader := []header{
+		{"topic", "/test/topic"},
+		{"md5sum", "c63aecb41bfdfd6b7e1fac37c7cbe7bf"},
+		{"type", "geometry_msgs/PointStamped"},
+		{"callerid", "testPublisher"},
+	}
+	writeAndConfirmPublisherHeader(t, pubConn, msgChan, replyHeader)
+
+	pubConn.Close()
+	select {
+	case <-subscription.remoteDisconnectedChan:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("took too long for the subscription to disconnect")
+	}
+}
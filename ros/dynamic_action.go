@@ -3,9 +3,6 @@ package ros
 // IMPORT REQUIRED PACKAGES.
 
 import (
-	"strings"
-
-	"github.com/asimovsecurity/rosgo/libgengo"
 	"github.com/pkg/errors"
 )
 
@@ -74,18 +71,14 @@ func newDynamicActionTypeNested(typeName string, packageName string) (*DynamicAc
 	// Create an empty action type.
 	m := new(DynamicActionType)
 
-	if context == nil {
-		// Create context for our ROS install.
-		c, err := libgengo.NewPkgContext(strings.Split(GetRuntimePackagePath(), ":"))
-		if err != nil {
-			return nil, err
-		}
-		context = c
+	ctx, err := getRuntimeContext()
+	if err != nil {
+		return nil, err
 	}
 
 	// We need to try to look up the full name, in case we've just been given a short name.
 	fullname := typeName
-	_, ok := context.GetActions()[fullname]
+	_, ok := ctx.GetActions()[fullname]
 	if !ok {
 		// Messages in the same package are allowed to use relative names, so try prefixing the package.
 		if packageName != "" {
@@ -94,7 +87,7 @@ func newDynamicActionTypeNested(typeName string, packageName string) (*DynamicAc
 	}
 
 	// Load context for the target message.
-	spec, err := context.LoadAction(fullname)
+	spec, err := ctx.LoadAction(fullname)
 	if err != nil {
 		return nil, err
 	}
@@ -4,11 +4,12 @@ package ros
 
 import (
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/asimovsecurity/rosgo/libgengo"
 	"github.com/pkg/errors"
@@ -23,6 +24,8 @@ type DynamicMessageType struct {
 	spec         *libgengo.MsgSpec
 	nested       map[string]*DynamicMessageType // Map with key string = messageType name.
 	jsonPrealloc int
+	plan         atomic.Value // Holds the compiled *dynamicPlan used for serialization.
+	nanPolicy    int32        // The NaNPolicy Validate uses, accessed atomically.
 }
 
 // DynamicMessage abstracts an instance of a ROS Message whose type is only known at runtime.  The schema of the message is denoted by the referenced DynamicMessageType, while the
@@ -53,14 +56,20 @@ var rosPkgPath string // Colon separated list of paths to search for message def
 
 var context *libgengo.PkgContext // We'll try to preserve a single message context to avoid reloading each time.
 
+// contextMutex guards rosPkgPath and context, which are shared by every node in the process.  The context itself is safe for concurrent use.
+var contextMutex sync.Mutex
+
 // DEFINE PUBLIC STATIC FUNCTIONS.
 
-// SetRuntimePackagePath sets the ROS package search path which will be used by DynamicMessage to look up ROS message definitions at runtime.
+// SetRuntimePackagePath sets the ROS package search path which will be used by DynamicMessage to look up ROS message definitions at runtime.  The path
+// is shared by every node in the process.
 func SetRuntimePackagePath(path string) {
+	contextMutex.Lock()
+	defer contextMutex.Unlock()
 	// We're not going to check that the result is valid, we'll just accept it blindly.
 	rosPkgPath = path
 	// Reset the message context
-	ResetContext()
+	context = nil
 	// All done.
 	return
 }
@@ -68,16 +77,16 @@ func SetRuntimePackagePath(path string) {
 // GetRuntimePackagePath returns the ROS package search path which will be used by DynamicMessage to look up ROS message definitions at runtime.  By default, this will
 // be equivalent to the ${ROS_PACKAGE_PATH} environment variable.
 func GetRuntimePackagePath() string {
-	// If a package path hasn't been set at the time of first use, by default we'll just use the ROS environment default.
-	if rosPkgPath == "" {
-		rosPkgPath = os.Getenv("ROS_PACKAGE_PATH")
-	}
+	contextMutex.Lock()
+	defer contextMutex.Unlock()
 	// All done.
-	return rosPkgPath
+	return runtimePackagePath()
 }
 
 // ResetContext resets the package path context so that a new one will be generated
 func ResetContext() {
+	contextMutex.Lock()
+	defer contextMutex.Unlock()
 	context = nil
 }
 
@@ -92,7 +101,11 @@ func NewDynamicMessageType(typeName string) (*DynamicMessageType, error) {
 // NewDynamicMessageTypeLiteral generates a DynamicMessageType, and returns a copy of the generated type. This is required by DynamicAction.
 func NewDynamicMessageTypeLiteral(typeName string) (DynamicMessageType, error) {
 	t, err := NewDynamicMessageType(typeName)
-	return *t, err
+	if err != nil {
+		return DynamicMessageType{}, err
+	}
+	// The copy gets a serialization plan of its own, rather than a copy of the cache which holds it.
+	return DynamicMessageType{spec: t.spec, nested: t.nested, jsonPrealloc: t.jsonPrealloc, nanPolicy: atomic.LoadInt32(&t.nanPolicy)}, nil
 }
 
 // NewDynamicMessageTypeFromSpec creates a DynamicMessageType using a preloaded message specification.
@@ -113,7 +126,7 @@ func NewDynamicMessageTypeFromSpec(spec *libgengo.MsgSpec) (*DynamicMessageType,
 	nestedChain[spec.FullName] = struct{}{}
 
 	// Populate the DynamicMessageType data from spec.
-	err := t.populateFromSpec(spec, nestedChain)
+	err := t.populateFromSpec(nil, spec, nestedChain)
 
 	return t, err
 }
@@ -123,17 +136,22 @@ func NewDynamicMessageTypeFromSpec(spec *libgengo.MsgSpec) (*DynamicMessageType,
 // is looked up directly from the existing context.  This 'nested' version of the function is able to be called recursively, where packageName should be the typeName of the
 // parent ROS message; this is used internally for handling complex ROS messages.
 func newDynamicMessageTypeNested(typeName string, packageName string, nested map[string]*DynamicMessageType, nestedChain map[string]struct{}) (*DynamicMessageType, error) {
+	return newDynamicMessageTypeInContext(nil, typeName, packageName, nested, nestedChain)
+}
+
+// newDynamicMessageTypeInContext is newDynamicMessageTypeNested, looking message definitions up in ctx rather than in the context of our ROS install; a nil
+// ctx means the context of our ROS install.
+func newDynamicMessageTypeInContext(ctx *libgengo.PkgContext, typeName string, packageName string, nested map[string]*DynamicMessageType, nestedChain map[string]struct{}) (*DynamicMessageType, error) {
 	// Create an empty message type.
 	t := &DynamicMessageType{}
 
 	// If we haven't created a message context yet, better do that.
-	if context == nil {
-		// Create context for our ROS install.
-		c, err := libgengo.NewPkgContext(strings.Split(GetRuntimePackagePath(), ":"))
+	if ctx == nil {
+		c, err := getRuntimeContext()
 		if err != nil {
 			return t, err
 		}
-		context = c
+		ctx = c
 	}
 
 	// We need to try to look up the full name, in case we've just been given a short name.
@@ -143,7 +161,7 @@ func newDynamicMessageTypeNested(typeName string, packageName string, nested map
 	if typeName == "Header" {
 		fullname = "std_msgs/Header"
 	} else {
-		_, ok := context.GetMsgs()[fullname]
+		_, ok := ctx.GetMsgs()[fullname]
 		if !ok {
 			// Seems like the package_name we were give wasn't the full name.
 
@@ -176,7 +194,7 @@ func newDynamicMessageTypeNested(typeName string, packageName string, nested map
 	nestedChain[fullname] = struct{}{}
 
 	// Load context for the target message.
-	spec, err := context.LoadMsg(fullname)
+	spec, err := ctx.LoadMsg(fullname)
 	if err != nil {
 		return t, err
 	}
@@ -185,7 +203,7 @@ func newDynamicMessageTypeNested(typeName string, packageName string, nested map
 	t.nested = nested
 
 	// Unravelling the nested chain, we are done.
-	err = t.populateFromSpec(spec, nestedChain)
+	err = t.populateFromSpec(ctx, spec, nestedChain)
 
 	// Unravelling the nested chain, we are done.
 	delete(nestedChain, fullname)
@@ -194,8 +212,9 @@ func newDynamicMessageTypeNested(typeName string, packageName string, nested map
 	return t, err
 }
 
-// populateFromSpec takes a message spec and fills a DynamicMessageType fields. Expects that we have a valid nested chain map.
-func (t *DynamicMessageType) populateFromSpec(spec *libgengo.MsgSpec, nestedChain map[string]struct{}) error {
+// populateFromSpec takes a message spec and fills a DynamicMessageType fields, looking nested messages up in ctx (nil for our ROS install). Expects that we have a
+// valid nested chain map.
+func (t *DynamicMessageType) populateFromSpec(ctx *libgengo.PkgContext, spec *libgengo.MsgSpec, nestedChain map[string]struct{}) error {
 	// Create nested maps if required.
 	if t.nested == nil || nestedChain == nil {
 		return errors.New("nested maps were not populated")
@@ -210,14 +229,16 @@ func (t *DynamicMessageType) populateFromSpec(spec *libgengo.MsgSpec, nestedChai
 	// Generate the spec for any nested messages.
 	for _, field := range spec.Fields {
 		if field.IsBuiltin == false {
-			_, err := newDynamicMessageTypeNested(field.Type, field.Package, t.nested, nestedChain)
+			_, err := newDynamicMessageTypeInContext(ctx, field.Type, field.Package, t.nested, nestedChain)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	return nil
+	// Compile the serialization plan now, rather than on the first message.
+	_, err := t.getPlan()
+	return err
 }
 
 // DEFINE PUBLIC RECEIVER FUNCTIONS.
@@ -280,7 +301,9 @@ func (m *DynamicMessage) Type() MessageType {
 	return m.dynamicType
 }
 
-// Serialize converts a DynamicMessage into a TCPROS bytestream allowing it to be published to other nodes; required for ros.Message.
+// Serialize converts a DynamicMessage into a TCPROS bytestream allowing it to be published to other nodes; required for ros.Message.  If it fails, buf is left
+// as it was; Validate reports everything that would make it fail.  Validate is stricter: Serialize also pads short fixed length arrays, truncates long ones,
+// ignores data which isn't a field of the type, and doesn't check the bounds of ROS 2 strings and arrays.
 func (m *DynamicMessage) Serialize(buf *bytes.Buffer) error {
 	if m.dynamicType.spec == nil {
 		return errors.New("dynamic message type spec is nil")
@@ -289,426 +312,26 @@ func (m *DynamicMessage) Serialize(buf *bytes.Buffer) error {
 		return errors.New("dynamic message type nested is nil")
 	}
 
-	// THIS METHOD IS BASICALLY AN UNTEMPLATED COPY OF THE TEMPLATE IN LIBGENGO.
-
-	var err error = nil
-
-	// Iterate over each of the fields in the message.
-	for _, field := range m.dynamicType.spec.Fields {
-
-		if field.IsArray {
-			// It's an array.
-
-			// Look up the item.
-			array, ok := m.data[field.Name]
-			if !ok {
-				return errors.New("Field: " + field.Name + ": No data found.")
-			}
-
-			if (reflect.ValueOf(array).Kind() != reflect.Array) && (reflect.ValueOf(array).Kind() != reflect.Slice) {
-				return errors.New("Field: " + field.Name + ": expected an array.")
-			}
-
-			// If the array is not a fixed length, it begins with a declaration of the array size.
-			var size uint32
-			if field.ArrayLen < 0 {
-				size = uint32(reflect.ValueOf(array).Len())
-				if err := binary.Write(buf, binary.LittleEndian, size); err != nil {
-					return errors.Wrap(err, "Field: "+field.Name)
-				}
-			} else {
-				size = uint32(field.ArrayLen)
-
-				// Make sure that the 'fixed length' array that is expected is the correct length. Pad it if necessary.
-				reflectLen := uint32(reflect.ValueOf(array).Len())
-				if reflectLen < size {
-					array, err = padArray(array, field, reflectLen, size)
-					if err != nil {
-						return errors.Wrap(err, "unable to pad array to correct length")
-					}
-				}
-			}
-
-			// Then we just write out all the elements one after another.
-			arrayValue := reflect.ValueOf(array)
-			for i := uint32(0); i < size; i++ {
-				//Casting the array item to interface type
-				var arrayItem interface{} = arrayValue.Index(int(i)).Interface()
-				// Need to handle each type appropriately.
-				if field.IsBuiltin {
-					if field.Type == "string" {
-						// Make sure we've actually got a string.
-						str, ok := arrayItem.(string)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected string.")
-						}
-						// The string should start with a declaration of the number of characters.
-						var sizeStr uint32 = uint32(len(str))
-						if err := binary.Write(buf, binary.LittleEndian, sizeStr); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-						// Then write out the actual characters.
-						data := []byte(str)
-						if err := binary.Write(buf, binary.LittleEndian, data); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-
-					} else if field.Type == "time" {
-						// Make sure we've actually got a time.
-						t, ok := arrayItem.(Time)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected ros.Time.")
-						}
-						// Then write out the structure.
-						if err := binary.Write(buf, binary.LittleEndian, t); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-
-					} else if field.Type == "duration" {
-						// Make sure we've actually got a duration.
-						d, ok := arrayItem.(Duration)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected ros.Duration.")
-						}
-						// Then write out the structure.
-						if err := binary.Write(buf, binary.LittleEndian, d); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-
-					} else {
-						// It's a primitive.
-
-						// Because no runtime expressions in type assertions in Go, we need to manually do this.
-						switch field.GoType {
-						case "bool":
-							// Make sure we've actually got a bool.
-							v, ok := arrayItem.(bool)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected bool.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						case "int8":
-							// Make sure we've actually got an int8.
-							v, ok := arrayItem.(int8)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected int8.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						case "int16":
-							// Make sure we've actually got an int16.
-							v, ok := arrayItem.(int16)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected int16.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						case "int32":
-							// Make sure we've actually got an int32.
-							v, ok := arrayItem.(int32)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected int32.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						case "int64":
-							// Make sure we've actually got an int64.
-							v, ok := arrayItem.(int64)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected int64.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						case "uint8":
-							// Make sure we've actually got a uint8.
-							v, ok := arrayItem.(uint8)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected uint8.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						case "uint16":
-							// Make sure we've actually got a uint16.
-							v, ok := arrayItem.(uint16)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected uint16.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						case "uint32":
-							// Make sure we've actually got a uint32.
-							v, ok := arrayItem.(uint32)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected uint32.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						case "uint64":
-							// Make sure we've actually got a uint64.
-							v, ok := arrayItem.(uint64)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected uint64.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						case "float32":
-							// Make sure we've actually got a float32.
-							v, ok := arrayItem.(JsonFloat32)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected JsonFloat32.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v.F); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						case "float64":
-							// Make sure we've actually got a float64.
-							v, ok := arrayItem.(JsonFloat64)
-							if !ok {
-								return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected JsonFloat64.")
-							}
-							// Then write out the value.
-							if err := binary.Write(buf, binary.LittleEndian, v.F); err != nil {
-								return errors.Wrap(err, "Field: "+field.Name)
-							}
-						default:
-							// Something went wrong.
-							return errors.New("we haven't implemented this primitive yet")
-						}
-					}
-
-				} else {
-					// Else it's not a builtin.
-
-					// Confirm the message we're holding is actually the correct type.
-					msg, ok := arrayItem.(dynamicMessageLike)
-					if !ok {
-						return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(arrayItem).Name() + ", expected Message.")
-					}
-					if msg == nil || msg.GetDynamicType() == nil || msg.GetDynamicType().spec == nil {
-						return errors.New("Field: " + field.Name + ": nil pointer to MsgSpec")
-					}
-					if msg.GetDynamicType().spec.ShortName != field.Type {
-						return errors.New("Field: " + field.Name + ": Found msg " + msg.GetDynamicType().spec.ShortName + ", expected " + field.Type + ".")
-					}
-					// Otherwise, we just recursively serialise it.
-					if err = msg.Serialize(buf); err != nil {
-						return errors.Wrap(err, "Field: "+field.Name)
-					}
-				}
-			}
-
-		} else {
-			// It's a scalar.
-
-			// Look up the item.
-			item, ok := m.data[field.Name]
-			if !ok {
-				return errors.New("Field: " + field.Name + ": No data found.")
-			}
-
-			// Need to handle each type appropriately.
-			if field.IsBuiltin {
-				if field.Type == "string" {
-					// Make sure we've actually got a string.
-					str, ok := item.(string)
-					if !ok {
-						return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected string.")
-					}
-					// The string should start with a declaration of the number of characters.
-					var sizeStr uint32 = uint32(len(str))
-					if err := binary.Write(buf, binary.LittleEndian, sizeStr); err != nil {
-						return errors.Wrap(err, "Field: "+field.Name)
-					}
-					// Then write out the actual characters.
-					data := []byte(str)
-					if err := binary.Write(buf, binary.LittleEndian, data); err != nil {
-						return errors.Wrap(err, "Field: "+field.Name)
-					}
-
-				} else if field.Type == "time" {
-					// Make sure we've actually got a time.
-					t, ok := item.(Time)
-					if !ok {
-						return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected ros.Time.")
-					}
-					// Then write out the structure.
-					if err := binary.Write(buf, binary.LittleEndian, t); err != nil {
-						return errors.Wrap(err, "Field: "+field.Name)
-					}
-
-				} else if field.Type == "duration" {
-					// Make sure we've actually got a duration.
-					d, ok := item.(Duration)
-					if !ok {
-						return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected ros.Duration.")
-					}
-					// Then write out the structure.
-					if err := binary.Write(buf, binary.LittleEndian, d); err != nil {
-						return errors.Wrap(err, "Field: "+field.Name)
-					}
-
-				} else {
-					// It's a primitive.
-
-					// Because no runtime expressions in type assertions in Go, we need to manually do this.
-					switch field.GoType {
-					case "bool":
-						// Make sure we've actually got a bool.
-						v, ok := item.(bool)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected bool.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					case "int8":
-						// Make sure we've actually got an int8.
-						v, ok := item.(int8)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected int8.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					case "int16":
-						// Make sure we've actually got an int16.
-						v, ok := item.(int16)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected int16.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					case "int32":
-						// Make sure we've actually got an int32.
-						v, ok := item.(int32)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected int32.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					case "int64":
-						// Make sure we've actually got an int64.
-						v, ok := item.(int64)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected int64.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					case "uint8":
-						// Make sure we've actually got a uint8.
-						v, ok := item.(uint8)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected uint8.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					case "uint16":
-						// Make sure we've actually got a uint16.
-						v, ok := item.(uint16)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected uint16.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					case "uint32":
-						// Make sure we've actually got a uint32.
-						v, ok := item.(uint32)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected uint32.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					case "uint64":
-						// Make sure we've actually got a uint64.
-						v, ok := item.(uint64)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected uint64.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					case "float32":
-						// Make sure we've actually got a float32.
-						v, ok := item.(JsonFloat32)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected JsonFloat32.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v.F); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					case "float64":
-						// Make sure we've actually got a float64.
-						v, ok := item.(JsonFloat64)
-						if !ok {
-							return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected JsonFloat64.")
-						}
-						// Then write out the value.
-						if err := binary.Write(buf, binary.LittleEndian, v.F); err != nil {
-							return errors.Wrap(err, "Field: "+field.Name)
-						}
-					default:
-						// Something went wrong.
-						return errors.New("we haven't implemented this primitive yet")
-					}
-				}
+	// The field layout is compiled once per type, so all that's left to do is follow the plan.
+	plan, err := m.dynamicType.getPlan()
+	if err != nil {
+		return err
+	}
 
-			} else {
-				// Else it's not a builtin.
+	// If every message of this type is the same size, make room for it up front.
+	if plan.fixedSize > 0 {
+		buf.Grow(plan.fixedSize)
+	}
 
-				// Confirm the message we're holding is actually the correct type.
-				msg, ok := item.(dynamicMessageLike)
-				if !ok {
-					return errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(item).Name() + ", expected Message.")
-				}
-				if msg.GetDynamicType().spec.ShortName != field.Type {
-					return errors.New("Field: " + field.Name + ": Found msg " + msg.GetDynamicType().spec.ShortName + ", expected " + field.Type + ".")
-				}
-				// Otherwise, we just recursively serialise it.
-				if err = msg.Serialize(buf); err != nil {
-					return errors.Wrap(err, "Field: "+field.Name)
-				}
-			}
-		}
+	// Should any field turn out to be unfit, take back what was written so the caller never sees half a message.
+	start := buf.Len()
+	if err := plan.encode(buf, m.data); err != nil {
+		buf.Truncate(start)
+		return err
 	}
 
 	// All done.
-	return err
+	return nil
 }
 
 // Deserialize parses a byte stream into a DynamicMessage, thus reconstructing the fields of a received ROS message; required for ros.Message.
@@ -722,137 +345,21 @@ func (m *DynamicMessage) Deserialize(buf *bytes.Reader) error {
 	}
 
 	// To give more sane results in the event of a decoding issue, we decode into a copy of the data field.
-	var err error = nil
-	tmpData := make(map[string]interface{})
 	m.data = nil
 
-	d := LEByteDecoder{}
-
-	// Iterate over each of the fields in the message.
-	for _, field := range m.dynamicType.spec.Fields {
-
-		if field.IsArray {
-			// It's an array.
-
-			// The array may be a fixed length, or it may be dynamic.
-			size := field.ArrayLen
-			if field.ArrayLen < 0 {
-				// The array is dynamic, so it starts with a declaration of the number of array elements.
-				var usize uint32
-				if usize, err = d.DecodeUint32(buf); err != nil {
-					return errors.Wrap(err, "Field: "+field.Name)
-				}
-				size = int(usize)
-			}
-			// Create an array of the target type.
-			switch field.GoType {
-			case "bool":
-				tmpData[field.Name], err = d.DecodeBoolArray(buf, size)
-			case "int8":
-				tmpData[field.Name], err = d.DecodeInt8Array(buf, size)
-			case "int16":
-				tmpData[field.Name], err = d.DecodeInt16Array(buf, size)
-			case "int32":
-				tmpData[field.Name], err = d.DecodeInt32Array(buf, size)
-			case "int64":
-				tmpData[field.Name], err = d.DecodeInt64Array(buf, size)
-			case "uint8":
-				tmpData[field.Name], err = d.DecodeUint8Array(buf, size)
-			case "uint16":
-				tmpData[field.Name], err = d.DecodeUint16Array(buf, size)
-			case "uint32":
-				tmpData[field.Name], err = d.DecodeUint32Array(buf, size)
-			case "uint64":
-				tmpData[field.Name], err = d.DecodeUint64Array(buf, size)
-			case "float32":
-				tmpData[field.Name], err = d.DecodeFloat32Array(buf, size)
-			case "float64":
-				tmpData[field.Name], err = d.DecodeFloat64Array(buf, size)
-			case "string":
-				tmpData[field.Name], err = d.DecodeStringArray(buf, size)
-			case "ros.Time":
-				tmpData[field.Name], err = d.DecodeTimeArray(buf, size)
-			case "ros.Duration":
-				tmpData[field.Name], err = d.DecodeDurationArray(buf, size)
-			default:
-				if field.IsBuiltin {
-					// Something went wrong.
-					return errors.New("we haven't implemented this primitive yet")
-				}
-
-				// The type encapsulates another ROS message, so we nest a DynamicMessage.
-				msgType, err := m.dynamicType.getNestedTypeFromField(&field)
-				if err != nil {
-					return errors.Wrap(err, "Field: "+field.Name)
-				}
-
-				if tmpData[field.Name], err = d.DecodeMessageArray(buf, size, msgType); err != nil {
-					return errors.Wrap(err, "Field: "+field.Name)
-				}
-			}
-			if err != nil {
-				return errors.Wrap(err, "Field: "+field.Name)
-			}
-
-		} else { // Else it's a scalar.
-
-			if field.IsBuiltin {
-				// It's a regular primitive element.
-				switch field.GoType {
-				case "bool":
-					tmpData[field.Name], err = d.DecodeBool(buf)
-				case "int8":
-					tmpData[field.Name], err = d.DecodeInt8(buf)
-				case "int16":
-					tmpData[field.Name], err = d.DecodeInt16(buf)
-				case "int32":
-					tmpData[field.Name], err = d.DecodeInt32(buf)
-				case "int64":
-					tmpData[field.Name], err = d.DecodeInt64(buf)
-				case "uint8":
-					tmpData[field.Name], err = d.DecodeUint8(buf)
-				case "uint16":
-					tmpData[field.Name], err = d.DecodeUint16(buf)
-				case "uint32":
-					tmpData[field.Name], err = d.DecodeUint32(buf)
-				case "uint64":
-					tmpData[field.Name], err = d.DecodeUint64(buf)
-				case "float32":
-					tmpData[field.Name], err = d.DecodeFloat32(buf)
-				case "float64":
-					tmpData[field.Name], err = d.DecodeFloat64(buf)
-				case "string":
-					tmpData[field.Name], err = d.DecodeString(buf)
-				case "ros.Time":
-					tmpData[field.Name], err = d.DecodeTime(buf)
-				case "ros.Duration":
-					tmpData[field.Name], err = d.DecodeDuration(buf)
-				default:
-					// Something went wrong.
-					return errors.New("we haven't implemented this primitive yet")
-				}
-
-				if err != nil {
-					return errors.Wrap(err, "Field: "+field.Name)
-				}
-
-			} else {
-				// The type encapsulates another ROS message, so we nest a DynamicMessage.
-				msgType, err := m.dynamicType.getNestedTypeFromField(&field)
-				if err != nil {
-					return errors.Wrap(err, "Field: "+field.Name)
-				}
+	plan, err := m.dynamicType.getPlan()
+	if err != nil {
+		return err
+	}
 
-				if tmpData[field.Name], err = d.DecodeMessage(buf, msgType); err != nil {
-					return errors.Wrap(err, "Field: "+field.Name)
-				}
-			}
-		}
+	tmpData := make(map[string]interface{}, plan.numFields)
+	if err := plan.decode(buf, tmpData); err != nil {
+		return err
 	}
 
 	// All done.
 	m.data = tmpData
-	return err
+	return nil
 }
 
 // String returns a string which represents the encapsulared DynamicMessage data.
@@ -863,6 +370,43 @@ func (m *DynamicMessage) String() string {
 
 // DEFINE PRIVATE STATIC FUNCTIONS.
 
+// getRuntimeContext returns the message context of our ROS install, creating it the first time it is needed.  Types which are being generated
+// while the context is reset keep using the context they started with.
+func getRuntimeContext() (*libgengo.PkgContext, error) {
+	contextMutex.Lock()
+	defer contextMutex.Unlock()
+	if context == nil {
+		// Create context for our ROS install.
+		c, err := libgengo.NewPkgContext(strings.Split(runtimePackagePath(), ":"))
+		if err != nil {
+			return nil, err
+		}
+		context = c
+	}
+	return context, nil
+}
+
+// runtimePackagePath returns the ROS package search path; contextMutex must be held.
+func runtimePackagePath() string {
+	// If a package path hasn't been set at the time of first use, by default we'll just use the ROS environment default.
+	if rosPkgPath == "" {
+		rosPkgPath = os.Getenv("ROS_PACKAGE_PATH")
+	}
+	return rosPkgPath
+}
+
+// dynamicDefaultValue converts a default value parsed by libgengo into the representation used in the DynamicMessage data map.
+func dynamicDefaultValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float32:
+		return JsonFloat32{F: v}
+	case float64:
+		return JsonFloat64{F: v}
+	default:
+		return v
+	}
+}
+
 // DEFINE PRIVATE RECEIVER FUNCTIONS.
 
 // zeroValueData creates the zeroValue (default) data map for a new DynamicMessage.
@@ -936,6 +480,15 @@ func (t *DynamicMessageType) zeroValueData() (map[string]interface{}, error) {
 				}
 				d[field.Name] = messages
 			}
+
+			// ROS 2 definitions may declare default array contents.
+			if defaults, ok := field.Default.([]interface{}); ok {
+				array := reflect.MakeSlice(reflect.TypeOf(d[field.Name]), len(defaults), len(defaults))
+				for i, value := range defaults {
+					array.Index(i).Set(reflect.ValueOf(dynamicDefaultValue(value)))
+				}
+				d[field.Name] = array.Interface()
+			}
 		} else { // Not an array.
 			if field.IsBuiltin {
 				// If it is a built in type.
@@ -971,6 +524,11 @@ func (t *DynamicMessageType) zeroValueData() (map[string]interface{}, error) {
 				default:
 					return d, errors.Wrap(err, "builtin field "+field.GoType+" not found")
 				}
+
+				// ROS 2 definitions may declare a default value.
+				if field.Default != nil {
+					d[field.Name] = dynamicDefaultValue(field.Default)
+				}
 			} else {
 				// The type encapsulates another ROS message, so we nest a DynamicMessage.
 				msgType, err := t.getNestedTypeFromField(&field)
@@ -998,145 +556,4 @@ func (t *DynamicMessageType) getNestedTypeFromField(field *libgengo.Field) (*Dyn
 	return nil, errors.Wrap(errors.New("nested map does not contain requested field"), "fieldtype: "+fieldtype)
 }
 
-// padArray pads the provided array to the specified length using the default value for the array type.
-func padArray(array interface{}, field libgengo.Field, actualSize, requiredSize uint32) (interface{}, error) {
-	switch field.GoType {
-	case "bool":
-		// Make sure we've actually got a bool.
-		v, ok := array.([]bool)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []bool.")
-		}
-		padding := make([]bool, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = false
-		}
-		v = append(v, padding...)
-		return v, nil
-	case "int8":
-		// Make sure we've actually got an int8.
-		v, ok := array.([]int8)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []int8.")
-		}
-		padding := make([]int8, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = 0
-		}
-		v = append(v, padding...)
-		return v, nil
-	case "int16":
-		// Make sure we've actually got an int16.
-		v, ok := array.([]int16)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []int16.")
-		}
-		padding := make([]int16, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = 0
-		}
-		v = append(v, padding...)
-		return v, nil
-	case "int32":
-		// Make sure we've actually got an int32.
-		v, ok := array.([]int32)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []int32.")
-		}
-		padding := make([]int32, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = 0
-		}
-		v = append(v, padding...)
-		return v, nil
-	case "int64":
-		// Make sure we've actually got an int64.
-		v, ok := array.([]int64)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []int64.")
-		}
-		padding := make([]int64, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = 0
-		}
-		v = append(v, padding...)
-		return v, nil
-	case "uint8":
-		// Make sure we've actually got a uint8.
-		v, ok := array.([]uint8)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []uint8.")
-		}
-		padding := make([]uint8, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = 0
-		}
-		v = append(v, padding...)
-		return v, nil
-	case "uint16":
-		// Make sure we've actually got a uint16.
-		v, ok := array.([]uint16)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []uint16.")
-		}
-		padding := make([]uint16, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = 0
-		}
-		v = append(v, padding...)
-		return v, nil
-	case "uint32":
-		// Make sure we've actually got a uint32.
-		v, ok := array.([]uint32)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []uint32.")
-		}
-		padding := make([]uint32, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = 0
-		}
-		v = append(v, padding...)
-		return v, nil
-	case "uint64":
-		// Make sure we've actually got a uint64.
-		v, ok := array.([]uint64)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []uint64.")
-		}
-		padding := make([]uint64, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = 0
-		}
-		v = append(v, padding...)
-		return v, nil
-	case "float32":
-		// Make sure we've actually got a float32.
-		v, ok := array.([]JsonFloat32)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []JsonFloat32.")
-		}
-		padding := make([]JsonFloat32, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = JsonFloat32{F: 0}
-		}
-		v = append(v, padding...)
-		return v, nil
-	case "float64":
-		// Make sure we've actually got a float64.
-		v, ok := array.([]JsonFloat64)
-		if !ok {
-			return nil, errors.New("Field: " + field.Name + ": Found " + reflect.TypeOf(array).Name() + ", expected []JsonFloat64.")
-		}
-		padding := make([]JsonFloat64, requiredSize-actualSize)
-		for i := range padding {
-			padding[i] = JsonFloat64{F: 0}
-		}
-		v = append(v, padding...)
-		return v, nil
-	default:
-		// Something went wrong.
-		return nil, errors.New("we haven't implemented this primitive yet")
-	}
-}
-
 // ALL DONE.
@@ -617,3 +617,105 @@ func BenchmarkDynamicMessage_NewMessage_BigArray(b *testing.B) {
 		_ = testMessage.data
 	}
 }
+
+// Benchmarks on serialization.
+
+// benchmarkSerialize repeatedly serializes the message held in serialized, reusing the output buffer between iterations.
+func benchmarkSerialize(b *testing.B, messageType *DynamicMessageType, serialized []byte) {
+	testMessage := messageType.NewDynamicMessage()
+	if err := testMessage.Deserialize(bytes.NewReader(serialized)); err != nil {
+		b.Fatalf("deserialize failed %s", err)
+	}
+
+	var buf bytes.Buffer
+	b.SetBytes(int64(len(serialized)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := testMessage.Serialize(&buf); err != nil {
+			b.Fatalf("serialize failed %s", err)
+		}
+	}
+}
+
+func BenchmarkDynamicMessage_Serialize_SingularPrimitives(b *testing.B) {
+	benchmarkSerialize(b, &singularMessageType, singularSerialized)
+}
+
+func BenchmarkDynamicMessage_Serialize_FixedArrayPrimitives(b *testing.B) {
+	benchmarkSerialize(b, &fixedArrayMessageType, fixedArraySerialized)
+}
+
+func BenchmarkDynamicMessage_Serialize_DynamicArrayMedley(b *testing.B) {
+	benchmarkSerialize(b, &dynamicArrayMessageType, dynamicArraySerialized)
+}
+
+func BenchmarkDynamicMessage_Serialize_uint8BigArray(b *testing.B) {
+	benchmarkSerialize(b, &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "uint8", "u8", true, 1_000_000),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}, bigArraySerialized)
+}
+
+func BenchmarkDynamicMessage_Serialize_int16BigArray(b *testing.B) {
+	benchmarkSerialize(b, &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "int16", "i16", true, 500_000),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}, bigArraySerialized)
+}
+
+func BenchmarkDynamicMessage_Serialize_float64BigArray(b *testing.B) {
+	benchmarkSerialize(b, &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "float64", "f64", true, 125_000),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}, bigArraySerialized)
+}
+
+func BenchmarkDynamicMessage_Serialize_stringBigArray(b *testing.B) {
+	benchmarkSerialize(b, &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "string", "s", true, 125_000),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}, bytes.Repeat([]byte{0x04, 0x00, 0x00, 0x00, 'J', 'o', 'J', 'o'}, 125_000))
+}
+
+func BenchmarkDynamicMessage_Serialize_timeBigArray(b *testing.B) {
+	benchmarkSerialize(b, &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "time", "t", true, 125_000),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}, bigArraySerialized)
+}
+
+// Benchmarks on lazy access through DynamicMessageView.
+
+// Benchmark reading a single field out of a message with a one megabyte byte array, as a subscriber picking the header out of an image would.
+func BenchmarkDynamicMessageView_Get_BigArray(b *testing.B) {
+	var bigArrayMessageType DynamicMessageType = DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "uint8", "u8", true, -1),
+			*gengo.NewField("Testing", "uint32", "u32", false, 0),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+	serialized := append(append([]byte{0x40, 0x42, 0x0f, 0x00}, bigArraySerialized...), 0x01, 0x00, 0x00, 0x00)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		view, err := bigArrayMessageType.NewDynamicMessageView(serialized)
+		if err != nil {
+			b.Fatalf("view failed %s", err)
+		}
+		if _, err := view.Get("u32"); err != nil {
+			b.Fatalf("get failed %s", err)
+		}
+	}
+}
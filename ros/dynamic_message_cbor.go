@@ -0,0 +1,320 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// DEFINE PRIVATE STRUCTURES.
+
+// cborCodec encodes messages as CBOR (RFC 8949): a map of field names to values, the same as JSON, but with uint8 arrays as byte strings and floats in
+// their native width.
+type cborCodec struct{}
+
+// cborEncoder writes CBOR for encodeDynamicFields.  Every length is known up front, so only definite length items are written.
+type cborEncoder struct {
+	buf []byte
+}
+
+// cborDecoder reads CBOR into generic values for decodeGeneric.
+type cborDecoder struct {
+	buf []byte
+	off int
+}
+
+// DEFINE PRIVATE GLOBALS.
+
+// CBOR major types.
+const (
+	cborUint   = 0 << 5
+	cborNegint = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+	cborSimple = 7 << 5
+)
+
+// cborMaxDepth limits how deeply nested the items we decode may be.
+const cborMaxDepth = 1000
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	cborCodec
+
+// Name returns "cbor"; required for Codec.
+func (cborCodec) Name() string {
+	return "cbor"
+}
+
+// Marshal encodes the message as CBOR; required for Codec.
+func (cborCodec) Marshal(m *DynamicMessage) ([]byte, error) {
+	enc := cborEncoder{}
+	if m != nil && m.dynamicType != nil {
+		enc.buf = make([]byte, 0, m.dynamicType.jsonPrealloc)
+	}
+	if err := encodeDynamicFields(&enc, m); err != nil {
+		return nil, err
+	}
+	return enc.buf, nil
+}
+
+// Unmarshal decodes CBOR into the message; required for Codec.
+func (cborCodec) Unmarshal(buf []byte, m *DynamicMessage) error {
+	dec := cborDecoder{buf: buf}
+	value, err := dec.decode(0)
+	if err != nil {
+		return errors.Wrap(err, "cbor")
+	}
+	if dec.off != len(buf) {
+		return errors.New("cbor: " + strconv.Itoa(len(buf)-dec.off) + " bytes of trailing data")
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("cbor: expected a map")
+	}
+	return m.decodeGeneric("", object)
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	cborEncoder
+
+func (e *cborEncoder) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, major|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, major|25, 0, 0)
+		binary.BigEndian.PutUint16(e.buf[len(e.buf)-2:], uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, major|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(n))
+	default:
+		e.buf = append(e.buf, major|27, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], n)
+	}
+}
+
+func (e *cborEncoder) beginMap(n int) {
+	e.head(cborMap, uint64(n))
+}
+
+func (e *cborEncoder) key(name string) {
+	e.writeString(name)
+}
+
+func (e *cborEncoder) endMap() {}
+
+func (e *cborEncoder) beginArray(n int, scalars bool) {
+	e.head(cborArray, uint64(n))
+}
+
+func (e *cborEncoder) endArray() {}
+
+func (e *cborEncoder) writeBool(v bool) {
+	if v {
+		e.buf = append(e.buf, cborSimple|21)
+	} else {
+		e.buf = append(e.buf, cborSimple|20)
+	}
+}
+
+func (e *cborEncoder) writeInt(v int64) {
+	if v < 0 {
+		e.head(cborNegint, uint64(-1-v))
+	} else {
+		e.head(cborUint, uint64(v))
+	}
+}
+
+func (e *cborEncoder) writeUint(v uint64) {
+	e.head(cborUint, v)
+}
+
+func (e *cborEncoder) writeFloat(f float64, bits int) {
+	if name, ok := nonFiniteFloatName(f); ok {
+		e.writeString(name)
+		return
+	}
+	if bits == 32 {
+		e.buf = append(e.buf, cborSimple|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], math.Float32bits(float32(f)))
+		return
+	}
+	e.buf = append(e.buf, cborSimple|27, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], math.Float64bits(f))
+}
+
+func (e *cborEncoder) writeString(s string) {
+	e.head(cborText, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *cborEncoder) writeBytes(b []byte) {
+	e.head(cborBytes, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *cborEncoder) writeTime(sec uint32, nsec uint32) {
+	e.beginMap(2)
+	e.key("sec")
+	e.writeUint(uint64(sec))
+	e.key("nsec")
+	e.writeUint(uint64(nsec))
+}
+
+//	cborDecoder
+
+// next returns the next n bytes of input.
+func (d *cborDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.buf)-d.off) {
+		return nil, errors.New("unexpected end of data at offset " + strconv.Itoa(d.off))
+	}
+	b := d.buf[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+// head reads the initial byte of an item and its argument.
+func (d *cborDecoder) head() (byte, byte, uint64, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info := b[0]&0xe0, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		arg, err := d.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		var n uint64
+		for _, c := range arg {
+			n = n<<8 | uint64(c)
+		}
+		return major, info, n, nil
+	}
+	return 0, 0, 0, errors.New("indefinite length items are not supported, at offset " + strconv.Itoa(d.off-1))
+}
+
+// decode reads a single item.
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errors.New("items nested too deeply")
+	}
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		return n, nil
+	case cborNegint:
+		if n > math.MaxInt64 {
+			return nil, errors.New("negative integer out of range")
+		}
+		return -1 - int64(n), nil
+	case cborBytes:
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case cborText:
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(b) {
+			return nil, errors.New("invalid UTF-8 in text string")
+		}
+		return string(b), nil
+	case cborArray:
+		if n > uint64(len(d.buf)-d.off) {
+			return nil, errors.New("array length out of range")
+		}
+		array := make([]interface{}, n)
+		for i := range array {
+			if array[i], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case cborMap:
+		if n > uint64(len(d.buf)-d.off) {
+			return nil, errors.New("map length out of range")
+		}
+		object := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, errors.New("map keys must be text strings")
+			}
+			if object[key], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return object, nil
+	case cborTag:
+		// Tags only add meaning to the item that follows, which is all we're interested in.
+		return d.decode(depth + 1)
+	}
+
+	// Simple values and floats.
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfToFloat64(uint16(n)), nil
+	case 26:
+		return math.Float32frombits(uint32(n)), nil
+	case 27:
+		return math.Float64frombits(n), nil
+	}
+	return nil, errors.New("unsupported simple value " + strconv.FormatUint(n, 10))
+}
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+// halfToFloat64 converts an IEEE 754 half precision float, which CBOR encoders may use for small values.
+func halfToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(mant+1024, exp-25)
+}
+
+// ALL DONE.
@@ -0,0 +1,414 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/asimovsecurity/rosgo/libgengo"
+	"github.com/pkg/errors"
+)
+
+// DEFINE PUBLIC STRUCTURES.
+
+// Codec encodes DynamicMessages to, and decodes them from, a format other than ROS serialization.  Codecs are registered, and looked up, by name; rosgo
+// provides "json", "cbor", "msgpack" and "yaml".
+type Codec interface {
+	// Name returns the name the codec is registered under.
+	Name() string
+	// Marshal encodes the message.
+	Marshal(m *DynamicMessage) ([]byte, error)
+	// Unmarshal decodes buf into the message, which must already have its type.  Fields missing from buf are left as they are.
+	Unmarshal(buf []byte, m *DynamicMessage) error
+}
+
+// DEFINE PRIVATE STRUCTURES.
+
+// dynamicEncoder receives the structure of a message from encodeDynamicFields, and writes it out in some format.  Every codec sees messages the same
+// way: as maps of field names to values, with times and durations as seconds and nanoseconds, and uint8 arrays as bytes.
+type dynamicEncoder interface {
+	beginMap(n int)
+	key(name string)
+	endMap()
+	beginArray(n int, scalars bool) // scalars is false for arrays of messages, times and durations.
+	endArray()
+	writeBool(v bool)
+	writeInt(v int64)
+	writeUint(v uint64)
+	writeFloat(f float64, bits int) // NaN and infinite values are passed on as they are; see nonFiniteFloatName.
+	writeString(s string)
+	writeBytes(b []byte)
+	writeTime(sec uint32, nsec uint32)
+}
+
+// dynamicFieldEncoder is implemented by encoders which write values differently depending on the field they belong to; encodeDynamicFields calls
+// setField before the key of each field.
+type dynamicFieldEncoder interface {
+	setField(t *DynamicMessageType, field *libgengo.Field)
+}
+
+// jsonCodec adapts MarshalJSON and UnmarshalJSON to Codec.
+type jsonCodec struct{}
+
+// DEFINE PRIVATE GLOBALS.
+
+var (
+	codecsMutex sync.RWMutex
+	codecs      = map[string]Codec{
+		"json":    jsonCodec{},
+		"cbor":    cborCodec{},
+		"msgpack": msgpackCodec{},
+		"yaml":    yamlCodec{},
+	}
+)
+
+// DEFINE PUBLIC STATIC FUNCTIONS.
+
+// RegisterCodec makes a codec available to GetCodec under its name, replacing any codec already registered under that name.
+func RegisterCodec(codec Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+	codecs[strings.ToLower(codec.Name())] = codec
+}
+
+// GetCodec returns the codec registered under the given name.
+func GetCodec(name string) (Codec, error) {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	codec, ok := codecs[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.New("unknown codec: " + name)
+	}
+	return codec, nil
+}
+
+// CodecNames returns the names of all registered codecs, in alphabetical order.
+func CodecNames() []string {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	jsonCodec
+
+// Name returns "json"; required for Codec.
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// Marshal encodes the message with MarshalJSON; required for Codec.
+func (jsonCodec) Marshal(m *DynamicMessage) ([]byte, error) {
+	return m.MarshalJSON()
+}
+
+// Unmarshal decodes the message with UnmarshalJSON; required for Codec.
+func (jsonCodec) Unmarshal(buf []byte, m *DynamicMessage) error {
+	return m.UnmarshalJSON(buf)
+}
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+// nonFiniteFloatName returns the string a NaN or infinite float is encoded as, since JSON has no way of writing them.  The other codecs follow suit, so
+// that a message looks the same whichever codec it went through.
+func nonFiniteFloatName(f float64) (string, bool) {
+	switch {
+	case math.IsNaN(f):
+		return "nan", true
+	case math.IsInf(f, 1):
+		return "+inf", true
+	case math.IsInf(f, -1):
+		return "-inf", true
+	}
+	return "", false
+}
+
+// parseDynamicFloat parses a float written as a string, including the names of non-finite values used by nonFiniteFloatName and by YAML.
+func parseDynamicFloat(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	// YAML writes infinity and NaN as .inf and .nan.
+	if trimmed := strings.TrimLeft(s, "+-"); strings.HasPrefix(trimmed, ".") && len(trimmed) > 1 && (trimmed[1] == 'i' || trimmed[1] == 'I' || trimmed[1] == 'n' || trimmed[1] == 'N') {
+		s = s[:len(s)-len(trimmed)] + trimmed[1:]
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// encodeDynamicFields walks the fields of a message, in declaration order, passing them on to the encoder.
+func encodeDynamicFields(enc dynamicEncoder, m *DynamicMessage) error {
+	// Confirm the pointers are valid.
+	if err := messagePointerError(m); err != nil {
+		return err
+	}
+
+	fields := m.dynamicType.spec.Fields
+	fieldEncoder, _ := enc.(dynamicFieldEncoder)
+	enc.beginMap(len(fields))
+	for i := range fields {
+		field := &fields[i]
+		v, ok := m.data[field.Name]
+		if !ok {
+			return errors.Wrap(errors.New("key not in data"), "key: "+field.Name)
+		}
+		if fieldEncoder != nil {
+			fieldEncoder.setField(m.dynamicType, field)
+		}
+		enc.key(field.Name)
+
+		var err error
+		if field.IsArray {
+			err = encodeDynamicArrayValue(enc, field, v)
+		} else {
+			err = encodeDynamicValue(enc, field, v)
+		}
+		if err != nil {
+			return errors.Wrap(err, "field: "+field.Name)
+		}
+	}
+	enc.endMap()
+
+	// All done.
+	return nil
+}
+
+// encodeDynamicValue passes a scalar field, or a single element of an array field, on to the encoder.
+func encodeDynamicValue(enc dynamicEncoder, field *libgengo.Field, v interface{}) error {
+	if field.IsBuiltin == false {
+		// The type encapsulates another ROS message.
+		switch nested := v.(type) {
+		case *DynamicMessage:
+			return encodeDynamicFields(enc, nested)
+		case *DynamicMessageView:
+			msg, err := nested.Message()
+			if err != nil {
+				return err
+			}
+			return encodeDynamicFields(enc, msg)
+		}
+		return newTypeError(v, "DynamicMessage")
+	}
+
+	prim := dynamicPrimitives[field.GoType]
+	if !dynamicPrimitiveMatches(prim, v) {
+		return newTypeError(v, dynamicPrimitiveNames[prim])
+	}
+	switch value := v.(type) {
+	case bool:
+		enc.writeBool(value)
+	case int8:
+		enc.writeInt(int64(value))
+	case int16:
+		enc.writeInt(int64(value))
+	case int32:
+		enc.writeInt(int64(value))
+	case int64:
+		enc.writeInt(value)
+	case uint8:
+		enc.writeUint(uint64(value))
+	case uint16:
+		enc.writeUint(uint64(value))
+	case uint32:
+		enc.writeUint(uint64(value))
+	case uint64:
+		enc.writeUint(value)
+	case JsonFloat32:
+		enc.writeFloat(float64(value.F), 32)
+	case JsonFloat64:
+		enc.writeFloat(value.F, 64)
+	case string:
+		enc.writeString(value)
+	case Time:
+		enc.writeTime(value.Sec, value.NSec)
+	case Duration:
+		enc.writeTime(value.Sec, value.NSec)
+	}
+	return nil
+}
+
+// encodeDynamicArrayValue passes an array field on to the encoder.
+func encodeDynamicArrayValue(enc dynamicEncoder, field *libgengo.Field, v interface{}) error {
+	prim := dynamicMessage
+	if field.IsBuiltin {
+		prim = dynamicPrimitives[field.GoType]
+	}
+	scalars := prim != dynamicMessage && prim != dynamicTime && prim != dynamicDuration
+
+	// The slices we hand out get a fast path.
+	switch array := v.(type) {
+	case []uint8:
+		if prim == dynamicUint8 {
+			enc.writeBytes(array)
+			return nil
+		}
+	case []int16:
+		if prim == dynamicInt16 {
+			enc.beginArray(len(array), true)
+			for _, item := range array {
+				enc.writeInt(int64(item))
+			}
+			enc.endArray()
+			return nil
+		}
+	case []int32:
+		if prim == dynamicInt32 {
+			enc.beginArray(len(array), true)
+			for _, item := range array {
+				enc.writeInt(int64(item))
+			}
+			enc.endArray()
+			return nil
+		}
+	case []JsonFloat32:
+		if prim == dynamicFloat32 {
+			enc.beginArray(len(array), true)
+			for _, item := range array {
+				enc.writeFloat(float64(item.F), 32)
+			}
+			enc.endArray()
+			return nil
+		}
+	case []JsonFloat64:
+		if prim == dynamicFloat64 {
+			enc.beginArray(len(array), true)
+			for _, item := range array {
+				enc.writeFloat(item.F, 64)
+			}
+			enc.endArray()
+			return nil
+		}
+	}
+
+	// Everything else goes element by element.
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return newTypeError(v, dynamicFieldTypeName(field))
+	}
+	length := rv.Len()
+	enc.beginArray(length, scalars)
+	for i := 0; i < length; i++ {
+		if err := encodeDynamicValue(enc, field, rv.Index(i).Interface()); err != nil {
+			return errors.Wrap(err, "index: "+strconv.Itoa(i))
+		}
+	}
+	enc.endArray()
+	return nil
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	DynamicMessageType
+
+// decodeGeneric converts a value decoded by one of the codecs (a map[string]interface{}, []interface{}, []byte, string, bool, or Go number) to the
+// representation used in DynamicMessage data for the field.  Array fields are converted whole, unless element is set.
+func (t *DynamicMessageType) decodeGeneric(path string, field *libgengo.Field, value interface{}, element bool) (interface{}, error) {
+	if field.IsArray && !element {
+		if _, ok := value.([]byte); ok && field.GoType == "uint8" {
+			return t.coerceArray(path, field, value)
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, &FieldTypeError{Path: path, Expected: dynamicFieldTypeName(field), Value: value}
+		}
+		converted := make([]interface{}, len(list))
+		for i, item := range list {
+			var err error
+			if converted[i], err = t.decodeGeneric(path+"["+strconv.Itoa(i)+"]", field, item, true); err != nil {
+				return nil, err
+			}
+		}
+		return t.coerceArray(path, field, converted)
+	}
+
+	if !field.IsBuiltin {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return t.coerceElement(path, field, value)
+		}
+		nested, err := t.getNestedTypeFromField(field)
+		if err != nil {
+			return nil, errors.Wrap(err, "Field: "+field.Name)
+		}
+		msg := nested.NewDynamicMessage()
+		if err := msg.decodeGeneric(path+".", object); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	switch prim := dynamicPrimitives[field.GoType]; prim {
+	case dynamicFloat32, dynamicFloat64:
+		if s, ok := value.(string); ok {
+			f, err := parseDynamicFloat(s)
+			if err != nil {
+				return nil, &FieldTypeError{Path: path, Expected: field.Type, Value: value}
+			}
+			value = f
+		}
+	case dynamicTime, dynamicDuration:
+		if object, ok := value.(map[string]interface{}); ok {
+			// Accept the same keys as JSON does.
+			var sec, nsec interface{}
+			for k, v := range object {
+				switch k {
+				case "sec", "secs", "Sec", "Secs":
+					sec = v
+				case "nsec", "nsecs", "NSec", "NSecs":
+					nsec = v
+				default:
+					return nil, &FieldTypeError{Path: path, Expected: field.Type, Value: value, Reason: "unknown key " + k}
+				}
+			}
+			s, reason, ok := coerceDynamicPrimitive(dynamicUint32, sec)
+			n, nreason, nok := coerceDynamicPrimitive(dynamicUint32, nsec)
+			if !ok || !nok || reason != "" || nreason != "" {
+				return nil, &FieldTypeError{Path: path, Expected: field.Type, Value: value, Reason: "expected sec and nsec"}
+			}
+			if prim == dynamicTime {
+				return NewTime(s.(uint32), n.(uint32)), nil
+			}
+			return NewDuration(s.(uint32), n.(uint32)), nil
+		}
+	}
+	return t.coerceElement(path, field, value)
+}
+
+//	DynamicMessage
+
+// decodeGeneric sets the fields of the message from a map decoded by one of the codecs.  The message is only changed if every field decodes.
+func (m *DynamicMessage) decodeGeneric(prefix string, object map[string]interface{}) error {
+	// Confirm the pointers are valid.
+	if err := messagePointerError(m); err != nil {
+		return err
+	}
+
+	decoded := make(map[string]interface{}, len(object))
+	for name, value := range object {
+		field := m.dynamicType.field(name)
+		if field == nil {
+			return &FieldPathError{Path: prefix + name, Reason: "no field " + name + " in " + m.dynamicType.Name()}
+		}
+		result, err := m.dynamicType.decodeGeneric(prefix+name, field, value, false)
+		if err != nil {
+			return err
+		}
+		decoded[name] = result
+	}
+	for name, value := range decoded {
+		m.data[name] = value
+	}
+
+	// All done.
+	return nil
+}
+
+// ALL DONE.
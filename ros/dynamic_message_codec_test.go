@@ -0,0 +1,291 @@
+package ros
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	gengo "github.com/asimovsecurity/rosgo/libgengo"
+)
+
+func newCodecTestMessage() *DynamicMessage {
+	innerType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "float64", "x", false, 0),
+			*gengo.NewField("Testing", "time", "stamp", false, 0),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+	testMessageType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "bool", "b", false, 0),
+			*gengo.NewField("Testing", "int8", "i8", false, 0),
+			*gengo.NewField("Testing", "uint64", "u64", false, 0),
+			*gengo.NewField("Testing", "float32", "f32", false, 0),
+			*gengo.NewField("Testing", "string", "s", false, 0),
+			*gengo.NewField("Testing", "duration", "d", false, 0),
+			*gengo.NewField("Testing", "uint8", "u8s", true, -1),
+			*gengo.NewField("Testing", "float64", "f64s", true, 3),
+			*gengo.NewField("Testing", "string", "ss", true, -1),
+			*gengo.NewField("Testing", "Test", "inner", false, 0),
+			*gengo.NewField("Testing", "Test", "inners", true, -1),
+		}),
+		nested: map[string]*DynamicMessageType{"Testing/Test": innerType},
+	}
+
+	inner := innerType.NewDynamicMessage()
+	inner.data["x"] = JsonFloat64{F: 0.5}
+	inner.data["stamp"] = NewTime(1500000000, 42)
+	element := innerType.NewDynamicMessage()
+	element.data["x"] = JsonFloat64{F: math.Inf(-1)}
+
+	msg := testMessageType.NewDynamicMessage()
+	msg.data["b"] = true
+	msg.data["i8"] = int8(-100)
+	msg.data["u64"] = uint64(math.MaxUint64)
+	msg.data["f32"] = JsonFloat32{F: float32(math.NaN())}
+	msg.data["s"] = "it's \"quoted\"\n"
+	msg.data["d"] = NewDuration(3, 500000000)
+	msg.data["u8s"] = []uint8{0, 1, 255}
+	msg.data["f64s"] = []JsonFloat64{{F: 1}, {F: -2.5}, {F: 1e-7}}
+	msg.data["ss"] = []string{"a", "b'c"}
+	msg.data["inner"] = inner
+	msg.data["inners"] = []Message{element}
+	return msg
+}
+
+// equalCodecTestMessages compares two messages from newCodecTestMessage, allowing for NaN.
+func equalCodecTestMessages(t *testing.T, expected *DynamicMessage, got *DynamicMessage) {
+	f32 := got.data["f32"].(JsonFloat32).F
+	if !math.IsNaN(float64(f32)) {
+		t.Fatalf("expected NaN, got %v", f32)
+	}
+	expectedData, gotData := make(map[string]interface{}), make(map[string]interface{})
+	for k, v := range expected.data {
+		expectedData[k] = v
+	}
+	for k, v := range got.data {
+		gotData[k] = v
+	}
+	delete(expectedData, "f32")
+	delete(gotData, "f32")
+	if !reflect.DeepEqual(expectedData, gotData) {
+		t.Fatalf("expected %v, got %v", expectedData, gotData)
+	}
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	for _, name := range CodecNames() {
+		t.Run(name, func(t *testing.T) {
+			codec, err := GetCodec(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := newCodecTestMessage()
+			encoded, err := codec.Marshal(msg)
+			if err != nil {
+				t.Fatalf("marshal failed: %s", err)
+			}
+			decoded := msg.dynamicType.NewDynamicMessage()
+			if err := codec.Unmarshal(encoded, decoded); err != nil {
+				t.Fatalf("unmarshal failed: %s\n%s", err, encoded)
+			}
+			equalCodecTestMessages(t, msg, decoded)
+		})
+	}
+}
+
+func TestCodec_Lookup(t *testing.T) {
+	if names := CodecNames(); !reflect.DeepEqual(names, []string{"cbor", "json", "msgpack", "yaml"}) {
+		t.Fatalf("unexpected codecs %v", names)
+	}
+	if _, err := GetCodec("CBOR"); err != nil {
+		t.Fatalf("expected codec names to be case insensitive: %s", err)
+	}
+	if _, err := GetCodec("xml"); err == nil {
+		t.Fatalf("expected an error for an unknown codec")
+	}
+}
+
+func TestCodec_TypeErrors(t *testing.T) {
+	for _, name := range CodecNames() {
+		codec, _ := GetCodec(name)
+		msg := newCodecTestMessage()
+		msg.data["i8"] = 1
+		if _, err := codec.Marshal(msg); err == nil {
+			t.Fatalf("%s: expected marshal to fail", name)
+		}
+	}
+}
+
+func TestCodec_CBOR_Encoding(t *testing.T) {
+	testMessageType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "int16", "a", false, 0),
+			*gengo.NewField("Testing", "float64", "b", false, 0),
+			*gengo.NewField("Testing", "uint8", "c", true, -1),
+			*gengo.NewField("Testing", "time", "t", false, 0),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+	msg := testMessageType.NewDynamicMessage()
+	msg.data["a"] = int16(-500)
+	msg.data["b"] = JsonFloat64{F: math.NaN()}
+	msg.data["c"] = []uint8{1, 2}
+	msg.data["t"] = NewTime(1, 2)
+
+	expected := []byte{
+		0xa4,
+		0x61, 'a', 0x39, 0x01, 0xf3,
+		0x61, 'b', 0x63, 'n', 'a', 'n',
+		0x61, 'c', 0x42, 0x01, 0x02,
+		0x61, 't', 0xa2, 0x63, 's', 'e', 'c', 0x01, 0x64, 'n', 's', 'e', 'c', 0x02,
+	}
+	codec, _ := GetCodec("cbor")
+	encoded, err := codec.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, expected) {
+		t.Fatalf("expected %x, got %x", expected, encoded)
+	}
+}
+
+func TestCodec_MessagePack_Encoding(t *testing.T) {
+	testMessageType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "int16", "a", false, 0),
+			*gengo.NewField("Testing", "float32", "b", false, 0),
+			*gengo.NewField("Testing", "uint8", "c", true, -1),
+			*gengo.NewField("Testing", "uint32", "d", false, 0),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+	msg := testMessageType.NewDynamicMessage()
+	msg.data["a"] = int16(-500)
+	msg.data["b"] = JsonFloat32{F: 1}
+	msg.data["c"] = []uint8{1, 2}
+	msg.data["d"] = uint32(70000)
+
+	expected := []byte{
+		0x84,
+		0xa1, 'a', 0xd1, 0xfe, 0x0c,
+		0xa1, 'b', 0xca, 0x3f, 0x80, 0x00, 0x00,
+		0xa1, 'c', 0xc4, 0x02, 0x01, 0x02,
+		0xa1, 'd', 0xce, 0x00, 0x01, 0x11, 0x70,
+	}
+	codec, _ := GetCodec("msgpack")
+	encoded, err := codec.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, expected) {
+		t.Fatalf("expected %x, got %x", expected, encoded)
+	}
+}
+
+func TestCodec_YAML_RostopicEcho(t *testing.T) {
+	// rostopic echo leaves a space after the colon of a field whose value starts on the next line, and after the dash of a sequence entry.
+	expected := strings.Join([]string{
+		"b: True",
+		"i8: -100",
+		"u64: 18446744073709551615",
+		"f32: nan",
+		"s: \"it's \\\"quoted\\\"\\n\"",
+		"d: ",
+		"  secs: 3",
+		"  nsecs: 500000000",
+		"u8s: [0, 1, 255]",
+		"f64s: [1.0, -2.5, 1e-07]",
+		"ss: ['a', \"b'c\"]",
+		"inner: ",
+		"  x: 0.5",
+		"  stamp: ",
+		"    secs: 1500000000",
+		"    nsecs:        42",
+		"inners: ",
+		"  - ",
+		"    x: -inf",
+		"    stamp: ",
+		"      secs: 0",
+		"      nsecs:         0",
+	}, "\n") + "\n"
+	codec, _ := GetCodec("yaml")
+	encoded, err := codec.Marshal(newCodecTestMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, encoded)
+	}
+}
+
+func TestCodec_YAML_Unmarshal(t *testing.T) {
+	codec, _ := GetCodec("yaml")
+	msg := newCodecTestMessage()
+
+	// Flow style, as given to rostopic pub, only sets the fields it mentions.
+	if err := codec.Unmarshal([]byte(`{i8: 5, f64s: [.inf, 2, "-3.5"], inner: {stamp: {secs: 7, nsecs: 8}}}`), msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.data["i8"] != int8(5) || msg.data["b"] != true {
+		t.Fatalf("unexpected data %v", msg.data)
+	}
+	if f64s := msg.data["f64s"].([]JsonFloat64); !math.IsInf(f64s[0].F, 1) || f64s[1].F != 2 || f64s[2].F != -3.5 {
+		t.Fatalf("unexpected f64s %v", f64s)
+	}
+	if stamp := msg.data["inner"].(*DynamicMessage).data["stamp"]; stamp != NewTime(7, 8) {
+		t.Fatalf("unexpected stamp %v", stamp)
+	}
+
+	// Block style, with compact sequence entries and comments.
+	input := `
+# A comment.
+s: 'single ''quoted'''
+ss:
+- x
+- "y"
+inners:
+  - x: 1.5  # Another comment.
+    stamp: {secs: 1, nsecs: 2}
+  - x: nan
+`
+	if err := codec.Unmarshal([]byte(input), msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.data["s"] != "single 'quoted'" || !reflect.DeepEqual(msg.data["ss"], []string{"x", "y"}) {
+		t.Fatalf("unexpected data %v", msg.data)
+	}
+	inners := msg.data["inners"].([]Message)
+	if len(inners) != 2 || inners[0].(*DynamicMessage).data["x"] != (JsonFloat64{F: 1.5}) || !math.IsNaN(inners[1].(*DynamicMessage).data["x"].(JsonFloat64).F) {
+		t.Fatalf("unexpected inners %v", inners)
+	}
+
+	// Mistakes are reported, and leave the message alone.
+	for _, input := range []string{"i8: 300", "nope: 1", "i8: [1, 2", "f64s: [1, 2]", "s:\n  - a\n bad"} {
+		if err := codec.Unmarshal([]byte(input), msg); err == nil {
+			t.Fatalf("expected an error for %q", input)
+		}
+	}
+	if msg.data["i8"] != int8(5) {
+		t.Fatalf("unexpected i8 %v", msg.data["i8"])
+	}
+}
+
+func TestCodec_Binary_Truncated(t *testing.T) {
+	for _, name := range []string{"cbor", "msgpack"} {
+		codec, _ := GetCodec(name)
+		msg := newCodecTestMessage()
+		encoded, err := codec.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(encoded); i++ {
+			if err := codec.Unmarshal(encoded[:i], msg.dynamicType.NewDynamicMessage()); err == nil {
+				t.Fatalf("%s: expected an error decoding %d of %d bytes", name, i, len(encoded))
+			}
+		}
+	}
+}
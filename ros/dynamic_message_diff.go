@@ -0,0 +1,341 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"strings"
+
+	"github.com/asimovsecurity/rosgo/libgengo"
+	"github.com/pkg/errors"
+)
+
+// DEFINE PUBLIC STRUCTURES.
+
+// MessageTypeDifferenceKind says how two message types differ.
+type MessageTypeDifferenceKind int
+
+// MessageTypeDifference is one way in which two message types differ, as found by DiffMessageTypes.
+type MessageTypeDifference struct {
+	Kind MessageTypeDifferenceKind
+	Path string // The field or constant; those of nested messages follow the path of their field and a dot, as in pose.position.x.
+	A    string // The declaration in the first message type, as written in a message definition; empty if there is none.
+	B    string // The declaration in the second message type.
+}
+
+// DEFINE PUBLIC GLOBALS.
+
+const (
+	MessageTypeRenamed MessageTypeDifferenceKind = iota // The message types have different names; A and B are the names.
+	FieldAdded                                          // The field is only in the second message type.
+	FieldRemoved                                        // The field is only in the first message type.
+	FieldRetyped                                        // The field has a different type, or array length.
+	FieldMoved                                          // The field is in a different place relative to the other fields.
+	ConstantAdded                                       // The constant is only in the second message type.
+	ConstantRemoved                                     // The constant is only in the first message type.
+	ConstantChanged                                     // The constant has a different type or value.
+)
+
+// DEFINE PUBLIC STATIC FUNCTIONS.
+
+// NewDynamicMessageTypeFromDefinition creates a DynamicMessageType from a message definition, as sent in the message_definition field of a connection
+// header.  A full definition holds the definitions of the messages the message uses too, each following a line of '=' and a line naming it, as in
+// "MSG: std_msgs/Header"; messages it doesn't define are looked up in our ROS install.
+func NewDynamicMessageTypeFromDefinition(typeName string, definition string) (*DynamicMessageType, error) {
+	if typeName == "Header" {
+		typeName = "std_msgs/Header"
+	}
+	texts := map[string]string{}
+	name, lines := typeName, []string{}
+	for _, line := range strings.Split(definition, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "=====") {
+			texts[name], name, lines = strings.Join(lines, "\n"), "", nil
+			continue
+		}
+		if name == "" && strings.HasPrefix(strings.TrimSpace(line), "MSG:") {
+			name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "MSG:"))
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if name == "" {
+		return nil, errors.New("message definition ends with a separator")
+	}
+	texts[name] = strings.Join(lines, "\n")
+
+	ctx, err := libgengo.NewPkgContext(nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadMessageDefinition(ctx, typeName, texts, map[string]struct{}{}); err != nil {
+		return nil, errors.Wrap(err, "type: "+typeName)
+	}
+	return newDynamicMessageTypeInContext(ctx, typeName, "", nil, nil)
+}
+
+// NewDynamicMessageTypeFromHeader creates a DynamicMessageType from the type and message_definition fields of a connection header, as passed to subscriber
+// callbacks in MessageEvent.ConnectionHeader, and checks it against the header's MD5 sum.
+func NewDynamicMessageTypeFromHeader(header map[string]string) (*DynamicMessageType, error) {
+	if header["type"] == "" || header["type"] == "*" || header["message_definition"] == "" {
+		return nil, errors.New("connection header has no message definition")
+	}
+	t, err := NewDynamicMessageTypeFromDefinition(header["type"], header["message_definition"])
+	if err != nil {
+		return nil, err
+	}
+	if md5sum := header["md5sum"]; md5sum != "" && md5sum != "*" && md5sum != t.MD5Sum() {
+		return nil, errors.New("message definition of " + t.Name() + " has MD5 sum " + t.MD5Sum() + ", not " + md5sum)
+	}
+	return t, nil
+}
+
+// DiffMessageTypes lists the differences between two message types, including those between the messages they use; it returns nil if they are the same.
+// Fields and constants are matched up by name, so a renamed field is reported as one field removed and another added.
+func DiffMessageTypes(a *DynamicMessageType, b *DynamicMessageType) []MessageTypeDifference {
+	var differences []MessageTypeDifference
+	if a.Name() != b.Name() {
+		differences = append(differences, MessageTypeDifference{Kind: MessageTypeRenamed, A: a.Name(), B: b.Name()})
+	}
+	return diffMessageTypes(a, b, "", differences)
+}
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	DynamicMessageType
+
+// Outline returns the constants and fields of the message type, one to a line, with the fields of nested messages indented beneath their field, as rosmsg
+// show prints them.
+func (t *DynamicMessageType) Outline() string {
+	var b strings.Builder
+	t.writeOutline(&b, "")
+	return b.String()
+}
+
+//	MessageTypeDifferenceKind
+
+// String returns the kind of difference in words, such as "field added".
+func (k MessageTypeDifferenceKind) String() string {
+	switch k {
+	case MessageTypeRenamed:
+		return "message type renamed"
+	case FieldAdded:
+		return "field added"
+	case FieldRemoved:
+		return "field removed"
+	case FieldRetyped:
+		return "field retyped"
+	case FieldMoved:
+		return "field moved"
+	case ConstantAdded:
+		return "constant added"
+	case ConstantRemoved:
+		return "constant removed"
+	case ConstantChanged:
+		return "constant changed"
+	}
+	return "unknown difference"
+}
+
+//	MessageTypeDifference
+
+// String describes the difference on one line, as in "field retyped: x: float32 x -> float64 x".
+func (d MessageTypeDifference) String() string {
+	s := d.Kind.String()
+	if d.Path != "" {
+		s += ": " + d.Path
+	}
+	switch {
+	case d.A != "" && d.B != "":
+		s += ": " + d.A + " -> " + d.B
+	case d.A != "":
+		s += ": " + d.A
+	case d.B != "":
+		s += ": " + d.B
+	}
+	return s
+}
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+// loadMessageDefinition loads the definition of a message, and of the messages it uses, into ctx.  Messages are taken from texts if they are there, and
+// from our ROS install otherwise.  The messages a message uses are loaded before it, since its MD5 sum depends on theirs.
+func loadMessageDefinition(ctx *libgengo.PkgContext, fullname string, texts map[string]string, loading map[string]struct{}) error {
+	if _, ok := ctx.GetMsgs()[fullname]; ok {
+		return nil
+	}
+	if _, ok := loading[fullname]; ok {
+		return errors.New("message is recursive: " + fullname)
+	}
+	loading[fullname] = struct{}{}
+	defer delete(loading, fullname)
+
+	text, ok := texts[fullname]
+	if !ok {
+		runtimeContext, err := getRuntimeContext()
+		if err != nil {
+			return err
+		}
+		spec, err := runtimeContext.LoadMsg(fullname)
+		if err != nil {
+			return err
+		}
+		text = spec.Text
+	}
+
+	// Parse the definition once to find the messages it uses, then again once they're loaded, to get the right MD5 sum.
+	spec, err := ctx.LoadMsgFromString(text, fullname)
+	if err != nil {
+		return err
+	}
+	for _, field := range spec.Fields {
+		if !field.IsBuiltin {
+			if err := loadMessageDefinition(ctx, field.Package+"/"+field.Type, texts, loading); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = ctx.LoadMsgFromString(text, fullname)
+	return err
+}
+
+// diffMessageTypes appends the differences between the fields and constants of two message types to differences.
+func diffMessageTypes(a *DynamicMessageType, b *DynamicMessageType, prefix string, differences []MessageTypeDifference) []MessageTypeDifference {
+	var aSpec, bSpec libgengo.MsgSpec
+	if a.spec != nil {
+		aSpec = *a.spec
+	}
+	if b.spec != nil {
+		bSpec = *b.spec
+	}
+
+	// Constants first, as they come first in the MD5 sum.
+	bConstants := make(map[string]libgengo.Constant, len(bSpec.Constants))
+	for _, constant := range bSpec.Constants {
+		bConstants[constant.Name] = constant
+	}
+	aConstants := make(map[string]struct{}, len(aSpec.Constants))
+	for _, constant := range aSpec.Constants {
+		aConstants[constant.Name] = struct{}{}
+		other, ok := bConstants[constant.Name]
+		switch {
+		case !ok:
+			differences = append(differences, MessageTypeDifference{Kind: ConstantRemoved, Path: prefix + constant.Name, A: constantDeclaration(constant)})
+		case constantDeclaration(other) != constantDeclaration(constant):
+			differences = append(differences, MessageTypeDifference{Kind: ConstantChanged, Path: prefix + constant.Name, A: constantDeclaration(constant), B: constantDeclaration(other)})
+		}
+	}
+	for _, constant := range bSpec.Constants {
+		if _, ok := aConstants[constant.Name]; !ok {
+			differences = append(differences, MessageTypeDifference{Kind: ConstantAdded, Path: prefix + constant.Name, B: constantDeclaration(constant)})
+		}
+	}
+
+	// Fields in both types are compared, and should be in the same order relative to each other.
+	bFields := make(map[string]*libgengo.Field, len(bSpec.Fields))
+	var bOrder []string
+	for i := range bSpec.Fields {
+		bFields[bSpec.Fields[i].Name] = &bSpec.Fields[i]
+	}
+	aFields := make(map[string]struct{}, len(aSpec.Fields))
+	for i := range aSpec.Fields {
+		aFields[aSpec.Fields[i].Name] = struct{}{}
+	}
+	for i := range bSpec.Fields {
+		if _, ok := aFields[bSpec.Fields[i].Name]; ok {
+			bOrder = append(bOrder, bSpec.Fields[i].Name)
+		}
+	}
+
+	position := 0
+	for i := range aSpec.Fields {
+		field := &aSpec.Fields[i]
+		other, ok := bFields[field.Name]
+		if !ok {
+			differences = append(differences, MessageTypeDifference{Kind: FieldRemoved, Path: prefix + field.Name, A: fieldDeclaration(field)})
+			continue
+		}
+		if bOrder[position] != field.Name {
+			differences = append(differences, MessageTypeDifference{Kind: FieldMoved, Path: prefix + field.Name})
+		}
+		position++
+		if fieldDeclaration(field) != fieldDeclaration(other) {
+			differences = append(differences, MessageTypeDifference{Kind: FieldRetyped, Path: prefix + field.Name, A: fieldDeclaration(field), B: fieldDeclaration(other)})
+		}
+
+		// Look into messages of the same name, in case they've changed.
+		if !field.IsBuiltin && !other.IsBuiltin && field.Package == other.Package && field.Type == other.Type {
+			aNested, aErr := a.getNestedTypeFromField(field)
+			bNested, bErr := b.getNestedTypeFromField(other)
+			if aErr == nil && bErr == nil && aNested.MD5Sum() != bNested.MD5Sum() {
+				differences = diffMessageTypes(aNested, bNested, prefix+field.Name+".", differences)
+			}
+		}
+	}
+	for i := range bSpec.Fields {
+		if _, ok := aFields[bSpec.Fields[i].Name]; !ok {
+			differences = append(differences, MessageTypeDifference{Kind: FieldAdded, Path: prefix + bSpec.Fields[i].Name, B: fieldDeclaration(&bSpec.Fields[i])})
+		}
+	}
+
+	// All done.
+	return differences
+}
+
+// fieldDeclaration returns the declaration of a field, naming nested messages in full.
+func fieldDeclaration(field *libgengo.Field) string {
+	if field.IsBuiltin {
+		return field.String()
+	}
+	return field.Package + "/" + field.String()
+}
+
+// constantDeclaration returns the declaration of a constant.
+func constantDeclaration(constant libgengo.Constant) string {
+	return constant.Type + " " + constant.Name + "=" + constant.ValueText
+}
+
+// describeMessageTypeMismatch lists the differences between the message type we have and the one a peer sent in its connection header, for logging
+// when their MD5 sums don't match.  It returns nil if either definition can't be understood.
+func describeMessageTypeMismatch(localName string, localDefinition string, remoteName string, remoteDefinition string) []string {
+	if localDefinition == "" || remoteDefinition == "" {
+		return nil
+	}
+	local, err := NewDynamicMessageTypeFromDefinition(localName, localDefinition)
+	if err != nil {
+		return nil
+	}
+	remote, err := NewDynamicMessageTypeFromDefinition(remoteName, remoteDefinition)
+	if err != nil {
+		return nil
+	}
+	differences := DiffMessageTypes(local, remote)
+	descriptions := make([]string, len(differences))
+	for i, difference := range differences {
+		descriptions[i] = difference.String()
+	}
+	return descriptions
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	DynamicMessageType
+
+// writeOutline writes the outline of the message type, indenting each line.
+func (t *DynamicMessageType) writeOutline(b *strings.Builder, indent string) {
+	if t.spec == nil {
+		return
+	}
+	for _, constant := range t.spec.Constants {
+		b.WriteString(indent + constantDeclaration(constant) + "\n")
+	}
+	for i := range t.spec.Fields {
+		field := &t.spec.Fields[i]
+		b.WriteString(indent + fieldDeclaration(field) + "\n")
+		if !field.IsBuiltin {
+			if nested, err := t.getNestedTypeFromField(field); err == nil {
+				nested.writeOutline(b, indent+"  ")
+			}
+		}
+	}
+}
+
+// ALL DONE.
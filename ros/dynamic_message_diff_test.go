@@ -0,0 +1,110 @@
+package ros
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pointStampedDefinition is the full definition of geometry_msgs/PointStamped, as roscpp sends it.
+var pointStampedDefinition = strings.Join([]string{
+	"# This represents a Point with reference coordinate frame and timestamp",
+	"Header header",
+	"Point point",
+	"",
+	"================================================================================",
+	"MSG: std_msgs/Header",
+	"# Standard metadata for higher-level stamped data types.",
+	"uint32 seq",
+	"time stamp",
+	"string frame_id",
+	"",
+	"================================================================================",
+	"MSG: geometry_msgs/Point",
+	"# This contains the position of a point in free space",
+	"float64 x",
+	"float64 y",
+	"float64 z",
+}, "\n")
+
+func TestNewDynamicMessageTypeFromDefinition(t *testing.T) {
+	msgType, err := NewDynamicMessageTypeFromDefinition("geometry_msgs/PointStamped", pointStampedDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType.MD5Sum() != "c63aecb41bfdfd6b7e1fac37c7cbe7bf" {
+		t.Fatalf("unexpected MD5 sum %s", msgType.MD5Sum())
+	}
+	msg := msgType.NewDynamicMessage()
+	if _, ok := msg.Data()["point"].(*DynamicMessage); !ok {
+		t.Fatalf("unexpected data %v", msg.Data())
+	}
+
+	expected := "std_msgs/Header header\n  uint32 seq\n  time stamp\n  string frame_id\ngeometry_msgs/Point point\n  float64 x\n  float64 y\n  float64 z\n"
+	if outline := msgType.Outline(); outline != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, outline)
+	}
+
+	if _, err := NewDynamicMessageTypeFromDefinition("Testing/Bad", "float64 x\n==========\n"); err == nil {
+		t.Fatalf("expected an error for a definition ending with a separator")
+	}
+}
+
+func TestDiffMessageTypes(t *testing.T) {
+	a, err := NewDynamicMessageTypeFromDefinition("Testing/Widget", strings.Join([]string{
+		"uint8 MODE_OFF=0",
+		"uint8 MODE_ON=1",
+		"uint8 mode",
+		"float32 x",
+		"float64 y",
+		"int32 z",
+		"Inner inner",
+		"==========",
+		"MSG: Testing/Inner",
+		"float64 value",
+	}, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewDynamicMessageTypeFromDefinition("Testing/Widget", strings.Join([]string{
+		"uint8 MODE_ON=2",
+		"uint8 MODE_AUTO=3",
+		"uint8 mode",
+		"float64 y",
+		"float64 x",
+		"Inner inner",
+		"string name",
+		"==========",
+		"MSG: Testing/Inner",
+		"float64[2] value",
+	}, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var descriptions []string
+	for _, difference := range DiffMessageTypes(a, b) {
+		descriptions = append(descriptions, difference.String())
+	}
+	expected := []string{
+		"constant removed: MODE_OFF: uint8 MODE_OFF=0",
+		"constant changed: MODE_ON: uint8 MODE_ON=1 -> uint8 MODE_ON=2",
+		"constant added: MODE_AUTO: uint8 MODE_AUTO=3",
+		"field moved: x",
+		"field retyped: x: float32 x -> float64 x",
+		"field moved: y",
+		"field removed: z: int32 z",
+		"field retyped: inner.value: float64 value -> float64[2] value",
+		"field added: name: string name",
+	}
+	if !reflect.DeepEqual(descriptions, expected) {
+		t.Fatalf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(descriptions, "\n"))
+	}
+
+	if differences := DiffMessageTypes(a, a); differences != nil {
+		t.Fatalf("expected no differences, got %v", differences)
+	}
+	if differences := DiffMessageTypes(a, b.nested["Testing/Inner"]); len(differences) == 0 || differences[0].Kind != MessageTypeRenamed {
+		t.Fatalf("expected the message types to be renamed, got %v", differences)
+	}
+}
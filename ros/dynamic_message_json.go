@@ -4,8 +4,6 @@ package ros
 
 import (
 	"encoding/base64"
-	"encoding/json"
-	"math"
 	"reflect"
 	"strconv"
 
@@ -28,161 +26,11 @@ import (
 
 //	DynamicMessageType
 
-// GenerateJSONSchema generates a (primitive) JSON schema for the associated DynamicMessageType; however note that since
+// GenerateJSONSchema generates a (draft-07) JSON schema for the associated DynamicMessageType; however note that since
 // we are mostly interested in making schema's for particular _topics_, the function takes a string prefix, and string topic name, which are
-// used to id the resulting schema.
+// used to id the resulting schema.  See GenerateJSONSchemaWithOptions for what the schema holds.
 func (t *DynamicMessageType) GenerateJSONSchema(prefix string, topic string) ([]byte, error) {
-	// The JSON schema for a message consist of the (recursive) properties names/types:
-	schemaItems, err := t.generateJSONSchemaProperties(prefix + topic)
-	if err != nil {
-		return nil, err
-	}
-
-	// Plus some extra keywords:
-	schemaItems["$schema"] = "https://json-schema.org/draft-07/schema#"
-	schemaItems["$id"] = prefix + topic
-
-	// The schema itself is created from the map of properties.
-	schemaString, err := json.Marshal(schemaItems)
-	if err != nil {
-		return nil, err
-	}
-
-	// All done.
-	return schemaString, nil
-}
-
-func (t *DynamicMessageType) generateJSONSchemaProperties(topic string) (map[string]interface{}, error) {
-	// Each message's schema indicates that it is an 'object' with some nested properties: those properties are the fields and their types.
-	properties := make(map[string]interface{})
-	schemaItems := make(map[string]interface{})
-	schemaItems["type"] = "object"
-	schemaItems["properties"] = properties
-
-	// Iterate over each of the fields in the message.
-	for _, field := range t.spec.Fields {
-		if field.IsArray {
-			// It's an array.
-			propertyContent := make(map[string]interface{})
-			properties[field.Name] = propertyContent
-
-			if field.GoType == "uint8" {
-				propertyContent["type"] = "string"
-			} else {
-				// Arrays all have a type of 'array', regardless of that the hold, then the 'item' keyword determines what type goes in the array.
-				propertyContent["type"] = "array"
-				arrayItems := make(map[string]interface{})
-				propertyContent["items"] = arrayItems
-
-				// Need to handle each type appropriately.
-				if field.IsBuiltin {
-					if field.Type == "string" {
-						arrayItems["type"] = "string"
-					} else if field.Type == "time" {
-						timeItems := make(map[string]interface{})
-						timeItems["sec"] = map[string]string{"type": "integer"}
-						timeItems["nsec"] = map[string]string{"type": "integer"}
-						arrayItems["type"] = "object"
-						arrayItems["properties"] = timeItems
-					} else if field.Type == "duration" {
-						timeItems := make(map[string]interface{})
-						timeItems["sec"] = map[string]string{"type": "integer"}
-						timeItems["nsec"] = map[string]string{"type": "integer"}
-						arrayItems["type"] = "object"
-						arrayItems["properties"] = timeItems
-					} else {
-						// It's a primitive.
-						var jsonType string
-						if field.GoType == "int8" || field.GoType == "int16" || field.GoType == "uint16" ||
-							field.GoType == "int32" || field.GoType == "uint32" || field.GoType == "int64" || field.GoType == "uint64" {
-							jsonType = "integer"
-						} else if field.GoType == "float32" || field.GoType == "float64" {
-							jsonType = "number"
-						} else if field.GoType == "bool" {
-							jsonType = "boolean"
-						} else {
-							// Something went wrong.
-							return nil, errors.New("we haven't implemented this primitive yet")
-						}
-						arrayItems["type"] = jsonType
-					}
-
-				} else {
-					// It's another nested message.
-
-					// Generate the nested type.
-					msgType, err := newDynamicMessageTypeNested(field.Type, field.Package, nil, nil)
-					if err != nil {
-						return nil, errors.Wrap(err, "Schema Field: "+field.Name)
-					}
-
-					// Recursively generate schema information for the nested type.
-					schemaElement, err := msgType.generateJSONSchemaProperties(topic + Sep + field.Name)
-					if err != nil {
-						return nil, errors.Wrap(err, "Schema Field:"+field.Name)
-					}
-					arrayItems["type"] = schemaElement
-				}
-			}
-		} else {
-			// It's a scalar.
-			if field.IsBuiltin {
-				propertyContent := make(map[string]interface{})
-				properties[field.Name] = propertyContent
-
-				if field.Type == "string" {
-					propertyContent["type"] = "string"
-				} else if field.Type == "time" {
-					timeItems := make(map[string]interface{})
-					timeItems["sec"] = map[string]string{"type": "integer"}
-					timeItems["nsec"] = map[string]string{"type": "integer"}
-					propertyContent["type"] = "object"
-					propertyContent["properties"] = timeItems
-				} else if field.Type == "duration" {
-					timeItems := make(map[string]interface{})
-					timeItems["sec"] = map[string]string{"type": "integer"}
-					timeItems["nsec"] = map[string]string{"type": "integer"}
-					propertyContent["type"] = "object"
-					propertyContent["properties"] = timeItems
-				} else {
-					// It's a primitive.
-					var jsonType string
-					if field.GoType == "int8" || field.GoType == "uint8" || field.GoType == "int16" || field.GoType == "uint16" ||
-						field.GoType == "int32" || field.GoType == "uint32" || field.GoType == "int64" || field.GoType == "uint64" {
-						jsonType = "integer"
-						jsonType = "integer"
-						jsonType = "integer"
-					} else if field.GoType == "float32" || field.GoType == "float64" {
-						jsonType = "number"
-					} else if field.GoType == "bool" {
-						jsonType = "boolean"
-					} else {
-						// Something went wrong.
-						return nil, errors.New("we haven't implemented this primitive yet")
-					}
-					propertyContent["type"] = jsonType
-				}
-			} else {
-				// It's another nested message.
-
-				// Generate the nested type.
-				msgType, err := newDynamicMessageTypeNested(field.Type, field.Package, nil, nil)
-				if err != nil {
-					return nil, errors.Wrap(err, "Schema Field: "+field.Name)
-				}
-
-				// Recursively generate schema information for the nested type.
-				schemaElement, err := msgType.generateJSONSchemaProperties(topic + Sep + field.Name)
-				if err != nil {
-					return nil, errors.Wrap(err, "Schema Field:"+field.Name)
-				}
-				properties[field.Name] = schemaElement
-			}
-		}
-	}
-
-	// All done.
-	return schemaItems, nil
+	return t.GenerateJSONSchemaWithOptions(prefix, topic, JSONOptions{})
 }
 
 //	DynamicMessage
@@ -195,40 +43,8 @@ func (m *DynamicMessage) MarshalJSON() ([]byte, error) {
 		return nil, err
 	}
 
-	buf := make([]byte, 0, m.dynamicType.jsonPrealloc)
-
-	buf = append(buf, byte('{'))
-	for i, field := range m.dynamicType.spec.Fields {
-		// Marshal the JSON name key.
-		if i > 0 {
-			buf = append(buf, byte(','))
-		}
-		buf = strconv.AppendQuote(buf, field.Name)
-		buf = append(buf, byte(':'))
-
-		// Marshal the value.
-		v, ok := m.data[field.Name]
-		if !ok {
-			return nil, errors.Wrap(errors.New("key not in data"), "key: "+field.Name)
-		}
-		var err error
-		if field.IsArray {
-			err = marshalArrayValue(&field, v, &buf)
-		} else {
-			err = marshalSingularValue(&field, v, &buf)
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "field: "+field.Name)
-		}
-	}
-
-	buf = append(buf, byte('}'))
-
-	if length := len(buf); length > m.dynamicType.jsonPrealloc {
-		m.dynamicType.jsonPrealloc = length
-	}
-
-	return buf, nil
+	// Every codec walks messages the same way, so the JSON written here can't drift from what they write.
+	return m.marshalJSON(JSONOptions{})
 }
 
 // UnmarshalJSON provides a custom implementation of JSON unmarshalling. Verification provided in dynamic_message_json_test.go.
@@ -344,18 +160,6 @@ func messagePointerError(m *DynamicMessage) error {
 
 // Marshalling Helpers.
 
-func marshalFloat(f float64, buf *[]byte, bits int) {
-	if math.IsNaN(f) {
-		*buf = strconv.AppendQuote(*buf, "nan")
-	} else if math.IsInf(f, 1) {
-		*buf = strconv.AppendQuote(*buf, "+inf")
-	} else if math.IsInf(f, -1) {
-		*buf = strconv.AppendQuote(*buf, "-inf")
-	} else {
-		*buf = strconv.AppendFloat(*buf, f, byte('g'), -1, bits)
-	}
-}
-
 func marshalSecNSec(sec uint64, nsec uint64, buf *[]byte) {
 	*buf = append(*buf, []byte("{\"sec\":")...)
 	*buf = strconv.AppendUint(*buf, sec, 10)
@@ -364,326 +168,10 @@ func marshalSecNSec(sec uint64, nsec uint64, buf *[]byte) {
 	*buf = append(*buf, byte('}'))
 }
 
-func marshalArrayUint8(v interface{}, buf *[]byte) error {
-	slice, ok := v.([]uint8)
-	if ok == false {
-		return newTypeError(v, "[]uint8")
-	}
-	*buf = append(*buf, byte('"'))
-	encodedLen := base64.StdEncoding.EncodedLen(len(slice))
-	if (cap(*buf) - len(*buf)) > encodedLen {
-		dst := (*buf)[len(*buf) : len(*buf)+encodedLen]
-		base64.StdEncoding.Encode(dst, slice)
-		*buf = (*buf)[:len(*buf)+encodedLen]
-	} else {
-		dst := make([]byte, encodedLen)
-		base64.StdEncoding.Encode(dst, slice)
-		*buf = append(*buf, dst...)
-	}
-	*buf = append(*buf, byte('"'))
-	return nil
-}
-
 func newTypeError(v interface{}, expected string) error {
 	return errors.New("has type " + reflect.TypeOf(v).Name() + ", expected " + expected)
 }
 
-func marshalArrayValue(field *libgengo.Field, v interface{}, buf *[]byte) error {
-	if field.BuiltInType == libgengo.Uint8 { // Special case, is marshalled as base64.
-		return marshalArrayUint8(v, buf)
-	}
-
-	*buf = append(*buf, byte('['))
-	if field.IsBuiltin == false {
-		// The type encapsulates an array of ROS messages, so we marshal the DynamicMessages.
-		if nestedArray, ok := v.([]Message); ok {
-			for i, nested := range nestedArray {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				nestedDynamicMessage, ok := nested.(*DynamicMessage)
-				if ok == false {
-					return newTypeError(nested, "DynamicMessage")
-				}
-
-				nestedbuf, err := nestedDynamicMessage.MarshalJSON()
-				if err != nil {
-					return err
-				}
-				*buf = append(*buf, nestedbuf...)
-			}
-		} else {
-			return newTypeError(v, "[]Message")
-		}
-	} else {
-		switch field.BuiltInType {
-		case libgengo.Bool:
-			slice, ok := v.([]bool)
-			if ok == false {
-				return newTypeError(v, "[]bool")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				if item == true {
-					*buf = append(*buf, []byte("true")...)
-				} else {
-					*buf = append(*buf, []byte("false")...)
-				}
-			}
-		case libgengo.Int8:
-			slice, ok := v.([]int8)
-			if ok == false {
-				return newTypeError(v, "[]int8")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				*buf = strconv.AppendInt(*buf, int64(item), 10)
-			}
-		case libgengo.Int16:
-			slice, ok := v.([]int16)
-			if ok == false {
-				return newTypeError(v, "[]int16")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				*buf = strconv.AppendInt(*buf, int64(item), 10)
-			}
-		case libgengo.Int32:
-			slice, ok := v.([]int32)
-			if ok == false {
-				return newTypeError(v, "[]int32")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				*buf = strconv.AppendInt(*buf, int64(item), 10)
-			}
-		case libgengo.Int64:
-			slice, ok := v.([]int64)
-			if ok == false {
-				return newTypeError(v, "[]int64")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				*buf = strconv.AppendInt(*buf, item, 10)
-			}
-		case libgengo.Uint16:
-			slice, ok := v.([]uint16)
-			if ok == false {
-				return newTypeError(v, "[]uint16")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				*buf = strconv.AppendUint(*buf, uint64(item), 10)
-			}
-		case libgengo.Uint32:
-			slice, ok := v.([]uint32)
-			if ok == false {
-				return newTypeError(v, "[]uint32")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				*buf = strconv.AppendUint(*buf, uint64(item), 10)
-			}
-		case libgengo.Uint64:
-			slice, ok := v.([]uint64)
-			if ok == false {
-				return newTypeError(v, "[]uint64")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				*buf = strconv.AppendUint(*buf, item, 10)
-			}
-		case libgengo.Float32:
-			slice, ok := v.([]JsonFloat32)
-			if ok == false {
-				return newTypeError(v, "[]JsonFloat32")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				marshalFloat(float64(item.F), &*buf, 32)
-			}
-		case libgengo.Float64:
-			slice, ok := v.([]JsonFloat64)
-			if ok == false {
-				return newTypeError(v, "[]JsonFloat64")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				marshalFloat(item.F, &*buf, 64)
-			}
-		case libgengo.String:
-			slice, ok := v.([]string)
-			if ok == false {
-				return newTypeError(v, "[]string")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				*buf = strconv.AppendQuote(*buf, item)
-			}
-		case libgengo.Time:
-			slice, ok := v.([]Time)
-			if ok == false {
-				return newTypeError(v, "[]Time")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				marshalSecNSec(uint64(item.Sec), uint64(item.NSec), &*buf)
-			}
-		case libgengo.Duration:
-			slice, ok := v.([]Duration)
-			if ok == false {
-				return newTypeError(v, "[]Duration")
-			}
-			for i, item := range slice {
-				if i > 0 {
-					*buf = append(*buf, byte(','))
-				}
-				marshalSecNSec(uint64(item.Sec), uint64(item.NSec), &*buf)
-			}
-		default:
-			// Something went wrong.
-			return errors.New("unknown builtin type" + field.GoType)
-		}
-	}
-	// Success.
-	*buf = append(*buf, byte(']'))
-	return nil
-}
-
-func marshalSingularValue(field *libgengo.Field, v interface{}, buf *[]byte) error {
-	if field.IsBuiltin == false {
-		// The type encapsulates another ROS message, so we marshal the DynamicMessage.
-		if nested, ok := v.(*DynamicMessage); ok {
-			nestedBuf, err := nested.MarshalJSON()
-			if err != nil {
-				return err
-			}
-			*buf = append(*buf, nestedBuf...)
-		} else {
-			return newTypeError(v, "DynamicMessage")
-		}
-		return nil
-	}
-	switch field.BuiltInType {
-	case libgengo.Bool:
-		value, ok := v.(bool)
-		if ok == false {
-			return newTypeError(v, "int8")
-		}
-		if value {
-			*buf = append(*buf, []byte("true")...)
-		} else {
-			*buf = append(*buf, []byte("false")...)
-		}
-	case libgengo.Int8:
-		value, ok := v.(int8)
-		if ok == false {
-			return newTypeError(v, "int8")
-		}
-		*buf = strconv.AppendInt(*buf, int64(value), 10)
-	case libgengo.Int16:
-		value, ok := v.(int16)
-		if ok == false {
-			return newTypeError(v, "int16")
-		}
-		*buf = strconv.AppendInt(*buf, int64(value), 10)
-	case libgengo.Int32:
-		value, ok := v.(int32)
-		if ok == false {
-			return newTypeError(v, "int32")
-		}
-		*buf = strconv.AppendInt(*buf, int64(value), 10)
-	case libgengo.Int64:
-		value, ok := v.(int64)
-		if ok == false {
-			return newTypeError(v, "int32")
-		}
-		*buf = strconv.AppendInt(*buf, value, 10)
-	case libgengo.Uint8:
-		value, ok := v.(uint8)
-		if ok == false {
-			return newTypeError(v, "uint8")
-		}
-		*buf = strconv.AppendInt(*buf, int64(value), 10)
-	case libgengo.Uint16:
-		value, ok := v.(uint16)
-		if ok == false {
-			return newTypeError(v, "uint16")
-		}
-		*buf = strconv.AppendInt(*buf, int64(value), 10)
-	case libgengo.Uint32:
-		value, ok := v.(uint32)
-		if ok == false {
-			return newTypeError(v, "uint32")
-		}
-		*buf = strconv.AppendInt(*buf, int64(value), 10)
-	case libgengo.Uint64:
-		value, ok := v.(uint64)
-		if ok == false {
-			return newTypeError(v, "uint64")
-		}
-		*buf = strconv.AppendInt(*buf, int64(value), 10)
-	case libgengo.Float32:
-		value, ok := v.(JsonFloat32)
-		if ok == false {
-			return newTypeError(v, "JsonFloat32")
-		}
-		marshalFloat(float64(value.F), &*buf, 32)
-	case libgengo.Float64:
-		value, ok := v.(JsonFloat64)
-		if ok == false {
-			return newTypeError(v, "JsonFloat64")
-		}
-		marshalFloat(value.F, &*buf, 64)
-	case libgengo.String:
-		value, ok := v.(string)
-		if ok == false {
-			return newTypeError(v, "string")
-		}
-		*buf = strconv.AppendQuote(*buf, value)
-	case libgengo.Time:
-		value, ok := v.(Time)
-		if ok == false {
-			return newTypeError(v, "Time")
-		}
-		marshalSecNSec(uint64(value.Sec), uint64(value.NSec), &*buf)
-	case libgengo.Duration:
-		value, ok := v.(Duration)
-		if ok == false {
-			return newTypeError(v, "Duration")
-		}
-		marshalSecNSec(uint64(value.Sec), uint64(value.NSec), &*buf)
-	default:
-		// Something went wrong.
-		return errors.New("unknown builtin type " + field.GoType)
-	}
-	return nil
-}
-
 // Unmarshalling Helpers.
 
 func unmarshalSecNSecObject(marshalled []byte) (sec uint32, nsec uint32, err error) {
@@ -758,6 +246,15 @@ func unmarshalNumber(value []byte, field *libgengo.Field, dest *interface{}) err
 	var intValue int64
 	var floatValue float64
 	var err error
+	if field.BuiltInType == libgengo.Uint64 {
+		// Values above math.MaxInt64 don't fit an int64.
+		uintValue, err := strconv.ParseUint(string(value), 10, 64)
+		if err != nil {
+			return err
+		}
+		*dest = uintValue
+		return nil
+	}
 	//We have a float to parse
 	if field.BuiltInType == libgengo.Float64 || field.BuiltInType == libgengo.Float32 {
 		floatValue, err = strconv.ParseFloat(string(value), 64)
@@ -0,0 +1,599 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/asimovsecurity/rosgo/libgengo"
+	"github.com/pkg/errors"
+)
+
+// DEFINE PUBLIC STRUCTURES.
+
+// JSONTimeFormat selects how MarshalJSONWithOptions writes times and durations.
+type JSONTimeFormat int
+
+// JSONFieldNames selects how MarshalJSONWithOptions writes field names.
+type JSONFieldNames int
+
+// JSONSchemaDraft selects the version of JSON Schema GenerateJSONSchemaWithOptions follows.
+type JSONSchemaDraft int
+
+// JSONOptions changes the conventions followed by MarshalJSON; the zero value follows them exactly.  UnmarshalJSONWithOptions accepts times in any
+// format, byte arrays either way, null floats and constant names whatever the options are, so only FieldNames has to match the JSON being decoded.
+type JSONOptions struct {
+	TimeFormat          JSONTimeFormat  // How times and durations are written.
+	ByteArraysAsNumbers bool            // Write uint8 arrays as arrays of numbers, rather than as base64 strings.
+	NaNAsNull           bool            // Write NaN as null, rather than "nan".  Infinities are still written as "+inf" and "-inf".
+	FloatPrecision      int             // Significant digits to write floats with; zero writes as many as it takes to read them back exactly.
+	FieldNames          JSONFieldNames  // How field names are written.
+	EnumNames           bool            // Write integer fields with constants as the name of the constant they equal; see EnumConstants.
+	SchemaDraft         JSONSchemaDraft // The JSON Schema draft GenerateJSONSchemaWithOptions follows; marshalling ignores it.
+}
+
+// DEFINE PRIVATE STRUCTURES.
+
+// jsonEncoder writes JSON for encodeDynamicFields, following a set of JSONOptions.
+type jsonEncoder struct {
+	buf    []byte
+	opts   JSONOptions
+	frames []jsonFrame
+	field  *libgengo.Field     // The field being written.
+	enum   []libgengo.Constant // The constants naming its values, if opts.EnumNames is set.
+}
+
+// jsonFrame is a map or array jsonEncoder is in the middle of writing.
+type jsonFrame struct {
+	array bool
+	count int
+}
+
+// DEFINE PUBLIC GLOBALS.
+
+const (
+	JSONTimeObject  JSONTimeFormat = iota // {"sec":1500000000,"nsec":42}, as MarshalJSON writes them.
+	JSONTimeRFC3339                       // "2017-07-14T02:40:00.000000042Z".  Durations are written as seconds, as for JSONTimeSeconds.
+	JSONTimeSeconds                       // 1500000000.000000042, exactly; readers parsing it as a float64 lose the last digits of nsec.
+)
+
+const (
+	JSONFieldNamesOriginal   JSONFieldNames = iota // frame_id, as in the message definition.
+	JSONFieldNamesCamelCase                        // frameId.
+	JSONFieldNamesPascalCase                       // FrameId.
+)
+
+const (
+	JSONSchemaDraft07     JSONSchemaDraft = iota // https://json-schema.org/draft-07/schema#, with nested messages under "definitions".
+	JSONSchemaDraft202012                        // https://json-schema.org/draft/2020-12/schema, with nested messages under "$defs".
+)
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	DynamicMessageType
+
+// EnumConstants returns the constants naming the values of an integer field, in the order they are declared.  A field takes the constants of its type
+// whose names start with its own name in upper case (STATUS_OK for status); failing that, the only scalar field of the constants' type takes all of them (as
+// the status of actionlib_msgs/GoalStatus does).  Other fields have none.
+func (t *DynamicMessageType) EnumConstants(name string) []libgengo.Constant {
+	field := t.field(name)
+	if field == nil || !field.IsBuiltin {
+		return nil
+	}
+	switch dynamicPrimitives[field.GoType] {
+	case dynamicInt8, dynamicInt16, dynamicInt32, dynamicInt64, dynamicUint8, dynamicUint16, dynamicUint32, dynamicUint64:
+	default:
+		return nil
+	}
+
+	var typed, named []libgengo.Constant
+	prefix := strings.ToUpper(name) + "_"
+	for _, constant := range t.spec.Constants {
+		if libgengo.ToGoType("", constant.Type) != field.GoType {
+			continue
+		}
+		typed = append(typed, constant)
+		if strings.HasPrefix(constant.Name, prefix) {
+			named = append(named, constant)
+		}
+	}
+	if len(named) > 0 {
+		return named
+	}
+	for i := range t.spec.Fields {
+		if other := &t.spec.Fields[i]; other.Name != name && other.IsBuiltin && !other.IsArray && other.GoType == field.GoType {
+			return nil
+		}
+	}
+
+	// All done.
+	return typed
+}
+
+//	DynamicMessage
+
+// MarshalJSONWithOptions marshals the message as MarshalJSON does, but following opts.
+func (m *DynamicMessage) MarshalJSONWithOptions(opts JSONOptions) ([]byte, error) {
+	// Confirm the pointers are valid.
+	if err := messagePointerError(m); err != nil {
+		return nil, err
+	}
+	return m.marshalJSON(opts)
+}
+
+// UnmarshalJSONWithOptions unmarshals JSON written by MarshalJSONWithOptions.  Fields missing from buf are left as they are, and the message is only
+// changed if every field decodes.
+func (m *DynamicMessage) UnmarshalJSONWithOptions(buf []byte, opts JSONOptions) error {
+	// Confirm the pointers are valid.
+	if err := messagePointerError(m); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var object map[string]interface{}
+	if err := dec.Decode(&object); err != nil {
+		return errors.Wrap(err, "json")
+	}
+	if object == nil {
+		return errors.New("json: expected an object")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("json: trailing data after the object")
+	}
+
+	converted, err := m.dynamicType.fromJSONObject("", object, &opts)
+	if err != nil {
+		return err
+	}
+	return m.decodeGeneric("", converted)
+}
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+// appendJSONString writes s as a JSON string.  Unlike strconv.AppendQuote, control characters are written the way JSON spells them.
+func appendJSONString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				buf = append(buf, "\ufffd"...)
+			} else {
+				buf = append(buf, s[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c == '\n':
+			buf = append(buf, '\\', 'n')
+		case c == '\r':
+			buf = append(buf, '\\', 'r')
+		case c == '\t':
+			buf = append(buf, '\\', 't')
+		case c < 0x20:
+			buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+		i++
+	}
+	return append(buf, '"')
+}
+
+// appendJSONSeconds writes a time or duration as an exact decimal number of seconds.  Durations are signed, as their seconds are in ROS.
+func appendJSONSeconds(buf []byte, sec uint32, nsec uint32, duration bool) []byte {
+	var total uint64
+	if duration {
+		signed := int64(int32(sec))*1e9 + int64(nsec)
+		if signed < 0 {
+			buf = append(buf, '-')
+			signed = -signed
+		}
+		total = uint64(signed)
+	} else {
+		total = uint64(sec)*1e9 + uint64(nsec)
+	}
+	buf = strconv.AppendUint(buf, total/1e9, 10)
+	if frac := total % 1e9; frac != 0 {
+		digits := strconv.FormatUint(frac+1e9, 10)[1:]
+		buf = append(buf, '.')
+		buf = append(buf, strings.TrimRight(digits, "0")...)
+	}
+	return buf
+}
+
+// parseJSONSeconds parses a decimal number of seconds, as written by appendJSONSeconds, into seconds and nanoseconds.  Digits beyond nanoseconds are
+// dropped.
+func parseJSONSeconds(s string, duration bool) (uint32, uint32, error) {
+	if strings.ContainsAny(s, "eE") {
+		// Exponents are rare enough to go through a float.
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		s = strconv.FormatFloat(f, 'f', 9, 64)
+	}
+	negative := strings.HasPrefix(s, "-")
+	whole, frac := strings.TrimPrefix(s, "-"), ""
+	if i := strings.IndexByte(whole, '.'); i >= 0 {
+		whole, frac = whole[:i], whole[i+1:]
+	}
+	if len(frac) > 9 {
+		frac = frac[:9]
+	}
+	seconds, err := strconv.ParseUint(whole, 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("invalid number of seconds " + s)
+	}
+	var nanoseconds uint64
+	if frac != "" {
+		if nanoseconds, err = strconv.ParseUint(frac+strings.Repeat("0", 9-len(frac)), 10, 64); err != nil {
+			return 0, 0, errors.New("invalid number of seconds " + s)
+		}
+	}
+
+	if !duration {
+		if negative || seconds > math.MaxUint32 {
+			return 0, 0, errors.New("time out of range: " + s)
+		}
+		return uint32(seconds), uint32(nanoseconds), nil
+	}
+	if seconds > math.MaxInt32+1 {
+		return 0, 0, errors.New("duration out of range: " + s)
+	}
+	total := int64(seconds)*1e9 + int64(nanoseconds)
+	if negative {
+		total = -total
+	}
+	// Nanoseconds are never negative, so negative durations round their seconds down.
+	sec := total / 1e9
+	if total%1e9 < 0 {
+		sec--
+	}
+	if sec < math.MinInt32 || sec > math.MaxInt32 {
+		return 0, 0, errors.New("duration out of range: " + s)
+	}
+	return uint32(int32(sec)), uint32(total - sec*1e9), nil
+}
+
+// fromJSONNumber converts a number decoded by encoding/json to the Go number closest to it: an int64, a uint64 or a float64.
+func fromJSONNumber(n json.Number) interface{} {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return u
+	}
+	if f, err := strconv.ParseFloat(string(n), 64); err == nil {
+		return f
+	}
+	return string(n)
+}
+
+// constantDecimal returns the value of an integer constant in decimal.
+func constantDecimal(constant libgengo.Constant) string {
+	v := reflect.ValueOf(constant.Value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	}
+	return ""
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	DynamicMessage
+
+// marshalJSON writes the message as JSON following opts, with encodeDynamicFields, as the other codecs write it.
+func (m *DynamicMessage) marshalJSON(opts JSONOptions) ([]byte, error) {
+	enc := jsonEncoder{opts: opts, buf: make([]byte, 0, m.dynamicType.jsonPrealloc)}
+	if err := encodeDynamicFields(&enc, m); err != nil {
+		return nil, err
+	}
+	// Messages of a type tend to be about the same size, so the next one starts with room for this one.
+	if length := len(enc.buf); length > m.dynamicType.jsonPrealloc {
+		m.dynamicType.jsonPrealloc = length
+	}
+	return enc.buf, nil
+}
+
+//	JSONOptions
+
+// fieldName returns the name a field is written under.
+func (opts *JSONOptions) fieldName(name string) string {
+	if opts.FieldNames == JSONFieldNamesOriginal {
+		return name
+	}
+	var b strings.Builder
+	upper := opts.FieldNames == JSONFieldNamesPascalCase
+	for _, r := range name {
+		if r == '_' {
+			upper = b.Len() > 0 || opts.FieldNames == JSONFieldNamesPascalCase
+			continue
+		}
+		if upper {
+			r = []rune(strings.ToUpper(string(r)))[0]
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return name
+	}
+	return b.String()
+}
+
+//	DynamicMessageType
+
+// fromJSONObject converts a JSON object decoded by encoding/json into the form decodeGeneric expects, undoing whatever the options did to it.  Keys may
+// be field names as they are, or as opts writes them; unknown keys are passed through for decodeGeneric to report.
+func (t *DynamicMessageType) fromJSONObject(prefix string, object map[string]interface{}, opts *JSONOptions) (map[string]interface{}, error) {
+	converted := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		field := t.field(key)
+		if field == nil {
+			for i := range t.spec.Fields {
+				if opts.fieldName(t.spec.Fields[i].Name) == key {
+					field = &t.spec.Fields[i]
+					break
+				}
+			}
+		}
+		if field == nil {
+			converted[key] = value
+			continue
+		}
+		result, err := t.fromJSONValue(prefix+field.Name, field, value, opts, false)
+		if err != nil {
+			return nil, err
+		}
+		converted[field.Name] = result
+	}
+
+	// All done.
+	return converted, nil
+}
+
+// fromJSONValue converts the value of a field for fromJSONObject.  Array fields are converted whole, unless element is set.
+func (t *DynamicMessageType) fromJSONValue(path string, field *libgengo.Field, value interface{}, opts *JSONOptions, element bool) (interface{}, error) {
+	if n, ok := value.(json.Number); ok && (!field.IsBuiltin || (field.GoType != "ros.Time" && field.GoType != "ros.Duration")) {
+		value = fromJSONNumber(n)
+	}
+
+	if field.IsArray && !element {
+		switch array := value.(type) {
+		case string:
+			if field.GoType == "uint8" {
+				decoded, err := base64.StdEncoding.DecodeString(array)
+				if err != nil {
+					return nil, &FieldTypeError{Path: path, Expected: dynamicFieldTypeName(field), Value: value, Reason: "invalid base64"}
+				}
+				return decoded, nil
+			}
+		case []interface{}:
+			converted := make([]interface{}, len(array))
+			for i, item := range array {
+				var err error
+				if converted[i], err = t.fromJSONValue(path+"["+strconv.Itoa(i)+"]", field, item, opts, true); err != nil {
+					return nil, err
+				}
+			}
+			return converted, nil
+		}
+		return value, nil
+	}
+
+	if !field.IsBuiltin {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return value, nil
+		}
+		nested, err := t.getNestedTypeFromField(field)
+		if err != nil {
+			return nil, errors.Wrap(err, "Field: "+field.Name)
+		}
+		return nested.fromJSONObject(path+".", object, opts)
+	}
+
+	switch prim := dynamicPrimitives[field.GoType]; prim {
+	case dynamicFloat32, dynamicFloat64:
+		if value == nil {
+			return math.NaN(), nil
+		}
+	case dynamicTime, dynamicDuration:
+		var s string
+		switch v := value.(type) {
+		case json.Number:
+			s = string(v)
+		case string:
+			if prim == dynamicTime {
+				if parsed, err := time.Parse(time.RFC3339Nano, v); err == nil {
+					if parsed.Unix() < 0 || parsed.Unix() > math.MaxUint32 {
+						return nil, &FieldTypeError{Path: path, Expected: field.Type, Value: value, Reason: "out of range"}
+					}
+					return NewTime(uint32(parsed.Unix()), uint32(parsed.Nanosecond())), nil
+				}
+			}
+			s = v
+		case map[string]interface{}:
+			object := make(map[string]interface{}, len(v))
+			for k, item := range v {
+				if n, ok := item.(json.Number); ok {
+					item = fromJSONNumber(n)
+				}
+				object[k] = item
+			}
+			return object, nil
+		default:
+			return value, nil
+		}
+		sec, nsec, err := parseJSONSeconds(s, prim == dynamicDuration)
+		if err != nil {
+			return nil, &FieldTypeError{Path: path, Expected: field.Type, Value: value, Reason: err.Error()}
+		}
+		if prim == dynamicTime {
+			return NewTime(sec, nsec), nil
+		}
+		return NewDuration(sec, nsec), nil
+	default:
+		if name, ok := value.(string); ok && prim != dynamicString && prim != dynamicBool {
+			for _, constant := range t.EnumConstants(field.Name) {
+				if constant.Name == name {
+					return constant.Value, nil
+				}
+			}
+		}
+	}
+	return value, nil
+}
+
+//	jsonEncoder
+
+// separate writes the comma before a value in an array, if it needs one.
+func (e *jsonEncoder) separate() {
+	if n := len(e.frames); n > 0 && e.frames[n-1].array {
+		if e.frames[n-1].count > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.frames[n-1].count++
+	}
+}
+
+// setField is called by encodeDynamicFields before each field; required for dynamicFieldEncoder.
+func (e *jsonEncoder) setField(t *DynamicMessageType, field *libgengo.Field) {
+	e.field, e.enum = field, nil
+	if e.opts.EnumNames {
+		e.enum = t.EnumConstants(field.Name)
+	}
+}
+
+func (e *jsonEncoder) beginMap(n int) {
+	e.separate()
+	e.buf = append(e.buf, '{')
+	e.frames = append(e.frames, jsonFrame{})
+}
+
+func (e *jsonEncoder) key(name string) {
+	frame := &e.frames[len(e.frames)-1]
+	if frame.count > 0 {
+		e.buf = append(e.buf, ',')
+	}
+	frame.count++
+	e.buf = appendJSONString(e.buf, e.opts.fieldName(name))
+	e.buf = append(e.buf, ':')
+}
+
+func (e *jsonEncoder) endMap() {
+	e.buf = append(e.buf, '}')
+	e.frames = e.frames[:len(e.frames)-1]
+}
+
+func (e *jsonEncoder) beginArray(n int, scalars bool) {
+	e.separate()
+	e.buf = append(e.buf, '[')
+	e.frames = append(e.frames, jsonFrame{array: true})
+}
+
+func (e *jsonEncoder) endArray() {
+	e.buf = append(e.buf, ']')
+	e.frames = e.frames[:len(e.frames)-1]
+}
+
+func (e *jsonEncoder) writeBool(v bool) {
+	e.separate()
+	e.buf = strconv.AppendBool(e.buf, v)
+}
+
+func (e *jsonEncoder) writeInt(v int64) {
+	e.writeInteger(strconv.FormatInt(v, 10))
+}
+
+func (e *jsonEncoder) writeUint(v uint64) {
+	e.writeInteger(strconv.FormatUint(v, 10))
+}
+
+// writeInteger writes an integer, given in decimal, or the name of the constant it equals.
+func (e *jsonEncoder) writeInteger(decimal string) {
+	e.separate()
+	for _, constant := range e.enum {
+		if constantDecimal(constant) == decimal {
+			e.buf = appendJSONString(e.buf, constant.Name)
+			return
+		}
+	}
+	e.buf = append(e.buf, decimal...)
+}
+
+func (e *jsonEncoder) writeFloat(f float64, bits int) {
+	e.separate()
+	if math.IsNaN(f) && e.opts.NaNAsNull {
+		e.buf = append(e.buf, "null"...)
+		return
+	}
+	if name, ok := nonFiniteFloatName(f); ok {
+		e.buf = appendJSONString(e.buf, name)
+		return
+	}
+	precision := -1
+	if e.opts.FloatPrecision > 0 {
+		precision = e.opts.FloatPrecision
+	}
+	e.buf = strconv.AppendFloat(e.buf, f, 'g', precision, bits)
+}
+
+func (e *jsonEncoder) writeString(s string) {
+	e.separate()
+	e.buf = appendJSONString(e.buf, s)
+}
+
+func (e *jsonEncoder) writeBytes(b []byte) {
+	if e.opts.ByteArraysAsNumbers {
+		e.beginArray(len(b), true)
+		for _, c := range b {
+			e.writeUint(uint64(c))
+		}
+		e.endArray()
+		return
+	}
+	e.separate()
+	e.buf = append(e.buf, '"')
+	e.buf = append(e.buf, base64.StdEncoding.EncodeToString(b)...)
+	e.buf = append(e.buf, '"')
+}
+
+func (e *jsonEncoder) writeTime(sec uint32, nsec uint32) {
+	duration := e.field != nil && e.field.GoType == "ros.Duration"
+	switch {
+	case e.opts.TimeFormat == JSONTimeRFC3339 && !duration:
+		e.separate()
+		e.buf = append(e.buf, '"')
+		e.buf = time.Unix(int64(sec), int64(nsec)).UTC().AppendFormat(e.buf, time.RFC3339Nano)
+		e.buf = append(e.buf, '"')
+	case e.opts.TimeFormat == JSONTimeRFC3339 || e.opts.TimeFormat == JSONTimeSeconds:
+		e.separate()
+		e.buf = appendJSONSeconds(e.buf, sec, nsec, duration)
+	default:
+		// The keys aren't field names, so FieldNames doesn't apply to them.
+		e.separate()
+		marshalSecNSec(uint64(sec), uint64(nsec), &e.buf)
+	}
+}
+
+// ALL DONE.
@@ -0,0 +1,200 @@
+package ros
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	gengo "github.com/asimovsecurity/rosgo/libgengo"
+)
+
+func newJSONOptionsTestMessage() *DynamicMessage {
+	spec := generateTestSpec([]gengo.Field{
+		*gengo.NewField("Testing", "string", "frame_id", false, 0),
+		*gengo.NewField("Testing", "uint8", "status", false, 0),
+		*gengo.NewField("Testing", "uint8", "data", true, -1),
+		*gengo.NewField("Testing", "float64", "value", false, 0),
+		*gengo.NewField("Testing", "time", "stamp", false, 0),
+		*gengo.NewField("Testing", "duration", "timeout", false, 0),
+	})
+	spec.Constants = []gengo.Constant{
+		{Type: "uint8", Name: "PENDING", Value: uint8(0)},
+		{Type: "uint8", Name: "ACTIVE", Value: uint8(1)},
+		{Type: "int32", Name: "LIMIT", Value: int32(10)},
+	}
+	testMessageType := &DynamicMessageType{spec: spec, nested: make(map[string]*DynamicMessageType)}
+
+	msg := testMessageType.NewDynamicMessage()
+	msg.data["frame_id"] = "map\x01"
+	msg.data["status"] = uint8(1)
+	msg.data["data"] = []uint8{1, 2}
+	msg.data["value"] = JsonFloat64{F: math.NaN()}
+	msg.data["stamp"] = NewTime(1500000000, 42)
+	msg.data["timeout"] = NewDuration(uint32(0xffffffff), 500000000) // -0.5 seconds.
+	return msg
+}
+
+func TestDynamicMessage_JSONOptions_Default(t *testing.T) {
+	msg := newJSONOptionsTestMessage()
+	expected, err := msg.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	marshalled, err := msg.MarshalJSONWithOptions(JSONOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(marshalled) != string(expected) {
+		t.Fatalf("expected %s, got %s", expected, marshalled)
+	}
+}
+
+func TestDynamicMessage_JSONOptions_Marshal(t *testing.T) {
+	msg := newJSONOptionsTestMessage()
+	testCases := []struct {
+		opts     JSONOptions
+		expected string
+	}{
+		{
+			JSONOptions{TimeFormat: JSONTimeRFC3339, NaNAsNull: true},
+			`{"frame_id":"map\u0001","status":1,"data":"AQI=","value":null,"stamp":"2017-07-14T02:40:00.000000042Z","timeout":-0.5}`,
+		},
+		{
+			JSONOptions{TimeFormat: JSONTimeSeconds, ByteArraysAsNumbers: true, FieldNames: JSONFieldNamesCamelCase, EnumNames: true},
+			`{"frameId":"map\u0001","status":"ACTIVE","data":[1,2],"value":"nan","stamp":1500000000.000000042,"timeout":-0.5}`,
+		},
+		{
+			JSONOptions{FieldNames: JSONFieldNamesPascalCase, FloatPrecision: 3},
+			`{"FrameId":"map\u0001","Status":1,"Data":"AQI=","Value":"nan","Stamp":{"sec":1500000000,"nsec":42},"Timeout":{"sec":4294967295,"nsec":500000000}}`,
+		},
+	}
+	for _, testCase := range testCases {
+		marshalled, err := msg.MarshalJSONWithOptions(testCase.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(marshalled) != testCase.expected {
+			t.Fatalf("%+v: expected %s, got %s", testCase.opts, testCase.expected, marshalled)
+		}
+
+		// Whatever the options, the JSON reads back the same.
+		decoded := msg.dynamicType.NewDynamicMessage()
+		if err := decoded.UnmarshalJSONWithOptions(marshalled, testCase.opts); err != nil {
+			t.Fatalf("%+v: %s", testCase.opts, err)
+		}
+		if f := decoded.data["value"].(JsonFloat64).F; !math.IsNaN(f) {
+			t.Fatalf("%+v: expected NaN, got %v", testCase.opts, f)
+		}
+		expected := newJSONOptionsTestMessage()
+		expected.data["value"], decoded.data["value"] = JsonFloat64{}, JsonFloat64{}
+		if !reflect.DeepEqual(decoded.data, expected.data) {
+			t.Fatalf("%+v: expected %v, got %v", testCase.opts, expected.data, decoded.data)
+		}
+	}
+
+	msg.data["value"] = JsonFloat64{F: 2.0 / 3}
+	marshalled, err := msg.MarshalJSONWithOptions(JSONOptions{FloatPrecision: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(marshalled), `"value":0.667`) {
+		t.Fatalf("expected 3 significant digits, got %s", marshalled)
+	}
+}
+
+func TestDynamicMessage_JSONOptions_Unmarshal(t *testing.T) {
+	msg := newJSONOptionsTestMessage()
+	opts := JSONOptions{FieldNames: JSONFieldNamesCamelCase}
+	input := `{"frameId":"odom","status":"PENDING","stamp":"1970-01-01T00:00:01.5Z","timeout":2.25,"data":[3]}`
+	if err := msg.UnmarshalJSONWithOptions([]byte(input), opts); err != nil {
+		t.Fatal(err)
+	}
+	if msg.data["frame_id"] != "odom" || msg.data["status"] != uint8(0) || !reflect.DeepEqual(msg.data["data"], []uint8{3}) {
+		t.Fatalf("unexpected data %v", msg.data)
+	}
+	if msg.data["stamp"] != NewTime(1, 500000000) || msg.data["timeout"] != NewDuration(2, 250000000) {
+		t.Fatalf("unexpected times %v, %v", msg.data["stamp"], msg.data["timeout"])
+	}
+
+	// Mistakes are reported, and leave the message alone.
+	for _, input := range []string{`{"status":"LIMIT"}`, `{"stamp":-1}`, `{"nope":1}`, `{"status":1} {}`, `[]`, `{"data":"!"}`} {
+		if err := msg.UnmarshalJSONWithOptions([]byte(input), opts); err == nil {
+			t.Fatalf("expected an error for %s", input)
+		}
+	}
+	if msg.data["frame_id"] != "odom" {
+		t.Fatalf("unexpected frame_id %v", msg.data["frame_id"])
+	}
+}
+
+func TestDynamicMessageType_EnumConstants(t *testing.T) {
+	testMessageType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "int32", "type", false, 0),
+			*gengo.NewField("Testing", "int32", "action", false, 0),
+			*gengo.NewField("Testing", "uint8", "mode", false, 0),
+			*gengo.NewField("Testing", "string", "name", false, 0),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+	testMessageType.spec.Constants = []gengo.Constant{
+		{Type: "int32", Name: "ARROW", Value: int32(0)},
+		{Type: "int32", Name: "ACTION_ADD", Value: int32(0)},
+		{Type: "uint8", Name: "MODE_FAST", Value: uint8(1)},
+		{Type: "string", Name: "NAME", Value: "x"},
+	}
+
+	names := func(field string) []string {
+		var names []string
+		for _, constant := range testMessageType.EnumConstants(field) {
+			names = append(names, constant.Name)
+		}
+		return names
+	}
+	if !reflect.DeepEqual(names("action"), []string{"ACTION_ADD"}) || !reflect.DeepEqual(names("mode"), []string{"MODE_FAST"}) {
+		t.Fatalf("unexpected constants %v, %v", names("action"), names("mode"))
+	}
+	// type shares its type with action, so the unprefixed constants could belong to either; strings are never enums.
+	if names("type") != nil || names("name") != nil || names("nope") != nil {
+		t.Fatalf("unexpected constants %v, %v", names("type"), names("name"))
+	}
+}
+
+func TestDynamicMessageType_GenerateJSONSchemaWithOptions(t *testing.T) {
+	msg := newJSONOptionsTestMessage()
+	schema, err := msg.dynamicType.GenerateJSONSchemaWithOptions("/ros/", "test", JSONOptions{
+		TimeFormat:          JSONTimeRFC3339,
+		ByteArraysAsNumbers: true,
+		NaNAsNull:           true,
+		FieldNames:          JSONFieldNamesCamelCase,
+		EnumNames:           true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"$id":"/ros/test","$schema":"https://json-schema.org/draft-07/schema#","properties":{` +
+		`"data":{"items":{"maximum":255,"minimum":0,"type":"integer"},"type":"array"},` +
+		`"frameId":{"type":"string"},` +
+		`"stamp":{"format":"date-time","type":"string"},` +
+		`"status":{"oneOf":[{"maximum":255,"minimum":0,"type":"integer"},{"enum":["PENDING","ACTIVE"],"type":"string"}]},` +
+		`"timeout":{"type":"number"},` +
+		`"value":{"type":["number","null"]}},` +
+		`"required":["frameId","status","data","value","stamp","timeout"],"title":"TestMessage","type":"object"}`
+	if string(schema) != expected {
+		t.Fatalf("expected %s, got %s", expected, schema)
+	}
+
+	// The default options give the same schema as GenerateJSONSchema.
+	schema, err = msg.dynamicType.GenerateJSONSchemaWithOptions("/ros/", "test", JSONOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultSchema, err := msg.dynamicType.GenerateJSONSchema("/ros/", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(schema) != string(defaultSchema) || !strings.Contains(string(schema), `"data":{"contentEncoding":"base64","type":"string"}`) {
+		t.Fatalf("unexpected schema %s", schema)
+	}
+}
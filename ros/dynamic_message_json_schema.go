@@ -0,0 +1,279 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/asimovsecurity/rosgo/libgengo"
+	"github.com/pkg/errors"
+)
+
+// DEFINE PRIVATE STRUCTURES.
+
+// jsonSchemaGenerator builds the schema of a message type, collecting the schemas of the messages nested in it as definitions.
+type jsonSchemaGenerator struct {
+	opts    *JSONOptions
+	keyword string                 // Where definitions go: "definitions" in draft-07, "$defs" in 2020-12.
+	defs    map[string]interface{} // The schemas of nested message types, by ROS name.
+}
+
+// DEFINE PRIVATE GLOBALS.
+
+// jsonSchemaIntegerRanges holds the minimum and maximum of each integer primitive.
+var jsonSchemaIntegerRanges = map[dynamicPrimitive][2]interface{}{
+	dynamicInt8:   {int64(math.MinInt8), int64(math.MaxInt8)},
+	dynamicInt16:  {int64(math.MinInt16), int64(math.MaxInt16)},
+	dynamicInt32:  {int64(math.MinInt32), int64(math.MaxInt32)},
+	dynamicInt64:  {int64(math.MinInt64), int64(math.MaxInt64)},
+	dynamicUint8:  {uint64(0), uint64(math.MaxUint8)},
+	dynamicUint16: {uint64(0), uint64(math.MaxUint16)},
+	dynamicUint32: {uint64(0), uint64(math.MaxUint32)},
+	dynamicUint64: {uint64(0), uint64(math.MaxUint64)},
+}
+
+// jsonPointerEscaper escapes a name for use in a JSON pointer.
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	DynamicMessageType
+
+// GenerateJSONSchemaWithOptions generates a JSON schema, as GenerateJSONSchema does, for the JSON MarshalJSONWithOptions writes given opts.  Each
+// message is titled with its ROS name, and described by the comments of its definition; every field is required, and integers, fixed and bounded
+// arrays and bounded strings are limited to what the ROS type holds.  Integer fields which have constants (see EnumConstants) are limited to them.
+// Nested message types are defined once, in "definitions" or "$defs" depending on opts.SchemaDraft, and referred to with "$ref".
+func (t *DynamicMessageType) GenerateJSONSchemaWithOptions(prefix string, topic string, opts JSONOptions) ([]byte, error) {
+	g := jsonSchemaGenerator{opts: &opts, keyword: "definitions", defs: make(map[string]interface{})}
+	schemaURI := "https://json-schema.org/draft-07/schema#"
+	if opts.SchemaDraft == JSONSchemaDraft202012 {
+		g.keyword, schemaURI = "$defs", "https://json-schema.org/draft/2020-12/schema"
+	}
+
+	// The JSON schema for a message consist of the (recursive) properties names/types:
+	schemaItems, err := g.message(t)
+	if err != nil {
+		return nil, err
+	}
+
+	// Plus some extra keywords:
+	if len(g.defs) > 0 {
+		schemaItems[g.keyword] = g.defs
+	}
+	schemaItems["$schema"] = schemaURI
+	schemaItems["$id"] = prefix + topic
+
+	// All done.
+	return json.Marshal(schemaItems)
+}
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+// jsonSchemaDescriptions reads the comments of a message definition.  The block of comments opening the definition, if a blank line follows it,
+// describes the message; a field is described by the comment on its own line or, failing that, by the comments on the lines just above it.
+func jsonSchemaDescriptions(text string) (string, map[string]string) {
+	var message string
+	var block []string
+	fields := make(map[string]string)
+	declared := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "==="):
+			// The definitions of nested messages follow, in a full message definition.
+			return message, fields
+		case line == "":
+			if !declared && message == "" {
+				message = strings.Join(block, "\n")
+			}
+			block = nil
+		case strings.HasPrefix(line, libgengo.CommentChar):
+			block = append(block, strings.TrimSpace(strings.TrimLeft(line, libgengo.CommentChar)))
+		default:
+			declared = true
+			code, comment := line, ""
+			if i := strings.Index(line, libgengo.CommentChar); i >= 0 {
+				code, comment = line[:i], strings.TrimSpace(strings.TrimLeft(line[i:], libgengo.CommentChar))
+			}
+			// Fields are a type and a name, and perhaps a default value; constants have an equals sign after the name.
+			tokens := strings.Fields(code)
+			if len(tokens) >= 2 && !strings.Contains(tokens[1], "=") && (len(tokens) == 2 || !strings.HasPrefix(tokens[2], "=")) {
+				if comment == "" {
+					comment = strings.Join(block, "\n")
+				}
+				if comment != "" {
+					fields[tokens[1]] = comment
+				}
+			}
+			block = nil
+		}
+	}
+	if !declared && message == "" {
+		message = strings.Join(block, "\n")
+	}
+	return message, fields
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	jsonSchemaGenerator
+
+// message generates the schema of a message type.
+func (g *jsonSchemaGenerator) message(t *DynamicMessageType) (map[string]interface{}, error) {
+	// Each message's schema indicates that it is an 'object' with some nested properties: those properties are the fields and their types.
+	description, descriptions := jsonSchemaDescriptions(t.spec.Text)
+	properties := make(map[string]interface{})
+	required := make([]string, 0, len(t.spec.Fields))
+	for i := range t.spec.Fields {
+		field := &t.spec.Fields[i]
+		property, err := g.field(t, field)
+		if err != nil {
+			return nil, errors.Wrap(err, "Schema Field: "+field.Name)
+		}
+		if d := descriptions[field.Name]; d != "" {
+			// Draft-07 ignores anything next to "$ref", so the reference has to be wrapped for the description to count.
+			if ref, ok := property["$ref"]; ok && g.keyword == "definitions" {
+				property = map[string]interface{}{"allOf": []interface{}{map[string]interface{}{"$ref": ref}}}
+			}
+			property["description"] = d
+		}
+		name := g.opts.fieldName(field.Name)
+		properties[name] = property
+		required = append(required, name)
+	}
+
+	schemaItems := map[string]interface{}{"type": "object", "properties": properties}
+	if t.Name() != "" {
+		schemaItems["title"] = t.Name()
+	}
+	if description != "" {
+		schemaItems["description"] = description
+	}
+	if len(required) > 0 {
+		schemaItems["required"] = required
+	}
+
+	// All done.
+	return schemaItems, nil
+}
+
+// field generates the schema of a field.
+func (g *jsonSchemaGenerator) field(t *DynamicMessageType, field *libgengo.Field) (map[string]interface{}, error) {
+	element, err := g.element(t, field)
+	if err != nil || !field.IsArray {
+		return element, err
+	}
+
+	// Fixed arrays have ArrayLen elements, and bounded arrays at most ArrayBound.
+	lengthKeyword, length := "Items", -1
+	if field.ArrayLen >= 0 {
+		length = field.ArrayLen
+	} else if field.ArrayBound > 0 {
+		length = field.ArrayBound
+	}
+
+	property := map[string]interface{}{"type": "array", "items": element}
+	if field.GoType == "uint8" && !g.opts.ByteArraysAsNumbers {
+		// Byte arrays are marshalled as base64, which takes four characters for every three bytes.
+		property = map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		lengthKeyword = "Length"
+		if length >= 0 {
+			length = base64.StdEncoding.EncodedLen(length)
+		}
+	}
+	if field.ArrayLen >= 0 {
+		property["min"+lengthKeyword] = length
+	}
+	if length >= 0 {
+		property["max"+lengthKeyword] = length
+	}
+
+	// All done.
+	return property, nil
+}
+
+// element generates the schema of a scalar field, or of a single element of an array field.
+func (g *jsonSchemaGenerator) element(t *DynamicMessageType, field *libgengo.Field) (map[string]interface{}, error) {
+	if field.IsBuiltin == false {
+		// It's another nested message.
+		nested, err := t.getNestedTypeFromField(field)
+		if err != nil {
+			return nil, err
+		}
+		return g.ref(nested)
+	}
+
+	switch prim := dynamicPrimitives[field.GoType]; prim {
+	case dynamicString:
+		schema := map[string]interface{}{"type": "string"}
+		if field.StringBound > 0 {
+			schema["maxLength"] = field.StringBound
+		}
+		return schema, nil
+	case dynamicBool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case dynamicInt8, dynamicInt16, dynamicInt32, dynamicInt64, dynamicUint8, dynamicUint16, dynamicUint32, dynamicUint64:
+		limits := jsonSchemaIntegerRanges[prim]
+		integer := map[string]interface{}{"type": "integer", "minimum": limits[0], "maximum": limits[1]}
+		constants := t.EnumConstants(field.Name)
+		if len(constants) == 0 {
+			return integer, nil
+		}
+		if g.opts.EnumNames {
+			// Values with a constant are written as its name, so only the others are written as numbers.
+			names := make([]string, len(constants))
+			for i, constant := range constants {
+				names[i] = constant.Name
+			}
+			return map[string]interface{}{"oneOf": []interface{}{
+				integer,
+				map[string]interface{}{"type": "string", "enum": names},
+			}}, nil
+		}
+		choices := make([]interface{}, len(constants))
+		for i, constant := range constants {
+			choices[i] = map[string]interface{}{"const": constant.Value, "title": constant.Name}
+		}
+		integer["anyOf"] = choices
+		return integer, nil
+	case dynamicFloat32, dynamicFloat64:
+		if g.opts.NaNAsNull {
+			return map[string]interface{}{"type": []string{"number", "null"}}, nil
+		}
+		return map[string]interface{}{"type": "number"}, nil
+	case dynamicTime, dynamicDuration:
+		switch {
+		case g.opts.TimeFormat == JSONTimeRFC3339 && prim == dynamicTime:
+			return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+		case g.opts.TimeFormat == JSONTimeRFC3339 || g.opts.TimeFormat == JSONTimeSeconds:
+			return map[string]interface{}{"type": "number"}, nil
+		}
+		timeItems := make(map[string]interface{})
+		timeItems["sec"] = map[string]interface{}{"type": "integer", "minimum": 0, "maximum": uint64(math.MaxUint32)}
+		timeItems["nsec"] = map[string]interface{}{"type": "integer", "minimum": 0, "maximum": uint64(math.MaxUint32)}
+		return map[string]interface{}{"type": "object", "properties": timeItems, "required": []string{"sec", "nsec"}}, nil
+	}
+
+	// Something went wrong.
+	return nil, errors.New("we haven't implemented this primitive yet")
+}
+
+// ref returns a reference to the schema of a nested message type, defining it the first time it is used.
+func (g *jsonSchemaGenerator) ref(t *DynamicMessageType) (map[string]interface{}, error) {
+	name := t.Name()
+	if _, ok := g.defs[name]; !ok {
+		g.defs[name] = nil
+		schema, err := g.message(t)
+		if err != nil {
+			delete(g.defs, name)
+			return nil, err
+		}
+		g.defs[name] = schema
+	}
+	return map[string]interface{}{"$ref": "#/" + g.keyword + "/" + jsonPointerEscaper.Replace(name)}, nil
+}
+
+// ALL DONE.
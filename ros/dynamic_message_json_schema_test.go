@@ -0,0 +1,148 @@
+package ros
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	gengo "github.com/asimovsecurity/rosgo/libgengo"
+)
+
+func newJSONSchemaTestType() *DynamicMessageType {
+	innerSpec := generateTestSpec([]gengo.Field{
+		*gengo.NewField("Testing", "float64", "x", false, 0),
+	})
+	innerSpec.FullName = "Testing/Inner"
+	innerSpec.Text = "# A point on a line.\n\nfloat64 x # Distance from the origin, in metres.\n"
+	innerType := &DynamicMessageType{spec: innerSpec, nested: make(map[string]*DynamicMessageType)}
+
+	spec := generateTestSpec([]gengo.Field{
+		*gengo.NewField("Testing", "uint8", "mode", false, 0),
+		*gengo.NewField("Testing", "int16", "offsets", true, 3),
+		*gengo.NewField("Testing", "uint8", "key", true, 4),
+		*gengo.NewField("Testing", "string", "name", false, 0),
+		*gengo.NewField("Testing", "int32", "ids", true, -1),
+		*gengo.NewField("Testing", "Inner", "origin", false, 0),
+		*gengo.NewField("Testing", "Inner", "points", true, -1),
+	})
+	spec.Fields[3].StringBound = 8
+	spec.Fields[4].ArrayBound = 2
+	spec.Constants = []gengo.Constant{
+		{Type: "uint8", Name: "MODE_OFF", Value: uint8(0)},
+		{Type: "uint8", Name: "MODE_ON", Value: uint8(1)},
+	}
+	spec.Text = strings.Join([]string{
+		"# Settings of a widget.",
+		"",
+		"uint8 MODE_OFF=0 # Not a field.",
+		"uint8 MODE_ON=1",
+		"# How the widget runs;",
+		"# one of the MODE constants.",
+		"uint8 mode",
+		"int16[3] offsets",
+		"uint8[4] key",
+		"string<=8 name # Shown to users.",
+		"int32[<=2] ids",
+		"Inner origin # Where the widget is.",
+		"Inner[] points",
+		"================================================================================",
+		"MSG: Testing/Inner",
+		"float64 y # Not ours.",
+	}, "\n")
+	return &DynamicMessageType{spec: spec, nested: map[string]*DynamicMessageType{"Testing/Inner": innerType}}
+}
+
+func TestDynamicMessageType_GenerateJSONSchema_Annotations(t *testing.T) {
+	schema, err := newJSONSchemaTestType().GenerateJSONSchema("/ros/", "widget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(schema, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"$id":         "/ros/widget",
+		"$schema":     "https://json-schema.org/draft-07/schema#",
+		"title":       "TestMessage",
+		"description": "Settings of a widget.",
+		"type":        "object",
+		"required":    []interface{}{"mode", "offsets", "key", "name", "ids", "origin", "points"},
+		"properties": map[string]interface{}{
+			"mode": map[string]interface{}{
+				"type": "integer", "minimum": 0.0, "maximum": 255.0,
+				"description": "How the widget runs;\none of the MODE constants.",
+				"anyOf": []interface{}{
+					map[string]interface{}{"const": 0.0, "title": "MODE_OFF"},
+					map[string]interface{}{"const": 1.0, "title": "MODE_ON"},
+				},
+			},
+			"offsets": map[string]interface{}{
+				"type": "array", "minItems": 3.0, "maxItems": 3.0,
+				"items": map[string]interface{}{"type": "integer", "minimum": -32768.0, "maximum": 32767.0},
+			},
+			"key":  map[string]interface{}{"type": "string", "contentEncoding": "base64", "minLength": 8.0, "maxLength": 8.0},
+			"name": map[string]interface{}{"type": "string", "maxLength": 8.0, "description": "Shown to users."},
+			"ids":  map[string]interface{}{"type": "array", "maxItems": 2.0, "items": map[string]interface{}{"type": "integer", "minimum": -2147483648.0, "maximum": 2147483647.0}},
+			"origin": map[string]interface{}{
+				"allOf":       []interface{}{map[string]interface{}{"$ref": "#/definitions/Testing~1Inner"}},
+				"description": "Where the widget is.",
+			},
+			"points": map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/definitions/Testing~1Inner"}},
+		},
+		"definitions": map[string]interface{}{
+			"Testing/Inner": map[string]interface{}{
+				"title":       "Testing/Inner",
+				"description": "A point on a line.",
+				"type":        "object",
+				"required":    []interface{}{"x"},
+				"properties": map[string]interface{}{
+					"x": map[string]interface{}{"type": "number", "description": "Distance from the origin, in metres."},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("unexpected schema %s", schema)
+	}
+}
+
+func TestDynamicMessageType_GenerateJSONSchema_Draft202012(t *testing.T) {
+	schema, err := newJSONSchemaTestType().GenerateJSONSchemaWithOptions("/ros/", "widget", JSONOptions{SchemaDraft: JSONSchemaDraft202012})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(schema, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["$schema"] != "https://json-schema.org/draft/2020-12/schema" || decoded["definitions"] != nil {
+		t.Fatalf("unexpected schema %s", schema)
+	}
+	if defs, ok := decoded["$defs"].(map[string]interface{}); !ok || defs["Testing/Inner"] == nil {
+		t.Fatalf("expected Testing/Inner in $defs, got %s", schema)
+	}
+	origin := decoded["properties"].(map[string]interface{})["origin"].(map[string]interface{})
+	// References can have siblings from 2019-09 on, so the description goes next to it.
+	if origin["$ref"] != "#/$defs/Testing~1Inner" || origin["description"] != "Where the widget is." {
+		t.Fatalf("unexpected reference %v", origin)
+	}
+
+	// The draft doesn't change how messages are marshalled.
+	msg := newJSONOptionsTestMessage()
+	expected, _ := msg.MarshalJSON()
+	marshalled, err := msg.MarshalJSONWithOptions(JSONOptions{SchemaDraft: JSONSchemaDraft202012})
+	if err != nil || string(marshalled) != string(expected) {
+		t.Fatalf("expected %s, got %s (%v)", expected, marshalled, err)
+	}
+}
+
+func TestJSONSchemaDescriptions(t *testing.T) {
+	// A comment block straight above the first field describes the field, not the message.
+	message, fields := jsonSchemaDescriptions("# The stamp.\ntime stamp\n\n# Orphaned.\n\nint32 x 5 # With a default.\n")
+	if message != "" || !reflect.DeepEqual(fields, map[string]string{"stamp": "The stamp.", "x": "With a default."}) {
+		t.Fatalf("unexpected descriptions %q, %v", message, fields)
+	}
+}
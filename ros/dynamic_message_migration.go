@@ -0,0 +1,292 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+
+	"github.com/asimovsecurity/rosgo/libgengo"
+	"github.com/pkg/errors"
+)
+
+// DEFINE PUBLIC STRUCTURES.
+
+// MigrationRule turns messages of an old definition of a message type into messages of a newer one, in the spirit of rosbag's migration rules.  Fields are
+// copied across by name, after renaming; numbers are converted to the new field's type as long as their values fit, so fields can be widened; and nested
+// messages are migrated in turn, using the rules for their own types, or by name if there are none.
+type MigrationRule struct {
+	From     *DynamicMessageType                                  // The old definition, which the rule is found by, by name and MD5 sum.
+	To       *DynamicMessageType                                  // The newer definition; it may have another name, and have rules of its own to migrate it further.
+	Renames  map[string]string                                    // The new names of fields of From, keyed by their names in From.
+	Defaults map[string]interface{}                               // Values for fields of To that From doesn't have, keyed by name, and converted as Set converts them.
+	Update   func(from *DynamicMessage, to *DynamicMessage) error // Optional; makes any other changes once fields are copied.  Fields that couldn't be copied are left at their zero values for it.
+}
+
+// MessageMigrator migrates messages of old definitions of their types to current ones, following its MigrationRules, so that recorded data and older nodes keep
+// working as message definitions change.  It's safe for concurrent use.
+type MessageMigrator struct {
+	mutex sync.RWMutex
+	rules map[migrationKey]*MigrationRule
+}
+
+// DEFINE PRIVATE STRUCTURES.
+
+// migrationKey identifies a definition of a message type.
+type migrationKey struct {
+	name   string
+	md5sum string
+}
+
+// DEFINE PUBLIC STATIC FUNCTIONS.
+
+// NewMessageMigrator creates a MessageMigrator without any rules.
+func NewMessageMigrator() *MessageMigrator {
+	return &MessageMigrator{rules: make(map[migrationKey]*MigrationRule)}
+}
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	MessageMigrator
+
+// AddRule adds a rule to the migrator.  There can only be one rule for each old definition, though rules can be chained, each migrating to the From of the
+// next.
+func (m *MessageMigrator) AddRule(rule MigrationRule) error {
+	if rule.From == nil || rule.From.spec == nil || rule.To == nil || rule.To.spec == nil {
+		return errors.New("migration rule needs both message types")
+	}
+	from := migrationKey{rule.From.Name(), rule.From.MD5Sum()}
+	if from == (migrationKey{rule.To.Name(), rule.To.MD5Sum()}) {
+		return errors.New("migration rule for " + from.name + " doesn't change its definition")
+	}
+	for oldName, newName := range rule.Renames {
+		if rule.From.field(oldName) == nil {
+			return errors.New("renamed field " + oldName + " isn't in " + from.name)
+		}
+		if rule.To.field(newName) == nil {
+			return errors.New("field " + oldName + " is renamed to " + newName + ", which isn't in " + rule.To.Name())
+		}
+	}
+	for name := range rule.Defaults {
+		if rule.To.field(name) == nil {
+			return errors.New("field " + name + " has a default but isn't in " + rule.To.Name())
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.rules[from]; ok {
+		return errors.New("there is already a migration rule for " + from.name + " with MD5 sum " + from.md5sum)
+	}
+	m.rules[from] = &rule
+	return nil
+}
+
+// CanMigrate returns whether messages of the named type with the given MD5 sum can be migrated to the message type to, which is true if they're already of it.
+func (m *MessageMigrator) CanMigrate(name string, md5sum string, to *DynamicMessageType) bool {
+	_, err := m.chain(migrationKey{name, md5sum}, to)
+	return err == nil
+}
+
+// Migrate migrates a message to the message type to, following the rules from the message's definition to it.  The migrated message may share nested
+// messages and arrays with msg, which is returned as it is if it's already of the message type.
+func (m *MessageMigrator) Migrate(msg *DynamicMessage, to *DynamicMessageType) (*DynamicMessage, error) {
+	if msg == nil || msg.dynamicType == nil {
+		return nil, errors.New("message has no type")
+	}
+	rules, err := m.chain(migrationKey{msg.dynamicType.Name(), msg.dynamicType.MD5Sum()}, to)
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		// Finish with the message type we were asked for, rather than the rule's copy of it.
+		target := rule.To
+		if i == len(rules)-1 {
+			target = to
+		}
+		if msg, err = m.convert("", msg, target, rule); err != nil {
+			return nil, errors.Wrap(err, "migrating "+rule.From.Name()+" ("+rule.From.MD5Sum()+")")
+		}
+	}
+
+	// All done.
+	return msg, nil
+}
+
+// MigrateSerialized deserializes a message of the named type with the given MD5 sum, as read from a connection or a bag file, and migrates it to the message
+// type to.
+func (m *MessageMigrator) MigrateSerialized(name string, md5sum string, buf []byte, to *DynamicMessageType) (*DynamicMessage, error) {
+	rules, err := m.chain(migrationKey{name, md5sum}, to)
+	if err != nil {
+		return nil, err
+	}
+	from := to
+	if len(rules) > 0 {
+		from = rules[0].From
+	}
+	msg := from.NewDynamicMessage()
+	if err := msg.Deserialize(bytes.NewReader(buf)); err != nil {
+		return nil, err
+	}
+	return m.Migrate(msg, to)
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+// chain finds the rules to follow, in order, to migrate the definition from to the message type to.
+func (m *MessageMigrator) chain(from migrationKey, to *DynamicMessageType) ([]*MigrationRule, error) {
+	if to == nil {
+		return nil, errors.New("no message type to migrate to")
+	}
+	target := migrationKey{to.Name(), to.MD5Sum()}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var rules []*MigrationRule
+	visited := map[migrationKey]struct{}{}
+	for key := from; key != target; key = (migrationKey{rules[len(rules)-1].To.Name(), rules[len(rules)-1].To.MD5Sum()}) {
+		if _, ok := visited[key]; ok {
+			return nil, errors.New("migration rules for " + key.name + " go round in a loop")
+		}
+		visited[key] = struct{}{}
+		rule, ok := m.rules[key]
+		if !ok {
+			return nil, errors.New("no migration rule for " + key.name + " with MD5 sum " + key.md5sum + " on the way to " + to.Name() + " with MD5 sum " + target.md5sum)
+		}
+		rules = append(rules, rule)
+	}
+
+	// All done.
+	return rules, nil
+}
+
+// convert makes a message of the message type to from one of another definition, copying its fields and following rule, if there is one.
+func (m *MessageMigrator) convert(prefix string, from *DynamicMessage, to *DynamicMessageType, rule *MigrationRule) (*DynamicMessage, error) {
+	if from.dynamicType.spec == nil || to.spec == nil {
+		return nil, errors.New("dynamic message type spec is nil")
+	}
+	result := to.NewDynamicMessage()
+	if result.data == nil {
+		return nil, errors.New("could not create a " + to.Name())
+	}
+
+	// Find where each field of the new message comes from, renamed fields taking the place of any old field of the same name.
+	sources := make(map[string]*libgengo.Field, len(from.dynamicType.spec.Fields))
+	for i := range from.dynamicType.spec.Fields {
+		field := &from.dynamicType.spec.Fields[i]
+		if _, ok := rule.renames()[field.Name]; !ok {
+			sources[field.Name] = field
+		}
+	}
+	for oldName, newName := range rule.renames() {
+		sources[newName] = from.dynamicType.field(oldName)
+	}
+
+	for i := range to.spec.Fields {
+		field := &to.spec.Fields[i]
+		path := prefix + field.Name
+		source, ok := sources[field.Name]
+		if !ok {
+			if value, ok := rule.defaults()[field.Name]; ok {
+				if err := result.Set(field.Name, value); err != nil {
+					return nil, errors.Wrap(err, "default for field: "+path)
+				}
+			}
+			continue
+		}
+		value, err := m.convertValue(path, source, from.data[source.Name], to, field)
+		if err != nil {
+			if rule != nil && rule.Update != nil {
+				continue
+			}
+			return nil, err
+		}
+		result.data[field.Name] = value
+	}
+
+	if rule != nil && rule.Update != nil {
+		if err := rule.Update(from, result); err != nil {
+			return nil, err
+		}
+	}
+
+	// All done.
+	return result, nil
+}
+
+// convertValue converts the value of a field of an old message to the field of the message type to which takes its place.
+func (m *MessageMigrator) convertValue(path string, source *libgengo.Field, value interface{}, to *DynamicMessageType, field *libgengo.Field) (interface{}, error) {
+	if source.IsArray != field.IsArray || source.IsBuiltin != field.IsBuiltin {
+		return nil, &FieldTypeError{Path: path, Expected: dynamicFieldTypeName(field), Value: value, Reason: "field was " + dynamicFieldTypeName(source)}
+	}
+	if field.IsBuiltin {
+		if field.IsArray {
+			return to.coerceArray(path, field, value)
+		}
+		return to.coerceElement(path, field, value)
+	}
+
+	nested, err := to.getNestedTypeFromField(field)
+	if err != nil {
+		return nil, errors.Wrap(err, "Field: "+field.Name)
+	}
+	if !field.IsArray {
+		msg, ok := value.(*DynamicMessage)
+		if !ok || msg == nil {
+			return nil, &FieldTypeError{Path: path, Expected: dynamicFieldTypeName(field), Value: value}
+		}
+		return m.migrateNested(path, msg, nested)
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, &FieldTypeError{Path: path, Expected: dynamicFieldTypeName(field), Value: value}
+	}
+	elements := make([]Message, rv.Len())
+	for i := range elements {
+		msg, ok := rv.Index(i).Interface().(*DynamicMessage)
+		if !ok || msg == nil {
+			return nil, &FieldTypeError{Path: path, Expected: dynamicFieldTypeName(field), Value: value}
+		}
+		if elements[i], err = m.migrateNested(path, msg, nested); err != nil {
+			return nil, err
+		}
+	}
+	// Let the array be checked against the new field's length.
+	return to.coerceArray(path, field, elements)
+}
+
+// migrateNested migrates a nested message, following the rules for its definition if there are any, or copying its fields by name if its type has the same name.
+func (m *MessageMigrator) migrateNested(path string, msg *DynamicMessage, to *DynamicMessageType) (*DynamicMessage, error) {
+	if msg.dynamicType.Name() == to.Name() && msg.dynamicType.MD5Sum() == to.MD5Sum() {
+		return msg, nil
+	}
+	if m.CanMigrate(msg.dynamicType.Name(), msg.dynamicType.MD5Sum(), to) {
+		return m.Migrate(msg, to)
+	}
+	if msg.dynamicType.Name() != to.Name() {
+		return nil, &FieldTypeError{Path: path, Expected: to.Name(), Value: msg, Reason: "no migration rule from " + msg.dynamicType.Name()}
+	}
+	return m.convert(path+".", msg, to, nil)
+}
+
+//	MigrationRule
+
+// renames returns the renamed fields of the rule; there are none without a rule.
+func (rule *MigrationRule) renames() map[string]string {
+	if rule == nil {
+		return nil
+	}
+	return rule.Renames
+}
+
+// defaults returns the defaults of the rule; there are none without a rule.
+func (rule *MigrationRule) defaults() map[string]interface{} {
+	if rule == nil {
+		return nil
+	}
+	return rule.Defaults
+}
+
+// ALL DONE.
@@ -0,0 +1,249 @@
+package ros
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// newMigrationTestTypes creates three definitions of Testing/Widget, each following on from the last.
+func newMigrationTestTypes(t *testing.T) (*DynamicMessageType, *DynamicMessageType, *DynamicMessageType) {
+	v1, err := NewDynamicMessageTypeFromDefinition("Testing/Widget", strings.Join([]string{
+		"int32 count",
+		"string label",
+		"Inner inner",
+		"Inner[] inners",
+		"==========",
+		"MSG: Testing/Inner",
+		"float32 value",
+	}, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := NewDynamicMessageTypeFromDefinition("Testing/Widget", strings.Join([]string{
+		"int64 count",
+		"string name",
+		"float64 scale",
+		"Inner inner",
+		"Inner[] inners",
+		"==========",
+		"MSG: Testing/Inner",
+		"float64 value",
+		"uint8 flag",
+	}, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v3, err := NewDynamicMessageTypeFromDefinition("Testing/Widget", strings.Join([]string{
+		"int64 count",
+		"string name",
+		"string description",
+		"float64 scale",
+		"Inner inner",
+		"Inner[] inners",
+		"==========",
+		"MSG: Testing/Inner",
+		"float64 value",
+		"uint8 flag",
+	}, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v1, v2, v3
+}
+
+// newMigrationTestMigrator creates a migrator from v1 to v2 to v3 of Testing/Widget.
+func newMigrationTestMigrator(t *testing.T, v1 *DynamicMessageType, v2 *DynamicMessageType, v3 *DynamicMessageType) *MessageMigrator {
+	migrator := NewMessageMigrator()
+	if err := migrator.AddRule(MigrationRule{
+		From:     v1,
+		To:       v2,
+		Renames:  map[string]string{"label": "name"},
+		Defaults: map[string]interface{}{"scale": 1.5},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.AddRule(MigrationRule{
+		From: v2,
+		To:   v3,
+		Update: func(from *DynamicMessage, to *DynamicMessage) error {
+			return to.Set("description", "widget "+from.Data()["name"].(string))
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return migrator
+}
+
+func TestMessageMigrator_Migrate(t *testing.T) {
+	v1, v2, v3 := newMigrationTestTypes(t)
+	migrator := newMigrationTestMigrator(t, v1, v2, v3)
+
+	old := v1.NewDynamicMessage()
+	if err := old.Set("count", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Set("label", "left"); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Set("inner.value", 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Set("inners", []interface{}{map[string]interface{}{"value": 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !migrator.CanMigrate(v1.Name(), v1.MD5Sum(), v3) || !migrator.CanMigrate(v3.Name(), v3.MD5Sum(), v3) {
+		t.Fatalf("expected v1 and v3 to migrate to v3")
+	}
+	if migrator.CanMigrate(v3.Name(), v3.MD5Sum(), v1) {
+		t.Fatalf("expected v3 not to migrate to v1")
+	}
+
+	msg, err := migrator.Migrate(old, v3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type() != v3 {
+		t.Fatalf("expected a message of v3, got %v", msg.Type())
+	}
+	expected := map[string]interface{}{
+		"count":       int64(7),
+		"name":        "left",
+		"description": "widget left",
+		"scale":       1.5,
+		"inner.value": 0.5,
+		"inner.flag":  uint8(0),
+		"inners[0]":   nil,
+	}
+	for path, value := range expected {
+		got, err := msg.Get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value == nil {
+			if nested, ok := got.(*DynamicMessage); !ok || nested.Type().MD5Sum() != v3.nested["Testing/Inner"].MD5Sum() {
+				t.Fatalf("%s: expected a migrated Testing/Inner, got %v", path, got)
+			}
+			continue
+		}
+		switch v := got.(type) {
+		case JsonFloat64:
+			got = v.F
+		}
+		if got != value {
+			t.Fatalf("%s: expected %v (%T), got %v (%T)", path, value, value, got, got)
+		}
+	}
+	if errs := msg.Validate(); len(errs) != 0 {
+		t.Fatalf("migrated message isn't valid: %v", errs)
+	}
+}
+
+func TestMessageMigrator_MigrateSerialized(t *testing.T) {
+	v1, v2, v3 := newMigrationTestTypes(t)
+	migrator := newMigrationTestMigrator(t, v1, v2, v3)
+
+	old := v1.NewDynamicMessage()
+	if err := old.Set("label", "right"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := old.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := migrator.MigrateSerialized(v1.Name(), v1.MD5Sum(), buf.Bytes(), v3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if description, _ := msg.Get("description"); description != "widget right" {
+		t.Fatalf("unexpected description %v", description)
+	}
+	if _, err := migrator.MigrateSerialized(v1.Name(), "00112233445566778899aabbccddeeff", buf.Bytes(), v3); err == nil {
+		t.Fatalf("expected an error for an unknown definition")
+	}
+}
+
+func TestMessageMigrator_Errors(t *testing.T) {
+	v1, v2, v3 := newMigrationTestTypes(t)
+	migrator := newMigrationTestMigrator(t, v1, v2, v3)
+
+	if err := migrator.AddRule(MigrationRule{From: v1, To: v3}); err == nil {
+		t.Fatalf("expected an error for a second rule for v1")
+	}
+	if err := migrator.AddRule(MigrationRule{From: v3, To: v3}); err == nil {
+		t.Fatalf("expected an error for a rule which doesn't change the definition")
+	}
+	if err := migrator.AddRule(MigrationRule{From: v3, To: v1, Renames: map[string]string{"name": "title"}}); err == nil {
+		t.Fatalf("expected an error for a rename to a missing field")
+	}
+
+	// Narrowing only works for values that fit.
+	narrow, err := NewDynamicMessageTypeFromDefinition("Testing/Widget", "int8 count\nstring name\nstring description\nfloat64 scale\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.AddRule(MigrationRule{From: v3, To: narrow}); err != nil {
+		t.Fatal(err)
+	}
+	msg := v3.NewDynamicMessage()
+	if err := msg.Set("count", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Migrate(msg, narrow); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Fatalf("expected an out of range error, got %v", err)
+	}
+	if err := msg.Set("count", 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Migrate(msg, narrow); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Subscriptions with a migrator accept publishers of definitions it can migrate.
+func TestSubscription_HeaderExchange_AcceptsMigratableDefinition(t *testing.T) {
+	v1, v2, v3 := newMigrationTestTypes(t)
+	migrator := newMigrationTestMigrator(t, v1, v2, v3)
+
+	pubConn, subConn := net.Pipe()
+	defer pubConn.Close()
+	msgChan := make(chan messageEvent)
+	subscription := newDefaultSubscription("fakeUri:12345", "/test/topic", v3, "testNode", msgChan, make(chan string))
+	subscription.dialer = &TCPRosDialerFake{conn: subConn}
+	subscription.migrator = migrator
+	ctx := newFakeContext()
+	defer ctx.cleanUp()
+	subscription.startWithContext(ctx, zerolog.New(os.Stdout).With().Logger())
+
+	headers, err := readConnectionHeader(pubConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range headers {
+		if h.key == "md5sum" && h.value != "*" {
+			t.Fatalf("expected the subscription to accept any MD5 sum, got %s", h.value)
+		}
+	}
+
+	replyHeader := []header{
+		{"topic", "/test/topic"},
+		{"md5sum", v1.MD5Sum()},
+		{"type", v1.Name()},
+		{"callerid", "testPublisher"},
+	}
+	writeAndConfirmPublisherHeader(t, pubConn, msgChan, replyHeader)
+
+	pubConn.Close()
+	select {
+	case <-subscription.remoteDisconnectedChan:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("took too long for the subscription to disconnect")
+	}
+}
@@ -0,0 +1,338 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// DEFINE PRIVATE STRUCTURES.
+
+// msgpackCodec encodes messages as MessagePack: a map of field names to values, the same as JSON, but with uint8 arrays as bin and floats in their
+// native width.
+type msgpackCodec struct{}
+
+// msgpackEncoder writes MessagePack for encodeDynamicFields, always using the smallest encoding of each value.
+type msgpackEncoder struct {
+	buf []byte
+}
+
+// msgpackDecoder reads MessagePack into generic values for decodeGeneric.
+type msgpackDecoder struct {
+	buf []byte
+	off int
+}
+
+// DEFINE PRIVATE GLOBALS.
+
+// msgpackMaxDepth limits how deeply nested the items we decode may be.
+const msgpackMaxDepth = 1000
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	msgpackCodec
+
+// Name returns "msgpack"; required for Codec.
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+// Marshal encodes the message as MessagePack; required for Codec.
+func (msgpackCodec) Marshal(m *DynamicMessage) ([]byte, error) {
+	enc := msgpackEncoder{}
+	if m != nil && m.dynamicType != nil {
+		enc.buf = make([]byte, 0, m.dynamicType.jsonPrealloc)
+	}
+	if err := encodeDynamicFields(&enc, m); err != nil {
+		return nil, err
+	}
+	return enc.buf, nil
+}
+
+// Unmarshal decodes MessagePack into the message; required for Codec.
+func (msgpackCodec) Unmarshal(buf []byte, m *DynamicMessage) error {
+	dec := msgpackDecoder{buf: buf}
+	value, err := dec.decode(0)
+	if err != nil {
+		return errors.Wrap(err, "msgpack")
+	}
+	if dec.off != len(buf) {
+		return errors.New("msgpack: " + strconv.Itoa(len(buf)-dec.off) + " bytes of trailing data")
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("msgpack: expected a map")
+	}
+	return m.decodeGeneric("", object)
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	msgpackEncoder
+
+// length writes the header of a str, bin, array or map: the fix format if n is under fixLimit, otherwise the 8 (if there is one), 16 or 32 bit format.
+func (e *msgpackEncoder) length(n int, fix byte, fixLimit int, format8 byte, format16 byte, format32 byte) {
+	switch {
+	case n < fixLimit:
+		e.buf = append(e.buf, fix|byte(n))
+	case format8 != 0 && n <= math.MaxUint8:
+		e.buf = append(e.buf, format8, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, format16, 0, 0)
+		binary.BigEndian.PutUint16(e.buf[len(e.buf)-2:], uint16(n))
+	default:
+		e.buf = append(e.buf, format32, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) beginMap(n int) {
+	e.length(n, 0x80, 16, 0, 0xde, 0xdf)
+}
+
+func (e *msgpackEncoder) key(name string) {
+	e.writeString(name)
+}
+
+func (e *msgpackEncoder) endMap() {}
+
+func (e *msgpackEncoder) beginArray(n int, scalars bool) {
+	e.length(n, 0x90, 16, 0, 0xdc, 0xdd)
+}
+
+func (e *msgpackEncoder) endArray() {}
+
+func (e *msgpackEncoder) writeBool(v bool) {
+	if v {
+		e.buf = append(e.buf, 0xc3)
+	} else {
+		e.buf = append(e.buf, 0xc2)
+	}
+}
+
+func (e *msgpackEncoder) writeInt(v int64) {
+	switch {
+	case v >= 0:
+		e.writeUint(uint64(v))
+	case v >= -32:
+		e.buf = append(e.buf, byte(v))
+	case v >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		e.buf = append(e.buf, 0xd1, 0, 0)
+		binary.BigEndian.PutUint16(e.buf[len(e.buf)-2:], uint16(v))
+	case v >= math.MinInt32:
+		e.buf = append(e.buf, 0xd2, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(v))
+	default:
+		e.buf = append(e.buf, 0xd3, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], uint64(v))
+	}
+}
+
+func (e *msgpackEncoder) writeUint(v uint64) {
+	switch {
+	case v < 0x80:
+		e.buf = append(e.buf, byte(v))
+	case v <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd, 0, 0)
+		binary.BigEndian.PutUint16(e.buf[len(e.buf)-2:], uint16(v))
+	case v <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(v))
+	default:
+		e.buf = append(e.buf, 0xcf, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], v)
+	}
+}
+
+func (e *msgpackEncoder) writeFloat(f float64, bits int) {
+	if name, ok := nonFiniteFloatName(f); ok {
+		e.writeString(name)
+		return
+	}
+	if bits == 32 {
+		e.buf = append(e.buf, 0xca, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], math.Float32bits(float32(f)))
+		return
+	}
+	e.buf = append(e.buf, 0xcb, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], math.Float64bits(f))
+}
+
+func (e *msgpackEncoder) writeString(s string) {
+	e.length(len(s), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) writeBytes(b []byte) {
+	e.length(len(b), 0, 0, 0xc4, 0xc5, 0xc6)
+	e.buf = append(e.buf, b...)
+}
+
+func (e *msgpackEncoder) writeTime(sec uint32, nsec uint32) {
+	e.beginMap(2)
+	e.key("sec")
+	e.writeUint(uint64(sec))
+	e.key("nsec")
+	e.writeUint(uint64(nsec))
+}
+
+//	msgpackDecoder
+
+// next returns the next n bytes of input.
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.buf)-d.off {
+		return nil, errors.New("unexpected end of data at offset " + strconv.Itoa(d.off))
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+// uint reads a big endian unsigned integer of n bytes.
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// decode reads a single item.
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > msgpackMaxDepth {
+		return nil, errors.New("items nested too deeply")
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	format := b[0]
+	switch {
+	case format <= 0x7f:
+		return uint64(format), nil
+	case format >= 0xe0:
+		return int64(int8(format)), nil
+	case format <= 0x8f:
+		return d.decodeMap(int(format&0x0f), depth)
+	case format <= 0x9f:
+		return d.decodeArray(int(format&0x0f), depth)
+	case format <= 0xbf:
+		return d.decodeString(int(format & 0x1f))
+	}
+
+	switch format {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (format - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 0xca:
+		v, err := d.uint(4)
+		return math.Float32frombits(uint32(v)), err
+	case 0xcb:
+		v, err := d.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (format - 0xcc))
+	case 0xd0:
+		v, err := d.uint(1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := d.uint(2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := d.uint(4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := d.uint(8)
+		return int64(v), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (format - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (format - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (format - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(n), depth)
+	}
+	return nil, errors.New("unsupported format 0x" + strconv.FormatUint(uint64(format), 16) + " at offset " + strconv.Itoa(d.off-1))
+}
+
+func (d *msgpackDecoder) decodeString(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) decodeArray(n int, depth int) (interface{}, error) {
+	if n < 0 || n > len(d.buf)-d.off {
+		return nil, errors.New("array length out of range")
+	}
+	array := make([]interface{}, n)
+	for i := range array {
+		var err error
+		if array[i], err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return array, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int, depth int) (interface{}, error) {
+	if n < 0 || n > len(d.buf)-d.off {
+		return nil, errors.New("map length out of range")
+	}
+	object := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, errors.New("map keys must be strings")
+		}
+		if object[key], err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return object, nil
+}
+
+// ALL DONE.
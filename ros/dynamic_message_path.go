@@ -0,0 +1,521 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asimovsecurity/rosgo/libgengo"
+	"github.com/pkg/errors"
+)
+
+// DEFINE PUBLIC STRUCTURES.
+
+// FieldPathError is returned when a field path doesn't lead to a field of a message.
+type FieldPathError struct {
+	Path   string // The path being resolved.
+	Reason string // What went wrong.
+}
+
+// FieldTypeError is returned when a value can't be converted to the ROS type of the field it's being set on.
+type FieldTypeError struct {
+	Path     string      // The path of the field being set.
+	Expected string      // The ROS type of the field, for example `float64`, `uint8[4]` or `Pose[]`.
+	Value    interface{} // The offending value.
+	Reason   string      // Why the value was rejected when its Go type would otherwise do, for example because it's out of range.
+}
+
+// DEFINE PRIVATE STRUCTURES.
+
+// dynamicPathElement is a single dot-separated element of a field path, such as `poses[3]`.
+type dynamicPathElement struct {
+	name  string
+	index int // Array index, or -1 if the element doesn't index into an array.
+}
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	FieldPathError
+
+// Error describes the path error; required for error.
+func (e *FieldPathError) Error() string {
+	return "path " + e.Path + ": " + e.Reason
+}
+
+//	FieldTypeError
+
+// Error describes the type error; required for error.
+func (e *FieldTypeError) Error() string {
+	description := fmt.Sprintf("path %s: cannot use %v (%T) as %s", e.Path, e.Value, e.Value, e.Expected)
+	if e.Reason != "" {
+		description += ": " + e.Reason
+	}
+	return description
+}
+
+//	DynamicMessage
+
+// Get returns the value of the field at the given path, for example `header.stamp` or `poses[3].pose.position.x`.  Values are returned in the same representation
+// as they are held in Data(), so float fields come back as JsonFloat32/JsonFloat64 and nested messages as *DynamicMessage.  Paths which don't lead to a field
+// return a *FieldPathError.
+func (m *DynamicMessage) Get(path string) (interface{}, error) {
+	if m.dynamicType == nil || m.dynamicType.spec == nil {
+		return nil, errors.New("dynamic message type spec is nil")
+	}
+	elements, err := parseDynamicPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := m
+	for i, element := range elements {
+		_, value, err := msg.lookup(path, element)
+		if err != nil {
+			return nil, err
+		}
+		if i == len(elements)-1 {
+			return value, nil
+		}
+		if msg, err = nextDynamicMessage(path, element, value); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unreachable, paths always have at least one element.
+	return nil, nil
+}
+
+// Set sets the value of the field at the given path, converting it to the field's declared ROS type: any Go number will do for a numeric field as long as it
+// fits, time.Time and time.Duration are accepted for time and duration fields, and nested messages may be given as a *DynamicMessage of the right type or as
+// a map[string]interface{} of their fields.  Values which can't be converted return a *FieldTypeError, and paths which don't lead to a field a *FieldPathError.
+func (m *DynamicMessage) Set(path string, value interface{}) error {
+	if m.dynamicType == nil || m.dynamicType.spec == nil {
+		return errors.New("dynamic message type spec is nil")
+	}
+	elements, err := parseDynamicPath(path)
+	if err != nil {
+		return err
+	}
+	return m.set(path, elements, value)
+}
+
+// Walk calls fn for each field of the message, depth first and in declaration order.  Nested messages are passed to fn before their own fields, and each message
+// in an array of messages is passed to fn as `name[i]` before its fields.  Walk stops at, and returns, the first error returned by fn.
+func (m *DynamicMessage) Walk(fn func(path string, field *libgengo.Field, value interface{}) error) error {
+	return m.walk("", fn)
+}
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+// parseDynamicPath splits a field path such as `poses[3].pose.position.x` into its elements.
+func parseDynamicPath(path string) ([]dynamicPathElement, error) {
+	if path == "" {
+		return nil, &FieldPathError{Path: path, Reason: "empty path"}
+	}
+
+	parts := strings.Split(path, ".")
+	elements := make([]dynamicPathElement, len(parts))
+	for i, part := range parts {
+		element := dynamicPathElement{name: part, index: -1}
+		if open := strings.IndexByte(part, '['); open >= 0 {
+			if !strings.HasSuffix(part, "]") {
+				return nil, &FieldPathError{Path: path, Reason: "unterminated array index in " + part}
+			}
+			index, err := strconv.Atoi(part[open+1 : len(part)-1])
+			if err != nil || index < 0 {
+				return nil, &FieldPathError{Path: path, Reason: "invalid array index in " + part}
+			}
+			element.name, element.index = part[:open], index
+		}
+		if element.name == "" {
+			return nil, &FieldPathError{Path: path, Reason: "empty field name"}
+		}
+		elements[i] = element
+	}
+	return elements, nil
+}
+
+// nextDynamicMessage checks that the value found at a path element is a message, so that the path can carry on into it.
+func nextDynamicMessage(path string, element dynamicPathElement, value interface{}) (*DynamicMessage, error) {
+	msg, ok := value.(*DynamicMessage)
+	if !ok || msg == nil {
+		return nil, &FieldPathError{Path: path, Reason: element.name + " is not a message"}
+	}
+	return msg, nil
+}
+
+// dynamicFieldTypeName returns the ROS type of a field, as it would be written in a message definition.
+func dynamicFieldTypeName(field *libgengo.Field) string {
+	return strings.TrimSuffix(field.String(), " "+field.Name)
+}
+
+// coerceDynamicPrimitive converts value to the Go representation used for the primitive in DynamicMessage data.  If the Go type of the value is acceptable but
+// the value itself isn't, a reason is returned.
+func coerceDynamicPrimitive(prim dynamicPrimitive, value interface{}) (interface{}, string, bool) {
+	// Our own float wrappers are as good as the floats they hold.
+	switch v := value.(type) {
+	case JsonFloat32:
+		value = v.F
+	case JsonFloat64:
+		value = v.F
+	}
+
+	switch prim {
+	case dynamicBool:
+		v, ok := value.(bool)
+		return v, "", ok
+
+	case dynamicString:
+		v, ok := value.(string)
+		return v, "", ok
+
+	case dynamicTime:
+		switch v := value.(type) {
+		case Time:
+			return v, "", true
+		case time.Time:
+			if v.Before(time.Unix(0, 0)) || v.Unix() > math.MaxUint32 {
+				return nil, "out of range", true
+			}
+			result := Time{}
+			result.FromNSec(uint64(v.UnixNano()))
+			return result, "", true
+		}
+		return nil, "", false
+
+	case dynamicDuration:
+		switch v := value.(type) {
+		case Duration:
+			return v, "", true
+		case time.Duration:
+			if v < 0 {
+				return nil, "out of range", true
+			}
+			result := Duration{}
+			result.FromNSec(uint64(v))
+			return result, "", true
+		}
+		return nil, "", false
+
+	case dynamicFloat32, dynamicFloat64:
+		var f float64
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f = float64(rv.Uint())
+		case reflect.Float32, reflect.Float64:
+			f = rv.Float()
+		default:
+			return nil, "", false
+		}
+		if prim == dynamicFloat64 {
+			return JsonFloat64{F: f}, "", true
+		}
+		if !math.IsInf(f, 0) && math.IsInf(float64(float32(f)), 0) {
+			return nil, "out of range", true
+		}
+		return JsonFloat32{F: float32(f)}, "", true
+	}
+
+	// Everything else is an integer.  Break the value down into a sign and magnitude so we can check that it fits.
+	var negative bool
+	var magnitude uint64
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := rv.Int()
+		negative = n < 0
+		magnitude = uint64(n)
+		if negative {
+			magnitude = uint64(-n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		magnitude = rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || math.IsInf(f, 0) {
+			return nil, "not a whole number", true
+		}
+		if math.Abs(f) >= math.Exp2(64) {
+			return nil, "out of range", true
+		}
+		negative = f < 0
+		magnitude = uint64(math.Abs(f))
+	default:
+		return nil, "", false
+	}
+
+	bits := uint(dynamicPrimitiveSizes[prim] * 8)
+	switch prim {
+	case dynamicInt8, dynamicInt16, dynamicInt32, dynamicInt64:
+		limit := uint64(1) << (bits - 1)
+		if (!negative && magnitude >= limit) || magnitude > limit {
+			return nil, "out of range", true
+		}
+	default:
+		if negative || (bits < 64 && magnitude >= uint64(1)<<bits) {
+			return nil, "out of range", true
+		}
+	}
+
+	n := int64(magnitude)
+	if negative {
+		n = -n
+	}
+	switch prim {
+	case dynamicInt8:
+		return int8(n), "", true
+	case dynamicInt16:
+		return int16(n), "", true
+	case dynamicInt32:
+		return int32(n), "", true
+	case dynamicInt64:
+		return n, "", true
+	case dynamicUint8:
+		return uint8(magnitude), "", true
+	case dynamicUint16:
+		return uint16(magnitude), "", true
+	case dynamicUint32:
+		return uint32(magnitude), "", true
+	default:
+		return magnitude, "", true
+	}
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	DynamicMessageType
+
+// field looks up a field of the message type by name.
+func (t *DynamicMessageType) field(name string) *libgengo.Field {
+	if t.spec == nil {
+		return nil
+	}
+	for i := range t.spec.Fields {
+		if t.spec.Fields[i].Name == name {
+			return &t.spec.Fields[i]
+		}
+	}
+	return nil
+}
+
+// coerceElement converts value to the representation used in DynamicMessage data for a scalar field, or for an element of an array field.
+func (t *DynamicMessageType) coerceElement(path string, field *libgengo.Field, value interface{}) (interface{}, error) {
+	if field.IsBuiltin {
+		prim := dynamicPrimitives[field.GoType]
+		result, reason, ok := coerceDynamicPrimitive(prim, value)
+		if !ok || reason != "" {
+			return nil, &FieldTypeError{Path: path, Expected: field.Type, Value: value, Reason: reason}
+		}
+		return result, nil
+	}
+
+	// The field holds a nested message.
+	nested, err := t.getNestedTypeFromField(field)
+	if err != nil {
+		return nil, errors.Wrap(err, "Field: "+field.Name)
+	}
+	switch v := value.(type) {
+	case *DynamicMessage:
+		if v != nil && v.dynamicType != nil && v.dynamicType.Name() == nested.Name() {
+			return v, nil
+		}
+	case *DynamicMessageView:
+		if v != nil && v.dynamicType != nil && v.dynamicType.Name() == nested.Name() {
+			return v.Message()
+		}
+	case map[string]interface{}:
+		// Fill out a new message from the map, fields which aren't mentioned keep their default values.
+		msg := nested.NewDynamicMessage()
+		for name, fieldValue := range v {
+			if err := msg.set(path+"."+name, []dynamicPathElement{{name: name, index: -1}}, fieldValue); err != nil {
+				return nil, err
+			}
+		}
+		return msg, nil
+	}
+	return nil, &FieldTypeError{Path: path, Expected: field.Type, Value: value}
+}
+
+// coerceArray converts value to the typed slice used in DynamicMessage data for an array field.
+func (t *DynamicMessageType) coerceArray(path string, field *libgengo.Field, value interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, &FieldTypeError{Path: path, Expected: dynamicFieldTypeName(field), Value: value}
+	}
+	length := rv.Len()
+	if field.ArrayLen >= 0 && length != field.ArrayLen {
+		return nil, &FieldTypeError{Path: path, Expected: dynamicFieldTypeName(field), Value: value, Reason: fmt.Sprintf("found %d elements", length)}
+	}
+	if field.ArrayBound > 0 && length > field.ArrayBound {
+		return nil, &FieldTypeError{Path: path, Expected: dynamicFieldTypeName(field), Value: value, Reason: fmt.Sprintf("found %d elements", length)}
+	}
+
+	// Create a slice of the type we hand out.
+	var array reflect.Value
+	switch {
+	case !field.IsBuiltin:
+		array = reflect.ValueOf(make([]Message, length))
+	case field.GoType == "string":
+		array = reflect.ValueOf(make([]string, length))
+	default:
+		array = reflect.ValueOf(newDynamicArray(dynamicPrimitives[field.GoType], length))
+	}
+
+	// If we were given exactly that, there's nothing to convert.
+	if rv.Type() == array.Type() && field.IsBuiltin {
+		return value, nil
+	}
+
+	for i := 0; i < length; i++ {
+		element, err := t.coerceElement(fmt.Sprintf("%s[%d]", path, i), field, rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		array.Index(i).Set(reflect.ValueOf(element))
+	}
+	return array.Interface(), nil
+}
+
+//	DynamicMessage
+
+// lookup finds the field and the value of a single path element within the message.
+func (m *DynamicMessage) lookup(path string, element dynamicPathElement) (*libgengo.Field, interface{}, error) {
+	field := m.dynamicType.field(element.name)
+	if field == nil {
+		return nil, nil, &FieldPathError{Path: path, Reason: "no field " + element.name + " in " + m.dynamicType.Name()}
+	}
+	value, ok := m.data[element.name]
+	if !ok {
+		return nil, nil, &FieldPathError{Path: path, Reason: "no data for " + element.name}
+	}
+	if element.index < 0 {
+		return field, value, nil
+	}
+
+	// Pick out the array element.
+	if !field.IsArray {
+		return nil, nil, &FieldPathError{Path: path, Reason: element.name + " is not an array"}
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, nil, &FieldPathError{Path: path, Reason: element.name + " does not hold an array"}
+	}
+	if element.index >= rv.Len() {
+		return nil, nil, &FieldPathError{Path: path, Reason: fmt.Sprintf("index %d out of range for %s of length %d", element.index, element.name, rv.Len())}
+	}
+	return field, rv.Index(element.index).Interface(), nil
+}
+
+// set follows the path elements down to the field to set, then converts and stores the value.
+func (m *DynamicMessage) set(path string, elements []dynamicPathElement, value interface{}) error {
+	// Find the message holding the field.
+	msg := m
+	for _, element := range elements[:len(elements)-1] {
+		_, next, err := msg.lookup(path, element)
+		if err != nil {
+			return err
+		}
+		if msg, err = nextDynamicMessage(path, element, next); err != nil {
+			return err
+		}
+	}
+
+	element := elements[len(elements)-1]
+	field := msg.dynamicType.field(element.name)
+	if field == nil {
+		return &FieldPathError{Path: path, Reason: "no field " + element.name + " in " + msg.dynamicType.Name()}
+	}
+	if msg.data == nil {
+		msg.data = make(map[string]interface{})
+	}
+
+	// Setting a single element of an array is done in place.
+	if element.index >= 0 {
+		_, _, err := msg.lookup(path, element)
+		if err != nil {
+			return err
+		}
+		converted, err := msg.dynamicType.coerceElement(path, field, value)
+		if err != nil {
+			return err
+		}
+		target := reflect.ValueOf(msg.data[element.name]).Index(element.index)
+		convertedValue := reflect.ValueOf(converted)
+		if !convertedValue.Type().AssignableTo(target.Type()) {
+			return &FieldTypeError{Path: path, Expected: field.Type, Value: value, Reason: "array holds " + target.Type().String()}
+		}
+		target.Set(convertedValue)
+		return nil
+	}
+
+	var converted interface{}
+	var err error
+	if field.IsArray {
+		converted, err = msg.dynamicType.coerceArray(path, field, value)
+	} else {
+		converted, err = msg.dynamicType.coerceElement(path, field, value)
+	}
+	if err != nil {
+		return err
+	}
+	msg.data[element.name] = converted
+	return nil
+}
+
+// walk visits the fields of the message for Walk, prefixing their paths with prefix.
+func (m *DynamicMessage) walk(prefix string, fn func(path string, field *libgengo.Field, value interface{}) error) error {
+	if m.dynamicType == nil || m.dynamicType.spec == nil {
+		return errors.New("dynamic message type spec is nil")
+	}
+
+	for i := range m.dynamicType.spec.Fields {
+		field := &m.dynamicType.spec.Fields[i]
+		path := prefix + field.Name
+		value := m.data[field.Name]
+		if err := fn(path, field, value); err != nil {
+			return err
+		}
+		if field.IsBuiltin {
+			continue
+		}
+
+		// Carry on into nested messages.
+		if !field.IsArray {
+			if msg, ok := value.(*DynamicMessage); ok && msg != nil {
+				if err := msg.walk(path+".", fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			continue
+		}
+		for j := 0; j < rv.Len(); j++ {
+			elementPath := path + "[" + strconv.Itoa(j) + "]"
+			element := rv.Index(j).Interface()
+			if err := fn(elementPath, field, element); err != nil {
+				return err
+			}
+			if msg, ok := element.(*DynamicMessage); ok && msg != nil {
+				if err := msg.walk(elementPath+".", fn); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// All done.
+	return nil
+}
+
+// ALL DONE.
@@ -0,0 +1,167 @@
+package ros
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	gengo "github.com/asimovsecurity/rosgo/libgengo"
+	"github.com/pkg/errors"
+)
+
+// newPathTestMessage creates a message with nested messages and arrays to run paths through.
+func newPathTestMessage() *DynamicMessage {
+	innerType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "uint16", "u16", false, 0),
+			*gengo.NewField("Testing", "float32", "f32", false, 0),
+			*gengo.NewField("Testing", "string", "s", false, 0),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+	testMessageType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "Test", "inner", false, 0),
+			*gengo.NewField("Testing", "Test", "inners", true, -1),
+			*gengo.NewField("Testing", "int16", "i16", true, 3),
+			*gengo.NewField("Testing", "float64", "f64", true, -1),
+			*gengo.NewField("Testing", "int8", "i8", false, 0),
+			*gengo.NewField("Testing", "time", "t", false, 0),
+		}),
+		nested: map[string]*DynamicMessageType{"Testing/Test": innerType},
+	}
+
+	msg := testMessageType.NewDynamicMessage()
+	msg.data["inners"] = []Message{innerType.NewMessage(), innerType.NewMessage()}
+	return msg
+}
+
+func TestDynamicMessage_GetSet(t *testing.T) {
+	msg := newPathTestMessage()
+
+	sets := []struct {
+		path     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"i8", -3, int8(-3)},
+		{"i8", 12.0, int8(12)},
+		{"inner.u16", uint64(65535), uint16(65535)},
+		{"inner.f32", 1.5, JsonFloat32{F: 1.5}},
+		{"inner.s", "hello", "hello"},
+		{"inners[1].u16", int8(7), uint16(7)},
+		{"i16[2]", 300, int16(300)},
+		{"f64", []float32{1, 2.5}, []JsonFloat64{{F: 1}, {F: 2.5}}},
+		{"i16", []int16{1, 2, 3}, []int16{1, 2, 3}},
+		{"t", time.Unix(5, 6), NewTime(5, 6)},
+	}
+	for _, set := range sets {
+		if err := msg.Set(set.path, set.value); err != nil {
+			t.Fatalf("set %s failed %s", set.path, err)
+		}
+		value, err := msg.Get(set.path)
+		if err != nil {
+			t.Fatalf("get %s failed %s", set.path, err)
+		}
+		if !reflect.DeepEqual(value, set.expected) {
+			t.Fatalf("%s: expected %#v, got %#v", set.path, set.expected, value)
+		}
+	}
+
+	// The nested values are visible through the maps as well.
+	inners := msg.Data()["inners"].([]Message)
+	if inners[1].(*DynamicMessage).Data()["u16"] != uint16(7) {
+		t.Fatalf("unexpected nested data %v", inners[1])
+	}
+
+	// Nested messages can be replaced from a map.
+	if err := msg.Set("inners[0]", map[string]interface{}{"u16": 9, "s": "nine"}); err != nil {
+		t.Fatalf("set from map failed %s", err)
+	}
+	if value, _ := msg.Get("inners[0].s"); value != "nine" {
+		t.Fatalf("expected nine, got %v", value)
+	}
+	if value, _ := msg.Get("inners[0].f32"); value != (JsonFloat32{}) {
+		t.Fatalf("expected default value, got %v", value)
+	}
+}
+
+func TestDynamicMessage_Set_TypeErrors(t *testing.T) {
+	msg := newPathTestMessage()
+	otherType := &DynamicMessageType{spec: generateTestSpec(nil), nested: make(map[string]*DynamicMessageType)}
+	otherType.spec.FullName = "Testing/Other"
+
+	badSets := []struct {
+		path   string
+		value  interface{}
+		reason string
+	}{
+		{"i8", 128, "out of range"},
+		{"i8", -129, "out of range"},
+		{"inner.u16", -1, "out of range"},
+		{"i8", 1.5, "not a whole number"},
+		{"i8", "1", ""},
+		{"inner.s", 1, ""},
+		{"inner.f32", 1e300, "out of range"},
+		{"i16", []int{1, 2}, "found 2 elements"},
+		{"i16", 3, ""},
+		{"f64", []interface{}{1, "2"}, ""},
+		{"inner", otherType.NewDynamicMessage(), ""},
+		{"inners[0]", map[string]interface{}{"u16": "x"}, ""},
+		{"t", time.Unix(-1, 0), "out of range"},
+	}
+	for _, set := range badSets {
+		err := msg.Set(set.path, set.value)
+		var typeErr *FieldTypeError
+		if !errors.As(err, &typeErr) {
+			t.Fatalf("%s: expected FieldTypeError, got %v", set.path, err)
+		}
+		if typeErr.Reason != set.reason {
+			t.Fatalf("%s: expected reason %q, got %q", set.path, set.reason, typeErr.Reason)
+		}
+	}
+
+	badPaths := []string{"", "missing", "inner.missing", "i8.x", "i8[0]", "inners[2].s", "inners.s", "inner[0]", "f64[x]", "inner..s"}
+	for _, path := range badPaths {
+		var pathErr *FieldPathError
+		if _, err := msg.Get(path); !errors.As(err, &pathErr) {
+			t.Fatalf("get %q: expected FieldPathError, got %v", path, err)
+		}
+		if err := msg.Set(path, 1); !errors.As(err, &pathErr) {
+			t.Fatalf("set %q: expected FieldPathError, got %v", path, err)
+		}
+	}
+}
+
+func TestDynamicMessage_Walk(t *testing.T) {
+	msg := newPathTestMessage()
+
+	var paths []string
+	err := msg.Walk(func(path string, field *gengo.Field, value interface{}) error {
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk failed %s", err)
+	}
+
+	expected := []string{
+		"inner", "inner.u16", "inner.f32", "inner.s",
+		"inners", "inners[0]", "inners[0].u16", "inners[0].f32", "inners[0].s", "inners[1]", "inners[1].u16", "inners[1].f32", "inners[1].s",
+		"i16", "f64", "i8", "t",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+
+	// Errors stop the walk.
+	stop := errors.New("stop")
+	count := 0
+	err = msg.Walk(func(path string, field *gengo.Field, value interface{}) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Fatalf("expected walk to stop, got %v after %d fields", err, count)
+	}
+}
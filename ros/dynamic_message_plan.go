@@ -0,0 +1,935 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/asimovsecurity/rosgo/libgengo"
+	"github.com/pkg/errors"
+)
+
+// DEFINE PRIVATE STRUCTURES.
+
+// dynamicPrimitive enumerates the builtin ROS types so that the codec doesn't have to compare type strings per message.
+type dynamicPrimitive uint8
+
+const (
+	dynamicBool dynamicPrimitive = iota
+	dynamicInt8
+	dynamicInt16
+	dynamicInt32
+	dynamicInt64
+	dynamicUint8
+	dynamicUint16
+	dynamicUint32
+	dynamicUint64
+	dynamicFloat32
+	dynamicFloat64
+	dynamicString
+	dynamicTime
+	dynamicDuration
+	dynamicMessage // Not a primitive; a nested ROS message.
+)
+
+// dynamicOpKind enumerates the operations a dynamicPlan is made of.
+type dynamicOpKind uint8
+
+const (
+	dynamicOpFixedRun     dynamicOpKind = iota // A run of consecutive fixed-size scalar fields, encoded as a single block.
+	dynamicOpString                            // A scalar string.
+	dynamicOpArray                             // An array of fixed-size primitives.
+	dynamicOpStringArray                       // An array of strings.
+	dynamicOpMessage                           // A nested message.
+	dynamicOpMessageArray                      // An array of nested messages.
+)
+
+// dynamicRunField is a scalar field inside a fixed-size run, located at a byte offset from the start of the run.
+type dynamicRunField struct {
+	name   string
+	prim   dynamicPrimitive
+	offset int
+}
+
+// dynamicOp is a single step of a dynamicPlan.
+type dynamicOp struct {
+	kind       dynamicOpKind
+	field      *libgengo.Field     // The field handled by this op; nil for fixed-size runs.
+	prim       dynamicPrimitive    // The element type of the field.
+	size       int                 // Byte size of a fixed-size run, or of a single fixed-size array element.
+	run        []dynamicRunField   // The fields of a fixed-size run.
+	nested     *DynamicMessageType // The type of nested message fields.
+	nestedPlan *dynamicPlan        // The plan of nested message fields.
+}
+
+// dynamicFieldRef locates a field within a dynamicPlan: the op holding it, and its index in the run if the op is a fixed-size run.
+type dynamicFieldRef struct {
+	op  int
+	run int
+}
+
+// dynamicPlan is the compiled form of a DynamicMessageType: a flat list of ops which serialize and deserialize the message without consulting the message spec.
+type dynamicPlan struct {
+	ops       []dynamicOp
+	fields    map[string]dynamicFieldRef // Field name to location, for access by name.
+	numFields int
+	fixedSize int // Wire size of every message of this type, or -1 if the size depends on the content.
+}
+
+// DEFINE PRIVATE GLOBALS.
+
+// dynamicPrimitives maps the Go type of a builtin field onto its dynamicPrimitive.
+var dynamicPrimitives = map[string]dynamicPrimitive{
+	"bool":         dynamicBool,
+	"int8":         dynamicInt8,
+	"int16":        dynamicInt16,
+	"int32":        dynamicInt32,
+	"int64":        dynamicInt64,
+	"uint8":        dynamicUint8,
+	"uint16":       dynamicUint16,
+	"uint32":       dynamicUint32,
+	"uint64":       dynamicUint64,
+	"float32":      dynamicFloat32,
+	"float64":      dynamicFloat64,
+	"string":       dynamicString,
+	"ros.Time":     dynamicTime,
+	"ros.Duration": dynamicDuration,
+}
+
+// dynamicPrimitiveSizes holds the wire size of each primitive; 0 means variable size.
+var dynamicPrimitiveSizes = [...]int{
+	dynamicBool:     1,
+	dynamicInt8:     1,
+	dynamicInt16:    2,
+	dynamicInt32:    4,
+	dynamicInt64:    8,
+	dynamicUint8:    1,
+	dynamicUint16:   2,
+	dynamicUint32:   4,
+	dynamicUint64:   8,
+	dynamicFloat32:  4,
+	dynamicFloat64:  8,
+	dynamicString:   0,
+	dynamicTime:     8,
+	dynamicDuration: 8,
+	dynamicMessage:  0,
+}
+
+// dynamicPrimitiveNames holds the name of the Go type expected in the data map for each primitive, for error reporting.
+var dynamicPrimitiveNames = [...]string{
+	dynamicBool:     "bool",
+	dynamicInt8:     "int8",
+	dynamicInt16:    "int16",
+	dynamicInt32:    "int32",
+	dynamicInt64:    "int64",
+	dynamicUint8:    "uint8",
+	dynamicUint16:   "uint16",
+	dynamicUint32:   "uint32",
+	dynamicUint64:   "uint64",
+	dynamicFloat32:  "JsonFloat32",
+	dynamicFloat64:  "JsonFloat64",
+	dynamicString:   "string",
+	dynamicTime:     "ros.Time",
+	dynamicDuration: "ros.Duration",
+	dynamicMessage:  "Message",
+}
+
+// Size of the scratch space used when encoding and decoding; kept on the stack so that neither direction allocates for it.
+const dynamicChunkSize = 1024
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+// compileDynamicPlan flattens the spec of a DynamicMessageType into a dynamicPlan.  Nested types are compiled (and cached) along the way.
+func compileDynamicPlan(t *DynamicMessageType) (*dynamicPlan, error) {
+	if t.spec == nil {
+		return nil, errors.New("dynamic message type spec is nil")
+	}
+	if t.nested == nil {
+		return nil, errors.New("dynamic message type nested is nil")
+	}
+
+	plan := &dynamicPlan{numFields: len(t.spec.Fields), fields: make(map[string]dynamicFieldRef, len(t.spec.Fields))}
+	fixed := true
+
+	for i := range t.spec.Fields {
+		field := &t.spec.Fields[i]
+
+		// Work out what we are dealing with.
+		op := dynamicOp{field: field, prim: dynamicMessage}
+		if field.IsBuiltin {
+			prim, ok := dynamicPrimitives[field.GoType]
+			if !ok {
+				// Something went wrong.
+				return nil, errors.New("Field: " + field.Name + ": we haven't implemented this primitive yet")
+			}
+			op.prim = prim
+			op.size = dynamicPrimitiveSizes[prim]
+		} else {
+			// The type encapsulates another ROS message, so we need its plan too.
+			nested, err := t.getNestedTypeFromField(field)
+			if err != nil {
+				return nil, errors.Wrap(err, "Field: "+field.Name)
+			}
+			nestedPlan, err := nested.getPlan()
+			if err != nil {
+				return nil, errors.Wrap(err, "Field: "+field.Name)
+			}
+			op.nested = nested
+			op.nestedPlan = nestedPlan
+			op.size = nestedPlan.fixedSize
+		}
+
+		// Scalar fixed-size primitives are merged into runs, everything else gets its own op.
+		switch {
+		case !field.IsArray && op.prim != dynamicMessage && op.size > 0:
+			if n := len(plan.ops); n == 0 || plan.ops[n-1].kind != dynamicOpFixedRun {
+				plan.ops = append(plan.ops, dynamicOp{kind: dynamicOpFixedRun})
+			}
+			run := &plan.ops[len(plan.ops)-1]
+			plan.fields[field.Name] = dynamicFieldRef{op: len(plan.ops) - 1, run: len(run.run)}
+			run.run = append(run.run, dynamicRunField{name: field.Name, prim: op.prim, offset: run.size})
+			run.size += op.size
+			plan.fixedSize += op.size
+			continue
+		case !field.IsArray && op.prim == dynamicString:
+			op.kind = dynamicOpString
+		case !field.IsArray:
+			op.kind = dynamicOpMessage
+		case op.prim == dynamicString:
+			op.kind = dynamicOpStringArray
+		case op.prim == dynamicMessage:
+			op.kind = dynamicOpMessageArray
+		default:
+			op.kind = dynamicOpArray
+		}
+
+		// Keep track of whether the message still has a fixed wire size.
+		if op.kind == dynamicOpString || op.kind == dynamicOpStringArray || field.ArrayLen < 0 && field.IsArray || op.prim == dynamicMessage && op.size < 0 {
+			fixed = false
+		} else if field.IsArray {
+			plan.fixedSize += op.size * field.ArrayLen
+		} else {
+			plan.fixedSize += op.size
+		}
+		plan.fields[field.Name] = dynamicFieldRef{op: len(plan.ops), run: -1}
+		plan.ops = append(plan.ops, op)
+	}
+
+	if !fixed {
+		plan.fixedSize = -1
+	}
+
+	// All done.
+	return plan, nil
+}
+
+// decodeDynamicScalar decodes a fixed-size primitive from the start of raw.
+func decodeDynamicScalar(prim dynamicPrimitive, raw []byte) interface{} {
+	switch prim {
+	case dynamicBool:
+		return raw[0] != 0x00
+	case dynamicInt8:
+		return int8(raw[0])
+	case dynamicInt16:
+		return int16(binary.LittleEndian.Uint16(raw))
+	case dynamicInt32:
+		return int32(binary.LittleEndian.Uint32(raw))
+	case dynamicInt64:
+		return int64(binary.LittleEndian.Uint64(raw))
+	case dynamicUint8:
+		return raw[0]
+	case dynamicUint16:
+		return binary.LittleEndian.Uint16(raw)
+	case dynamicUint32:
+		return binary.LittleEndian.Uint32(raw)
+	case dynamicUint64:
+		return binary.LittleEndian.Uint64(raw)
+	case dynamicFloat32:
+		return JsonFloat32{F: math.Float32frombits(binary.LittleEndian.Uint32(raw))}
+	case dynamicFloat64:
+		return JsonFloat64{F: math.Float64frombits(binary.LittleEndian.Uint64(raw))}
+	case dynamicTime:
+		return Time{temporal{Sec: binary.LittleEndian.Uint32(raw), NSec: binary.LittleEndian.Uint32(raw[4:])}}
+	case dynamicDuration:
+		return Duration{temporal{Sec: binary.LittleEndian.Uint32(raw), NSec: binary.LittleEndian.Uint32(raw[4:])}}
+	}
+	return nil
+}
+
+// encodeDynamicScalar encodes a fixed-size primitive into the start of raw.  Returns false if the item isn't of the Go type expected for the primitive.
+func encodeDynamicScalar(prim dynamicPrimitive, raw []byte, item interface{}) bool {
+	switch prim {
+	case dynamicBool:
+		v, ok := item.(bool)
+		if !ok {
+			return false
+		}
+		raw[0] = 0x00
+		if v {
+			raw[0] = 0x01
+		}
+	case dynamicInt8:
+		v, ok := item.(int8)
+		if !ok {
+			return false
+		}
+		raw[0] = uint8(v)
+	case dynamicInt16:
+		v, ok := item.(int16)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint16(raw, uint16(v))
+	case dynamicInt32:
+		v, ok := item.(int32)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint32(raw, uint32(v))
+	case dynamicInt64:
+		v, ok := item.(int64)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint64(raw, uint64(v))
+	case dynamicUint8:
+		v, ok := item.(uint8)
+		if !ok {
+			return false
+		}
+		raw[0] = v
+	case dynamicUint16:
+		v, ok := item.(uint16)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint16(raw, v)
+	case dynamicUint32:
+		v, ok := item.(uint32)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint32(raw, v)
+	case dynamicUint64:
+		v, ok := item.(uint64)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint64(raw, v)
+	case dynamicFloat32:
+		v, ok := item.(JsonFloat32)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint32(raw, math.Float32bits(v.F))
+	case dynamicFloat64:
+		v, ok := item.(JsonFloat64)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint64(raw, math.Float64bits(v.F))
+	case dynamicTime:
+		v, ok := item.(Time)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint32(raw, v.Sec)
+		binary.LittleEndian.PutUint32(raw[4:], v.NSec)
+	case dynamicDuration:
+		v, ok := item.(Duration)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint32(raw, v.Sec)
+		binary.LittleEndian.PutUint32(raw[4:], v.NSec)
+	default:
+		return false
+	}
+	return true
+}
+
+// newDynamicArray allocates the typed slice used in the data map for an array of primitives.
+func newDynamicArray(prim dynamicPrimitive, size int) interface{} {
+	switch prim {
+	case dynamicBool:
+		return make([]bool, size)
+	case dynamicInt8:
+		return make([]int8, size)
+	case dynamicInt16:
+		return make([]int16, size)
+	case dynamicInt32:
+		return make([]int32, size)
+	case dynamicInt64:
+		return make([]int64, size)
+	case dynamicUint8:
+		return make([]uint8, size)
+	case dynamicUint16:
+		return make([]uint16, size)
+	case dynamicUint32:
+		return make([]uint32, size)
+	case dynamicUint64:
+		return make([]uint64, size)
+	case dynamicFloat32:
+		return make([]JsonFloat32, size)
+	case dynamicFloat64:
+		return make([]JsonFloat64, size)
+	case dynamicTime:
+		return make([]Time, size)
+	case dynamicDuration:
+		return make([]Duration, size)
+	}
+	return nil
+}
+
+// decodeDynamicChunk decodes the elements held in raw into array, starting at element start.
+func decodeDynamicChunk(array interface{}, start int, raw []byte) {
+	switch v := array.(type) {
+	case []bool:
+		for i, b := range raw {
+			v[start+i] = b != 0x00
+		}
+	case []int8:
+		for i, b := range raw {
+			v[start+i] = int8(b)
+		}
+	case []int16:
+		for i := range v[start : start+len(raw)/2] {
+			v[start+i] = int16(binary.LittleEndian.Uint16(raw[2*i:]))
+		}
+	case []int32:
+		for i := range v[start : start+len(raw)/4] {
+			v[start+i] = int32(binary.LittleEndian.Uint32(raw[4*i:]))
+		}
+	case []int64:
+		for i := range v[start : start+len(raw)/8] {
+			v[start+i] = int64(binary.LittleEndian.Uint64(raw[8*i:]))
+		}
+	case []uint8:
+		copy(v[start:], raw)
+	case []uint16:
+		for i := range v[start : start+len(raw)/2] {
+			v[start+i] = binary.LittleEndian.Uint16(raw[2*i:])
+		}
+	case []uint32:
+		for i := range v[start : start+len(raw)/4] {
+			v[start+i] = binary.LittleEndian.Uint32(raw[4*i:])
+		}
+	case []uint64:
+		for i := range v[start : start+len(raw)/8] {
+			v[start+i] = binary.LittleEndian.Uint64(raw[8*i:])
+		}
+	case []JsonFloat32:
+		for i := range v[start : start+len(raw)/4] {
+			v[start+i].F = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+		}
+	case []JsonFloat64:
+		for i := range v[start : start+len(raw)/8] {
+			v[start+i].F = math.Float64frombits(binary.LittleEndian.Uint64(raw[8*i:]))
+		}
+	case []Time:
+		for i := range v[start : start+len(raw)/8] {
+			v[start+i].Sec = binary.LittleEndian.Uint32(raw[8*i:])
+			v[start+i].NSec = binary.LittleEndian.Uint32(raw[8*i+4:])
+		}
+	case []Duration:
+		for i := range v[start : start+len(raw)/8] {
+			v[start+i].Sec = binary.LittleEndian.Uint32(raw[8*i:])
+			v[start+i].NSec = binary.LittleEndian.Uint32(raw[8*i+4:])
+		}
+	}
+}
+
+// encodeDynamicChunk encodes the elements of array starting at element start into raw.  Returns false if array isn't the typed slice expected for the primitive.
+func encodeDynamicChunk(prim dynamicPrimitive, array interface{}, start int, raw []byte) bool {
+	switch prim {
+	case dynamicBool:
+		v, ok := array.([]bool)
+		if !ok {
+			return false
+		}
+		for i, b := range v[start : start+len(raw)] {
+			raw[i] = 0x00
+			if b {
+				raw[i] = 0x01
+			}
+		}
+	case dynamicInt8:
+		v, ok := array.([]int8)
+		if !ok {
+			return false
+		}
+		for i, b := range v[start : start+len(raw)] {
+			raw[i] = uint8(b)
+		}
+	case dynamicInt16:
+		v, ok := array.([]int16)
+		if !ok {
+			return false
+		}
+		for i, x := range v[start : start+len(raw)/2] {
+			binary.LittleEndian.PutUint16(raw[2*i:], uint16(x))
+		}
+	case dynamicInt32:
+		v, ok := array.([]int32)
+		if !ok {
+			return false
+		}
+		for i, x := range v[start : start+len(raw)/4] {
+			binary.LittleEndian.PutUint32(raw[4*i:], uint32(x))
+		}
+	case dynamicInt64:
+		v, ok := array.([]int64)
+		if !ok {
+			return false
+		}
+		for i, x := range v[start : start+len(raw)/8] {
+			binary.LittleEndian.PutUint64(raw[8*i:], uint64(x))
+		}
+	case dynamicUint8:
+		v, ok := array.([]uint8)
+		if !ok {
+			return false
+		}
+		copy(raw, v[start:])
+	case dynamicUint16:
+		v, ok := array.([]uint16)
+		if !ok {
+			return false
+		}
+		for i, x := range v[start : start+len(raw)/2] {
+			binary.LittleEndian.PutUint16(raw[2*i:], x)
+		}
+	case dynamicUint32:
+		v, ok := array.([]uint32)
+		if !ok {
+			return false
+		}
+		for i, x := range v[start : start+len(raw)/4] {
+			binary.LittleEndian.PutUint32(raw[4*i:], x)
+		}
+	case dynamicUint64:
+		v, ok := array.([]uint64)
+		if !ok {
+			return false
+		}
+		for i, x := range v[start : start+len(raw)/8] {
+			binary.LittleEndian.PutUint64(raw[8*i:], x)
+		}
+	case dynamicFloat32:
+		v, ok := array.([]JsonFloat32)
+		if !ok {
+			return false
+		}
+		for i, x := range v[start : start+len(raw)/4] {
+			binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(x.F))
+		}
+	case dynamicFloat64:
+		v, ok := array.([]JsonFloat64)
+		if !ok {
+			return false
+		}
+		for i, x := range v[start : start+len(raw)/8] {
+			binary.LittleEndian.PutUint64(raw[8*i:], math.Float64bits(x.F))
+		}
+	case dynamicTime:
+		v, ok := array.([]Time)
+		if !ok {
+			return false
+		}
+		for i, x := range v[start : start+len(raw)/8] {
+			binary.LittleEndian.PutUint32(raw[8*i:], x.Sec)
+			binary.LittleEndian.PutUint32(raw[8*i+4:], x.NSec)
+		}
+	case dynamicDuration:
+		v, ok := array.([]Duration)
+		if !ok {
+			return false
+		}
+		for i, x := range v[start : start+len(raw)/8] {
+			binary.LittleEndian.PutUint32(raw[8*i:], x.Sec)
+			binary.LittleEndian.PutUint32(raw[8*i+4:], x.NSec)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// decodeDynamicSize decodes the uint32 length prefix of strings and dynamic arrays.
+func decodeDynamicSize(buf *bytes.Reader) (int, error) {
+	var raw [4]byte
+	if n, _ := buf.Read(raw[:]); n != len(raw) {
+		return 0, errors.New("Could not read 4 bytes from buffer")
+	}
+	return int(binary.LittleEndian.Uint32(raw[:])), nil
+}
+
+// encodeDynamicSize encodes the uint32 length prefix of strings and dynamic arrays.
+func encodeDynamicSize(buf *bytes.Buffer, size int) {
+	var raw [4]byte
+	binary.LittleEndian.PutUint32(raw[:], uint32(size))
+	buf.Write(raw[:])
+}
+
+// decodeDynamicString decodes a length-prefixed string.
+func decodeDynamicString(buf *bytes.Reader) (string, error) {
+	size, err := decodeDynamicSize(buf)
+	if err != nil {
+		return "", errors.Wrap(err, "decoding string")
+	}
+	if err := CheckSize(buf, size); err != nil {
+		return "", errors.Wrap(err, "decoding string")
+	}
+	// Short strings are staged on the stack so that the string itself is the only allocation.
+	var scratch [128]byte
+	var raw []byte
+	if size <= len(scratch) {
+		raw = scratch[:size]
+	} else {
+		raw = make([]byte, size)
+	}
+	buf.Read(raw)
+	return string(raw), nil
+}
+
+// decodeDynamicArray decodes size fixed-size primitives into a newly allocated typed slice.  The elements are staged through a stack buffer, so the slice
+// is the only allocation.
+func decodeDynamicArray(buf *bytes.Reader, prim dynamicPrimitive, size int) (interface{}, error) {
+	elemSize := dynamicPrimitiveSizes[prim]
+	if err := CheckSize(buf, size*elemSize); err != nil {
+		return nil, errors.Wrap(err, "decoding "+dynamicPrimitiveNames[prim]+" array")
+	}
+
+	array := newDynamicArray(prim, size)
+
+	// Byte arrays can be read straight into place.
+	if v, ok := array.([]uint8); ok {
+		buf.Read(v)
+		return v, nil
+	}
+
+	var chunk [dynamicChunkSize]byte
+	perChunk := len(chunk) / elemSize
+	for start := 0; start < size; start += perChunk {
+		count := size - start
+		if count > perChunk {
+			count = perChunk
+		}
+		raw := chunk[:count*elemSize]
+		buf.Read(raw)
+		decodeDynamicChunk(array, start, raw)
+	}
+	return array, nil
+}
+
+// encodeDynamicArray encodes the first size elements of array, zero-padding if the array is shorter.  Arrays which aren't the expected typed slice (for
+// instance a []interface{}) are encoded element by element.
+func encodeDynamicArray(buf *bytes.Buffer, field *libgengo.Field, prim dynamicPrimitive, array interface{}, length, size int) error {
+	elemSize := dynamicPrimitiveSizes[prim]
+	count := length
+	if count > size {
+		count = size
+	}
+
+	var chunk [dynamicChunkSize]byte
+	perChunk := len(chunk) / elemSize
+	for start := 0; start < count; start += perChunk {
+		n := count - start
+		if n > perChunk {
+			n = perChunk
+		}
+		raw := chunk[:n*elemSize]
+		if !encodeDynamicChunk(prim, array, start, raw) {
+			// Not the typed slice we hand out, so fall back to checking each of the elements.
+			arrayValue := reflect.ValueOf(array)
+			for i := 0; i < n; i++ {
+				item := arrayValue.Index(start + i).Interface()
+				if !encodeDynamicScalar(prim, raw[i*elemSize:], item) {
+					return errors.New(fmt.Sprintf("Field: %s: Found %T, expected %s.", field.Name, item, dynamicPrimitiveNames[prim]))
+				}
+			}
+		}
+		buf.Write(raw)
+	}
+
+	// Fixed length arrays are padded out with zero values.
+	if count < size {
+		for i := range chunk {
+			chunk[i] = 0x00
+		}
+		for padding := (size - count) * elemSize; padding > 0; padding -= len(chunk) {
+			if padding < len(chunk) {
+				buf.Write(chunk[:padding])
+			} else {
+				buf.Write(chunk[:])
+			}
+		}
+	}
+	return nil
+}
+
+// encodeDynamicNested serializes a nested message after checking it is of the expected type.
+func encodeDynamicNested(buf *bytes.Buffer, field *libgengo.Field, item interface{}) error {
+	msg, ok := item.(dynamicMessageLike)
+	if !ok || msg == nil || reflect.ValueOf(msg).Kind() == reflect.Ptr && reflect.ValueOf(msg).IsNil() {
+		return errors.New(fmt.Sprintf("Field: %s: Found %T, expected Message.", field.Name, item))
+	}
+	msgType := msg.GetDynamicType()
+	if msgType == nil || msgType.spec == nil {
+		return errors.New("Field: " + field.Name + ": nil pointer to MsgSpec")
+	}
+	if msgType.spec.ShortName != field.Type {
+		return errors.New("Field: " + field.Name + ": Found msg " + msgType.spec.ShortName + ", expected " + field.Type + ".")
+	}
+	// Otherwise, we just recursively serialise it.
+	if err := msg.Serialize(buf); err != nil {
+		return errors.Wrap(err, "Field: "+field.Name)
+	}
+	return nil
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	DynamicMessageType
+
+// getPlan returns the compiled dynamicPlan of the type, compiling it on first use.
+func (t *DynamicMessageType) getPlan() (*dynamicPlan, error) {
+	if plan, ok := t.plan.Load().(*dynamicPlan); ok {
+		return plan, nil
+	}
+	plan, err := compileDynamicPlan(t)
+	if err != nil {
+		return nil, err
+	}
+	// Compilation is deterministic, so if two goroutines race here it doesn't matter who wins.
+	t.plan.Store(plan)
+	return plan, nil
+}
+
+//	dynamicPlan
+
+// decode parses a TCPROS byte stream into data.
+func (p *dynamicPlan) decode(buf *bytes.Reader, data map[string]interface{}) error {
+	for i := range p.ops {
+		op := &p.ops[i]
+
+		switch op.kind {
+		case dynamicOpFixedRun:
+			// The whole run is read in one go, then split up into fields.
+			if buf.Len() < op.size {
+				return errors.Wrap(errors.New("buffer size too small"), "Field: "+op.run[0].name)
+			}
+			var scratch [64]byte
+			var raw []byte
+			if op.size <= len(scratch) {
+				raw = scratch[:op.size]
+			} else {
+				raw = make([]byte, op.size)
+			}
+			buf.Read(raw)
+			for _, field := range op.run {
+				data[field.name] = decodeDynamicScalar(field.prim, raw[field.offset:])
+			}
+
+		case dynamicOpString:
+			value, err := decodeDynamicString(buf)
+			if err != nil {
+				return errors.Wrap(err, "Field: "+op.field.Name)
+			}
+			data[op.field.Name] = value
+
+		case dynamicOpMessage:
+			msg, err := op.nestedPlan.decodeMessage(buf, op.nested)
+			if err != nil {
+				return errors.Wrap(err, "Field: "+op.field.Name)
+			}
+			data[op.field.Name] = msg
+
+		default:
+			// It's an array. If the array is not a fixed length, it begins with a declaration of the array size.
+			size := op.field.ArrayLen
+			if size < 0 {
+				var err error
+				if size, err = decodeDynamicSize(buf); err != nil {
+					return errors.Wrap(err, "Field: "+op.field.Name)
+				}
+			}
+
+			switch op.kind {
+			case dynamicOpArray:
+				array, err := decodeDynamicArray(buf, op.prim, size)
+				if err != nil {
+					return errors.Wrap(err, "Field: "+op.field.Name)
+				}
+				data[op.field.Name] = array
+
+			case dynamicOpStringArray:
+				// Use minimum string byte size = 4.
+				if err := CheckSize(buf, size*4); err != nil {
+					return errors.Wrap(errors.Wrap(err, "decoding string array"), "Field: "+op.field.Name)
+				}
+				array := make([]string, size)
+				for j := range array {
+					value, err := decodeDynamicString(buf)
+					if err != nil {
+						return errors.Wrap(errors.Wrap(err, "decoding string array"), "Field: "+op.field.Name)
+					}
+					array[j] = value
+				}
+				data[op.field.Name] = array
+
+			case dynamicOpMessageArray:
+				// Not an exact check for variable size messages, but at least prevents an impossible allocation.
+				minSize := size
+				if op.nestedPlan.fixedSize > 0 {
+					minSize = size * op.nestedPlan.fixedSize
+				}
+				if err := CheckSize(buf, minSize); err != nil {
+					return errors.Wrap(errors.Wrap(err, "decoding message array"), "Field: "+op.field.Name)
+				}
+				array := make([]Message, size)
+				for j := range array {
+					msg, err := op.nestedPlan.decodeMessage(buf, op.nested)
+					if err != nil {
+						return errors.Wrap(errors.Wrap(err, "decoding message array"), "Field: "+op.field.Name)
+					}
+					array[j] = msg
+				}
+				data[op.field.Name] = array
+			}
+		}
+	}
+
+	// All done.
+	return nil
+}
+
+// decodeMessage parses a nested message of type msgType, which must be the type this plan was compiled from.
+func (p *dynamicPlan) decodeMessage(buf *bytes.Reader, msgType *DynamicMessageType) (*DynamicMessage, error) {
+	// Skip the zero value initialization, this would just get discarded anyway.
+	data := make(map[string]interface{}, p.numFields)
+	if err := p.decode(buf, data); err != nil {
+		return nil, errors.Wrap(err, "decoding message")
+	}
+	return &DynamicMessage{dynamicType: msgType, data: data}, nil
+}
+
+// encode converts data into a TCPROS byte stream.
+func (p *dynamicPlan) encode(buf *bytes.Buffer, data map[string]interface{}) error {
+	for i := range p.ops {
+		op := &p.ops[i]
+
+		if op.kind == dynamicOpFixedRun {
+			// The whole run is assembled on the stack, then written in one go.
+			var scratch [64]byte
+			var raw []byte
+			if op.size <= len(scratch) {
+				raw = scratch[:op.size]
+			} else {
+				raw = make([]byte, op.size)
+			}
+			for _, field := range op.run {
+				item, ok := data[field.name]
+				if !ok {
+					return errors.New("Field: " + field.name + ": No data found.")
+				}
+				if !encodeDynamicScalar(field.prim, raw[field.offset:], item) {
+					return errors.New(fmt.Sprintf("Field: %s: Found %T, expected %s.", field.name, item, dynamicPrimitiveNames[field.prim]))
+				}
+			}
+			buf.Write(raw)
+			continue
+		}
+
+		// Look up the item.
+		item, ok := data[op.field.Name]
+		if !ok {
+			return errors.New("Field: " + op.field.Name + ": No data found.")
+		}
+
+		switch op.kind {
+		case dynamicOpString:
+			str, ok := item.(string)
+			if !ok {
+				return errors.New(fmt.Sprintf("Field: %s: Found %T, expected string.", op.field.Name, item))
+			}
+			// The string should start with a declaration of the number of characters.
+			encodeDynamicSize(buf, len(str))
+			buf.WriteString(str)
+
+		case dynamicOpMessage:
+			if err := encodeDynamicNested(buf, op.field, item); err != nil {
+				return err
+			}
+
+		default:
+			// It's an array.
+			arrayValue := reflect.ValueOf(item)
+			if arrayValue.Kind() != reflect.Array && arrayValue.Kind() != reflect.Slice {
+				return errors.New("Field: " + op.field.Name + ": expected an array.")
+			}
+			length := arrayValue.Len()
+
+			// If the array is not a fixed length, it begins with a declaration of the array size. Fixed length arrays are truncated or padded to fit.
+			size := op.field.ArrayLen
+			if size < 0 {
+				size = length
+				encodeDynamicSize(buf, size)
+			}
+
+			switch op.kind {
+			case dynamicOpArray:
+				if err := encodeDynamicArray(buf, op.field, op.prim, item, length, size); err != nil {
+					return err
+				}
+
+			case dynamicOpStringArray:
+				strs, typed := item.([]string)
+				for j := 0; j < size; j++ {
+					// Padding uses empty strings.
+					var str string
+					if typed && j < length {
+						str = strs[j]
+					} else if j < length {
+						element := arrayValue.Index(j).Interface()
+						if str, ok = element.(string); !ok {
+							return errors.New(fmt.Sprintf("Field: %s: Found %T, expected string.", op.field.Name, element))
+						}
+					}
+					encodeDynamicSize(buf, len(str))
+					buf.WriteString(str)
+				}
+
+			case dynamicOpMessageArray:
+				msgs, typed := item.([]Message)
+				var padding *DynamicMessage
+				for j := 0; j < size; j++ {
+					var element interface{}
+					if j >= length {
+						// Padding uses zeroed messages, as it does zero values for other arrays.
+						if padding == nil {
+							padding = op.nested.NewDynamicMessage()
+						}
+						element = padding
+					} else if typed {
+						element = msgs[j]
+					} else {
+						element = arrayValue.Index(j).Interface()
+					}
+					if err := encodeDynamicNested(buf, op.field, element); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	// All done.
+	return nil
+}
+
+// ALL DONE.
@@ -0,0 +1,852 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/asimovsecurity/rosgo/libgengo"
+	"github.com/pkg/errors"
+)
+
+// DEFINE PUBLIC STRUCTURES.
+
+// ProtoDescriptor describes a .proto file generated by GenerateProtoDescriptor.  Each ROS message type has a file of its own, in a protobuf package named
+// after its ROS package, so `geometry_msgs/Pose` becomes `ros.geometry_msgs.Pose` in `ros/geometry_msgs/Pose.proto`.  Time and duration become `ros.Time`
+// and `ros.Duration`, which every file using them imports from `ros/time.proto`.  Files are the same whichever type they were generated for, so the files
+// of any number of types can be loaded together, so long as each file name is only loaded once.
+type ProtoDescriptor struct {
+	FileName string   // Name of the .proto file, such as `ros/geometry_msgs/Pose.proto`.
+	Package  string   // Protobuf package, such as `ros.geometry_msgs`.
+	Message  string   // Fully qualified name of the message, such as `ros.geometry_msgs.Pose`; empty for `ros/time.proto`.
+	Imports  []string // Names of the files the file imports.
+	rosName  string
+	messages []*protoMessage
+	imports  []*ProtoDescriptor
+}
+
+// DEFINE PRIVATE STRUCTURES.
+
+// protoMessage is the protobuf equivalent of a single ROS message type.
+type protoMessage struct {
+	name      string
+	fields    []protoField
+	constants []libgengo.Constant
+}
+
+// protoField is a field of a protoMessage.
+type protoField struct {
+	name     string
+	number   int
+	repeated bool
+	kind     int    // One of the FieldDescriptorProto.Type values.
+	typeName string // Fully qualified name of message types, with a leading dot.
+	comment  string // What the protobuf type leaves out about the ROS type.
+}
+
+// DEFINE PRIVATE GLOBALS.
+
+// Protobuf wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// FieldDescriptorProto.Type values.
+const (
+	protoTypeDouble  = 1
+	protoTypeFloat   = 2
+	protoTypeUint64  = 4
+	protoTypeInt32   = 5
+	protoTypeBool    = 8
+	protoTypeString  = 9
+	protoTypeMessage = 11
+	protoTypeBytes   = 12
+	protoTypeUint32  = 13
+	protoTypeSint32  = 17
+	protoTypeSint64  = 18
+)
+
+// protoTypeNames holds the .proto names of the FieldDescriptorProto.Type values we use.
+var protoTypeNames = map[int]string{
+	protoTypeDouble: "double",
+	protoTypeFloat:  "float",
+	protoTypeUint64: "uint64",
+	protoTypeInt32:  "int32",
+	protoTypeBool:   "bool",
+	protoTypeString: "string",
+	protoTypeBytes:  "bytes",
+	protoTypeUint32: "uint32",
+	protoTypeSint32: "sint32",
+	protoTypeSint64: "sint64",
+}
+
+// protoPrimitiveTypes maps primitives to the protobuf types they're encoded as.  Signed integers are zigzag encoded, as they are as likely to be
+// negative as not.
+var protoPrimitiveTypes = [...]int{
+	dynamicBool:    protoTypeBool,
+	dynamicInt8:    protoTypeSint32,
+	dynamicInt16:   protoTypeSint32,
+	dynamicInt32:   protoTypeSint32,
+	dynamicInt64:   protoTypeSint64,
+	dynamicUint8:   protoTypeUint32,
+	dynamicUint16:  protoTypeUint32,
+	dynamicUint32:  protoTypeUint32,
+	dynamicUint64:  protoTypeUint64,
+	dynamicFloat32: protoTypeFloat,
+	dynamicFloat64: protoTypeDouble,
+	dynamicString:  protoTypeString,
+}
+
+// protoTemporalMessages are the messages time and duration are encoded as.  ROS durations are signed, and times aren't.
+var protoTemporalMessages = []*protoMessage{
+	{name: "Duration", fields: []protoField{{name: "sec", number: 1, kind: protoTypeInt32}, {name: "nsec", number: 2, kind: protoTypeInt32}}},
+	{name: "Time", fields: []protoField{{name: "sec", number: 1, kind: protoTypeUint32}, {name: "nsec", number: 2, kind: protoTypeUint32}}},
+}
+
+// protoTimeDescriptor is the file every generated file using time or duration imports them from.
+var protoTimeDescriptor = &ProtoDescriptor{FileName: "ros/time.proto", Package: "ros", messages: protoTemporalMessages}
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	DynamicMessageType
+
+// GenerateProtoDescriptor generates the .proto file of the message type; Files returns it along with the files it imports, those of every type nested
+// within it.  Each field of a ROS message becomes the protobuf field numbered by its position in the message definition.  Arrays become repeated fields,
+// except for uint8 and char arrays, which become bytes; fixed array lengths, and the width of narrow integers, are only noted in comments.  See
+// MarshalProto for the encoding of messages.
+func (t *DynamicMessageType) GenerateProtoDescriptor() (*ProtoDescriptor, error) {
+	if t.spec == nil {
+		return nil, errors.New("dynamic message type spec is nil")
+	}
+	return t.protoDescriptor(make(map[string]*ProtoDescriptor))
+}
+
+//	ProtoDescriptor
+
+// Files returns the descriptor and every file it imports, directly or not, each file after those it imports.
+func (d *ProtoDescriptor) Files() []*ProtoDescriptor {
+	var files []*ProtoDescriptor
+	visited := make(map[string]bool)
+	var visit func(file *ProtoDescriptor)
+	visit = func(file *ProtoDescriptor) {
+		if visited[file.FileName] {
+			return
+		}
+		visited[file.FileName] = true
+		for _, imported := range file.imports {
+			visit(imported)
+		}
+		files = append(files, file)
+	}
+	visit(d)
+	return files
+}
+
+// Proto returns the descriptor as the source of a .proto file.
+func (d *ProtoDescriptor) Proto() []byte {
+	var buf bytes.Buffer
+	if d.rosName != "" {
+		fmt.Fprintf(&buf, "// Generated by rosgo from %s; DO NOT EDIT.\n", d.rosName)
+	} else {
+		buf.WriteString("// Generated by rosgo; DO NOT EDIT.\n")
+	}
+	fmt.Fprintf(&buf, "\nsyntax = \"proto3\";\n\npackage %s;\n", d.Package)
+	if len(d.Imports) > 0 {
+		buf.WriteString("\n")
+		for _, name := range d.Imports {
+			fmt.Fprintf(&buf, "import %q;\n", name)
+		}
+	}
+	for _, msg := range d.messages {
+		buf.WriteString("\n")
+		msg.writeProto(&buf, "")
+	}
+	return buf.Bytes()
+}
+
+// FileDescriptorProto returns the descriptor as a serialized google.protobuf.FileDescriptorProto, ready for protodesc.NewFile or a descriptor pool.  The
+// files it imports have to be loaded first; see Files.
+func (d *ProtoDescriptor) FileDescriptorProto() []byte {
+	var buf []byte
+	buf = appendProtoString(buf, 1, d.FileName)
+	buf = appendProtoString(buf, 2, d.Package)
+	for _, name := range d.Imports {
+		buf = appendProtoString(buf, 3, name)
+	}
+	for _, msg := range d.messages {
+		buf = msg.appendDescriptor(buf, 4)
+	}
+	buf = appendProtoString(buf, 12, "proto3")
+	return buf
+}
+
+//	DynamicMessage
+
+// MarshalProto encodes the message as protobuf, following the descriptor generated by GenerateProtoDescriptor.  As in proto3, scalar fields holding
+// their zero value are left out; nested messages, times and durations always appear.  Fixed length arrays must hold exactly the right number of elements.
+func (m *DynamicMessage) MarshalProto() ([]byte, error) {
+	// Confirm the pointers are valid.
+	if err := messagePointerError(m); err != nil {
+		return nil, err
+	}
+	return m.appendProto(make([]byte, 0, m.dynamicType.jsonPrealloc))
+}
+
+// UnmarshalProto decodes protobuf encoded by MarshalProto, or by anything else following the descriptor generated by GenerateProtoDescriptor, replacing
+// the contents of the message.  Fields unknown to the descriptor are skipped.  The message is only changed if decoding succeeds.
+func (m *DynamicMessage) UnmarshalProto(buf []byte) error {
+	// Confirm the pointers are valid.
+	if err := messagePointerError(m); err != nil {
+		return err
+	}
+	data, err := m.dynamicType.decodeProto(buf)
+	if err != nil {
+		return err
+	}
+	m.data = data
+	return nil
+}
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+func appendProtoVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendProtoTag(buf []byte, number int, wire int) []byte {
+	return appendProtoVarint(buf, uint64(number)<<3|uint64(wire))
+}
+
+func appendProtoString(buf []byte, number int, s string) []byte {
+	buf = appendProtoTag(buf, number, protoBytes)
+	buf = appendProtoVarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// insertProtoLength prefixes everything written to buf since start with its length.
+func insertProtoLength(buf []byte, start int) []byte {
+	var length [10]byte
+	n := len(appendProtoVarint(length[:0], uint64(len(buf)-start)))
+	buf = append(buf, length[:n]...)
+	copy(buf[start+n:], buf[start:len(buf)-n])
+	copy(buf[start:], length[:n])
+	return buf
+}
+
+// appendProtoTemporal encodes a time or duration as its own message.
+func appendProtoTemporal(buf []byte, number int, prim dynamicPrimitive, sec uint32, nsec uint32) []byte {
+	buf = appendProtoTag(buf, number, protoBytes)
+	start := len(buf)
+	s, n := uint64(sec), uint64(nsec)
+	if prim == dynamicDuration {
+		// Durations are int32s, so negative values are sign extended.
+		s, n = uint64(int64(int32(sec))), uint64(int64(int32(nsec)))
+	}
+	if s != 0 {
+		buf = appendProtoVarint(appendProtoTag(buf, 1, protoVarint), s)
+	}
+	if n != 0 {
+		buf = appendProtoVarint(appendProtoTag(buf, 2, protoVarint), n)
+	}
+	return insertProtoLength(buf, start)
+}
+
+// protoWireType returns the wire type a primitive is encoded with.
+func protoWireType(prim dynamicPrimitive) int {
+	switch prim {
+	case dynamicFloat32:
+		return protoFixed32
+	case dynamicFloat64:
+		return protoFixed64
+	case dynamicString, dynamicTime, dynamicDuration, dynamicMessage:
+		return protoBytes
+	}
+	return protoVarint
+}
+
+// protoRaw converts a numeric or bool value to the integer it's written as.
+func protoRaw(value interface{}) uint64 {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return 1
+		}
+	case int8:
+		return uint64(uint32(int32(v)<<1) ^ uint32(int32(v)>>31))
+	case int16:
+		return uint64(uint32(int32(v)<<1) ^ uint32(int32(v)>>31))
+	case int32:
+		return uint64(uint32(v<<1) ^ uint32(v>>31))
+	case int64:
+		return uint64(v<<1) ^ uint64(v>>63)
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case uint64:
+		return v
+	case JsonFloat32:
+		return uint64(math.Float32bits(v.F))
+	case JsonFloat64:
+		return math.Float64bits(v.F)
+	}
+	return 0
+}
+
+// appendProtoRaw writes the integer a value is written as, in the primitive's wire type.
+func appendProtoRaw(buf []byte, prim dynamicPrimitive, raw uint64) []byte {
+	switch prim {
+	case dynamicFloat32:
+		return append(buf, byte(raw), byte(raw>>8), byte(raw>>16), byte(raw>>24))
+	case dynamicFloat64:
+		return append(buf, byte(raw), byte(raw>>8), byte(raw>>16), byte(raw>>24), byte(raw>>32), byte(raw>>40), byte(raw>>48), byte(raw>>56))
+	}
+	return appendProtoVarint(buf, raw)
+}
+
+// fromProtoRaw converts the integer a value was written as back to the value, checking it fits the primitive.
+func fromProtoRaw(prim dynamicPrimitive, raw uint64) (interface{}, bool) {
+	// Undo the zigzag encoding of signed values.
+	signed := int64(raw>>1) ^ -int64(raw&1)
+	switch prim {
+	case dynamicBool:
+		return raw != 0, true
+	case dynamicInt8:
+		return int8(signed), signed >= math.MinInt8 && signed <= math.MaxInt8
+	case dynamicInt16:
+		return int16(signed), signed >= math.MinInt16 && signed <= math.MaxInt16
+	case dynamicInt32:
+		return int32(signed), signed >= math.MinInt32 && signed <= math.MaxInt32
+	case dynamicInt64:
+		return signed, true
+	case dynamicUint8:
+		return uint8(raw), raw <= math.MaxUint8
+	case dynamicUint16:
+		return uint16(raw), raw <= math.MaxUint16
+	case dynamicUint32:
+		return uint32(raw), raw <= math.MaxUint32
+	case dynamicUint64:
+		return raw, true
+	case dynamicFloat32:
+		return JsonFloat32{F: math.Float32frombits(uint32(raw))}, true
+	case dynamicFloat64:
+		return JsonFloat64{F: math.Float64frombits(raw)}, true
+	}
+	return nil, false
+}
+
+// readProtoVarint reads a varint from the front of buf, returning its value and length.
+func readProtoVarint(buf []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(buf) && i < 10; i++ {
+		v |= uint64(buf[i]&0x7f) << (7 * uint(i))
+		if buf[i] < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("invalid varint")
+}
+
+// readProtoField reads the tag and value of a field from the front of buf.  The value is returned as an integer for varint and fixed wire types, and as
+// the bytes for length delimited ones.
+func readProtoField(buf []byte) (number int, wire int, raw uint64, value []byte, n int, err error) {
+	tag, n, err := readProtoVarint(buf)
+	if err != nil {
+		return 0, 0, 0, nil, 0, err
+	}
+	number, wire = int(tag>>3), int(tag&7)
+	if number <= 0 {
+		return 0, 0, 0, nil, 0, errors.New("invalid field number " + strconv.Itoa(number))
+	}
+
+	switch wire {
+	case protoVarint:
+		v, m, err := readProtoVarint(buf[n:])
+		return number, wire, v, nil, n + m, err
+	case protoFixed32, protoFixed64:
+		size := 4
+		if wire == protoFixed64 {
+			size = 8
+		}
+		if len(buf)-n < size {
+			return 0, 0, 0, nil, 0, errors.New("unexpected end of data")
+		}
+		for i := size - 1; i >= 0; i-- {
+			raw = raw<<8 | uint64(buf[n+i])
+		}
+		return number, wire, raw, nil, n + size, nil
+	case protoBytes:
+		length, m, err := readProtoVarint(buf[n:])
+		if err != nil {
+			return 0, 0, 0, nil, 0, err
+		}
+		n += m
+		if length > uint64(len(buf)-n) {
+			return 0, 0, 0, nil, 0, errors.New("unexpected end of data")
+		}
+		return number, wire, 0, buf[n : n+int(length)], n + int(length), nil
+	}
+	return 0, 0, 0, nil, 0, errors.New("unsupported wire type " + strconv.Itoa(wire))
+}
+
+// decodeProtoTemporal decodes a time or duration message.
+func decodeProtoTemporal(prim dynamicPrimitive, buf []byte) (interface{}, error) {
+	var sec, nsec uint32
+	for len(buf) > 0 {
+		number, wire, raw, _, n, err := readProtoField(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[n:]
+		if wire != protoVarint || (number != 1 && number != 2) {
+			continue
+		}
+		// Times are uint32s, and durations sign extended int32s; either way the low 32 bits are what we're after.
+		if number == 1 {
+			sec = uint32(raw)
+		} else {
+			nsec = uint32(raw)
+		}
+	}
+	if prim == dynamicTime {
+		return NewTime(sec, nsec), nil
+	}
+	return NewDuration(sec, nsec), nil
+}
+
+// newDynamicArrayOf returns an empty slice of the type used for arrays of the primitive.
+func newDynamicArrayOf(prim dynamicPrimitive) interface{} {
+	switch prim {
+	case dynamicString:
+		return []string{}
+	case dynamicMessage:
+		return []Message{}
+	}
+	return newDynamicArray(prim, 0)
+}
+
+// decodeProtoPacked decodes a packed run of numbers or bools, or the bytes of a uint8 array.
+func decodeProtoPacked(prim dynamicPrimitive, buf []byte) (interface{}, error) {
+	switch prim {
+	case dynamicUint8:
+		return append([]uint8{}, buf...), nil
+	case dynamicFloat32:
+		if len(buf)%4 != 0 {
+			return nil, errors.New("packed float length not a multiple of 4")
+		}
+		array := make([]JsonFloat32, len(buf)/4)
+		for i := range array {
+			b := buf[4*i:]
+			array[i].F = math.Float32frombits(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24)
+		}
+		return array, nil
+	case dynamicFloat64:
+		if len(buf)%8 != 0 {
+			return nil, errors.New("packed double length not a multiple of 8")
+		}
+		array := make([]JsonFloat64, len(buf)/8)
+		for i := range array {
+			b := buf[8*i:]
+			array[i].F = math.Float64frombits(uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+				uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56)
+		}
+		return array, nil
+	}
+
+	// Everything else is varints; count them so the array is only allocated once.
+	count := 0
+	for _, b := range buf {
+		if b < 0x80 {
+			count++
+		}
+	}
+	array := reflect.ValueOf(newDynamicArray(prim, count))
+	for i := 0; i < count; i++ {
+		raw, n, err := readProtoVarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[n:]
+		value, ok := fromProtoRaw(prim, raw)
+		if !ok {
+			return nil, errors.New("value " + strconv.FormatUint(raw, 10) + " out of range")
+		}
+		array.Index(i).Set(reflect.ValueOf(value))
+	}
+	if len(buf) > 0 {
+		return nil, errors.New("invalid varint")
+	}
+	return array.Interface(), nil
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	protoMessage
+
+// writeProto writes the message as .proto source.
+func (msg *protoMessage) writeProto(buf *bytes.Buffer, indent string) {
+	fmt.Fprintf(buf, "%smessage %s {\n", indent, msg.name)
+	for _, c := range msg.constants {
+		fmt.Fprintf(buf, "%s  // Constant: %s %s = %s\n", indent, c.Type, c.Name, c.ValueText)
+	}
+	for _, field := range msg.fields {
+		buf.WriteString(indent + "  ")
+		if field.repeated {
+			buf.WriteString("repeated ")
+		}
+		if field.kind == protoTypeMessage {
+			buf.WriteString(field.typeName)
+		} else {
+			buf.WriteString(protoTypeNames[field.kind])
+		}
+		fmt.Fprintf(buf, " %s = %d;", field.name, field.number)
+		if field.comment != "" {
+			buf.WriteString(" // " + field.comment)
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString(indent + "}\n")
+}
+
+// appendDescriptor writes the message as a DescriptorProto.
+func (msg *protoMessage) appendDescriptor(buf []byte, number int) []byte {
+	buf = appendProtoTag(buf, number, protoBytes)
+	start := len(buf)
+	buf = appendProtoString(buf, 1, msg.name)
+	for _, field := range msg.fields {
+		buf = appendProtoTag(buf, 2, protoBytes)
+		fieldStart := len(buf)
+		buf = appendProtoString(buf, 1, field.name)
+		buf = appendProtoVarint(appendProtoTag(buf, 3, protoVarint), uint64(field.number))
+		label := uint64(1)
+		if field.repeated {
+			label = 3
+		}
+		buf = appendProtoVarint(appendProtoTag(buf, 4, protoVarint), label)
+		buf = appendProtoVarint(appendProtoTag(buf, 5, protoVarint), uint64(field.kind))
+		if field.typeName != "" {
+			buf = appendProtoString(buf, 6, field.typeName)
+		}
+		buf = insertProtoLength(buf, fieldStart)
+	}
+	return insertProtoLength(buf, start)
+}
+
+//	DynamicMessageType
+
+// protoDescriptor generates the .proto file of the message type for GenerateProtoDescriptor, and those of its nested types, reusing the files in done.
+func (t *DynamicMessageType) protoDescriptor(done map[string]*ProtoDescriptor) (*ProtoDescriptor, error) {
+	if d, ok := done[t.Name()]; ok {
+		return d, nil
+	}
+	d := &ProtoDescriptor{
+		FileName: "ros/" + t.spec.Package + "/" + t.spec.ShortName + ".proto",
+		Package:  "ros." + t.spec.Package,
+		Message:  "ros." + t.spec.Package + "." + t.spec.ShortName,
+		rosName:  t.Name(),
+	}
+	done[t.Name()] = d
+
+	imported := make(map[string]bool)
+	addImport := func(file *ProtoDescriptor) {
+		if !imported[file.FileName] {
+			imported[file.FileName] = true
+			d.imports = append(d.imports, file)
+		}
+	}
+	msg := &protoMessage{name: t.spec.ShortName, constants: t.spec.Constants}
+	for i := range t.spec.Fields {
+		field := &t.spec.Fields[i]
+		pf := protoField{name: field.Name, number: i + 1, repeated: field.IsArray}
+
+		switch {
+		case !field.IsBuiltin:
+			nested, err := t.getNestedTypeFromField(field)
+			if err != nil {
+				return nil, errors.Wrap(err, "Field: "+field.Name)
+			}
+			file, err := nested.protoDescriptor(done)
+			if err != nil {
+				return nil, err
+			}
+			addImport(file)
+			pf.kind = protoTypeMessage
+			pf.typeName = "." + file.Message
+		case field.GoType == "ros.Time":
+			addImport(protoTimeDescriptor)
+			pf.kind, pf.typeName = protoTypeMessage, ".ros.Time"
+		case field.GoType == "ros.Duration":
+			addImport(protoTimeDescriptor)
+			pf.kind, pf.typeName = protoTypeMessage, ".ros.Duration"
+		case field.IsArray && field.GoType == "uint8":
+			pf.kind, pf.repeated = protoTypeBytes, false
+		default:
+			pf.kind = protoPrimitiveTypes[dynamicPrimitives[field.GoType]]
+		}
+
+		// Note what the protobuf type doesn't say.
+		narrow := field.IsBuiltin && (field.GoType == "int8" || field.GoType == "int16" || field.GoType == "uint8" || field.GoType == "uint16")
+		if narrow || (field.IsArray && field.ArrayLen >= 0) || field.ArrayBound > 0 || field.StringBound > 0 {
+			pf.comment = dynamicFieldTypeName(field)
+		}
+		msg.fields = append(msg.fields, pf)
+	}
+	d.messages = []*protoMessage{msg}
+
+	// Sort the imports, so that the output doesn't depend on the order we came across the types.
+	sort.Slice(d.imports, func(i, j int) bool { return d.imports[i].FileName < d.imports[j].FileName })
+	for _, file := range d.imports {
+		d.Imports = append(d.Imports, file.FileName)
+	}
+
+	// All done.
+	return d, nil
+}
+
+//	DynamicMessage
+
+// appendProto appends the fields of the message to buf.
+func (m *DynamicMessage) appendProto(buf []byte) ([]byte, error) {
+	for i := range m.dynamicType.spec.Fields {
+		field := &m.dynamicType.spec.Fields[i]
+		value, ok := m.data[field.Name]
+		if !ok {
+			return nil, errors.Wrap(errors.New("key not in data"), "key: "+field.Name)
+		}
+		var err error
+		if field.IsArray {
+			buf, err = m.appendProtoArray(buf, i+1, field, value)
+		} else {
+			buf, err = m.appendProtoValue(buf, i+1, field, value, false)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "field: "+field.Name)
+		}
+	}
+	return buf, nil
+}
+
+// appendProtoValue appends a scalar field, or an element of a repeated field.  Zero values of scalar fields are left out, unless always is set.
+func (m *DynamicMessage) appendProtoValue(buf []byte, number int, field *libgengo.Field, value interface{}, always bool) ([]byte, error) {
+	if !field.IsBuiltin {
+		msg, ok := value.(*DynamicMessage)
+		if view, isView := value.(*DynamicMessageView); isView {
+			var err error
+			if msg, err = view.Message(); err != nil {
+				return nil, err
+			}
+			ok = true
+		}
+		if !ok || msg == nil {
+			return nil, newTypeError(value, "DynamicMessage")
+		}
+		if err := messagePointerError(msg); err != nil {
+			return nil, err
+		}
+		buf = appendProtoTag(buf, number, protoBytes)
+		start := len(buf)
+		var err error
+		if buf, err = msg.appendProto(buf); err != nil {
+			return nil, err
+		}
+		return insertProtoLength(buf, start), nil
+	}
+
+	prim := dynamicPrimitives[field.GoType]
+	if !dynamicPrimitiveMatches(prim, value) {
+		return nil, newTypeError(value, dynamicPrimitiveNames[prim])
+	}
+	switch v := value.(type) {
+	case string:
+		if v != "" || always {
+			buf = appendProtoString(buf, number, v)
+		}
+	case Time:
+		buf = appendProtoTemporal(buf, number, prim, v.Sec, v.NSec)
+	case Duration:
+		buf = appendProtoTemporal(buf, number, prim, v.Sec, v.NSec)
+	default:
+		if raw := protoRaw(v); raw != 0 || always {
+			buf = appendProtoRaw(appendProtoTag(buf, number, protoWireType(prim)), prim, raw)
+		}
+	}
+	return buf, nil
+}
+
+// appendProtoArray appends an array field: packed for numbers and bools, as bytes for uint8, and one element at a time for everything else.
+func (m *DynamicMessage) appendProtoArray(buf []byte, number int, field *libgengo.Field, value interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, newTypeError(value, dynamicFieldTypeName(field))
+	}
+	length := rv.Len()
+	if field.ArrayLen >= 0 && length != field.ArrayLen {
+		return nil, errors.New("fixed array has " + strconv.Itoa(length) + " elements, expected " + strconv.Itoa(field.ArrayLen))
+	}
+	if length == 0 {
+		return buf, nil
+	}
+
+	prim := dynamicMessage
+	if field.IsBuiltin {
+		prim = dynamicPrimitives[field.GoType]
+	}
+	switch prim {
+	case dynamicUint8:
+		if bytes, ok := value.([]uint8); ok {
+			buf = appendProtoTag(buf, number, protoBytes)
+			buf = appendProtoVarint(buf, uint64(len(bytes)))
+			return append(buf, bytes...), nil
+		}
+	case dynamicString, dynamicTime, dynamicDuration, dynamicMessage:
+		for i := 0; i < length; i++ {
+			var err error
+			if buf, err = m.appendProtoValue(buf, number, field, rv.Index(i).Interface(), true); err != nil {
+				return nil, errors.Wrap(err, "index: "+strconv.Itoa(i))
+			}
+		}
+		return buf, nil
+	}
+
+	// Numbers and bools are packed.  Anything other than the slices we hand out is converted first.
+	if rv.Type() != dynamicArrayTypes[prim] {
+		converted, err := m.dynamicType.coerceArray(field.Name, field, value)
+		if err != nil {
+			return nil, err
+		}
+		rv = reflect.ValueOf(converted)
+	}
+	buf = appendProtoTag(buf, number, protoBytes)
+	start := len(buf)
+	switch array := rv.Interface().(type) {
+	case []uint8:
+		// Only uint8 arrays which weren't []uint8 to begin with end up here, and they're still written as bytes.
+		buf = append(buf, array...)
+	case []JsonFloat32:
+		for _, v := range array {
+			buf = appendProtoRaw(buf, prim, uint64(math.Float32bits(v.F)))
+		}
+	case []JsonFloat64:
+		for _, v := range array {
+			buf = appendProtoRaw(buf, prim, math.Float64bits(v.F))
+		}
+	default:
+		for i := 0; i < length; i++ {
+			buf = appendProtoVarint(buf, protoRaw(rv.Index(i).Interface()))
+		}
+	}
+	return insertProtoLength(buf, start), nil
+}
+
+//	DynamicMessageType
+
+// decodeProto decodes the fields of a message of this type into a new data map.
+func (t *DynamicMessageType) decodeProto(buf []byte) (map[string]interface{}, error) {
+	data, err := t.zeroValueData()
+	if err != nil {
+		return nil, err
+	}
+	fields := t.spec.Fields
+
+	// Arrays are collected separately, since they start out empty rather than zeroed.
+	arrays := make([]interface{}, len(fields))
+	for len(buf) > 0 {
+		number, wire, raw, value, n, err := readProtoField(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[n:]
+		if number > len(fields) {
+			continue
+		}
+		field := &fields[number-1]
+
+		prim := dynamicMessage
+		if field.IsBuiltin {
+			prim = dynamicPrimitives[field.GoType]
+		}
+		var result interface{}
+		switch {
+		case field.IsArray && prim != dynamicMessage && prim != dynamicString && prim != dynamicTime && prim != dynamicDuration && wire == protoBytes:
+			// A packed run of elements, or the bytes of a uint8 array.
+			result, err = decodeProtoPacked(prim, value)
+		case wire != protoWireType(prim):
+			err = errors.New("unexpected wire type " + strconv.Itoa(wire))
+		case prim == dynamicMessage:
+			var nested *DynamicMessageType
+			if nested, err = t.getNestedTypeFromField(field); err == nil {
+				msg := &DynamicMessage{dynamicType: nested}
+				if msg.data, err = nested.decodeProto(value); err == nil {
+					result = msg
+				}
+			}
+		case prim == dynamicString:
+			result = string(value)
+		case prim == dynamicTime || prim == dynamicDuration:
+			result, err = decodeProtoTemporal(prim, value)
+		default:
+			var ok bool
+			if result, ok = fromProtoRaw(prim, raw); !ok {
+				err = errors.New("value " + strconv.FormatUint(raw, 10) + " out of range")
+			}
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "field: "+field.Name)
+		}
+
+		if !field.IsArray {
+			data[field.Name] = result
+			continue
+		}
+		// Add whatever we got to what we have of the array so far.
+		switch {
+		case arrays[number-1] == nil && reflect.TypeOf(result).Kind() == reflect.Slice:
+			arrays[number-1] = result
+		case arrays[number-1] == nil:
+			arrays[number-1] = reflect.Append(reflect.ValueOf(newDynamicArrayOf(prim)), reflect.ValueOf(result)).Interface()
+		case reflect.TypeOf(result).Kind() == reflect.Slice:
+			arrays[number-1] = reflect.AppendSlice(reflect.ValueOf(arrays[number-1]), reflect.ValueOf(result)).Interface()
+		default:
+			arrays[number-1] = reflect.Append(reflect.ValueOf(arrays[number-1]), reflect.ValueOf(result)).Interface()
+		}
+	}
+
+	// Check the arrays are the right length.
+	for i := range fields {
+		field := &fields[i]
+		if !field.IsArray {
+			continue
+		}
+		array := arrays[i]
+		if array == nil {
+			prim := dynamicMessage
+			if field.IsBuiltin {
+				prim = dynamicPrimitives[field.GoType]
+			}
+			array = newDynamicArrayOf(prim)
+		}
+		if length := reflect.ValueOf(array).Len(); field.ArrayLen >= 0 && length != field.ArrayLen {
+			return nil, errors.Wrap(errors.New("fixed array has "+strconv.Itoa(length)+" elements, expected "+strconv.Itoa(field.ArrayLen)), "field: "+field.Name)
+		}
+		data[field.Name] = array
+	}
+
+	// All done.
+	return data, nil
+}
+
+// ALL DONE.
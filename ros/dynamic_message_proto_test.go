@@ -0,0 +1,220 @@
+package ros
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	gengo "github.com/asimovsecurity/rosgo/libgengo"
+)
+
+func TestDynamicMessage_Proto_RoundTrip(t *testing.T) {
+	msg := newCodecTestMessage()
+	msg.data["d"] = NewDuration(uint32(0xffffffff), 0) // A negative duration.
+	encoded, err := msg.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := msg.dynamicType.NewDynamicMessage()
+	if err := decoded.UnmarshalProto(encoded); err != nil {
+		t.Fatal(err)
+	}
+	equalCodecTestMessages(t, msg, decoded)
+
+	// Zero values round trip too, though most of them aren't written at all.
+	zero := msg.dynamicType.NewDynamicMessage()
+	zero.data["f64s"] = []JsonFloat64{{F: 0}, {F: math.Copysign(0, -1)}, {F: 0}}
+	if encoded, err = zero.MarshalProto(); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.UnmarshalProto(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if f := decoded.data["f64s"].([]JsonFloat64)[1].F; f != 0 || !math.Signbit(f) {
+		t.Fatalf("expected -0, got %v", f)
+	}
+	if decoded.data["s"] != "" || decoded.data["inner"].(*DynamicMessage).data["stamp"] != NewTime(0, 0) || len(decoded.data["ss"].([]string)) != 0 {
+		t.Fatalf("unexpected data %v", decoded.data)
+	}
+}
+
+func TestDynamicMessage_Proto_Encoding(t *testing.T) {
+	testMessageType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "int16", "a", false, 0),
+			*gengo.NewField("Testing", "uint32", "b", true, -1),
+			*gengo.NewField("Testing", "string", "c", true, -1),
+			*gengo.NewField("Testing", "time", "t", false, 0),
+			*gengo.NewField("Testing", "bool", "unset", false, 0),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+	msg := testMessageType.NewDynamicMessage()
+	msg.data["a"] = int16(-2)
+	msg.data["b"] = []uint32{1, 300}
+	msg.data["c"] = []string{"x", ""}
+	msg.data["t"] = NewTime(1, 0)
+
+	expected := []byte{
+		0x08, 0x03, // a, zigzag encoded.
+		0x12, 0x03, 0x01, 0xac, 0x02, // b, packed.
+		0x1a, 0x01, 'x', 0x1a, 0x00, // c, one element at a time.
+		0x22, 0x02, 0x08, 0x01, // t, as a message.
+	}
+	encoded, err := msg.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, expected) {
+		t.Fatalf("expected %x, got %x", expected, encoded)
+	}
+
+	// Other encoders may not pack repeated fields, and may add fields we don't know about.
+	foreign := []byte{
+		0x10, 0x05, 0x10, 0x06, // b, unpacked.
+		0x12, 0x01, 0x07, // b, packed.
+		0xf8, 0x01, 0x01, // Field 31.
+	}
+	if err := msg.UnmarshalProto(foreign); err != nil {
+		t.Fatal(err)
+	}
+	if b := msg.data["b"].([]uint32); len(b) != 3 || b[0] != 5 || b[2] != 7 || msg.data["a"] != int16(0) {
+		t.Fatalf("unexpected data %v", msg.data)
+	}
+
+	// Values out of range for the ROS type are rejected.
+	if err := msg.UnmarshalProto([]byte{0x08, 0x80, 0x80, 0x04}); err == nil {
+		t.Fatalf("expected an error for an int16 out of range")
+	}
+}
+
+func TestDynamicMessage_Proto_FixedArrays(t *testing.T) {
+	msg := newCodecTestMessage()
+	msg.data["f64s"] = []JsonFloat64{{F: 1}}
+	if _, err := msg.MarshalProto(); err == nil {
+		t.Fatalf("expected an error for a fixed array of the wrong length")
+	}
+
+	msg = newCodecTestMessage()
+	encoded, err := msg.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Drop the f64s field (number 8), which must have three elements.
+	var stripped []byte
+	for buf := encoded; len(buf) > 0; {
+		number, _, _, _, n, err := readProtoField(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if number != 8 {
+			stripped = append(stripped, buf[:n]...)
+		}
+		buf = buf[n:]
+	}
+	if err := msg.UnmarshalProto(stripped); err == nil {
+		t.Fatalf("expected an error for a missing fixed array")
+	}
+}
+
+func TestDynamicMessageType_GenerateProtoDescriptor(t *testing.T) {
+	msg := newCodecTestMessage()
+	msg.dynamicType.spec.Constants = []gengo.Constant{{Type: "int8", Name: "LIMIT", ValueText: "10"}}
+	innerType := msg.data["inner"].(*DynamicMessage).dynamicType
+	innerType.spec.FullName, innerType.spec.ShortName, innerType.spec.Package = "other_msgs/Inner", "Inner", "other_msgs"
+	for i := range msg.dynamicType.spec.Fields {
+		if field := &msg.dynamicType.spec.Fields[i]; !field.IsBuiltin {
+			field.Package, field.Type = "other_msgs", "Inner"
+		}
+	}
+	msg.dynamicType.nested = map[string]*DynamicMessageType{"other_msgs/Inner": innerType}
+
+	descriptor, err := msg.dynamicType.GenerateProtoDescriptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if descriptor.FileName != "ros/Testing/Test.proto" || descriptor.Message != "ros.Testing.Test" {
+		t.Fatalf("unexpected descriptor %+v", descriptor)
+	}
+
+	expected := `// Generated by rosgo from TestMessage; DO NOT EDIT.
+
+syntax = "proto3";
+
+package ros.Testing;
+
+import "ros/other_msgs/Inner.proto";
+import "ros/time.proto";
+
+message Test {
+  // Constant: int8 LIMIT = 10
+  bool b = 1;
+  sint32 i8 = 2; // int8
+  uint64 u64 = 3;
+  float f32 = 4;
+  string s = 5;
+  .ros.Duration d = 6;
+  bytes u8s = 7; // uint8[]
+  repeated double f64s = 8; // float64[3]
+  repeated string ss = 9;
+  .ros.other_msgs.Inner inner = 10;
+  repeated .ros.other_msgs.Inner inners = 11;
+}
+`
+	if proto := string(descriptor.Proto()); proto != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, proto)
+	}
+
+	// Nested types, and time and duration, are left to files of their own, each loaded before the files importing them.
+	var names []string
+	for _, file := range descriptor.Files() {
+		names = append(names, file.FileName)
+	}
+	if strings.Join(names, " ") != "ros/time.proto ros/other_msgs/Inner.proto ros/Testing/Test.proto" {
+		t.Fatalf("unexpected files %v", names)
+	}
+	expected = `// Generated by rosgo; DO NOT EDIT.
+
+syntax = "proto3";
+
+package ros;
+
+message Duration {
+  int32 sec = 1;
+  int32 nsec = 2;
+}
+
+message Time {
+  uint32 sec = 1;
+  uint32 nsec = 2;
+}
+`
+	if proto := string(descriptor.Files()[0].Proto()); proto != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, proto)
+	}
+
+	// The files of a type are the same whichever type they were generated for, so they can be loaded together.
+	innerDescriptor, err := innerType.GenerateProtoDescriptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(innerDescriptor.FileDescriptorProto(), descriptor.Files()[1].FileDescriptorProto()) {
+		t.Fatalf("expected the same file for %s", innerDescriptor.FileName)
+	}
+
+	// The FileDescriptorProto holds the name, package, two imports, the message and the syntax.
+	var numbers []int
+	for buf := descriptor.FileDescriptorProto(); len(buf) > 0; {
+		number, _, _, _, n, err := readProtoField(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		numbers = append(numbers, number)
+		buf = buf[n:]
+	}
+	if fmt.Sprint(numbers) != "[1 2 3 3 4 12]" {
+		t.Fatalf("unexpected FileDescriptorProto fields %v", numbers)
+	}
+}
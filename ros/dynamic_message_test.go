@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"reflect"
 	"testing"
 
 	gengo "github.com/asimovsecurity/rosgo/libgengo"
@@ -786,6 +787,180 @@ func TestDynamicMessage_DynamicType_FromSpec_BadSpec(t *testing.T) {
 	}
 }
 
+func TestDynamicMessage_NewMessage_ROS2Defaults(t *testing.T) {
+	fields := []gengo.Field{
+		*gengo.NewField("Testing", "int32", "i32", false, 0),
+		*gengo.NewField("Testing", "float64", "f64", false, 0),
+		*gengo.NewField("Testing", "string", "s", false, 0),
+		*gengo.NewField("Testing", "float32", "fa", true, 2),
+		*gengo.NewField("Testing", "uint8", "u8a", true, -1),
+	}
+	fields[0].Default = int32(42)
+	fields[1].Default = float64(-1.5)
+	fields[2].Default = "foo"
+	fields[3].Default = []interface{}{float32(1), float32(2)}
+	fields[4].Default = []interface{}{uint8(3)}
+	testMessageType := DynamicMessageType{
+		spec:         generateTestSpec(fields),
+		nested:       make(map[string]*DynamicMessageType),
+		jsonPrealloc: 0,
+	}
+
+	expected := map[string]interface{}{
+		"i32": int32(42),
+		"f64": JsonFloat64{F: -1.5},
+		"s":   "foo",
+		"fa":  []JsonFloat32{{F: 1}, {F: 2}},
+		"u8a": []uint8{3},
+	}
+
+	testMessage := testMessageType.NewDynamicMessage()
+	if !reflect.DeepEqual(testMessage.data, expected) {
+		t.Fatalf("unexpected default data, got %v, expected %v", testMessage.data, expected)
+	}
+}
+
+func TestDynamicMessage_Serialize_RoundTrip(t *testing.T) {
+	testCases := map[string]struct {
+		messageType *DynamicMessageType
+		serialized  []byte
+	}{
+		"singular":      {&singularMessageType, singularSerialized},
+		"fixed array":   {&fixedArrayMessageType, fixedArraySerialized},
+		"dynamic array": {&dynamicArrayMessageType, dynamicArraySerialized},
+	}
+
+	for name, testCase := range testCases {
+		testMessage := testCase.messageType.NewDynamicMessage()
+		if err := testMessage.Deserialize(bytes.NewReader(testCase.serialized)); err != nil {
+			t.Fatalf("%s: deserialize failed %s", name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := testMessage.Serialize(&buf); err != nil {
+			t.Fatalf("%s: serialize failed %s", name, err)
+		}
+		if !bytes.Equal(buf.Bytes(), testCase.serialized) {
+			t.Fatalf("%s: expected %x, got %x", name, testCase.serialized, buf.Bytes())
+		}
+	}
+}
+
+func TestDynamicMessage_Serialize_Nested(t *testing.T) {
+	innerType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "uint16", "u16", false, 0),
+			*gengo.NewField("Testing", "string", "s", false, 0),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+	testMessageType := DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "Test", "inner", false, 0),
+			*gengo.NewField("Testing", "Test", "inners", true, -1),
+			*gengo.NewField("Testing", "int8", "i8", false, 0),
+		}),
+		nested: map[string]*DynamicMessageType{"Testing/Test": innerType},
+	}
+
+	serialized := []byte{
+		0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 'h', 'i', // inner
+		0x02, 0x00, 0x00, 0x00, // Dynamic array size.
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, // inners[0]
+		0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 'x', // inners[1]
+		0xff, // i8
+	}
+
+	testMessage := testMessageType.NewDynamicMessage()
+	if err := testMessage.Deserialize(bytes.NewReader(serialized)); err != nil {
+		t.Fatalf("deserialize failed %s", err)
+	}
+	inners := testMessage.data["inners"].([]Message)
+	if len(inners) != 2 || inners[1].(*DynamicMessage).data["s"] != "x" {
+		t.Fatalf("unexpected nested data %v", testMessage.data)
+	}
+
+	var buf bytes.Buffer
+	if err := testMessage.Serialize(&buf); err != nil {
+		t.Fatalf("serialize failed %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), serialized) {
+		t.Fatalf("expected %x, got %x", serialized, buf.Bytes())
+	}
+
+	// Short fixed arrays of messages are padded with zeroed messages, as arrays of primitives are.
+	fixedType := DynamicMessageType{
+		spec:   generateTestSpec([]gengo.Field{*gengo.NewField("Testing", "Test", "inners", true, 2)}),
+		nested: map[string]*DynamicMessageType{"Testing/Test": innerType},
+	}
+	fixedMessage := fixedType.NewDynamicMessage()
+	fixedMessage.data["inners"] = []Message{inners[1]}
+	buf.Reset()
+	if err := fixedMessage.Serialize(&buf); err != nil {
+		t.Fatalf("serialize failed %s", err)
+	}
+	padded := []byte{
+		0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 'x', // inners[0]
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // inners[1]
+	}
+	if !bytes.Equal(buf.Bytes(), padded) {
+		t.Fatalf("expected %x, got %x", padded, buf.Bytes())
+	}
+
+	// Nested messages of the wrong type are rejected.
+	otherType := &DynamicMessageType{spec: generateTestSpec(nil), nested: make(map[string]*DynamicMessageType)}
+	otherType.spec.ShortName = "Other"
+	testMessage.data["inner"] = otherType.NewDynamicMessage()
+	if err := testMessage.Serialize(&buf); err == nil {
+		t.Fatalf("expected serialize error for mismatched nested type")
+	}
+}
+
+func TestDynamicMessage_Serialize_Conversions(t *testing.T) {
+	testMessageType := DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "int16", "i16", true, 3),
+			*gengo.NewField("Testing", "string", "s", true, 2),
+			*gengo.NewField("Testing", "uint8", "u8", true, -1),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+
+	testMessage := testMessageType.NewDynamicMessage()
+	// Short fixed arrays are padded, untyped slices are accepted element by element.
+	testMessage.data["i16"] = []interface{}{int16(-2)}
+	testMessage.data["s"] = []string{"a"}
+	testMessage.data["u8"] = []uint8{0x01, 0x02}
+
+	expected := []byte{
+		0xfe, 0xff, 0x00, 0x00, 0x00, 0x00, // i16
+		0x01, 0x00, 0x00, 0x00, 'a', 0x00, 0x00, 0x00, 0x00, // s
+		0x02, 0x00, 0x00, 0x00, 0x01, 0x02, // u8
+	}
+
+	var buf bytes.Buffer
+	if err := testMessage.Serialize(&buf); err != nil {
+		t.Fatalf("serialize failed %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("expected %x, got %x", expected, buf.Bytes())
+	}
+
+	// Elements of the wrong type are reported.
+	testMessage.data["i16"] = []interface{}{int32(-2)}
+	if err := testMessage.Serialize(&buf); err == nil {
+		t.Fatalf("expected serialize error for int32 element")
+	}
+	testMessage.data["i16"] = []int32{1, 2, 3}
+	if err := testMessage.Serialize(&buf); err == nil {
+		t.Fatalf("expected serialize error for []int32")
+	}
+	delete(testMessage.data, "i16")
+	if err := testMessage.Serialize(&buf); err == nil {
+		t.Fatalf("expected serialize error for missing field")
+	}
+}
+
 // Testing helpers
 
 // Float32Near helper to check that two float32 are within a tolerance.
@@ -0,0 +1,290 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/asimovsecurity/rosgo/libgengo"
+)
+
+// DEFINE PUBLIC STRUCTURES.
+
+// FieldError describes a problem with the contents of a single field of a DynamicMessage, as reported by Validate.
+type FieldError struct {
+	Path   string // Path of the offending field, for example `poses[3].pose.position.x`.
+	Reason string // What is wrong with it.
+}
+
+// NaNPolicy determines whether Validate accepts NaN and infinite values in float fields.
+type NaNPolicy int
+
+// DEFINE PUBLIC GLOBALS.
+
+const (
+	// NaNAllowed accepts NaN and infinite values, as ROS itself does.
+	NaNAllowed NaNPolicy = iota
+	// NaNRejected reports NaN values, but accepts infinite ones.
+	NaNRejected
+	// NonFiniteRejected reports both NaN and infinite values.
+	NonFiniteRejected
+)
+
+// DEFINE PRIVATE GLOBALS.
+
+// dynamicArrayTypes holds the typed slice DynamicMessage data uses for arrays of each primitive.
+var dynamicArrayTypes = [...]reflect.Type{
+	dynamicBool:     reflect.TypeOf([]bool(nil)),
+	dynamicInt8:     reflect.TypeOf([]int8(nil)),
+	dynamicInt16:    reflect.TypeOf([]int16(nil)),
+	dynamicInt32:    reflect.TypeOf([]int32(nil)),
+	dynamicInt64:    reflect.TypeOf([]int64(nil)),
+	dynamicUint8:    reflect.TypeOf([]uint8(nil)),
+	dynamicUint16:   reflect.TypeOf([]uint16(nil)),
+	dynamicUint32:   reflect.TypeOf([]uint32(nil)),
+	dynamicUint64:   reflect.TypeOf([]uint64(nil)),
+	dynamicFloat32:  reflect.TypeOf([]JsonFloat32(nil)),
+	dynamicFloat64:  reflect.TypeOf([]JsonFloat64(nil)),
+	dynamicString:   reflect.TypeOf([]string(nil)),
+	dynamicTime:     reflect.TypeOf([]Time(nil)),
+	dynamicDuration: reflect.TypeOf([]Duration(nil)),
+	dynamicMessage:  reflect.TypeOf([]Message(nil)),
+}
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	FieldError
+
+// Error describes the field error; required for error.
+func (e FieldError) Error() string {
+	return "path " + e.Path + ": " + e.Reason
+}
+
+//	DynamicMessageType
+
+// SetNaNPolicy sets whether Validate accepts NaN and infinite float values in messages of this type, nested messages included.  By default they are allowed.
+// It may be called while other goroutines use the type.
+func (t *DynamicMessageType) SetNaNPolicy(policy NaNPolicy) {
+	atomic.StoreInt32(&t.nanPolicy, int32(policy))
+}
+
+// NaNPolicy returns the NaN policy used when validating messages of this type.
+func (t *DynamicMessageType) NaNPolicy() NaNPolicy {
+	return NaNPolicy(atomic.LoadInt32(&t.nanPolicy))
+}
+
+//	DynamicMessage
+
+// Validate checks every field of the message, recursively, against its DynamicMessageType: that each field holds the Go type DynamicMessage uses for its ROS
+// type, that fixed length and bounded arrays have acceptable lengths, that nested messages are of the right type, and that float values meet the NaN policy
+// of the type.  It returns a FieldError for every problem found, or nil if the message is fit to be serialized.  Anything which would make Serialize fail is
+// reported, as are fixed length arrays of the wrong length, strings and arrays over their ROS 2 bounds, and data which isn't a field of the type, which
+// Serialize would pad, truncate, write anyway or drop.
+func (m *DynamicMessage) Validate() []FieldError {
+	if m.dynamicType == nil || m.dynamicType.spec == nil {
+		return []FieldError{{Reason: "dynamic message type spec is nil"}}
+	}
+	return m.validate("", m.dynamicType.NaNPolicy(), nil)
+}
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+// dynamicPrimitiveMatches checks that value has the Go type DynamicMessage uses for the primitive.
+func dynamicPrimitiveMatches(prim dynamicPrimitive, value interface{}) bool {
+	switch value.(type) {
+	case bool:
+		return prim == dynamicBool
+	case int8:
+		return prim == dynamicInt8
+	case int16:
+		return prim == dynamicInt16
+	case int32:
+		return prim == dynamicInt32
+	case int64:
+		return prim == dynamicInt64
+	case uint8:
+		return prim == dynamicUint8
+	case uint16:
+		return prim == dynamicUint16
+	case uint32:
+		return prim == dynamicUint32
+	case uint64:
+		return prim == dynamicUint64
+	case JsonFloat32:
+		return prim == dynamicFloat32
+	case JsonFloat64:
+		return prim == dynamicFloat64
+	case string:
+		return prim == dynamicString
+	case Time:
+		return prim == dynamicTime
+	case Duration:
+		return prim == dynamicDuration
+	}
+	return false
+}
+
+// checkDynamicFloat returns the reason a float value breaks the NaN policy, if it does.
+func checkDynamicFloat(policy NaNPolicy, f float64) string {
+	if policy != NaNAllowed && math.IsNaN(f) {
+		return "NaN is not allowed"
+	}
+	if policy == NonFiniteRejected && math.IsInf(f, 0) {
+		return "infinity is not allowed"
+	}
+	return ""
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	DynamicMessage
+
+// validate checks the fields of the message for Validate, prefixing their paths with prefix and appending any problems to errs.
+func (m *DynamicMessage) validate(prefix string, policy NaNPolicy, errs []FieldError) []FieldError {
+	for i := range m.dynamicType.spec.Fields {
+		field := &m.dynamicType.spec.Fields[i]
+		path := prefix + field.Name
+
+		value, ok := m.data[field.Name]
+		if !ok {
+			errs = append(errs, FieldError{Path: path, Reason: "no data found"})
+			continue
+		}
+		if field.IsArray {
+			errs = m.validateArray(path, field, policy, value, errs)
+		} else {
+			errs = m.validateElement(path, field, policy, value, errs)
+		}
+	}
+
+	// Anything else in the data would be silently dropped by Serialize, which is probably not what was intended.
+	var unknown []string
+	for name := range m.data {
+		if m.dynamicType.field(name) == nil {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, FieldError{Path: prefix + name, Reason: "not a field of " + m.dynamicType.Name()})
+	}
+
+	// All done.
+	return errs
+}
+
+// validateArray checks the value of an array field.
+func (m *DynamicMessage) validateArray(path string, field *libgengo.Field, policy NaNPolicy, value interface{}, errs []FieldError) []FieldError {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return append(errs, FieldError{Path: path, Reason: fmt.Sprintf("expected %s, found %T", dynamicFieldTypeName(field), value)})
+	}
+
+	// Check the length.
+	length := rv.Len()
+	if field.ArrayLen >= 0 && length != field.ArrayLen {
+		errs = append(errs, FieldError{Path: path, Reason: fmt.Sprintf("expected %d elements, found %d", field.ArrayLen, length)})
+	}
+	if field.ArrayBound > 0 && length > field.ArrayBound {
+		errs = append(errs, FieldError{Path: path, Reason: fmt.Sprintf("expected at most %d elements, found %d", field.ArrayBound, length)})
+	}
+
+	// Typed slices of the kind we hand out only need their values checked, and only for floats and bounded strings.
+	prim := dynamicMessage
+	if field.IsBuiltin {
+		prim = dynamicPrimitives[field.GoType]
+	}
+	if rv.Type() == dynamicArrayTypes[prim] {
+		switch v := value.(type) {
+		case []JsonFloat32:
+			for j, f := range v {
+				if reason := checkDynamicFloat(policy, float64(f.F)); reason != "" {
+					errs = append(errs, FieldError{Path: path + "[" + strconv.Itoa(j) + "]", Reason: reason})
+				}
+			}
+			return errs
+		case []JsonFloat64:
+			for j, f := range v {
+				if reason := checkDynamicFloat(policy, f.F); reason != "" {
+					errs = append(errs, FieldError{Path: path + "[" + strconv.Itoa(j) + "]", Reason: reason})
+				}
+			}
+			return errs
+		case []string:
+			if field.StringBound == 0 {
+				return errs
+			}
+		case []Message:
+		default:
+			return errs
+		}
+	}
+
+	// Otherwise each element needs checking.
+	for j := 0; j < length; j++ {
+		errs = m.validateElement(path+"["+strconv.Itoa(j)+"]", field, policy, rv.Index(j).Interface(), errs)
+	}
+	return errs
+}
+
+// validateElement checks the value of a scalar field, or of a single element of an array field.
+func (m *DynamicMessage) validateElement(path string, field *libgengo.Field, policy NaNPolicy, value interface{}, errs []FieldError) []FieldError {
+	if field.IsBuiltin {
+		prim := dynamicPrimitives[field.GoType]
+		if !dynamicPrimitiveMatches(prim, value) {
+			return append(errs, FieldError{Path: path, Reason: fmt.Sprintf("expected %s, found %T", dynamicPrimitiveNames[prim], value)})
+		}
+		switch v := value.(type) {
+		case JsonFloat32:
+			if reason := checkDynamicFloat(policy, float64(v.F)); reason != "" {
+				errs = append(errs, FieldError{Path: path, Reason: reason})
+			}
+		case JsonFloat64:
+			if reason := checkDynamicFloat(policy, v.F); reason != "" {
+				errs = append(errs, FieldError{Path: path, Reason: reason})
+			}
+		case string:
+			if field.StringBound > 0 && len(v) > field.StringBound {
+				errs = append(errs, FieldError{Path: path, Reason: fmt.Sprintf("expected at most %d characters, found %d", field.StringBound, len(v))})
+			}
+		}
+		return errs
+	}
+
+	// It's a nested message, which has to be of the declared type.
+	nested, err := m.dynamicType.getNestedTypeFromField(field)
+	if err != nil {
+		return append(errs, FieldError{Path: path, Reason: err.Error()})
+	}
+	msg, ok := value.(dynamicMessageLike)
+	if !ok || msg == nil || reflect.ValueOf(msg).IsNil() {
+		return append(errs, FieldError{Path: path, Reason: fmt.Sprintf("expected message %s, found %T", nested.Name(), value)})
+	}
+	msgType := msg.GetDynamicType()
+	// Serialize goes by the short name of the type the field declares, so that has to match too.
+	if msgType == nil || msgType.spec == nil || msgType.Name() != nested.Name() || msgType.spec.ShortName != field.Type {
+		found := "<nil>"
+		if msgType != nil {
+			found = msgType.Name()
+		}
+		return append(errs, FieldError{Path: path, Reason: "expected message " + nested.Name() + ", found " + found})
+	}
+
+	switch v := msg.(type) {
+	case *DynamicMessage:
+		return v.validate(path+".", policy, errs)
+	case *DynamicMessageView:
+		// Views can only be checked for being whole messages.
+		if err := v.layout(); err != nil {
+			errs = append(errs, FieldError{Path: path, Reason: err.Error()})
+		}
+	}
+	return errs
+}
+
+// ALL DONE.
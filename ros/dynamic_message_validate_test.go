@@ -0,0 +1,162 @@
+package ros
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	gengo "github.com/asimovsecurity/rosgo/libgengo"
+)
+
+func newValidateTestMessage() *DynamicMessage {
+	innerType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "float64", "f64", false, 0),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+	testMessageType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "int8", "i8", false, 0),
+			*gengo.NewField("Testing", "float32", "f32", true, 3),
+			*gengo.NewField("Testing", "string", "s", false, 0),
+			*gengo.NewField("Testing", "Test", "inner", false, 0),
+			*gengo.NewField("Testing", "Test", "inners", true, -1),
+		}),
+		nested: map[string]*DynamicMessageType{"Testing/Test": innerType},
+	}
+
+	inner := innerType.NewDynamicMessage()
+	inner.data["f64"] = JsonFloat64{F: 1.5}
+	element := innerType.NewDynamicMessage()
+	element.data["f64"] = JsonFloat64{F: -2}
+
+	msg := testMessageType.NewDynamicMessage()
+	msg.data["i8"] = int8(-1)
+	msg.data["f32"] = []JsonFloat32{{F: 1}, {F: 2}, {F: 3}}
+	msg.data["s"] = "hello"
+	msg.data["inner"] = inner
+	msg.data["inners"] = []Message{element}
+	return msg
+}
+
+func TestDynamicMessage_Validate_Valid(t *testing.T) {
+	msg := newValidateTestMessage()
+	if errs := msg.Validate(); errs != nil {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	// Slices of interfaces are fine too, so long as the elements are.
+	msg.data["f32"] = []interface{}{JsonFloat32{F: 1}, JsonFloat32{F: 2}, JsonFloat32{F: 3}}
+	if errs := msg.Validate(); errs != nil {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+func TestDynamicMessage_Validate_Errors(t *testing.T) {
+	otherType := &DynamicMessageType{spec: generateTestSpec(nil), nested: make(map[string]*DynamicMessageType)}
+	otherType.spec.FullName = "Testing/Other"
+
+	msg := newValidateTestMessage()
+	msg.data["i8"] = 1
+	msg.data["f32"] = []JsonFloat32{{F: 1}, {F: 2}}
+	delete(msg.data, "s")
+	msg.data["inner"].(*DynamicMessage).data["f64"] = float64(1.5)
+	msg.data["inners"] = []Message{otherType.NewDynamicMessage()}
+	msg.data["extra"] = true
+
+	expected := []FieldError{
+		{Path: "i8", Reason: "expected int8, found int"},
+		{Path: "f32", Reason: "expected 3 elements, found 2"},
+		{Path: "s", Reason: "no data found"},
+		{Path: "inner.f64", Reason: "expected JsonFloat64, found float64"},
+		{Path: "inners[0]", Reason: "expected message TestMessage, found Testing/Other"},
+		{Path: "extra", Reason: "not a field of TestMessage"},
+	}
+	if errs := msg.Validate(); !reflect.DeepEqual(errs, expected) {
+		t.Fatalf("expected %v, got %v", expected, errs)
+	}
+}
+
+func TestDynamicMessage_Validate_NaNPolicy(t *testing.T) {
+	msg := newValidateTestMessage()
+	msg.data["f32"] = []JsonFloat32{{F: 1}, {F: float32(math.NaN())}, {F: float32(math.Inf(1))}}
+	msg.data["inner"].(*DynamicMessage).data["f64"] = JsonFloat64{F: math.NaN()}
+
+	if errs := msg.Validate(); errs != nil {
+		t.Fatalf("NaN allowed by default, got %v", errs)
+	}
+
+	msg.dynamicType.SetNaNPolicy(NaNRejected)
+	expected := []FieldError{
+		{Path: "f32[1]", Reason: "NaN is not allowed"},
+		{Path: "inner.f64", Reason: "NaN is not allowed"},
+	}
+	if errs := msg.Validate(); !reflect.DeepEqual(errs, expected) {
+		t.Fatalf("expected %v, got %v", expected, errs)
+	}
+
+	msg.dynamicType.SetNaNPolicy(NonFiniteRejected)
+	expected = []FieldError{
+		{Path: "f32[1]", Reason: "NaN is not allowed"},
+		{Path: "f32[2]", Reason: "infinity is not allowed"},
+		{Path: "inner.f64", Reason: "NaN is not allowed"},
+	}
+	if errs := msg.Validate(); !reflect.DeepEqual(errs, expected) {
+		t.Fatalf("expected %v, got %v", expected, errs)
+	}
+}
+
+func TestDynamicMessage_Serialize_Atomic(t *testing.T) {
+	msg := newValidateTestMessage()
+	msg.data["inners"] = []Message{msg.data["inner"].(*DynamicMessage), nil}
+
+	buf := bytes.NewBufferString("prefix")
+	if err := msg.Serialize(buf); err == nil {
+		t.Fatalf("expected serialize to fail")
+	}
+	if buf.String() != "prefix" {
+		t.Fatalf("expected buffer to be left alone, got %q", buf.String())
+	}
+}
+
+func TestDynamicMessage_Validate_ReportsSerializeErrors(t *testing.T) {
+	renamedType := &DynamicMessageType{spec: generateTestSpec(nil), nested: make(map[string]*DynamicMessageType)}
+	renamedType.spec.ShortName = "Renamed"
+
+	for name, spoil := range map[string]func(*DynamicMessage){
+		"missing":        func(msg *DynamicMessage) { delete(msg.data, "i8") },
+		"wrong type":     func(msg *DynamicMessage) { msg.data["s"] = 1 },
+		"not an array":   func(msg *DynamicMessage) { msg.data["f32"] = JsonFloat32{F: 1} },
+		"wrong element":  func(msg *DynamicMessage) { msg.data["f32"] = []interface{}{1.0, 2.0, 3.0} },
+		"nil message":    func(msg *DynamicMessage) { msg.data["inner"] = nil },
+		"renamed nested": func(msg *DynamicMessage) { msg.data["inners"] = []Message{renamedType.NewDynamicMessage()} },
+		"nested field":   func(msg *DynamicMessage) { msg.data["inner"].(*DynamicMessage).data["f64"] = "1.5" },
+	} {
+		msg := newValidateTestMessage()
+		spoil(msg)
+		var buf bytes.Buffer
+		if err := msg.Serialize(&buf); err == nil {
+			t.Fatalf("%s: expected serialize to fail", name)
+		}
+		if errs := msg.Validate(); len(errs) == 0 {
+			t.Fatalf("%s: validate passed a message serialize rejects", name)
+		}
+	}
+}
+
+func TestDynamicMessage_SetNaNPolicy_Concurrent(t *testing.T) {
+	msg := newValidateTestMessage()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			msg.dynamicType.SetNaNPolicy(NaNPolicy(i % 3))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		msg.Validate()
+	}
+	<-done
+}
@@ -0,0 +1,426 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// DEFINE PUBLIC STRUCTURES.
+
+// DynamicMessageViewType is a MessageType whose messages are DynamicMessageViews rather than DynamicMessages.  Subscribing to a topic with a DynamicMessageViewType
+// hands the callback a view of the received bytes, so that only the fields the callback actually reads are ever decoded.
+type DynamicMessageViewType struct {
+	dynamicType *DynamicMessageType
+}
+
+// DynamicMessageView is a read-only view of a serialized ROS message whose type is only known at runtime.  Unlike a DynamicMessage, the view keeps the raw TCPROS
+// bytes and only decodes a field when it is accessed by path, which makes it cheap to pick a few fields out of large messages such as images or point clouds.
+// DynamicMessageView implements the rosgo Message interface.
+type DynamicMessageView struct {
+	dynamicType *DynamicMessageType
+	plan        *dynamicPlan
+	raw         []byte
+	offsets     []int // Start of the data of each op in the plan, followed by the end of the message; worked out on first access.
+}
+
+// DEFINE PUBLIC STATIC FUNCTIONS.
+
+// NewDynamicMessageViewType generates a DynamicMessageViewType corresponding to the specified typeName from the available ROS message definitions; typeName should be a
+// fully-qualified ROS message type name.
+func NewDynamicMessageViewType(typeName string) (*DynamicMessageViewType, error) {
+	t, err := NewDynamicMessageType(typeName)
+	if err != nil {
+		return nil, err
+	}
+	return t.ViewType(), nil
+}
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	DynamicMessageType
+
+// ViewType returns a MessageType with the same schema as the DynamicMessageType, but which creates DynamicMessageViews.
+func (t *DynamicMessageType) ViewType() *DynamicMessageViewType {
+	return &DynamicMessageViewType{dynamicType: t}
+}
+
+// NewDynamicMessageView creates a view over a serialized message of this type.  The bytes are not copied, so they must not be modified while the view is in use.
+func (t *DynamicMessageType) NewDynamicMessageView(raw []byte) (*DynamicMessageView, error) {
+	plan, err := t.getPlan()
+	if err != nil {
+		return nil, err
+	}
+	return &DynamicMessageView{dynamicType: t, plan: plan, raw: raw}, nil
+}
+
+//	DynamicMessageViewType
+
+// DynamicType returns the DynamicMessageType describing the schema of the viewed messages.
+func (t *DynamicMessageViewType) DynamicType() *DynamicMessageType {
+	return t.dynamicType
+}
+
+// Name returns the full ROS name of the message type; required for ros.MessageType.
+func (t *DynamicMessageViewType) Name() string {
+	return t.dynamicType.Name()
+}
+
+// Text returns the full ROS message specification for this message type; required for ros.MessageType.
+func (t *DynamicMessageViewType) Text() string {
+	return t.dynamicType.Text()
+}
+
+// MD5Sum returns the ROS compatible MD5 sum of the message type; required for ros.MessageType.
+func (t *DynamicMessageViewType) MD5Sum() string {
+	return t.dynamicType.MD5Sum()
+}
+
+// NewMessage creates an empty DynamicMessageView; required for ros.MessageType.
+func (t *DynamicMessageViewType) NewMessage() Message {
+	return &DynamicMessageView{dynamicType: t.dynamicType}
+}
+
+//	DynamicMessageView
+
+// Type returns the ROS type of the viewed message; required for ros.Message.
+func (v *DynamicMessageView) Type() MessageType {
+	return v.dynamicType.ViewType()
+}
+
+// GetDynamicType returns the DynamicMessageType of the viewed message.
+func (v *DynamicMessageView) GetDynamicType() *DynamicMessageType {
+	return v.dynamicType
+}
+
+// Bytes returns the serialized message held by the view.
+func (v *DynamicMessageView) Bytes() []byte {
+	return v.raw
+}
+
+// Serialize writes out the viewed message as is; required for ros.Message.
+func (v *DynamicMessageView) Serialize(buf *bytes.Buffer) error {
+	// Make sure that we are holding a whole message before passing it on.
+	if err := v.layout(); err != nil {
+		return err
+	}
+	buf.Write(v.raw[:v.offsets[len(v.offsets)-1]])
+	return nil
+}
+
+// Deserialize takes a copy of the remaining bytes of the reader to view; required for ros.Message.  Subscribers skip the copy and hand the received bytes over directly.
+func (v *DynamicMessageView) Deserialize(buf *bytes.Reader) error {
+	raw := make([]byte, buf.Len())
+	buf.Read(raw)
+	v.reset(raw)
+	return nil
+}
+
+// Get decodes the field at the given path, for example `header.stamp` or `poses[3].pose.position.x`.  Values are returned in the same representation as they
+// are held in DynamicMessage data, except that nested messages are returned as DynamicMessageViews and uint8 arrays are sub-slices of the viewed bytes.
+func (v *DynamicMessageView) Get(path string) (interface{}, error) {
+	elements, err := parseDynamicPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	view := v
+	for i, element := range elements {
+		last := i == len(elements)-1
+
+		// Find where the field lives in the message.
+		if err := view.layout(); err != nil {
+			return nil, err
+		}
+		ref, ok := view.plan.fields[element.name]
+		if !ok {
+			return nil, &FieldPathError{Path: path, Reason: "no field " + element.name + " in " + view.dynamicType.Name()}
+		}
+		op := &view.plan.ops[ref.op]
+		start, end := view.offsets[ref.op], view.offsets[ref.op+1]
+
+		// Scalars in a fixed-size run can be decoded straight away.
+		if ref.run >= 0 {
+			if element.index >= 0 {
+				return nil, &FieldPathError{Path: path, Reason: element.name + " is not an array"}
+			}
+			if !last {
+				return nil, &FieldPathError{Path: path, Reason: element.name + " is not a message"}
+			}
+			field := op.run[ref.run]
+			return decodeDynamicScalar(field.prim, view.raw[start+field.offset:]), nil
+		}
+
+		// Otherwise narrow things down to a single array element if we've been asked to.
+		if element.index >= 0 {
+			if !op.field.IsArray {
+				return nil, &FieldPathError{Path: path, Reason: element.name + " is not an array"}
+			}
+			var err error
+			if start, end, err = op.element(view.raw, start, element.index); err != nil {
+				return nil, errors.Wrap(err, "Field: "+element.name)
+			}
+		}
+		single := !op.field.IsArray || element.index >= 0
+
+		if last {
+			if single {
+				return view.elementValue(op, start, end), nil
+			}
+			return view.arrayValue(op, start, end), nil
+		}
+
+		// There is more path to go, so we'd better be holding a message.
+		if op.prim != dynamicMessage || !single {
+			return nil, &FieldPathError{Path: path, Reason: element.name + " is not a message"}
+		}
+		view = op.nestedView(view.raw, start, end)
+	}
+
+	// Unreachable, paths always have at least one element.
+	return nil, nil
+}
+
+// Message decodes the whole of the viewed message into a DynamicMessage.
+func (v *DynamicMessageView) Message() (*DynamicMessage, error) {
+	if err := v.layout(); err != nil {
+		return nil, err
+	}
+	return v.plan.decodeMessage(bytes.NewReader(v.raw), v.dynamicType)
+}
+
+// String returns a string which describes the viewed message.
+func (v *DynamicMessageView) String() string {
+	return fmt.Sprint(v.dynamicType.Name(), "::view(", len(v.raw), " bytes)")
+}
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+// checkDynamicBounds checks that size bytes are available from off in raw, returning the offset just past them.
+func checkDynamicBounds(raw []byte, off, size int) (int, error) {
+	if size < 0 || len(raw)-off < size {
+		return 0, errors.New("buffer size too small")
+	}
+	return off + size, nil
+}
+
+// readDynamicSize reads the uint32 length prefix of a string or dynamic array at off in raw, returning it along with the offset just past it.
+func readDynamicSize(raw []byte, off int) (int, int, error) {
+	end, err := checkDynamicBounds(raw, off, 4)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(binary.LittleEndian.Uint32(raw[off:])), end, nil
+}
+
+// skipDynamicString returns the offset just past the string at off in raw.
+func skipDynamicString(raw []byte, off int) (int, error) {
+	size, off, err := readDynamicSize(raw, off)
+	if err != nil {
+		return 0, errors.Wrap(err, "decoding string")
+	}
+	return checkDynamicBounds(raw, off, size)
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	DynamicMessageView
+
+// reset points the view at a new serialized message.
+func (v *DynamicMessageView) reset(raw []byte) {
+	v.raw = raw
+	v.offsets = nil
+}
+
+// layout works out where the data of each op in the plan starts.  This only touches the length prefixes of strings and arrays, so it's cheap even for big messages.
+func (v *DynamicMessageView) layout() error {
+	if v.offsets != nil {
+		return nil
+	}
+	if v.plan == nil {
+		plan, err := v.dynamicType.getPlan()
+		if err != nil {
+			return err
+		}
+		v.plan = plan
+	}
+
+	offsets := make([]int, len(v.plan.ops)+1)
+	off := 0
+	for i := range v.plan.ops {
+		offsets[i] = off
+		var err error
+		if off, err = v.plan.ops[i].skip(v.raw, off); err != nil {
+			return errors.Wrap(err, "Field: "+v.plan.ops[i].name())
+		}
+	}
+	offsets[len(v.plan.ops)] = off
+
+	// All done.
+	v.offsets = offsets
+	return nil
+}
+
+// elementValue decodes a scalar field, or a single element of an array field, held in raw[start:end].
+func (v *DynamicMessageView) elementValue(op *dynamicOp, start, end int) interface{} {
+	switch op.prim {
+	case dynamicString:
+		return string(v.raw[start+4 : end])
+	case dynamicMessage:
+		return op.nestedView(v.raw, start, end)
+	default:
+		return decodeDynamicScalar(op.prim, v.raw[start:end])
+	}
+}
+
+// arrayValue decodes a whole array field held in raw[start:end].
+func (v *DynamicMessageView) arrayValue(op *dynamicOp, start, end int) interface{} {
+	// The layout has already been checked, so there's no need to check bounds again.
+	count, off, _ := op.arrayCount(v.raw, start)
+
+	switch op.kind {
+	case dynamicOpStringArray:
+		array := make([]string, count)
+		for i := range array {
+			size, first, _ := readDynamicSize(v.raw, off)
+			off = first + size
+			array[i] = string(v.raw[first:off])
+		}
+		return array
+
+	case dynamicOpMessageArray:
+		array := make([]*DynamicMessageView, count)
+		for i := range array {
+			next, _ := op.nestedPlan.skip(v.raw, off)
+			array[i] = op.nestedView(v.raw, off, next)
+			off = next
+		}
+		return array
+
+	default:
+		// Byte arrays are handed out without copying; the capacity is clipped so that appending can't scribble over the rest of the message.
+		if op.prim == dynamicUint8 {
+			return v.raw[off:end:end]
+		}
+		array := newDynamicArray(op.prim, count)
+		decodeDynamicChunk(array, 0, v.raw[off:end])
+		return array
+	}
+}
+
+//	dynamicOp
+
+// name returns the name of the (first) field handled by the op.
+func (op *dynamicOp) name() string {
+	if op.kind == dynamicOpFixedRun {
+		return op.run[0].name
+	}
+	return op.field.Name
+}
+
+// nestedView creates a view of the nested message held in raw[start:end].
+func (op *dynamicOp) nestedView(raw []byte, start, end int) *DynamicMessageView {
+	return &DynamicMessageView{dynamicType: op.nested, plan: op.nestedPlan, raw: raw[start:end:end]}
+}
+
+// arrayCount returns the number of elements in the array field at off in raw, along with the offset of the first element.
+func (op *dynamicOp) arrayCount(raw []byte, off int) (int, int, error) {
+	if op.field.ArrayLen >= 0 {
+		return op.field.ArrayLen, off, nil
+	}
+	return readDynamicSize(raw, off)
+}
+
+// elementSize returns the wire size of each array element, or -1 if the elements vary in size.
+func (op *dynamicOp) elementSize() int {
+	switch op.kind {
+	case dynamicOpArray:
+		return op.size
+	case dynamicOpMessageArray:
+		return op.nestedPlan.fixedSize
+	default:
+		return -1
+	}
+}
+
+// skipElement returns the offset just past the variable size array element at off in raw.
+func (op *dynamicOp) skipElement(raw []byte, off int) (int, error) {
+	if op.prim == dynamicString {
+		return skipDynamicString(raw, off)
+	}
+	return op.nestedPlan.skip(raw, off)
+}
+
+// skip returns the offset just past the data of the op, which starts at off in raw.
+func (op *dynamicOp) skip(raw []byte, off int) (int, error) {
+	switch op.kind {
+	case dynamicOpFixedRun:
+		return checkDynamicBounds(raw, off, op.size)
+	case dynamicOpString:
+		return skipDynamicString(raw, off)
+	case dynamicOpMessage:
+		return op.nestedPlan.skip(raw, off)
+	}
+
+	// It's an array.
+	count, off, err := op.arrayCount(raw, off)
+	if err != nil {
+		return 0, err
+	}
+	if size := op.elementSize(); size >= 0 {
+		return checkDynamicBounds(raw, off, count*size)
+	}
+	for i := 0; i < count; i++ {
+		if off, err = op.skipElement(raw, off); err != nil {
+			return 0, err
+		}
+	}
+	return off, nil
+}
+
+// element returns the start and end of element index of the array field at off in raw.
+func (op *dynamicOp) element(raw []byte, off, index int) (int, int, error) {
+	count, off, err := op.arrayCount(raw, off)
+	if err != nil {
+		return 0, 0, err
+	}
+	if index >= count {
+		return 0, 0, errors.New(fmt.Sprintf("index %d out of range for array of length %d", index, count))
+	}
+
+	// Fixed size elements can be found directly, the rest we have to step through.
+	if size := op.elementSize(); size >= 0 {
+		start := off + index*size
+		end, err := checkDynamicBounds(raw, start, size)
+		return start, end, err
+	}
+	for i := 0; i < index; i++ {
+		if off, err = op.skipElement(raw, off); err != nil {
+			return 0, 0, err
+		}
+	}
+	end, err := op.skipElement(raw, off)
+	return off, end, err
+}
+
+//	dynamicPlan
+
+// skip returns the offset just past the message at off in raw.
+func (p *dynamicPlan) skip(raw []byte, off int) (int, error) {
+	if p.fixedSize >= 0 {
+		return checkDynamicBounds(raw, off, p.fixedSize)
+	}
+	for i := range p.ops {
+		var err error
+		if off, err = p.ops[i].skip(raw, off); err != nil {
+			return 0, errors.Wrap(err, "Field: "+p.ops[i].name())
+		}
+	}
+	return off, nil
+}
+
+// ALL DONE.
@@ -0,0 +1,181 @@
+package ros
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	gengo "github.com/asimovsecurity/rosgo/libgengo"
+)
+
+// `dynamic_message_view_test.go` uses the message types and serialized payloads defined in `dynamic_message_benchmark_test.go`.
+
+func TestDynamicMessageView_Get_Primitives(t *testing.T) {
+	testCases := map[string]struct {
+		messageType *DynamicMessageType
+		serialized  []byte
+	}{
+		"singular":      {&singularMessageType, singularSerialized},
+		"fixed array":   {&fixedArrayMessageType, fixedArraySerialized},
+		"dynamic array": {&dynamicArrayMessageType, dynamicArraySerialized},
+	}
+
+	for name, testCase := range testCases {
+		// The view should agree with a full decode on every field.
+		expected := testCase.messageType.NewDynamicMessage()
+		if err := expected.Deserialize(bytes.NewReader(testCase.serialized)); err != nil {
+			t.Fatalf("%s: deserialize failed %s", name, err)
+		}
+
+		view, err := testCase.messageType.NewDynamicMessageView(testCase.serialized)
+		if err != nil {
+			t.Fatalf("%s: failed to create view %s", name, err)
+		}
+		for key, expectedValue := range expected.data {
+			value, err := view.Get(key)
+			if err != nil {
+				t.Fatalf("%s: get %s failed %s", name, key, err)
+			}
+			if !reflect.DeepEqual(value, expectedValue) {
+				t.Fatalf("%s: %s: expected %v, got %v", name, key, expectedValue, value)
+			}
+		}
+
+		// Nothing should be lost by passing the view on.
+		var buf bytes.Buffer
+		if err := view.Serialize(&buf); err != nil {
+			t.Fatalf("%s: serialize failed %s", name, err)
+		}
+		if !bytes.Equal(buf.Bytes(), testCase.serialized) {
+			t.Fatalf("%s: expected %x, got %x", name, testCase.serialized, buf.Bytes())
+		}
+	}
+
+	// Array elements can be picked out individually.
+	view, _ := dynamicArrayMessageType.NewDynamicMessageView(dynamicArraySerialized)
+	expectedElements := map[string]interface{}{
+		"u16[1]": uint16(0x9abc),
+		"s[2]":   "croos",
+		"t[1]":   NewTime(0x1337beef, 0x1337f00d),
+		"u8[7]":  uint8(0x12),
+	}
+	for path, expectedValue := range expectedElements {
+		value, err := view.Get(path)
+		if err != nil {
+			t.Fatalf("get %s failed %s", path, err)
+		}
+		if value != expectedValue {
+			t.Fatalf("%s: expected %v, got %v", path, expectedValue, value)
+		}
+	}
+}
+
+func TestDynamicMessageView_Get_Nested(t *testing.T) {
+	innerType := &DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "uint16", "u16", false, 0),
+			*gengo.NewField("Testing", "string", "s", false, 0),
+		}),
+		nested: make(map[string]*DynamicMessageType),
+	}
+	testMessageType := DynamicMessageType{
+		spec: generateTestSpec([]gengo.Field{
+			*gengo.NewField("Testing", "Test", "inner", false, 0),
+			*gengo.NewField("Testing", "Test", "inners", true, -1),
+			*gengo.NewField("Testing", "uint8", "data", true, -1),
+			*gengo.NewField("Testing", "int8", "i8", false, 0),
+		}),
+		nested: map[string]*DynamicMessageType{"Testing/Test": innerType},
+	}
+
+	serialized := []byte{
+		0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 'h', 'i', // inner
+		0x02, 0x00, 0x00, 0x00, // Dynamic array size.
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, // inners[0]
+		0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 'x', // inners[1]
+		0x03, 0x00, 0x00, 0x00, 0xaa, 0xbb, 0xcc, // data
+		0xff, // i8
+	}
+
+	view, err := testMessageType.NewDynamicMessageView(serialized)
+	if err != nil {
+		t.Fatalf("failed to create view %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"inner.u16":     uint16(1),
+		"inner.s":       "hi",
+		"inners[1].u16": uint16(3),
+		"inners[1].s":   "x",
+		"i8":            int8(-1),
+	}
+	for path, expectedValue := range expected {
+		value, err := view.Get(path)
+		if err != nil {
+			t.Fatalf("get %s failed %s", path, err)
+		}
+		if value != expectedValue {
+			t.Fatalf("%s: expected %v, got %v", path, expectedValue, value)
+		}
+	}
+
+	// Byte arrays are sub-slices of the viewed bytes.
+	data, err := view.Get("data")
+	if err != nil {
+		t.Fatalf("get data failed %s", err)
+	}
+	if b := data.([]byte); len(b) != 3 || &b[0] != &serialized[29] || cap(b) != 3 {
+		t.Fatalf("expected sub-slice of the serialized bytes, got %v", b)
+	}
+
+	// Nested messages are views too.
+	inners, err := view.Get("inners")
+	if err != nil {
+		t.Fatalf("get inners failed %s", err)
+	}
+	if views := inners.([]*DynamicMessageView); len(views) != 2 || !bytes.Equal(views[0].Bytes(), serialized[12:18]) {
+		t.Fatalf("unexpected nested views %v", inners)
+	}
+
+	// A full decode is still available.
+	msg, err := view.Message()
+	if err != nil {
+		t.Fatalf("message failed %s", err)
+	}
+	if msg.data["i8"] != int8(-1) {
+		t.Fatalf("unexpected decoded message %v", msg)
+	}
+
+	// Bad paths are reported.
+	badPaths := []string{"", "missing", "inner.missing", "i8.x", "i8[0]", "inners[2].s", "inners.s", "inner[0]", "data[x]", "inners[-1]", "inner..s"}
+	for _, path := range badPaths {
+		if _, err := view.Get(path); err == nil {
+			t.Fatalf("expected error for path %q", path)
+		}
+	}
+
+	// As are truncated messages.
+	truncated, _ := testMessageType.NewDynamicMessageView(serialized[:20])
+	if _, err := truncated.Get("inner.u16"); err == nil {
+		t.Fatalf("expected error for truncated message")
+	}
+	if err := truncated.Serialize(&bytes.Buffer{}); err == nil {
+		t.Fatalf("expected serialize error for truncated message")
+	}
+}
+
+func TestDynamicMessageView_MessageType(t *testing.T) {
+	viewType := singularMessageType.ViewType()
+	if viewType.Name() != singularMessageType.Name() || viewType.MD5Sum() != singularMessageType.MD5Sum() || viewType.Text() != singularMessageType.Text() {
+		t.Fatalf("view type doesn't match the dynamic type")
+	}
+
+	msg := viewType.NewMessage()
+	if err := msg.Deserialize(bytes.NewReader(singularSerialized)); err != nil {
+		t.Fatalf("deserialize failed %s", err)
+	}
+	value, err := msg.(*DynamicMessageView).Get("s")
+	if err != nil || value != "Rocos" {
+		t.Fatalf("unexpected value %v, error %v", value, err)
+	}
+}
@@ -0,0 +1,603 @@
+package ros
+
+// IMPORT REQUIRED PACKAGES.
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DEFINE PRIVATE STRUCTURES.
+
+// yamlCodec encodes messages as YAML, laid out exactly as `rostopic echo` prints them, and decodes the block and flow YAML that `rostopic pub` accepts.
+type yamlCodec struct{}
+
+// yamlEncoder writes `rostopic echo` style YAML for encodeDynamicFields.
+type yamlEncoder struct {
+	buf    []byte
+	frames []yamlFrame
+}
+
+// yamlFrame is a map or sequence the encoder is in the middle of writing.
+type yamlFrame struct {
+	indent string // Indentation of the entries of a block map or sequence.
+	seq    bool   // A block sequence, written one `- ` entry per line.
+	flow   bool   // A sequence of scalars, written inline as Python would print a list.
+	empty  bool   // An empty sequence, already written as [].
+	count  int    // Number of entries written so far.
+}
+
+// yamlLine is a line of YAML input, less its indentation.
+type yamlLine struct {
+	indent int
+	text   string
+	number int
+}
+
+// yamlParser reads the block structure of YAML input, one line at a time.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// yamlFlowParser reads flow style YAML, and the scalars of block style YAML.
+type yamlFlowParser struct {
+	s string
+	i int
+}
+
+// DEFINE PUBLIC RECEIVER FUNCTIONS.
+
+//	yamlCodec
+
+// Name returns "yaml"; required for Codec.
+func (yamlCodec) Name() string {
+	return "yaml"
+}
+
+// Marshal encodes the message as YAML, as `rostopic echo` would print it; required for Codec.
+func (yamlCodec) Marshal(m *DynamicMessage) ([]byte, error) {
+	enc := yamlEncoder{}
+	if err := encodeDynamicFields(&enc, m); err != nil {
+		return nil, err
+	}
+	return append(enc.buf, '\n'), nil
+}
+
+// Unmarshal decodes YAML into the message; required for Codec.
+func (yamlCodec) Unmarshal(buf []byte, m *DynamicMessage) error {
+	value, err := parseYAML(string(buf))
+	if err != nil {
+		return errors.Wrap(err, "yaml")
+	}
+	if value == nil {
+		return nil
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("yaml: expected a map")
+	}
+	return m.decodeGeneric("", object)
+}
+
+// DEFINE PRIVATE STATIC FUNCTIONS.
+
+// formatPythonFloat formats a float as Python's repr does, which is how `rostopic echo` prints them.
+func formatPythonFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	exp, _ := strconv.Atoi(s[strings.IndexByte(s, 'e')+1:])
+	if exp < -4 || exp >= 16 {
+		return s
+	}
+	s = strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.ContainsRune(s, '.') {
+		s += ".0"
+	}
+	return s
+}
+
+// quotePythonString quotes a string as Python's repr does, which is how `rostopic echo` prints strings within lists.
+func quotePythonString(s string) string {
+	quote := byte('\'')
+	if strings.IndexByte(s, '\'') >= 0 && strings.IndexByte(s, '"') < 0 {
+		quote = '"'
+	}
+	buf := []byte{quote}
+	for _, r := range s {
+		switch {
+		case r == rune(quote) || r == '\\':
+			buf = append(buf, '\\', byte(r))
+		case r == '\n':
+			buf = append(buf, '\\', 'n')
+		case r == '\r':
+			buf = append(buf, '\\', 'r')
+		case r == '\t':
+			buf = append(buf, '\\', 't')
+		case r < 0x20 || r == 0x7f:
+			buf = append(buf, fmt.Sprintf("\\x%02x", r)...)
+		default:
+			buf = append(buf, string(r)...)
+		}
+	}
+	return string(append(buf, quote))
+}
+
+// parseYAML parses YAML input into generic values for decodeGeneric.  It understands the subset of YAML used to write ROS messages: block maps and
+// sequences, flow maps and sequences, and plain, single and double quoted scalars.  Anchors, tags and multi-line scalars aren't supported.
+func parseYAML(input string) (interface{}, error) {
+	p := yamlParser{}
+	for number, text := range strings.Split(input, "\n") {
+		text = strings.TrimRight(text, " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed[0] == '#' || text == "---" || text == "..." {
+			continue
+		}
+		if trimmed[0] == '\t' {
+			return nil, errors.New("tab used for indentation at line " + strconv.Itoa(number+1))
+		}
+		p.lines = append(p.lines, yamlLine{indent: len(text) - len(trimmed), text: trimmed, number: number + 1})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+
+	value, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, errors.New("unexpected indentation at line " + strconv.Itoa(p.lines[p.pos].number))
+	}
+	return value, nil
+}
+
+// isYAMLSequenceEntry checks whether a line starts an entry of a block sequence.
+func isYAMLSequenceEntry(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits a block map entry into its key, and the value following it on the same line (if any).
+func splitYAMLKey(text string) (string, string, bool) {
+	if text == "" || strings.IndexByte("[{'\"", text[0]) >= 0 {
+		// Quoted keys are allowed, but flow collections and quoted scalars aren't keys.
+		if text == "" || text[0] == '[' || text[0] == '{' {
+			return "", "", false
+		}
+		f := yamlFlowParser{s: text}
+		key, err := f.parseQuoted()
+		if err != nil || f.i >= len(text) || text[f.i] != ':' || (f.i+1 < len(text) && text[f.i+1] != ' ') {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(text[f.i+1:]), true
+	}
+	if strings.HasSuffix(text, ":") {
+		return text[:len(text)-1], "", true
+	}
+	if i := strings.Index(text, ": "); i >= 0 {
+		return text[:i], strings.TrimSpace(text[i+2:]), true
+	}
+	return "", "", false
+}
+
+// resolveYAMLScalar works out the type of a plain (unquoted) scalar.
+func resolveYAMLScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	}
+	if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return n
+	}
+	if n, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return n
+	}
+	// ParseFloat also accepts nan and inf, which YAML leaves as strings; decodeGeneric will still take them for float fields.
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return f
+	}
+	return s
+}
+
+// DEFINE PRIVATE RECEIVER FUNCTIONS.
+
+//	yamlEncoder
+
+// value writes whatever has to come before a value, depending on what it's part of.
+func (e *yamlEncoder) value() {
+	if len(e.frames) == 0 {
+		return
+	}
+	top := &e.frames[len(e.frames)-1]
+	switch {
+	case top.flow:
+		if top.count > 0 {
+			e.buf = append(e.buf, ", "...)
+		}
+	case top.seq:
+		e.buf = append(e.buf, '\n')
+		e.buf = append(e.buf, top.indent...)
+		e.buf = append(e.buf, "- "...)
+	default:
+		// Python leaves a space after the colon even when the value starts on the next line.
+		e.buf = append(e.buf, ' ')
+	}
+	top.count++
+}
+
+// push starts a map or sequence within whatever is being written.
+func (e *yamlEncoder) push(frame yamlFrame) {
+	if len(e.frames) > 0 {
+		frame.indent = e.frames[len(e.frames)-1].indent + "  "
+	}
+	e.frames = append(e.frames, frame)
+}
+
+// flow checks whether values are being written into a Python style list.
+func (e *yamlEncoder) flow() bool {
+	return len(e.frames) > 0 && e.frames[len(e.frames)-1].flow
+}
+
+func (e *yamlEncoder) beginMap(n int) {
+	e.value()
+	e.push(yamlFrame{})
+}
+
+func (e *yamlEncoder) key(name string) {
+	if len(e.buf) > 0 {
+		e.buf = append(e.buf, '\n')
+	}
+	e.buf = append(e.buf, e.frames[len(e.frames)-1].indent...)
+	e.buf = append(e.buf, name...)
+	e.buf = append(e.buf, ':')
+}
+
+func (e *yamlEncoder) endMap() {
+	e.frames = e.frames[:len(e.frames)-1]
+}
+
+func (e *yamlEncoder) beginArray(n int, scalars bool) {
+	e.value()
+	switch {
+	case n == 0:
+		e.buf = append(e.buf, "[]"...)
+		e.push(yamlFrame{empty: true})
+	case scalars:
+		e.buf = append(e.buf, '[')
+		e.push(yamlFrame{flow: true})
+	default:
+		e.push(yamlFrame{seq: true})
+	}
+}
+
+func (e *yamlEncoder) endArray() {
+	if top := e.frames[len(e.frames)-1]; top.flow {
+		e.buf = append(e.buf, ']')
+	}
+	e.frames = e.frames[:len(e.frames)-1]
+}
+
+func (e *yamlEncoder) writeBool(v bool) {
+	e.value()
+	if v {
+		e.buf = append(e.buf, "True"...)
+	} else {
+		e.buf = append(e.buf, "False"...)
+	}
+}
+
+func (e *yamlEncoder) writeInt(v int64) {
+	e.value()
+	e.buf = strconv.AppendInt(e.buf, v, 10)
+}
+
+func (e *yamlEncoder) writeUint(v uint64) {
+	e.value()
+	e.buf = strconv.AppendUint(e.buf, v, 10)
+}
+
+func (e *yamlEncoder) writeFloat(f float64, bits int) {
+	e.value()
+	e.buf = append(e.buf, formatPythonFloat(f)...)
+}
+
+func (e *yamlEncoder) writeString(s string) {
+	flow := e.flow()
+	e.value()
+	switch {
+	case flow:
+		e.buf = append(e.buf, quotePythonString(s)...)
+	case s == "":
+		e.buf = append(e.buf, "''"...)
+	default:
+		// Go's escapes are all valid in YAML double quoted scalars.
+		e.buf = strconv.AppendQuote(e.buf, s)
+	}
+}
+
+func (e *yamlEncoder) writeBytes(b []byte) {
+	e.beginArray(len(b), true)
+	for _, c := range b {
+		e.writeUint(uint64(c))
+	}
+	e.endArray()
+}
+
+func (e *yamlEncoder) writeTime(sec uint32, nsec uint32) {
+	e.value()
+	indent := "  "
+	if len(e.frames) > 0 {
+		indent = e.frames[len(e.frames)-1].indent + "  "
+	}
+	// Nanoseconds are right aligned, as rostopic does.
+	e.buf = append(e.buf, fmt.Sprintf("\n%ssecs: %d\n%snsecs: %9d", indent, sec, indent, nsec)...)
+}
+
+//	yamlParser
+
+// parseNode parses whatever starts at the current line: a block sequence, a block map, or a scalar or flow collection on a line of its own.
+func (p *yamlParser) parseNode() (interface{}, error) {
+	line := p.lines[p.pos]
+	if isYAMLSequenceEntry(line.text) {
+		return p.parseSequence(line.indent)
+	}
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return p.parseMap(line.indent)
+	}
+	p.pos++
+	return parseYAMLFlow(line.text, line.number)
+}
+
+// parseMap parses the entries of a block map at the given indentation.
+func (p *yamlParser) parseMap(indent int) (interface{}, error) {
+	result := make(map[string]interface{})
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, errors.New("unexpected indentation at line " + strconv.Itoa(line.number))
+		}
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, errors.New("expected a key at line " + strconv.Itoa(line.number))
+		}
+		if _, ok := result[key]; ok {
+			return nil, errors.New("duplicate key " + key + " at line " + strconv.Itoa(line.number))
+		}
+		p.pos++
+
+		// The value is either on the same line, or the block which follows; sequences may sit at the same indentation as their key.
+		var value interface{}
+		var err error
+		if rest != "" {
+			value, err = parseYAMLFlow(rest, line.number)
+		} else if p.pos < len(p.lines) && (p.lines[p.pos].indent > indent || (p.lines[p.pos].indent == indent && isYAMLSequenceEntry(p.lines[p.pos].text))) {
+			value, err = p.parseNode()
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// parseSequence parses the entries of a block sequence at the given indentation.
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	result := []interface{}{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isYAMLSequenceEntry(line.text) {
+			break
+		}
+		rest := strings.TrimLeft(line.text[1:], " ")
+
+		var value interface{}
+		var err error
+		switch {
+		case rest == "":
+			// The entry is the block which follows.
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				value, err = p.parseNode()
+			}
+		case isYAMLSequenceEntry(rest):
+			// A compact nested entry such as `- a: 1`; treat what follows the dash as a line of its own.
+			p.lines[p.pos] = yamlLine{indent: indent + len(line.text) - len(rest), text: rest, number: line.number}
+			value, err = p.parseNode()
+		default:
+			if _, _, ok := splitYAMLKey(rest); ok {
+				p.lines[p.pos] = yamlLine{indent: indent + len(line.text) - len(rest), text: rest, number: line.number}
+				value, err = p.parseNode()
+			} else {
+				p.pos++
+				value, err = parseYAMLFlow(rest, line.number)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+//	yamlFlowParser
+
+// parseYAMLFlow parses a scalar or flow collection making up the rest of a line.
+func parseYAMLFlow(text string, number int) (interface{}, error) {
+	f := yamlFlowParser{s: text}
+	value, err := f.parseValue(false)
+	if err == nil {
+		f.skipSpace()
+		if f.i < len(f.s) && f.s[f.i] != '#' {
+			err = errors.New("unexpected " + strconv.Quote(f.s[f.i:]))
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "line "+strconv.Itoa(number))
+	}
+	return value, nil
+}
+
+func (f *yamlFlowParser) skipSpace() {
+	for f.i < len(f.s) && (f.s[f.i] == ' ' || f.s[f.i] == '\t') {
+		f.i++
+	}
+}
+
+// parseValue parses a single value; inFlow is set within a flow collection, where commas and brackets end plain scalars.
+func (f *yamlFlowParser) parseValue(inFlow bool) (interface{}, error) {
+	f.skipSpace()
+	if f.i >= len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.i] {
+	case '[':
+		return f.parseSequence()
+	case '{':
+		return f.parseMap()
+	case '"', '\'':
+		return f.parseQuoted()
+	}
+	return resolveYAMLScalar(f.parsePlain(inFlow, false)), nil
+}
+
+// parsePlain reads a plain scalar, up to a comment, or in flow collections up to a comma, bracket or (for keys) colon.
+func (f *yamlFlowParser) parsePlain(inFlow bool, isKey bool) string {
+	start := f.i
+	for ; f.i < len(f.s); f.i++ {
+		c := f.s[f.i]
+		if c == '#' && f.i > start && f.s[f.i-1] == ' ' {
+			break
+		}
+		if inFlow && (c == ',' || c == ']' || c == '}') {
+			break
+		}
+		if isKey && c == ':' && (f.i+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.i+1]) >= 0) {
+			break
+		}
+	}
+	return strings.TrimSpace(f.s[start:f.i])
+}
+
+// parseQuoted reads a single or double quoted scalar.
+func (f *yamlFlowParser) parseQuoted() (string, error) {
+	quote := f.s[f.i]
+	start := f.i
+	for f.i++; f.i < len(f.s); f.i++ {
+		switch {
+		case quote == '"' && f.s[f.i] == '\\':
+			f.i++
+		case f.s[f.i] == quote:
+			if quote == '\'' && f.i+1 < len(f.s) && f.s[f.i+1] == '\'' {
+				// Single quotes are escaped by doubling them.
+				f.i++
+				continue
+			}
+			f.i++
+			if quote == '\'' {
+				return strings.Replace(f.s[start+1:f.i-1], "''", "'", -1), nil
+			}
+			return strconv.Unquote(f.s[start:f.i])
+		}
+	}
+	return "", errors.New("unterminated string " + f.s[start:])
+}
+
+// parseSequence reads a flow sequence such as `[1, 2, 3]`.
+func (f *yamlFlowParser) parseSequence() (interface{}, error) {
+	result := []interface{}{}
+	f.i++
+	for {
+		f.skipSpace()
+		if f.i < len(f.s) && f.s[f.i] == ']' {
+			f.i++
+			return result, nil
+		}
+		value, err := f.parseValue(true)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+		if err := f.next(']'); err != nil {
+			return nil, err
+		}
+		if f.s[f.i-1] == ']' {
+			return result, nil
+		}
+	}
+}
+
+// parseMap reads a flow map such as `{x: 1, y: 2}`.
+func (f *yamlFlowParser) parseMap() (interface{}, error) {
+	result := make(map[string]interface{})
+	f.i++
+	for {
+		f.skipSpace()
+		if f.i < len(f.s) && f.s[f.i] == '}' {
+			f.i++
+			return result, nil
+		}
+		var key string
+		if f.i < len(f.s) && (f.s[f.i] == '"' || f.s[f.i] == '\'') {
+			var err error
+			if key, err = f.parseQuoted(); err != nil {
+				return nil, err
+			}
+		} else {
+			key = f.parsePlain(true, true)
+		}
+		f.skipSpace()
+		if f.i >= len(f.s) || f.s[f.i] != ':' {
+			return nil, errors.New("expected : after key " + key)
+		}
+		f.i++
+		value, err := f.parseValue(true)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+		if err := f.next('}'); err != nil {
+			return nil, err
+		}
+		if f.s[f.i-1] == '}' {
+			return result, nil
+		}
+	}
+}
+
+// next moves past the comma or closing bracket following an entry of a flow collection.
+func (f *yamlFlowParser) next(closing byte) error {
+	f.skipSpace()
+	if f.i < len(f.s) && (f.s[f.i] == ',' || f.s[f.i] == closing) {
+		f.i++
+		return nil
+	}
+	return errors.New("expected , or " + string(closing))
+}
+
+// ALL DONE.
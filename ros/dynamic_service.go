@@ -3,8 +3,6 @@ package ros
 // IMPORT REQUIRED PACKAGES.
 
 import (
-	"strings"
-
 	"github.com/asimovsecurity/rosgo/libgengo"
 	"github.com/pkg/errors"
 )
@@ -55,18 +53,14 @@ func newDynamicServiceTypeNested(typeName string, packageName string) (*DynamicS
 	m := new(DynamicServiceType)
 
 	// Create a message context if for some reason it does not exist yet, as it also contains service definitions
-	if context == nil {
-		// Create context for our ROS install.
-		c, err := libgengo.NewPkgContext(strings.Split(GetRuntimePackagePath(), ":"))
-		if err != nil {
-			return nil, err
-		}
-		context = c
+	ctx, err := getRuntimeContext()
+	if err != nil {
+		return nil, err
 	}
 	// We need to try to look up the full name, in case we've just been given a short name.
 	fullname := typeName
 
-	_, ok := context.GetSrvs()[fullname]
+	_, ok := ctx.GetSrvs()[fullname]
 	if !ok {
 		// Seems like the package_name we were give wasn't the full name.
 
@@ -77,7 +71,7 @@ func newDynamicServiceTypeNested(typeName string, packageName string) (*DynamicS
 	}
 
 	// Load context for the target message.
-	spec, err := context.LoadSrv(fullname)
+	spec, err := ctx.LoadSrv(fullname)
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +94,37 @@ func newDynamicServiceTypeNested(typeName string, packageName string) (*DynamicS
 
 }
 
+// newDynamicServiceTypeFromText creates a DynamicServiceType from the text of a service definition, given the definitions of the messages it uses by full
+// name; messages it doesn't define are looked up in our ROS install.
+func newDynamicServiceTypeFromText(typeName string, text string, texts map[string]string) (*DynamicServiceType, error) {
+	ctx, err := libgengo.NewPkgContext(nil)
+	if err != nil {
+		return nil, err
+	}
+	for name := range texts {
+		if err := loadMessageDefinition(ctx, name, texts, map[string]struct{}{}); err != nil {
+			return nil, errors.Wrap(err, "type: "+name)
+		}
+	}
+	spec, err := ctx.LoadSrvFromString(text, typeName)
+	if err != nil {
+		return nil, errors.Wrap(err, "type: "+typeName)
+	}
+
+	m := new(DynamicServiceType)
+	m.name = spec.FullName
+	m.md5sum = spec.MD5Sum
+	m.text = spec.Text
+	if m.reqType, err = newDynamicMessageTypeInContext(ctx, spec.Request.FullName, "", nil, nil); err != nil {
+		return nil, errors.Wrap(err, "error generating request type")
+	}
+	if m.resType, err = newDynamicMessageTypeInContext(ctx, spec.Response.FullName, "", nil, nil); err != nil {
+		return nil, errors.Wrap(err, "error generating response type")
+	}
+	// All done.
+	return m, nil
+}
+
 // DEFINE PUBLIC RECEIVER FUNCTIONS.
 
 //	DynamicServiceType
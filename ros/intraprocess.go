@@ -0,0 +1,182 @@
+package ros
+
+import (
+	goContext "context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// localSubscriberSession is a subscriber in this process which a publisher passes its messages to directly, rather than serializing them and sending
+// them over TCPROS.  Only the latest message is kept for it, as for a remote publisher, so that a busy subscriber can't hold up the publisher.
+type localSubscriberSession struct {
+	pub        *defaultPublisher
+	callerID   string
+	ctx        goContext.Context
+	msgChan    chan messageEvent
+	latestChan chan messageEvent
+	header     map[string]string
+}
+
+var (
+	localNodesMutex sync.RWMutex
+	// localNodes holds the nodes in this process which take intra-process connections, by slave API URI.
+	localNodes = map[string]*defaultNode{}
+)
+
+// Publish passes msg to this subscriber alone, without serializing it; required for SingleSubscriberPublisher.
+func (session *localSubscriberSession) Publish(msg Message) {
+	session.deliver(msg)
+}
+
+// GetSubscriberName returns the name of the subscribing node; required for SingleSubscriberPublisher.
+func (session *localSubscriberSession) GetSubscriberName() string {
+	return session.callerID
+}
+
+// GetTopic returns the topic subscribed to; required for SingleSubscriberPublisher.
+func (session *localSubscriberSession) GetTopic() string {
+	return session.pub.topic
+}
+
+// deliver queues msg for the subscriber, in place of any message it hasn't taken yet, and says whether it's still subscribed.
+func (session *localSubscriberSession) deliver(msg Message) bool {
+	if session.ctx.Err() != nil {
+		return false
+	}
+	event := messageEvent{
+		msg: msg,
+		event: MessageEvent{
+			PublisherName:    session.pub.node.qualifiedName,
+			ReceiptTime:      time.Now(),
+			ConnectionHeader: session.header,
+		},
+	}
+	for {
+		select {
+		case session.latestChan <- event:
+			return true
+		default:
+		}
+		select {
+		case <-session.latestChan:
+		default:
+		}
+	}
+}
+
+// run passes queued messages on to the subscriber until it unsubscribes.
+func (session *localSubscriberSession) run() {
+	for {
+		select {
+		case event := <-session.latestChan:
+			select {
+			case session.msgChan <- event:
+			case <-session.ctx.Done():
+				return
+			}
+		case <-session.ctx.Done():
+			return
+		}
+	}
+}
+
+// registerLocal lets subscribers in this process connect to the node's publishers directly.
+func (node *defaultNode) registerLocal() {
+	localNodesMutex.Lock()
+	defer localNodesMutex.Unlock()
+	localNodes[node.xmlrpcURI] = node
+}
+
+// unregisterLocal stops subscribers in this process connecting to the node's publishers directly.
+func (node *defaultNode) unregisterLocal() {
+	localNodesMutex.Lock()
+	defer localNodesMutex.Unlock()
+	if localNodes[node.xmlrpcURI] == node {
+		delete(localNodes, node.xmlrpcURI)
+	}
+}
+
+// connectLocal connects the subscriber directly to the publisher at pubURI, if it's in this process and takes intra-process connections, until ctx is
+// done.  Publishers of a different Go message type, and publishers whose messages need migrating, are left to TCPROS.
+func (sub *defaultSubscriber) connectLocal(ctx goContext.Context, pubURI string, callerID string) bool {
+	if sub.migrator != nil {
+		return false
+	}
+	localNodesMutex.RLock()
+	node, ok := localNodes[pubURI]
+	localNodesMutex.RUnlock()
+	if !ok {
+		return false
+	}
+	node.publishersMutex.RLock()
+	pub, ok := node.publishers[sub.topic]
+	node.publishersMutex.RUnlock()
+	if !ok || pub.msgType.MD5Sum() != sub.msgType.MD5Sum() || pub.msgType.Name() != sub.msgType.Name() {
+		return false
+	}
+	if reflect.TypeOf(pub.msgType.NewMessage()) != reflect.TypeOf(sub.msgType.NewMessage()) {
+		return false
+	}
+
+	session := &localSubscriberSession{
+		pub:        pub,
+		callerID:   callerID,
+		ctx:        ctx,
+		msgChan:    sub.msgChan,
+		latestChan: make(chan messageEvent, 1),
+		header: map[string]string{
+			"callerid":      node.qualifiedName,
+			"topic":         sub.topic,
+			"type":          pub.msgType.Name(),
+			"md5sum":        pub.msgType.MD5Sum(),
+			"intra_process": "1",
+		},
+	}
+	if !pub.addLocalSession(session) {
+		return false
+	}
+	go session.run()
+	return true
+}
+
+// addLocalSession starts passing messages to a subscriber in this process, unless the publisher has shut down.
+func (pub *defaultPublisher) addLocalSession(session *localSubscriberSession) bool {
+	pub.localMutex.Lock()
+	if pub.closed {
+		pub.localMutex.Unlock()
+		return false
+	}
+	pub.localSessions = append(pub.localSessions, session)
+	atomic.AddInt32(&pub.numLocal, 1)
+	pub.localMutex.Unlock()
+	if pub.connectCallback != nil {
+		go pub.connectCallback(session)
+	}
+	return true
+}
+
+// liveLocalSessions returns the subscribers in this process which are still subscribed, dropping those which aren't.  If closing, it drops them all,
+// and no more can be added.
+func (pub *defaultPublisher) liveLocalSessions(closing bool) []*localSubscriberSession {
+	pub.localMutex.Lock()
+	var live, dead []*localSubscriberSession
+	for _, session := range pub.localSessions {
+		if closing || session.ctx.Err() != nil {
+			dead = append(dead, session)
+		} else {
+			live = append(live, session)
+		}
+	}
+	pub.localSessions = live
+	pub.closed = pub.closed || closing
+	atomic.StoreInt32(&pub.numLocal, int32(len(live)))
+	pub.localMutex.Unlock()
+	if pub.disconnectCallback != nil {
+		for _, session := range dead {
+			go pub.disconnectCallback(session)
+		}
+	}
+	return live
+}
@@ -0,0 +1,134 @@
+package ros
+
+import (
+	goContext "context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIntraProcess(t *testing.T) {
+	writeTestPackage(t)
+	master := newFakeMaster()
+	defer master.server.Close()
+
+	newNode := func(name string, intraProcess bool) Node {
+		node, err := NewNodeWithOptions(name, WithMasterURI(master.server.URL), WithHostname("localhost"), WithSignalHandling(false), WithIntraProcess(intraProcess))
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for node.OK() {
+				node.SpinOnce()
+			}
+		}()
+		return node
+	}
+	talker := newNode("talker", true)
+	defer talker.Shutdown()
+	// The listener is shut down part way through.
+	listener := newNode("listener", true)
+	remote := newNode("remote", false)
+	defer remote.Shutdown()
+
+	msgType, err := NewDynamicMessageType("rosgo_test_msgs/Status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var connected, disconnected int32
+	pub, err := talker.NewPublisherWithOptions("status", msgType, WithConnectCallbacks(
+		func(SingleSubscriberPublisher) { atomic.AddInt32(&connected, 1) },
+		func(SingleSubscriberPublisher) { atomic.AddInt32(&disconnected, 1) },
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	localChan := make(chan *DynamicMessage, 10)
+	headerChan := make(chan map[string]string, 10)
+	if _, err := listener.NewSubscriber("/status", msgType, func(msg *DynamicMessage, event MessageEvent) {
+		localChan <- msg
+		headerChan <- event.ConnectionHeader
+	}); err != nil {
+		t.Fatal(err)
+	}
+	remoteChan := make(chan *DynamicMessage, 10)
+	if _, err := remote.NewSubscriber("/status", msgType, func(msg *DynamicMessage) { remoteChan <- msg }); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := msgType.NewMessage().(*DynamicMessage)
+	msg.Data()["robot"] = "talker"
+	var local, tcpros *DynamicMessage
+	deadline := time.Now().Add(5 * time.Second)
+	for (local == nil || tcpros == nil) && time.Now().Before(deadline) {
+		pub.Publish(msg)
+		time.Sleep(20 * time.Millisecond)
+		select {
+		case local = <-localChan:
+			if header := <-headerChan; header["intra_process"] != "1" || header["callerid"] != "/talker" {
+				t.Fatalf("unexpected connection header %v", header)
+			}
+		case tcpros = <-remoteChan:
+		default:
+		}
+	}
+	if local == nil || tcpros == nil {
+		t.Fatalf("expected both subscribers to receive the message, got %v and %v", local, tcpros)
+	}
+	if local != msg {
+		t.Fatal("expected the subscriber in this process to be passed the published message itself")
+	}
+	if tcpros == msg || tcpros.Data()["robot"] != "talker" {
+		t.Fatalf("expected the remote subscriber to receive a copy, got %v", tcpros)
+	}
+	if n := pub.GetNumSubscribers(); n != 2 || atomic.LoadInt32(&connected) != 2 {
+		t.Fatalf("expected 2 subscribers to have connected, got %d (%d callbacks)", n, connected)
+	}
+
+	// Once the listener shuts down, it's no longer passed messages.
+	listener.Shutdown()
+	deadline = time.Now().Add(5 * time.Second)
+	for pub.GetNumSubscribers() != 1 && time.Now().Before(deadline) {
+		pub.Publish(msg)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := pub.GetNumSubscribers(); n != 1 {
+		t.Fatalf("expected 1 subscriber after the listener shut down, got %d", n)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&disconnected) < 1 {
+		t.Fatal("expected the disconnect callback for the listener")
+	}
+}
+
+func TestLocalSubscriberSessionKeepsLatest(t *testing.T) {
+	ctx, cancel := goContext.WithCancel(goContext.Background())
+	defer cancel()
+	session := &localSubscriberSession{
+		pub:        &defaultPublisher{node: &defaultNode{qualifiedName: "/talker"}},
+		ctx:        ctx,
+		msgChan:    make(chan messageEvent),
+		latestChan: make(chan messageEvent, 1),
+	}
+
+	// Nothing takes the messages, but delivering them doesn't wait.
+	for i := 0; i < 3; i++ {
+		if !session.deliver(&AnyMessage{Bytes: []byte{byte(i)}}) {
+			t.Fatal("expected the session to be subscribed")
+		}
+	}
+	go session.run()
+	select {
+	case event := <-session.msgChan:
+		if data := event.msg.(*AnyMessage).Bytes; len(data) != 1 || data[0] != 2 {
+			t.Fatalf("expected the latest message, got %v", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the message to be passed on")
+	}
+
+	cancel()
+	if session.deliver(&AnyMessage{}) {
+		t.Fatal("expected the session to be unsubscribed")
+	}
+}
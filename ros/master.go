@@ -1,14 +1,26 @@
 package ros
 
 import (
+	goContext "context"
 	"fmt"
 
 	"github.com/asimovsecurity/rosgo/xmlrpc"
 )
 
+// APIError is the error returned when a ROS master or slave API call reports a status other than APIStatusSuccess.
+type APIError struct {
+	Code    int32
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("ROS Master API call failed with code %d: %s", e.Code, e.Message)
+}
+
 //callRosApi performs an XML-RPC call to the ROS system. calleeUri is the address to send the request, method is the method to be called in the request. args is an interface of values that are required by the method call. Returns interface of the XML response from callee.
-func callRosAPI(client *xmlrpc.XMLClient, calleeURI string, method string, args ...interface{}) (interface{}, error) {
-	result, err := client.Call(calleeURI, method, args...)
+//The call is abandoned when ctx is done; a status other than success is returned as an *APIError.
+func callRosAPI(ctx goContext.Context, client *xmlrpc.XMLClient, calleeURI string, method string, args ...interface{}) (interface{}, error) {
+	result, err := client.CallContext(ctx, calleeURI, method, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -34,8 +46,7 @@ func callRosAPI(client *xmlrpc.XMLClient, calleeURI string, method string, args
 	value = xs[2]
 
 	if code != APIStatusSuccess {
-		err := fmt.Errorf("ROS Master API call failed with code %d: %s", code, message)
-		return nil, err
+		return nil, &APIError{Code: code, Message: message}
 	}
 	return value, nil
 }
@@ -54,7 +65,7 @@ func PingMasterURI(calleeURI string) bool {
 	xmlClient := xmlrpc.NewXMLClient()
 	xmlClient.Timeout = masterAPITimeout
 
-	_, err := callRosAPI(xmlClient, calleeURI, "getUri", calleeURI)
+	_, err := callRosAPI(goContext.Background(), xmlClient, calleeURI, "getUri", calleeURI)
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,214 @@
+package ros
+
+import (
+	goContext "context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/asimovsecurity/rosgo/xmlrpc"
+)
+
+// fakeMaster is an in-process ROS master, with enough of the master API for nodes to share parameters and find each other's topics and services.  It
+// counts the calls which register something, and can be made to look restarted or unreachable.
+type fakeMaster struct {
+	mutex       sync.Mutex
+	pid         int32
+	down        bool
+	calls       map[string]int
+	params      map[string]interface{}
+	publishers  map[string]map[string]bool
+	subscribers map[string]map[string]bool
+	services    map[string]string
+	// notifyMutex sends publisherUpdate calls one topic change at a time, so that the last one a subscriber gets is up to date.
+	notifyMutex sync.Mutex
+	client      *xmlrpc.XMLClient
+	server      *httptest.Server
+}
+
+func newFakeMaster() *fakeMaster {
+	m := &fakeMaster{
+		pid:         int32(os.Getpid()),
+		calls:       map[string]int{},
+		params:      map[string]interface{}{},
+		publishers:  map[string]map[string]bool{},
+		subscribers: map[string]map[string]bool{},
+		services:    map[string]string{},
+		client:      xmlrpc.NewXMLClient(),
+	}
+	m.client.Timeout = time.Second
+	m.server = httptest.NewServer(m.handler())
+	return m
+}
+
+// handler serves the master API, or drops every connection while the master is down.
+func (m *fakeMaster) handler() http.Handler {
+	ok := func(value interface{}) (interface{}, error) {
+		return buildRosAPIResult(APIStatusSuccess, "", value), nil
+	}
+	fail := func(message string) (interface{}, error) {
+		return buildRosAPIResult(APIStatusError, message, int32(0)), nil
+	}
+	handler := xmlrpc.NewHandler(map[string]xmlrpc.Method{
+		"getPid": func(callerID string) (interface{}, error) {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			return ok(m.pid)
+		},
+		"getParam": func(callerID string, key string) (interface{}, error) {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			if value, found := m.params[key]; found {
+				return ok(value)
+			}
+			return fail("Parameter [" + key + "] is not set")
+		},
+		"setParam": func(callerID string, key string, value interface{}) (interface{}, error) {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			m.calls["setParam"]++
+			m.params[key] = value
+			return ok(int32(0))
+		},
+		"hasParam": func(callerID string, key string) (interface{}, error) {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			_, found := m.params[key]
+			return ok(found)
+		},
+		"registerPublisher": func(callerID string, topic string, topicType string, callerAPI string) (interface{}, error) {
+			subscribers := m.register("registerPublisher", m.publishers, m.subscribers, topic, callerAPI, true)
+			go m.notify(topic)
+			return ok(subscribers)
+		},
+		"unregisterPublisher": func(callerID string, topic string, callerAPI string) (interface{}, error) {
+			m.register("unregisterPublisher", m.publishers, m.subscribers, topic, callerAPI, false)
+			go m.notify(topic)
+			return ok(int32(1))
+		},
+		"registerSubscriber": func(callerID string, topic string, topicType string, callerAPI string) (interface{}, error) {
+			return ok(m.register("registerSubscriber", m.subscribers, m.publishers, topic, callerAPI, true))
+		},
+		"unregisterSubscriber": func(callerID string, topic string, callerAPI string) (interface{}, error) {
+			m.register("unregisterSubscriber", m.subscribers, m.publishers, topic, callerAPI, false)
+			return ok(int32(1))
+		},
+		"registerService": func(callerID string, service string, serviceAPI string, callerAPI string) (interface{}, error) {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			m.calls["registerService"]++
+			m.services[service] = serviceAPI
+			return ok(int32(1))
+		},
+		"unregisterService": func(callerID string, service string, serviceAPI string) (interface{}, error) {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			if m.services[service] == serviceAPI {
+				delete(m.services, service)
+			}
+			return ok(int32(1))
+		},
+		"lookupService": func(callerID string, service string) (interface{}, error) {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			if uri, found := m.services[service]; found {
+				return ok(uri)
+			}
+			return fail("no provider")
+		},
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mutex.Lock()
+		down := m.down
+		m.mutex.Unlock()
+		if down {
+			panic(http.ErrAbortHandler)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// register adds or removes callerAPI from the topic's entry in registry, and returns the topic's entries in others.
+func (m *fakeMaster) register(method string, registry map[string]map[string]bool, others map[string]map[string]bool, topic string, callerAPI string, add bool) []interface{} {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.calls[method]++
+	if registry[topic] == nil {
+		registry[topic] = map[string]bool{}
+	}
+	if add {
+		registry[topic][callerAPI] = true
+	} else {
+		delete(registry[topic], callerAPI)
+	}
+	list := []interface{}{}
+	for api := range others[topic] {
+		list = append(list, api)
+	}
+	return list
+}
+
+// notify tells the topic's subscribers who publishes it now.
+func (m *fakeMaster) notify(topic string) {
+	m.notifyMutex.Lock()
+	defer m.notifyMutex.Unlock()
+	m.mutex.Lock()
+	publishers := []interface{}{}
+	for api := range m.publishers[topic] {
+		publishers = append(publishers, api)
+	}
+	var subscribers []string
+	for api := range m.subscribers[topic] {
+		subscribers = append(subscribers, api)
+	}
+	m.mutex.Unlock()
+	for _, api := range subscribers {
+		// Subscribers which have shut down don't answer.
+		callRosAPI(goContext.Background(), m.client, api, "publisherUpdate", "/master", topic, publishers)
+	}
+}
+
+// registered returns the number of nodes in the topic's entry in registry.
+func (m *fakeMaster) registered(registry map[string]map[string]bool, topic string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(registry[topic])
+}
+
+// set changes the process ID the master reports, and whether it can be reached at all.
+func (m *fakeMaster) set(pid int32, down bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pid, m.down = pid, down
+}
+
+// count returns the number of times method has been called.
+func (m *fakeMaster) count(method string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.calls[method]
+}
+
+// counts returns a copy of the call counts, for reporting.
+func (m *fakeMaster) counts() map[string]int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	counts := make(map[string]int, len(m.calls))
+	for method, count := range m.calls {
+		counts[method] = count
+	}
+	return counts
+}
+
+// parameters returns a copy of the parameters set on the master.
+func (m *fakeMaster) parameters() map[string]interface{} {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	params := make(map[string]interface{}, len(m.params))
+	for key, value := range m.params {
+		params[key] = value
+	}
+	return params
+}
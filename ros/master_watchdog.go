@@ -0,0 +1,268 @@
+package ros
+
+import (
+	goContext "context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// masterWatchdogInterval is how often a node waiting for its master checks that the master is still the one it registered with, by default.
+	masterWatchdogInterval = 1 * time.Second
+	// masterRetryMin and masterRetryMax bound the delay between attempts to reach a master which can't be reached, by default.
+	masterRetryMin = 100 * time.Millisecond
+	masterRetryMax = 5 * time.Second
+)
+
+// SetMasterCallbacks sets the functions called, from Spin or SpinOnce, when the node loses contact with its master and when its registrations have been
+// restored.  Either may be nil.
+func (node *defaultNode) SetMasterCallbacks(lost func(), restored func()) {
+	node.masterCallbacksMutex.Lock()
+	defer node.masterCallbacksMutex.Unlock()
+	node.masterLostCallback = lost
+	node.masterRestoredCallback = restored
+}
+
+// watchMaster polls the master until ctx is done.  When the master can't be reached, it's polled again with exponential backoff; once it can,
+// or if it has restarted since it was last reached, or registrations have been queued, the node's parameters, publishers, subscribers and service servers
+// are registered with it again.
+func (node *defaultNode) watchMaster(ctx goContext.Context) {
+	identity, err := node.masterIdentity(ctx)
+	lost := err != nil
+	retry := node.retryMin
+	for {
+		delay := node.watchdogInterval
+		if lost {
+			delay = retry
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if !node.OK() {
+			return
+		}
+
+		current, err := node.masterIdentity(ctx)
+		if err != nil {
+			if lost {
+				retry = backoff(retry, node.retryMax)
+			} else {
+				node.log.Warn().Err(err).Str("master-uri", node.masterURI).Msg("lost contact with master")
+				lost, retry = true, node.retryMin
+				node.masterEvent(true, false)
+			}
+			continue
+		}
+		restarted := !lost && current != identity
+		if !lost && !restarted && !node.hasPendingRegistrations() {
+			continue
+		}
+
+		if restarted {
+			node.log.Warn().Str("master-uri", node.masterURI).Msg("master has restarted")
+		}
+		identity = current
+		if err := node.reregister(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			node.log.Error().Err(err).Msg("failed to register with master again")
+			if !lost {
+				lost, retry = true, node.retryMin
+				node.masterEvent(true, false)
+			}
+			continue
+		}
+		if lost || restarted {
+			node.log.Info().Str("master-uri", node.masterURI).Msg("registered with master again")
+			node.masterEvent(restarted, true)
+		}
+		lost = false
+	}
+}
+
+// waitForMaster polls the master, with exponential backoff, until it can be reached or timeout has passed.  A timeout of 0 waits as long as the node's
+// context allows.
+func (node *defaultNode) waitForMaster(timeout time.Duration) bool {
+	ctx := node.ctx
+	if timeout > 0 {
+		var cancel goContext.CancelFunc
+		ctx, cancel = goContext.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	retry := node.retryMin
+	for {
+		if _, err := callRosAPI(ctx, node.xmlClient, node.masterURI, "getPid", node.qualifiedName); err == nil {
+			return true
+		}
+		node.log.Info().Str("master-uri", node.masterURI).Dur("retry", retry).Msg("waiting for master")
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(retry):
+		}
+		retry = backoff(retry, node.retryMax)
+	}
+}
+
+// queueRegistration says whether a failed call to the master can be retried once the master appears, and if so, marks the node as having
+// registrations to retry.  Only calls which never reached the master can; those it answered, but refused, and anything which went wrong before calling
+// it, can't.
+func (node *defaultNode) queueRegistration(err error) bool {
+	if !node.lazyRegistration || !isTransportError(err) {
+		return false
+	}
+	node.log.Warn().Err(err).Msg("master is unavailable; registration queued")
+	node.pendingMutex.Lock()
+	node.registrationPending = true
+	node.pendingMutex.Unlock()
+	return true
+}
+
+// hasPendingRegistrations says whether any registrations have been queued since the node last registered with the master.
+func (node *defaultNode) hasPendingRegistrations() bool {
+	node.pendingMutex.Lock()
+	defer node.pendingMutex.Unlock()
+	return node.registrationPending
+}
+
+// masterIdentity returns a string which changes when the master restarts: its process ID, and the run ID roslaunch sets, if any.
+func (node *defaultNode) masterIdentity(ctx goContext.Context) (string, error) {
+	pid, err := callRosAPI(ctx, node.xmlClient, node.masterURI, "getPid", node.qualifiedName)
+	if err != nil {
+		return "", err
+	}
+	// A master in a container may well have the same process ID every time it starts.
+	runID, err := callRosAPI(ctx, node.xmlClient, node.masterURI, "getParam", node.qualifiedName, "/run_id")
+	if err != nil {
+		runID = ""
+	}
+	return fmt.Sprint(pid, " ", runID), nil
+}
+
+// reregister sets the node's queued parameters, and registers its publishers, subscribers and service servers with the master as if they had just been
+// created.  It gives up once ctx is done.
+func (node *defaultNode) reregister(ctx goContext.Context) error {
+	// Anything queued from now on is registered next time.  The queued parameters are set without the lock held, so that queueing more doesn't wait on
+	// the master.
+	node.pendingMutex.Lock()
+	node.registrationPending = false
+	pending := node.pendingParams
+	node.pendingParams = nil
+	node.pendingMutex.Unlock()
+	for i, setParams := range pending {
+		if err := setParams(); err != nil {
+			if isTransportError(err) {
+				node.pendingMutex.Lock()
+				node.registrationPending = true
+				node.pendingParams = append(pending[i:], node.pendingParams...)
+				node.pendingMutex.Unlock()
+				return errors.Wrap(err, "params")
+			}
+			// Retrying parameters the master refused would only hold up everything else.
+			node.log.Error().Err(err).Msg("master refused queued parameters")
+		}
+	}
+
+	// Publishers, subscribers and servers are copied, so that their locks aren't held while the master is called.
+	node.publishersMutex.RLock()
+	publishers := make(map[string]string, len(node.publishers))
+	for name, pub := range node.publishers {
+		publishers[name] = pub.msgType.Name()
+	}
+	node.publishersMutex.RUnlock()
+	for name, msgType := range publishers {
+		if _, err := callRosAPI(ctx, node.xmlClient, node.masterURI, "registerPublisher", node.qualifiedName, name, msgType, node.xmlrpcURI); err != nil {
+			return errors.Wrap(err, "topic: "+name)
+		}
+	}
+
+	node.subscribersMutex.RLock()
+	subscribers := make(map[string]*defaultSubscriber, len(node.subscribers))
+	for name, sub := range node.subscribers {
+		subscribers[name] = sub
+	}
+	node.subscribersMutex.RUnlock()
+	for name, sub := range subscribers {
+		result, err := callRosAPI(ctx, node.xmlClient, node.masterURI, "registerSubscriber", node.qualifiedName, name, sub.msgType.Name(), node.xmlrpcURI)
+		if err != nil {
+			return errors.Wrap(err, "topic: "+name)
+		}
+		// The master doesn't tell subscribers about publishers which were already registered, so pass them on as publisherUpdate would.
+		list, _ := result.([]interface{})
+		uris := make([]string, 0, len(list))
+		for _, item := range list {
+			if uri, ok := item.(string); ok {
+				uris = append(uris, uri)
+			}
+		}
+		select {
+		case sub.pubListChan <- uris:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	node.serversMutex.RLock()
+	servers := make(map[string]string, len(node.servers))
+	for name, server := range node.servers {
+		servers[name] = server.rosrpcAddr
+	}
+	node.serversMutex.RUnlock()
+	for name, addr := range servers {
+		if _, err := callRosAPI(ctx, node.xmlClient, node.masterURI, "registerService", node.qualifiedName, name, addr, node.xmlrpcURI); err != nil {
+			return errors.Wrap(err, "service: "+name)
+		}
+	}
+
+	return nil
+}
+
+// masterEvent queues the master lost and restored callbacks, in that order, to be run by Spin.
+func (node *defaultNode) masterEvent(lost bool, restored bool) {
+	node.masterCallbacksMutex.Lock()
+	var callbacks []func()
+	if lost && node.masterLostCallback != nil {
+		callbacks = append(callbacks, node.masterLostCallback)
+	}
+	if restored && node.masterRestoredCallback != nil {
+		callbacks = append(callbacks, node.masterRestoredCallback)
+	}
+	node.masterCallbacksMutex.Unlock()
+	if len(callbacks) == 0 {
+		return
+	}
+
+	// The watchdog mustn't wait for the node to spin.
+	go func() {
+		select {
+		case node.jobChan <- func() {
+			for _, callback := range callbacks {
+				callback()
+			}
+		}:
+		case <-node.ctx.Done():
+		}
+	}()
+}
+
+// isTransportError says whether err is from a call which never reached the master, or got no answer from it.
+func isTransportError(err error) bool {
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
+
+// backoff doubles a retry delay, up to max.
+func backoff(retry time.Duration, max time.Duration) time.Duration {
+	if retry *= 2; retry > max {
+		return max
+	}
+	return retry
+}
@@ -0,0 +1,105 @@
+package ros
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withMasterRetry shortens the delays between a node's attempts to reach its master, so that tests needn't wait for them.
+func withMasterRetry(min time.Duration, max time.Duration) NodeOption {
+	return func(options *nodeOptions) {
+		options.masterRetryMin, options.masterRetryMax = min, max
+	}
+}
+
+func TestMasterWatchdog(t *testing.T) {
+	master := newFakeMaster()
+	defer master.server.Close()
+	master.set(100, false)
+
+	node, err := NewNode("watchdog_test", []string{"__master:=" + master.server.URL, "__hostname:=localhost"}, WithMasterWatchdog(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+	if _, err := node.NewPublisher("chatter", AnyMessageType{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node.NewSubscriber("echo", AnyMessageType{}, func(msg *AnyMessage) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	node.SetMasterCallbacks(func() { events = append(events, "lost") }, func() { events = append(events, "restored") })
+	waitForEvents := func(expected ...string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for len(events) < len(expected) && time.Now().Before(deadline) {
+			node.SpinOnce()
+		}
+		if len(events) != len(expected) {
+			t.Fatalf("expected events %v, got %v", expected, events)
+		}
+		for i := range expected {
+			if events[i] != expected[i] {
+				t.Fatalf("expected events %v, got %v", expected, events)
+			}
+		}
+		events = nil
+	}
+
+	// A restarted master has a new process ID.
+	master.set(200, false)
+	waitForEvents("lost", "restored")
+	if master.count("registerPublisher") != 2 || master.count("registerSubscriber") != 2 {
+		t.Fatalf("expected the node to register again, got %v", master.counts())
+	}
+
+	master.set(200, true)
+	waitForEvents("lost")
+	master.set(200, false)
+	waitForEvents("restored")
+	if master.count("registerPublisher") != 3 || master.count("registerSubscriber") != 3 {
+		t.Fatalf("expected the node to register again, got %v", master.counts())
+	}
+}
+
+func TestWaitForMaster(t *testing.T) {
+	master := newFakeMaster()
+	defer master.server.Close()
+	master.set(100, true)
+	args := []string{"__master:=" + master.server.URL, "__hostname:=localhost", "_rate:=10"}
+
+	if _, err := NewNode("wait_test", args); err == nil {
+		t.Fatal("expected an error setting a parameter without a master")
+	}
+	// A parameter file which can't be read is an error whether or not there's a master.
+	missing := append([]string{"__params:=" + filepath.Join(t.TempDir(), "missing.yaml")}, args...)
+	if _, err := NewNode("wait_test", missing, WaitForMaster(20*time.Millisecond), withMasterRetry(5*time.Millisecond, 50*time.Millisecond)); err == nil {
+		t.Fatal("expected an error loading a missing parameter file")
+	}
+
+	node, err := NewNode("wait_test", args, WaitForMaster(20*time.Millisecond), WithMasterWatchdog(10*time.Millisecond), withMasterRetry(5*time.Millisecond, 50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+	if _, err := node.NewPublisher("chatter", AnyMessageType{}); err != nil {
+		t.Fatal(err)
+	}
+	restored := false
+	node.SetMasterCallbacks(nil, func() { restored = true })
+	if master.count("setParam") != 0 || master.count("registerPublisher") != 0 {
+		t.Fatalf("expected no registrations yet, got %v", master.counts())
+	}
+
+	master.set(100, false)
+	deadline := time.Now().Add(2 * time.Second)
+	for !restored && time.Now().Before(deadline) {
+		node.SpinOnce()
+	}
+	if !restored || master.count("setParam") != 1 || master.count("registerPublisher") != 1 {
+		t.Fatalf("expected the queued registrations once the master appeared, got %v", master.counts())
+	}
+}
@@ -0,0 +1,206 @@
+package ros
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeTestPackage writes a ROS package with a message definition, and makes it the runtime package path until the test ends.
+func writeTestPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rosgo_test_msgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := filepath.Join(dir, "rosgo_test_msgs")
+	if err := os.MkdirAll(filepath.Join(pkg, "msg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkg, "package.xml"), []byte("<package><name>rosgo_test_msgs</name></package>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkg, "msg", "Status.msg"), []byte("string robot\nuint32 seq\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := GetRuntimePackagePath()
+	SetRuntimePackagePath(dir)
+	t.Cleanup(func() {
+		SetRuntimePackagePath(path)
+		os.RemoveAll(dir)
+	})
+}
+
+func TestRuntimeContextShared(t *testing.T) {
+	writeTestPackage(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%8 == 0 {
+				ResetContext()
+			}
+			msgType, err := NewDynamicMessageType("rosgo_test_msgs/Status")
+			if err == nil && msgType.Name() != "rosgo_test_msgs/Status" {
+				err = fmt.Errorf("unexpected type %s", msgType.Name())
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestManyNodes(t *testing.T) {
+	writeTestPackage(t)
+	master := newFakeMaster()
+	defer master.server.Close()
+
+	// Every node has the same name, in a namespace of its own, and listens to the next node's status.
+	const numNodes = 24
+	nodes := make([]Node, numNodes)
+	received := make([]chan string, numNodes)
+	var wg sync.WaitGroup
+	errs := make(chan error, numNodes)
+	for i := range nodes {
+		received[i] = make(chan string, 100)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			node, err := NewNodeWithOptions("node",
+				WithMasterURI(master.server.URL),
+				WithNamespace(fmt.Sprintf("robot_%d", i)),
+				WithHostname("localhost"),
+				WithSignalHandling(false),
+			)
+			if err != nil {
+				errs <- err
+				return
+			}
+			nodes[i] = node
+			if err := node.SetParam("~id", fmt.Sprint(i)); err != nil {
+				errs <- err
+				return
+			}
+			msgType, err := NewDynamicMessageType("rosgo_test_msgs/Status")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if _, err := node.NewPublisher("status", msgType); err != nil {
+				errs <- err
+				return
+			}
+			next := fmt.Sprintf("/robot_%d/status", (i+1)%numNodes)
+			_, err = node.NewSubscriber(next, msgType, func(msg *DynamicMessage) {
+				robot, _ := msg.Data()["robot"].(string)
+				select {
+				case received[i] <- robot:
+				default:
+				}
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, node := range nodes {
+			if node.OK() {
+				node.Shutdown()
+			}
+		}
+	}()
+
+	uris := map[string]bool{}
+	for i, node := range nodes {
+		n := node.(*defaultNode)
+		if expected := fmt.Sprintf("/robot_%d/node", i); node.QualifiedName() != expected {
+			t.Fatalf("expected %s, got %s", expected, node.QualifiedName())
+		}
+		if uris[n.xmlrpcURI] {
+			t.Fatalf("slave API %s is shared", n.xmlrpcURI)
+		}
+		uris[n.xmlrpcURI] = true
+		if id, err := node.GetParamString("~id", ""); err != nil || id != fmt.Sprint(i) {
+			t.Fatalf("expected ~id of %s to be %d, got %q (%v)", node.QualifiedName(), i, id, err)
+		}
+		go func(node Node) {
+			for node.OK() {
+				node.SpinOnce()
+			}
+		}(node)
+	}
+
+	// Publish until every node has heard from its neighbour.
+	heard := make([]string, numNodes)
+	deadline := time.Now().Add(10 * time.Second)
+	for remaining := numNodes; remaining > 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d nodes heard nothing: %v", remaining, heard)
+		}
+		for i, node := range nodes {
+			pub := node.(*defaultNode).publishers[fmt.Sprintf("/robot_%d/status", i)]
+			msg := pub.msgType.NewMessage().(*DynamicMessage)
+			msg.Data()["robot"] = fmt.Sprintf("robot_%d", i)
+			pub.Publish(msg)
+		}
+		time.Sleep(20 * time.Millisecond)
+		for i := range nodes {
+			select {
+			case robot := <-received[i]:
+				if heard[i] == "" {
+					remaining--
+				}
+				heard[i] = robot
+			default:
+			}
+		}
+	}
+	for i, robot := range heard {
+		if expected := fmt.Sprintf("robot_%d", (i+1)%numNodes); robot != expected {
+			t.Fatalf("expected node %d to hear from %s, got %s", i, expected, robot)
+		}
+	}
+
+	// Shutting down half the nodes leaves the rest working.
+	for i := 1; i < numNodes; i += 2 {
+		wg.Add(1)
+		go func(node Node) {
+			defer wg.Done()
+			node.Shutdown()
+		}(nodes[i])
+	}
+	wg.Wait()
+	for i, node := range nodes {
+		topic := fmt.Sprintf("/robot_%d/status", i)
+		if i%2 == 1 {
+			if node.OK() || master.registered(master.publishers, topic) != 0 {
+				t.Fatalf("expected %s to have shut down and unregistered", node.QualifiedName())
+			}
+			continue
+		}
+		if !node.OK() || master.registered(master.publishers, topic) != 1 {
+			t.Fatalf("expected %s to be unaffected", node.QualifiedName())
+		}
+		if id, err := node.GetParamString("~id", ""); err != nil || id != fmt.Sprint(i) {
+			t.Fatalf("expected ~id of %s to be %d, got %q (%v)", node.QualifiedName(), i, id, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+// +build !windows
+
+package ros
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNodeSignalHandlers(t *testing.T) {
+	master := newFakeMaster()
+	defer master.server.Close()
+
+	newNode := func(name string) Node {
+		node, err := NewNodeWithOptions(name, WithMasterURI(master.server.URL), WithHostname("localhost"), WithSignalHandling(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return node
+	}
+	stopped := newNode("stopped")
+	running := newNode("running")
+	defer running.Shutdown()
+	quiet, err := NewNodeWithOptions("quiet", WithMasterURI(master.server.URL), WithHostname("localhost"), WithSignalHandling(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer quiet.Shutdown()
+
+	// A node which has shut down no longer takes the signal, while the others with signal handling still do.
+	stopped.Shutdown()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Skip("can't interrupt the test: ", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for running.OK() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if running.OK() {
+		t.Fatal("expected the running node to be interrupted")
+	}
+	if !quiet.OK() {
+		t.Fatal("expected the node without signal handling to keep running")
+	}
+}
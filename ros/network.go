@@ -1,6 +1,7 @@
 package ros
 
 import (
+	"fmt"
 	"net"
 	"os"
 	"strings"
@@ -33,3 +34,38 @@ func determineHost() (string, bool) {
 	// Fall back to the loopback UP
 	return "127.0.0.1", true
 }
+
+// loopbackIP returns the loopback address a node only reachable at host should listen on.
+func loopbackIP(host string) string {
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "::1"
+	}
+	return "127.0.0.1"
+}
+
+// interfaceIP returns an address of the named network interface, preferring IPv4 to IPv6 and global to link-local addresses.
+func interfaceIP(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	var best net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipnet.IP
+		if best == nil || (best.To4() == nil && ip.To4() != nil) || (best.IsLinkLocalUnicast() && !ip.IsLinkLocalUnicast() && (best.To4() == nil) == (ip.To4() == nil)) {
+			best = ip
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("interface %s has no IP address", name)
+	}
+	return best.String(), nil
+}
@@ -62,3 +62,21 @@ func TestDetermineHost(t *testing.T) {
 		t.Errorf("localOnly flag is wrong for %s", host)
 	}
 }
+
+func TestInterfaceIP(t *testing.T) {
+	if ip := loopbackIP("::1"); ip != "::1" {
+		t.Errorf("expected ::1 for an IPv6 loopback host, got %s", ip)
+	}
+	if ip := loopbackIP("localhost"); ip != "127.0.0.1" {
+		t.Errorf("expected 127.0.0.1 for localhost, got %s", ip)
+	}
+
+	if ip, err := interfaceIP("lo"); err != nil {
+		t.Skip("no loopback interface named lo: ", err)
+	} else if ip != "127.0.0.1" {
+		t.Errorf("expected 127.0.0.1 for lo, got %s", ip)
+	}
+	if _, err := interfaceIP("no-such-interface"); err == nil {
+		t.Error("expected an error for a missing interface")
+	}
+}
@@ -1,8 +1,10 @@
 package ros
 
 import (
+	goContext "context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/http"
@@ -71,6 +73,8 @@ type defaultNode struct {
 	xmlrpcListener   net.Listener
 	xmlrpcHandler    *xmlrpc.Handler
 	xmlClient        *xmlrpc.XMLClient
+	ctx              goContext.Context
+	cancel           goContext.CancelFunc
 	subscribers      map[string]*defaultSubscriber
 	subscribersMutex sync.RWMutex
 	publishers       map[string]*defaultPublisher
@@ -87,9 +91,28 @@ type defaultNode struct {
 	logDir           string
 	hostname         string
 	listenIP         string
+	minPort          int
+	maxPort          int
+	clock            Clock
+	intraProcess     bool
+	logging          *nodeLogging
 	homeDir          string
 	nameResolver     *NameResolver
 	nonRosArgs       []string
+
+	masterLostCallback     func()
+	masterRestoredCallback func()
+	masterCallbacksMutex   sync.Mutex
+
+	watchdogInterval time.Duration
+	retryMin         time.Duration
+	retryMax         time.Duration
+	stopWatchdog     goContext.CancelFunc
+
+	lazyRegistration    bool
+	registrationPending bool
+	pendingParams       []func() error
+	pendingMutex        sync.Mutex
 }
 
 // serviceheader is the header returned from probing a ros service, containing all type information
@@ -101,38 +124,69 @@ type ServiceHeader struct {
 	ServiceType  string
 }
 
-func listenRandomPort(address string, trialLimit int) (net.Listener, error) {
-	var listener net.Listener
-	var err error
-	numTrial := 0
-	for numTrial < trialLimit {
-		port := 1024 + rand.Intn(65535-1024)
-		addr := fmt.Sprintf("%s:%d", address, port)
-		listener, err = net.Listen("tcp", addr)
+// listenRandomPort listens on a port between minPort and maxPort, trying ports from a random one onwards.
+func listenRandomPort(address string, minPort int, maxPort int, trialLimit int) (net.Listener, error) {
+	numPorts := maxPort - minPort + 1
+	if minPort < 1 || maxPort > 65535 || numPorts < 1 {
+		return nil, fmt.Errorf("invalid port range %d-%d", minPort, maxPort)
+	}
+	start := rand.Intn(numPorts)
+	for numTrial := 0; numTrial < trialLimit && numTrial < numPorts; numTrial++ {
+		port := minPort + (start+numTrial)%numPorts
+		listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
 		if err == nil {
 			return listener, nil
 		}
-		numTrial++
-
 	}
 	return nil, fmt.Errorf("listenRandomPort exceeds trial limit")
 }
 
-func newDefaultNodeWithLogs(name string, log zerolog.Logger, args []string) (*defaultNode, error) {
-	node, err := newDefaultNode(name, args)
+// listen listens for the node's slave API, a publisher or a service, on port if it's set, or otherwise on a port in the node's port range.
+func (node *defaultNode) listen(port int) (net.Listener, error) {
+	if port > 0 {
+		listener, err := net.Listen("tcp", net.JoinHostPort(node.listenIP, strconv.Itoa(port)))
+		if err != nil {
+			return nil, errors.Wrap(err, "port: "+strconv.Itoa(port))
+		}
+		return listener, nil
+	}
+	return listenRandomPort(node.listenIP, node.minPort, node.maxPort, 10)
+}
+
+// endpointURI returns the URI other nodes reach one of the node's endpoints at, given the scheme and the address the endpoint listens on.
+func (node *defaultNode) endpointURI(scheme string, listener net.Listener) (string, error) {
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		return "", err
+	}
+	return scheme + "://" + net.JoinHostPort(node.hostname, port), nil
+}
+
+func newDefaultNodeWithLogs(name string, log zerolog.Logger, opts ...NodeOption) (*defaultNode, error) {
+	node, err := newDefaultNode(name, append([]NodeOption{WithLogger(log)}, opts...)...)
 	if err != nil {
 		log.Error().Err(err).Msg("could not instantiate newDefaultNode")
 		return nil, err
 	}
-
-	node.log = log
 	return node, nil
 }
 
-func newDefaultNode(name string, args []string) (*defaultNode, error) {
+func newDefaultNode(name string, opts ...NodeOption) (*defaultNode, error) {
 	node := new(defaultNode)
+	var options nodeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	ctx := options.ctx
+	if ctx == nil {
+		ctx = goContext.Background()
+	}
+	node.ctx, node.cancel = goContext.WithCancel(ctx)
 
-	remapping, params, specials, rest := processArguments(args)
+	remapping, params, specials, rest := processArguments(options.args)
+	for k, v := range options.remappings {
+		remapping[k] = v
+	}
 
 	node.homeDir = filepath.Join(os.Getenv("HOME"), ".ros")
 	if homeDir := os.Getenv("ROS_HOME"); len(homeDir) > 0 {
@@ -140,7 +194,9 @@ func newDefaultNode(name string, args []string) (*defaultNode, error) {
 	}
 
 	log := zerolog.New(os.Stdout).With().Logger().Level(zerolog.FatalLevel)
-	if value, ok := specials["__ll"]; ok {
+	if options.logger != nil {
+		log = *options.logger
+	} else if value, ok := specials["__ll"]; ok {
 		val, err := strconv.ParseInt(value, 10, 32)
 		if err == nil {
 			log = log.Level(zerolog.Level(val))
@@ -169,13 +225,18 @@ func newDefaultNode(name string, args []string) (*defaultNode, error) {
 		// Namespaces should all be absolute, so make sure it starts with a slash.
 		node.namespace = GlobalNS + strings.TrimPrefix(ns, GlobalNS)
 	}
+	if ns := options.namespace; len(ns) > 0 {
+		node.namespace = GlobalNS + strings.TrimPrefix(ns, GlobalNS)
+	}
+	node.enableInterrupts = defaultInterrupts
 	if value, ok := specials["__si"]; ok {
 		val, err := strconv.ParseBool(value)
-		if err != nil {
+		if err == nil {
 			node.enableInterrupts = val
 		}
-	} else {
-		node.enableInterrupts = defaultInterrupts
+	}
+	if options.enableInterrupts != nil {
+		node.enableInterrupts = *options.enableInterrupts
 	}
 	node.logDir = filepath.Join(node.homeDir, "log")
 	if logDir := os.Getenv("ROS_LOG_DIR"); len(logDir) > 0 {
@@ -187,23 +248,45 @@ func newDefaultNode(name string, args []string) (*defaultNode, error) {
 
 	var onlyLocalhost bool
 	node.hostname, onlyLocalhost = determineHost()
-	if value, ok := specials["__hostname"]; ok {
+	if value := options.hostname; len(value) > 0 {
+		node.hostname = value
+		onlyLocalhost = (value == "localhost" || value == "::1" || strings.HasPrefix(value, "127."))
+	} else if value, ok := specials["__hostname"]; ok {
 		node.hostname = value
 		onlyLocalhost = (value == "localhost")
 	} else if value, ok := specials["__ip"]; ok {
 		node.hostname = value
 		onlyLocalhost = (value == "::1" || strings.HasPrefix(value, "127."))
 	}
-	if onlyLocalhost {
-		node.listenIP = "127.0.0.1"
+	if len(options.listenInterface) > 0 {
+		if node.listenIP, err = interfaceIP(options.listenInterface); err != nil {
+			return nil, errors.Wrap(err, "interface: "+options.listenInterface)
+		}
+	} else if len(options.listenIP) > 0 {
+		node.listenIP = options.listenIP
+	} else if onlyLocalhost {
+		node.listenIP = loopbackIP(node.hostname)
 	} else {
 		node.listenIP = "0.0.0.0"
 	}
+	node.minPort, node.maxPort = 1024, 65535
+	if options.minPort > 0 || options.maxPort > 0 {
+		node.minPort, node.maxPort = options.minPort, options.maxPort
+	}
 
 	node.masterURI = os.Getenv("ROS_MASTER_URI")
 	if value, ok := specials["__master"]; ok {
 		node.masterURI = value
 	}
+	if len(options.masterURI) > 0 {
+		node.masterURI = options.masterURI
+	}
+
+	node.clock = options.clock
+	if node.clock == nil {
+		node.clock = systemClock{}
+	}
+	node.intraProcess = options.intraProcess
 
 	node.nameResolver = newNameResolver(node.namespace, node.name, remapping)
 	node.nonRosArgs = rest
@@ -216,18 +299,24 @@ func newDefaultNode(name string, args []string) (*defaultNode, error) {
 	node.subscribers = make(map[string]*defaultSubscriber)
 	node.publishers = make(map[string]*defaultPublisher)
 	node.servers = make(map[string]*defaultServiceServer)
-	node.interruptChan = make(chan os.Signal)
+	// signal.Notify doesn't block, so an unbuffered channel could miss the signal.
+	node.interruptChan = make(chan os.Signal, 1)
 	node.ok = true
 
 	// Install signal handler
 	if node.enableInterrupts == true {
 		signal.Notify(node.interruptChan, os.Interrupt)
+		// Every node in the process with signal handling enabled is interrupted; the handler is removed when the node shuts down.
 		go func() {
-			<-node.interruptChan
-			log.Info().Msg("interrupted")
-			node.okMutex.Lock()
-			node.ok = false
-			node.okMutex.Unlock()
+			defer signal.Stop(node.interruptChan)
+			select {
+			case <-node.interruptChan:
+				log.Info().Msg("interrupted")
+				node.okMutex.Lock()
+				node.ok = false
+				node.okMutex.Unlock()
+			case <-node.ctx.Done():
+			}
 		}()
 	}
 	node.jobChan = make(chan func())
@@ -237,26 +326,66 @@ func newDefaultNode(name string, args []string) (*defaultNode, error) {
 	node.xmlClient = xmlrpc.NewXMLClient()
 	node.xmlClient.Timeout = masterAPITimeout
 
-	// Set parameters set by arguments
-	for k, v := range params {
-		_, err := callRosAPI(node.xmlClient, node.masterURI, "setParam", node.qualifiedName, k, v)
-		if err != nil {
+	node.watchdogInterval, node.retryMin, node.retryMax = options.masterWatchdog, masterRetryMin, masterRetryMax
+	if options.masterRetryMin > 0 {
+		node.retryMin = options.masterRetryMin
+	}
+	if options.masterRetryMax > 0 {
+		node.retryMax = options.masterRetryMax
+	}
+	if options.waitForMaster {
+		// Queued registrations are only made by the watchdog.
+		if node.watchdogInterval <= 0 {
+			node.watchdogInterval = masterWatchdogInterval
+		}
+		node.lazyRegistration = true
+		if !node.waitForMaster(options.masterTimeout) {
+			log.Warn().Str("master-uri", node.masterURI).Msg("master is unavailable; registrations will be queued")
+		}
+	}
+
+	// Set parameters set by arguments, those in a parameter file first.  The file is read now, so that a missing or malformed one isn't queued.
+	var fileParams interface{}
+	if file, ok := specials["__params"]; ok {
+		if fileParams, err = readParamFile(file); err != nil {
+			log.Error().Err(err).Msg("")
 			return nil, err
 		}
 	}
+	setParams := func() error {
+		if fileParams != nil {
+			if err := node.setParamTree(node.nameResolver.remap(PrivateNS), fileParams); err != nil {
+				return err
+			}
+		}
+		for k, v := range params {
+			_, err := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "setParam", node.qualifiedName, k, v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := setParams(); err != nil {
+		if !node.queueRegistration(err) {
+			return nil, err
+		}
+		node.pendingMutex.Lock()
+		node.pendingParams = append(node.pendingParams, setParams)
+		node.pendingMutex.Unlock()
+	}
 
-	listener, err := listenRandomPort(node.listenIP, 10)
+	listener, err := node.listen(options.xmlrpcPort)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return nil, err
 	}
-	_, port, err := net.SplitHostPort(listener.Addr().String())
+	node.xmlrpcURI, err = node.endpointURI("http", listener)
 	if err != nil {
 		// Not reached
 		log.Error().Err(err).Msg("")
 		return nil, err
 	}
-	node.xmlrpcURI = fmt.Sprintf("http://%s:%s", node.hostname, port)
 	log.Debug().Str("address", listener.Addr().String()).Msg("listening on http address")
 	node.xmlrpcListener = listener
 	m := map[string]xmlrpc.Method{
@@ -279,6 +408,25 @@ func newDefaultNode(name string, args []string) (*defaultNode, error) {
 	}
 	node.xmlrpcHandler = xmlrpc.NewHandler(m)
 	go http.Serve(node.xmlrpcListener, node.xmlrpcHandler)
+	if node.intraProcess {
+		node.registerLocal()
+	}
+	if options.rosout {
+		if err := node.startLogging(); err != nil {
+			log.Error().Err(err).Msg("could not start publishing to rosout")
+			node.Shutdown()
+			return nil, err
+		}
+	}
+	if node.watchdogInterval > 0 {
+		var watchCtx goContext.Context
+		watchCtx, node.stopWatchdog = goContext.WithCancel(node.ctx)
+		node.waitGroup.Add(1)
+		go func() {
+			defer node.waitGroup.Done()
+			node.watchMaster(watchCtx)
+		}()
+	}
 	log.Debug().Str("name", node.qualifiedName).Msg("started")
 	return node, nil
 }
@@ -291,8 +439,8 @@ func (node *defaultNode) OK() bool {
 }
 
 func (node *defaultNode) RemovePublisher(topic string) {
-	node.publishersMutex.RLock()
-	defer node.publishersMutex.RUnlock()
+	node.publishersMutex.Lock()
+	defer node.publishersMutex.Unlock()
 
 	name := node.nameResolver.remap(topic)
 
@@ -355,8 +503,8 @@ func (node *defaultNode) getPublications(callerID string) (interface{}, error) {
 	defer node.publishersMutex.RUnlock()
 
 	result := []interface{}{}
-	for topic, typ := range node.publishers {
-		pair := []interface{}{topic, typ}
+	for topic, pub := range node.publishers {
+		pair := []interface{}{topic, pub.msgType.Name()}
 		result = append(result, pair)
 	}
 	return buildRosAPIResult(APIStatusSuccess, "Success", result), nil
@@ -370,7 +518,10 @@ func (node *defaultNode) publisherUpdate(callerID string, topic string, publishe
 	node.log.Debug().Msg("slave API publisherUpdate() called")
 	var code int32
 	var message string
-	if sub, ok := node.subscribers[topic]; !ok {
+	node.subscribersMutex.RLock()
+	sub, ok := node.subscribers[topic]
+	node.subscribersMutex.RUnlock()
+	if !ok {
 		node.log.Debug().Msg("publisherUpdate() called without subscribing topic")
 		code = APIStatusFailure
 		message = "No such topic"
@@ -429,22 +580,36 @@ func (node *defaultNode) NewPublisher(topic string, msgType MessageType) (Publis
 }
 
 func (node *defaultNode) NewPublisherWithCallbacks(topic string, msgType MessageType, connectCallback, disconnectCallback func(SingleSubscriberPublisher)) (Publisher, error) {
+	return node.NewPublisherWithOptions(topic, msgType, WithConnectCallbacks(connectCallback, disconnectCallback))
+}
+
+func (node *defaultNode) NewPublisherWithOptions(topic string, msgType MessageType, opts ...PublisherOption) (Publisher, error) {
 	node.publishersMutex.Lock()
 	defer node.publishersMutex.Unlock()
 
+	var options publisherOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	name := node.nameResolver.remap(topic)
-	pub, ok := node.publishers[topic]
+	pub, ok := node.publishers[name]
 	if !ok {
-		_, err := callRosAPI(node.xmlClient, node.masterURI, "registerPublisher",
+		var err error
+		if pub, err = newDefaultPublisher(node, name, msgType, options); err != nil {
+			node.log.Error().Err(err).Str("topic", name).Msg("failed to listen for subscribers")
+			return nil, errors.Wrap(err, "topic: "+name)
+		}
+		_, err = callRosAPI(node.ctx, node.xmlClient, node.masterURI, "registerPublisher",
 			node.qualifiedName,
 			name, msgType.Name(),
 			node.xmlrpcURI)
-		if err != nil {
+		if err != nil && !node.queueRegistration(err) {
 			node.log.Error().Err(err).Msg("failed to call registerPublisher()")
+			pub.listener.Close()
 			return nil, err
 		}
 
-		pub = newDefaultPublisher(node, name, msgType, connectCallback, disconnectCallback)
 		node.publishers[name] = pub
 		go pub.start(&node.waitGroup)
 	}
@@ -454,7 +619,7 @@ func (node *defaultNode) NewPublisherWithCallbacks(topic string, msgType Message
 // Master API for getSystemState
 func (node *defaultNode) GetSystemState() ([]interface{}, error) {
 	node.log.Trace().Msg("call Master API getSystemState")
-	result, err := callRosAPI(node.xmlClient, node.masterURI, "getSystemState",
+	result, err := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "getSystemState",
 		node.qualifiedName)
 	if err != nil {
 		node.log.Error().Err(err).Msg("failed to call getSystemState()")
@@ -494,7 +659,7 @@ func (node *defaultNode) GetServiceType(serviceName string) (*ServiceHeader, err
 	serviceName = node.nameResolver.remap(serviceName)
 
 	// Probe the service
-	result, err := callRosAPI(node.xmlClient, node.masterURI, "lookupService", node.qualifiedName, serviceName)
+	result, err := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "lookupService", node.qualifiedName, serviceName)
 	if err != nil {
 		return nil, errors.Errorf("failed to lookup service %s : %s", serviceName, err)
 	}
@@ -551,7 +716,7 @@ func (node *defaultNode) GetServiceType(serviceName string) (*ServiceHeader, err
 // Master API call for getPublishedTopics
 func (node *defaultNode) GetPublishedTopics(subgraph string) (map[string]string, error) {
 	node.log.Trace().Msg("call Master API getPublishedTopics")
-	result, err := callRosAPI(node.xmlClient, node.masterURI, "getPublishedTopics",
+	result, err := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "getPublishedTopics",
 		node.qualifiedName,
 		subgraph)
 	if err != nil {
@@ -597,7 +762,7 @@ func (node *defaultNode) GetPublishedActions(subgraph string) (map[string]string
 // Master API call for getTopicTypes
 func (node *defaultNode) GetTopicTypes() []interface{} {
 	node.log.Trace().Msg("call Master API getTopicTypes")
-	result, err := callRosAPI(node.xmlClient, node.masterURI, "getTopicTypes",
+	result, err := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "getTopicTypes",
 		node.qualifiedName)
 	if err != nil {
 		node.log.Error().Err(err).Msg("failed to call getTopicTypes()")
@@ -612,6 +777,9 @@ func (node *defaultNode) GetTopicTypes() []interface{} {
 
 // RemoveSubscriber shuts down and deletes an existing topic subscriber.
 func (node *defaultNode) RemoveSubscriber(topic string) {
+	node.subscribersMutex.Lock()
+	defer node.subscribersMutex.Unlock()
+
 	name := node.nameResolver.remap(topic)
 	if sub, ok := node.subscribers[name]; ok {
 		sub.Shutdown()
@@ -625,6 +793,18 @@ func (node *defaultNode) NewSubscriber(topic string, msgType MessageType, callba
 }
 
 func (node *defaultNode) NewSubscriberWithFlowControl(topic string, msgType MessageType, enableChan chan bool, callback interface{}) (Subscriber, error) {
+	return node.NewSubscriberWithOptions(topic, msgType, callback, WithFlowControl(enableChan))
+}
+
+func (node *defaultNode) NewSubscriberWithOptions(topic string, msgType MessageType, callback interface{}, opts ...SubscriberOption) (Subscriber, error) {
+	var options subscriberOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if _, ok := msgType.(*DynamicMessageType); options.migrator != nil && !ok {
+		return nil, errors.New("message migration needs a *DynamicMessageType")
+	}
+
 	node.subscribersMutex.Lock()
 	defer node.subscribersMutex.Unlock()
 
@@ -632,17 +812,17 @@ func (node *defaultNode) NewSubscriberWithFlowControl(topic string, msgType Mess
 	sub, ok := node.subscribers[name]
 	if !ok {
 		node.log.Debug().Msg("call Master API registerSubscriber")
-		result, err := callRosAPI(node.xmlClient, node.masterURI, "registerSubscriber",
+		result, err := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "registerSubscriber",
 			node.qualifiedName,
 			name,
 			msgType.Name(),
 			node.xmlrpcURI)
-		if err != nil {
+		if err != nil && !node.queueRegistration(err) {
 			node.log.Error().Err(err).Msg("failed to call registerSubscriber()")
 			return nil, err
 		}
 		list, ok := result.([]interface{})
-		if !ok {
+		if !ok && err == nil {
 			node.log.Error().Str("type", reflect.TypeOf(result).String()).Msg("result is not []string")
 		}
 		var publishers []string
@@ -657,10 +837,12 @@ func (node *defaultNode) NewSubscriberWithFlowControl(topic string, msgType Mess
 		node.log.Debug().Strs("publishers", publishers).Msg("")
 
 		sub = newDefaultSubscriber(name, msgType, callback)
+		sub.migrator = options.migrator
+		sub.intraProcess = node.intraProcess
 		node.subscribers[name] = sub
 
 		node.log.Debug().Str("topic", sub.topic).Msg("start subscriber goroutine for topic")
-		go sub.start(&node.waitGroup, node.qualifiedName, node.xmlrpcURI, node.masterURI, node.jobChan, enableChan, node.log)
+		go sub.start(node.ctx, &node.waitGroup, node.qualifiedName, node.xmlrpcURI, node.masterURI, node.jobChan, options.enableChan, node.log)
 		node.log.Debug().Msg("done")
 		sub.pubListChan <- publishers
 		node.log.Debug().Str("topic", sub.topic).Msg("update publisher list for topic")
@@ -672,27 +854,40 @@ func (node *defaultNode) NewSubscriberWithFlowControl(topic string, msgType Mess
 
 func (node *defaultNode) NewServiceClient(service string, srvType ServiceType) ServiceClient {
 	name := node.nameResolver.remap(service)
-	client := newDefaultServiceClient(node.log, node.qualifiedName, node.masterURI, name, srvType)
+	client := newDefaultServiceClient(node.ctx, node.log, node.qualifiedName, node.masterURI, name, srvType)
 	return client
 }
 
 func (node *defaultNode) NewServiceServer(service string, srvType ServiceType, handler interface{}) ServiceServer {
+	server, err := node.NewServiceServerWithOptions(service, srvType, handler)
+	if err != nil {
+		return nil
+	}
+	return server
+}
+
+func (node *defaultNode) NewServiceServerWithOptions(service string, srvType ServiceType, handler interface{}, opts ...ServiceServerOption) (ServiceServer, error) {
 	node.serversMutex.Lock()
 	defer node.serversMutex.Unlock()
 
+	var options serviceServerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	name := node.nameResolver.remap(service)
 	server, ok := node.servers[name]
 	if ok {
 		server.Shutdown()
 	}
 
-	server = newDefaultServiceServer(node, name, srvType, handler)
-	if server == nil {
-		return nil
+	server, err := newDefaultServiceServer(node, name, srvType, handler, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "service: "+name)
 	}
 
 	node.servers[name] = server
-	return server
+	return server, nil
 }
 
 func (node *defaultNode) SpinOnce() bool {
@@ -722,9 +917,13 @@ func (node *defaultNode) Spin() {
 
 func (node *defaultNode) Shutdown() {
 	node.log.Debug().Msg("shutting node down")
+	node.unregisterLocal()
 	node.okMutex.Lock()
 	node.ok = false
 	node.okMutex.Unlock()
+	if node.stopWatchdog != nil {
+		node.stopWatchdog()
+	}
 	node.log.Debug().Msg("shutdown subscribers")
 	for _, s := range node.subscribers {
 		s.Shutdown()
@@ -749,24 +948,25 @@ func (node *defaultNode) Shutdown() {
 	node.log.Debug().Msg("wait XMLRPC server shutdown")
 	node.xmlrpcHandler.WaitForShutdown()
 	node.log.Debug().Msg("wait XMLRPC server shutdown...done")
+	node.cancel()
 	node.log.Debug().Msg("shutting node down completed")
 	return
 }
 
 func (node *defaultNode) GetParam(key string) (interface{}, error) {
 	name := node.nameResolver.remap(key)
-	return callRosAPI(node.xmlClient, node.masterURI, "getParam", node.qualifiedName, name)
+	return callRosAPI(node.ctx, node.xmlClient, node.masterURI, "getParam", node.qualifiedName, name)
 }
 
 func (node *defaultNode) SetParam(key string, value interface{}) error {
 	name := node.nameResolver.remap(key)
-	_, e := callRosAPI(node.xmlClient, node.masterURI, "setParam", node.qualifiedName, name, value)
+	_, e := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "setParam", node.qualifiedName, name, value)
 	return e
 }
 
 func (node *defaultNode) HasParam(key string) (bool, error) {
 	name := node.nameResolver.remap(key)
-	result, err := callRosAPI(node.xmlClient, node.masterURI, "hasParam", node.qualifiedName, name)
+	result, err := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "hasParam", node.qualifiedName, name)
 	if err != nil {
 		return false, err
 	}
@@ -775,7 +975,7 @@ func (node *defaultNode) HasParam(key string) (bool, error) {
 }
 
 func (node *defaultNode) SearchParam(key string) (string, error) {
-	result, err := callRosAPI(node.xmlClient, node.masterURI, "searchParam", node.qualifiedName, key)
+	result, err := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "searchParam", node.qualifiedName, key)
 	if err != nil {
 		return "", err
 	}
@@ -785,11 +985,154 @@ func (node *defaultNode) SearchParam(key string) (string, error) {
 
 func (node *defaultNode) DeleteParam(key string) error {
 	name := node.nameResolver.remap(key)
-	_, err := callRosAPI(node.xmlClient, node.masterURI, "deleteParam", node.qualifiedName, name)
+	_, err := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "deleteParam", node.qualifiedName, name)
 	return err
 }
 
+func (node *defaultNode) LoadParams(file string, namespace string) error {
+	value, err := readParamFile(file)
+	if err != nil {
+		return err
+	}
+	return node.setParamTree(node.nameResolver.remap(namespace), value)
+}
+
+// readParamFile reads the parameters in a YAML file.
+func readParamFile(file string) (interface{}, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	value, err := UnmarshalParamYAML(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "file: "+file)
+	}
+	return value, nil
+}
+
+// setParamTree sets a parameter, setting each entry of a map separately.
+func (node *defaultNode) setParamTree(name string, value interface{}) error {
+	entries, ok := value.(map[string]interface{})
+	if !ok || len(entries) == 0 {
+		_, err := callRosAPI(node.ctx, node.xmlClient, node.masterURI, "setParam", node.qualifiedName, name, value)
+		return err
+	}
+	for key, entry := range entries {
+		if err := node.setParamTree(strings.TrimSuffix(name, Sep)+Sep+key, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupParam returns a parameter's value, and whether it's set at all.
+func (node *defaultNode) lookupParam(key string) (interface{}, bool, error) {
+	value, err := node.GetParam(key)
+	if err == nil {
+		return value, true, nil
+	}
+	// The master reports parameters which aren't set as errors too.
+	if has, hasErr := node.HasParam(key); hasErr == nil && !has {
+		return nil, false, nil
+	}
+	return nil, false, err
+}
+
+func (node *defaultNode) GetParamInt(key string, defaultValue int) (int, error) {
+	value, ok, err := node.lookupParam(key)
+	if err != nil || !ok {
+		return defaultValue, err
+	}
+	i, ok := paramInt(value)
+	if !ok || int64(int(i)) != i {
+		return defaultValue, paramTypeError(node.nameResolver.remap(key), "an integer", value)
+	}
+	return int(i), nil
+}
+
+func (node *defaultNode) GetParamFloat(key string, defaultValue float64) (float64, error) {
+	value, ok, err := node.lookupParam(key)
+	if err != nil || !ok {
+		return defaultValue, err
+	}
+	f, ok := paramFloat(value)
+	if !ok {
+		return defaultValue, paramTypeError(node.nameResolver.remap(key), "a float", value)
+	}
+	return f, nil
+}
+
+func (node *defaultNode) GetParamString(key string, defaultValue string) (string, error) {
+	value, ok, err := node.lookupParam(key)
+	if err != nil || !ok {
+		return defaultValue, err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return defaultValue, paramTypeError(node.nameResolver.remap(key), "a string", value)
+	}
+	return s, nil
+}
+
+func (node *defaultNode) GetParamBool(key string, defaultValue bool) (bool, error) {
+	value, ok, err := node.lookupParam(key)
+	if err != nil || !ok {
+		return defaultValue, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return defaultValue, paramTypeError(node.nameResolver.remap(key), "a bool", value)
+	}
+	return b, nil
+}
+
+func (node *defaultNode) GetParamStrings(key string, defaultValue []string) ([]string, error) {
+	value, ok, err := node.lookupParam(key)
+	if err != nil || !ok {
+		return defaultValue, err
+	}
+	strs, ok := paramStrings(value)
+	if !ok {
+		return defaultValue, paramTypeError(node.nameResolver.remap(key), "a list of strings", value)
+	}
+	return strs, nil
+}
+
+func (node *defaultNode) GetParamMap(key string, defaultValue map[string]interface{}) (map[string]interface{}, error) {
+	value, ok, err := node.lookupParam(key)
+	if err != nil || !ok {
+		return defaultValue, err
+	}
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return defaultValue, paramTypeError(node.nameResolver.remap(key), "a map", value)
+	}
+	return m, nil
+}
+
+func (node *defaultNode) BindParams(prefix string, out interface{}) error {
+	value, ok, err := node.lookupParam(prefix)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		value = map[string]interface{}{}
+	}
+	return bindParams(node.nameResolver.remap(prefix), value, out)
+}
+
+func (node *defaultNode) MasterURI() string {
+	return node.masterURI
+}
+
+func (node *defaultNode) Now() Time {
+	return node.clock.Now()
+}
+
 func (node *defaultNode) Logger() zerolog.Logger {
+	if node.logging != nil {
+		return node.logging.logger(node.log)
+	}
 	return node.log
 }
 
@@ -0,0 +1,193 @@
+package ros
+
+import (
+	goContext "context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// NodeOption configures a node as it's created.  Options override the command-line arguments given by WithArgs, which override the ROS environment
+// variables.
+type NodeOption func(*nodeOptions)
+
+// Clock is a source of ROS time, for nodes which don't use the system clock.
+type Clock interface {
+	Now() Time
+}
+
+// nodeOptions holds the settings NodeOptions make.
+type nodeOptions struct {
+	ctx              goContext.Context
+	args             []string
+	masterURI        string
+	namespace        string
+	remappings       NameMap
+	hostname         string
+	listenIP         string
+	listenInterface  string
+	xmlrpcPort       int
+	minPort          int
+	maxPort          int
+	logger           *zerolog.Logger
+	enableInterrupts *bool
+	clock            Clock
+	waitForMaster    bool
+	masterTimeout    time.Duration
+	masterWatchdog   time.Duration
+	masterRetryMin   time.Duration
+	masterRetryMax   time.Duration
+	intraProcess     bool
+	rosout           bool
+}
+
+// systemClock is the Clock nodes use by default.
+type systemClock struct{}
+
+// WithArgs configures a node from command-line arguments, as rosrun passes them: name:=remapping, _param:=value, and special arguments such as
+// __master:=uri and __ns:=namespace.  Any other arguments are returned by Node.NonRosArgs.
+func WithArgs(args []string) NodeOption {
+	return func(options *nodeOptions) {
+		options.args = args
+	}
+}
+
+// WithContext bounds a node's master and slave API calls: they're abandoned once ctx is done.
+func WithContext(ctx goContext.Context) NodeOption {
+	return func(options *nodeOptions) {
+		options.ctx = ctx
+	}
+}
+
+// WithMasterURI sets the URI of a node's master, in place of ROS_MASTER_URI.
+func WithMasterURI(uri string) NodeOption {
+	return func(options *nodeOptions) {
+		options.masterURI = uri
+	}
+}
+
+// WithNamespace sets the namespace a node's names are resolved in, in place of ROS_NAMESPACE.
+func WithNamespace(namespace string) NodeOption {
+	return func(options *nodeOptions) {
+		options.namespace = namespace
+	}
+}
+
+// WithRemappings remaps names used by a node, as name:=remapping arguments do.
+func WithRemappings(remappings NameMap) NodeOption {
+	return func(options *nodeOptions) {
+		if options.remappings == nil {
+			options.remappings = NameMap{}
+		}
+		for name, remapping := range remappings {
+			options.remappings[name] = remapping
+		}
+	}
+}
+
+// WithHostname sets the host name or IP address a node gives other nodes to reach it by, in place of ROS_HOSTNAME or ROS_IP.  Unless WithListenAddress
+// says otherwise, a node given a loopback host listens on the loopback interface only.
+func WithHostname(host string) NodeOption {
+	return func(options *nodeOptions) {
+		options.hostname = host
+	}
+}
+
+// WithListenAddress sets the IP address of the interface a node listens on for its slave API, publishers and services.  It may be an IPv4 or IPv6
+// address; "::" listens on every interface.
+func WithListenAddress(ip string) NodeOption {
+	return func(options *nodeOptions) {
+		options.listenIP = ip
+		options.listenInterface = ""
+	}
+}
+
+// WithListenInterface makes a node listen on an address of the named network interface, such as "eth0", for its slave API, publishers and services.
+// IPv4 addresses are preferred.
+func WithListenInterface(name string) NodeOption {
+	return func(options *nodeOptions) {
+		options.listenInterface = name
+		options.listenIP = ""
+	}
+}
+
+// WithPortRange sets the ports a node's slave API, publishers and services may listen on, from min to max inclusive.  Endpoints given a port of their
+// own, by WithXMLRPCPort, WithPublisherPort or WithServicePort, listen on that port instead.
+func WithPortRange(min int, max int) NodeOption {
+	return func(options *nodeOptions) {
+		options.minPort = min
+		options.maxPort = max
+	}
+}
+
+// WithXMLRPCPort makes a node's slave API listen on port, rather than a port in its port range.
+func WithXMLRPCPort(port int) NodeOption {
+	return func(options *nodeOptions) {
+		options.xmlrpcPort = port
+	}
+}
+
+// WithLogger sets the logger a node logs to.
+func WithLogger(log zerolog.Logger) NodeOption {
+	return func(options *nodeOptions) {
+		options.logger = &log
+	}
+}
+
+// WithSignalHandling sets whether a node stops, so that OK returns false, when the process is interrupted.
+func WithSignalHandling(enable bool) NodeOption {
+	return func(options *nodeOptions) {
+		options.enableInterrupts = &enable
+	}
+}
+
+// WithClock sets the clock Node.Now reads.
+func WithClock(clock Clock) NodeOption {
+	return func(options *nodeOptions) {
+		options.clock = clock
+	}
+}
+
+// WaitForMaster makes a node wait for up to timeout for its master as it starts, or for as long as its context allows if timeout is 0.  If the master
+// still can't be reached, the node starts anyway: the parameters given in its arguments, and any publishers, subscribers and service servers it creates,
+// are queued and registered once the master appears.  The node watches its master, as WithMasterWatchdog does, every second unless told otherwise.
+func WaitForMaster(timeout time.Duration) NodeOption {
+	return func(options *nodeOptions) {
+		options.waitForMaster = true
+		options.masterTimeout = timeout
+	}
+}
+
+// WithMasterWatchdog makes a node check its master every interval, and register its parameters, publishers, subscribers and service servers again
+// if the master has restarted or couldn't be reached; the callbacks set by Node.SetMasterCallbacks are only called by a node which does.  An interval of
+// 0, the default, disables the check.
+func WithMasterWatchdog(interval time.Duration) NodeOption {
+	return func(options *nodeOptions) {
+		options.masterWatchdog = interval
+	}
+}
+
+// WithIntraProcess sets whether a node's publishers and subscribers connect directly to those of other nodes in the process which also have it set.  A
+// publisher passes each message to directly connected subscribers' callbacks as it is, without serializing it, so neither the publisher nor the callbacks
+// may change a message once it has been published.  Publishers and subscribers in other processes, or of a different Go message type, still use TCPROS.
+func WithIntraProcess(enable bool) NodeOption {
+	return func(options *nodeOptions) {
+		options.intraProcess = enable
+	}
+}
+
+// WithRosout sets whether messages logged through a node's Logger are published to /rosout as rosgraph_msgs/Log, as roscpp does: those at Info and
+// above, whatever the level of the logger's own output.  The node also serves ~get_loggers and ~set_logger_level, through which the /rosout level of its
+// logger, named "ros", can be read and changed while it runs; unlike roscpp's, they leave the level of the logger's own output alone.  Like other
+// services, they are only answered while the node spins.  Loggers taken from Logger before the level is lowered don't log below the level they were
+// taken at.
+func WithRosout(enable bool) NodeOption {
+	return func(options *nodeOptions) {
+		options.rosout = enable
+	}
+}
+
+// Now returns the current time from the system clock; required for Clock.
+func (systemClock) Now() Time {
+	return Now()
+}
@@ -1,7 +1,18 @@
 package ros
 
 import (
+	goContext "context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"testing"
+
+	"github.com/asimovsecurity/rosgo/xmlrpc"
 )
 
 func TestLoadJsonFromString(t *testing.T) {
@@ -17,3 +28,210 @@ func TestLoadJsonFromString(t *testing.T) {
 		t.Error(i)
 	}
 }
+
+// newParamTestNode returns a node in /ns named talker, and its master, which starts with the parameters in params.
+func newParamTestNode(params map[string]interface{}) (*defaultNode, *fakeMaster) {
+	master := newFakeMaster()
+	for key, value := range params {
+		master.params[key] = value
+	}
+	node := &defaultNode{
+		qualifiedName: "/ns/talker",
+		masterURI:     master.server.URL,
+		xmlClient:     xmlrpc.NewXMLClient(),
+		nameResolver:  newNameResolver("/ns", "talker", NameMap{}),
+		ctx:           goContext.Background(),
+	}
+	return node, master
+}
+
+func TestLoadParams(t *testing.T) {
+	node, master := newParamTestNode(nil)
+	defer master.server.Close()
+
+	dir, err := ioutil.TempDir("", "rosgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "params.yaml")
+	if err := ioutil.WriteFile(file, []byte("rate: 10\narm:\n  joints: [a, b]\n  limits: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := node.LoadParams(file, "~"); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"/ns/talker/rate":       int32(10),
+		"/ns/talker/arm/joints": []interface{}{"a", "b"},
+		"/ns/talker/arm/limits": map[string]interface{}{},
+	}
+	if params := master.parameters(); !reflect.DeepEqual(params, expected) {
+		t.Fatalf("expected %v, got %v", expected, params)
+	}
+
+	if err := node.LoadParams(filepath.Join(dir, "missing.yaml"), ""); err == nil {
+		t.Fatal("expected an error loading a missing file")
+	}
+}
+
+func TestGetParamTyped(t *testing.T) {
+	node, master := newParamTestNode(map[string]interface{}{
+		"/ns/rate":         int32(10),
+		"/ns/talker/scale": 1.5,
+		"/ns/frame":        "base_link",
+		"/ns/enabled":      true,
+		"/ns/joints":       []interface{}{"left", "right"},
+		"/ns/limits":       map[string]interface{}{"max": 2.0},
+	})
+	defer master.server.Close()
+
+	if i, err := node.GetParamInt("rate", 5); err != nil || i != 10 {
+		t.Errorf("rate: %v, %v", i, err)
+	}
+	if i, err := node.GetParamInt("missing", 5); err != nil || i != 5 {
+		t.Errorf("missing: %v, %v", i, err)
+	}
+	if f, err := node.GetParamFloat("~scale", 0); err != nil || f != 1.5 {
+		t.Errorf("scale: %v, %v", f, err)
+	}
+	if f, err := node.GetParamFloat("rate", 0); err != nil || f != 10 {
+		t.Errorf("rate as a float: %v, %v", f, err)
+	}
+	if s, err := node.GetParamString("frame", ""); err != nil || s != "base_link" {
+		t.Errorf("frame: %v, %v", s, err)
+	}
+	if b, err := node.GetParamBool("enabled", false); err != nil || !b {
+		t.Errorf("enabled: %v, %v", b, err)
+	}
+	if strs, err := node.GetParamStrings("joints", nil); err != nil || !reflect.DeepEqual(strs, []string{"left", "right"}) {
+		t.Errorf("joints: %v, %v", strs, err)
+	}
+	if m, err := node.GetParamMap("limits", nil); err != nil || m["max"] != 2.0 {
+		t.Errorf("limits: %v, %v", m, err)
+	}
+
+	var apiErr *APIError
+	if _, err := node.GetParam("missing"); !errors.As(err, &apiErr) || apiErr.Code != APIStatusError {
+		t.Errorf("expected an APIError, got %v", err)
+	}
+
+	i, err := node.GetParamInt("frame", 5)
+	if paramErr, ok := err.(ParamError); !ok || paramErr.Key != "/ns/frame" || i != 5 {
+		t.Errorf("expected a ParamError for /ns/frame, got %v, %v", i, err)
+	}
+}
+
+type fixedClock Time
+
+func (c fixedClock) Now() Time {
+	return Time(c)
+}
+
+func TestNewNodeWithOptions(t *testing.T) {
+	master := newFakeMaster()
+	defer master.server.Close()
+
+	stamp := NewTime(1234, 5678)
+	node, err := NewNodeWithOptions("talker",
+		WithArgs([]string{"__ns:=/ignored", "chatter:=/args", "extra"}),
+		WithMasterURI(master.server.URL),
+		WithNamespace("robot"),
+		WithRemappings(NameMap{"chatter": "/remapped"}),
+		WithHostname("localhost"),
+		WithPortRange(41000, 41099),
+		WithSignalHandling(false),
+		WithClock(fixedClock(stamp)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+
+	if node.Namespace() != "/robot" || node.QualifiedName() != "/robot/talker" {
+		t.Fatalf("expected /robot/talker, got %s in %s", node.QualifiedName(), node.Namespace())
+	}
+	n := node.(*defaultNode)
+	if name := n.nameResolver.remap("chatter"); name != "/remapped" {
+		t.Fatalf("expected chatter to be remapped to /remapped, got %s", name)
+	}
+	if n.enableInterrupts || n.listenIP != "127.0.0.1" {
+		t.Fatalf("unexpected interrupts %v or listen address %s", n.enableInterrupts, n.listenIP)
+	}
+	u, err := url.Parse(n.xmlrpcURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port, _ := strconv.Atoi(u.Port()); u.Hostname() != "localhost" || port < 41000 || port > 41099 {
+		t.Fatalf("expected a localhost URI with a port in range, got %s", n.xmlrpcURI)
+	}
+	if !reflect.DeepEqual(node.NonRosArgs(), []string{"extra"}) {
+		t.Fatalf("expected the non-ROS arguments to be kept, got %v", node.NonRosArgs())
+	}
+	if node.Now() != stamp {
+		t.Fatalf("expected the node's clock to read %v, got %v", stamp, node.Now())
+	}
+	if node.MasterURI() != master.server.URL {
+		t.Fatalf("expected master %s, got %s", master.server.URL, node.MasterURI())
+	}
+}
+
+// freePorts returns ports which were free on the IPv6 loopback interface a moment ago.
+func freePorts(t *testing.T, n int) []int {
+	var ports []int
+	for i := 0; i < n; i++ {
+		listener, err := net.Listen("tcp", "[::1]:0")
+		if err != nil {
+			t.Skip("IPv6 loopback is unavailable: ", err)
+		}
+		defer listener.Close()
+		ports = append(ports, listener.Addr().(*net.TCPAddr).Port)
+	}
+	return ports
+}
+
+func TestNodeEndpointPorts(t *testing.T) {
+	master := newFakeMaster()
+	defer master.server.Close()
+
+	ports := freePorts(t, 3)
+	node, err := NewNodeWithOptions("ports_test",
+		WithMasterURI(master.server.URL),
+		WithHostname("::1"),
+		WithXMLRPCPort(ports[0]),
+		WithSignalHandling(false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+	n := node.(*defaultNode)
+	if expected := "http://" + net.JoinHostPort("::1", strconv.Itoa(ports[0])); n.xmlrpcURI != expected || n.listenIP != "::1" {
+		t.Fatalf("expected %s on ::1, got %s on %s", expected, n.xmlrpcURI, n.listenIP)
+	}
+
+	if _, err := node.NewPublisherWithOptions("chatter", AnyMessageType{}, WithPublisherPort(ports[1])); err != nil {
+		t.Fatal(err)
+	}
+	api := &SubscriberRosAPI{topic: "/chatter", nodeID: "/listener", xmlClient: xmlrpc.NewXMLClient(), ctx: goContext.Background()}
+	uri, err := api.RequestTopicURI(n.xmlrpcURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := net.JoinHostPort("::1", strconv.Itoa(ports[1])); uri != expected {
+		t.Fatalf("expected subscribers to connect to %s, got %s", expected, uri)
+	}
+	if _, err := node.NewPublisherWithOptions("other", AnyMessageType{}, WithPublisherPort(ports[1])); err == nil {
+		t.Fatal("expected an error publishing on a port already in use")
+	}
+
+	srv, err := node.NewServiceServerWithOptions("add", testServiceType{}, func(*testService) error { return nil }, WithServicePort(ports[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown()
+	if expected := "rosrpc://" + net.JoinHostPort("::1", strconv.Itoa(ports[2])); n.servers["/add"].rosrpcAddr != expected {
+		t.Fatalf("expected the service at %s, got %s", expected, n.servers["/add"].rosrpcAddr)
+	}
+}
@@ -0,0 +1,272 @@
+package ros
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ParamError describes a problem with a single parameter, as reported by Node.BindParams.
+type ParamError struct {
+	Key    string // Resolved name of the offending parameter, for example `/robot/wheels[2]/radius`.
+	Reason string // What is wrong with it.
+}
+
+// ParamBindError lists every parameter which Node.BindParams couldn't bind to its struct.
+type ParamBindError []ParamError
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// Error describes the parameter error; required for error.
+func (e ParamError) Error() string {
+	return "param " + e.Key + ": " + e.Reason
+}
+
+// Error lists the parameter errors; required for error.
+func (e ParamBindError) Error() string {
+	reasons := make([]string, len(e))
+	for i, paramErr := range e {
+		reasons[i] = paramErr.Key + ": " + paramErr.Reason
+	}
+	return strconv.Itoa(len(e)) + " parameters could not be bound: " + strings.Join(reasons, "; ")
+}
+
+// paramInt converts a parameter value to an int; floats are accepted if they're whole numbers.
+func paramInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+// paramFloat converts a parameter value to a float64; integers are accepted too.
+func paramFloat(value interface{}) (float64, bool) {
+	if f, ok := value.(float64); ok {
+		return f, true
+	}
+	if i, ok := paramInt(value); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// paramStrings converts a parameter value to a list of strings.
+func paramStrings(value interface{}) ([]string, bool) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, len(list))
+	for i, entry := range list {
+		if strs[i], ok = entry.(string); !ok {
+			return nil, false
+		}
+	}
+	return strs, true
+}
+
+// describeParam names the type of a parameter value, for error messages.
+func describeParam(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "nothing"
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "a map"
+	case int32, int64, int:
+		return "an integer"
+	case float64:
+		return "a float"
+	case bool:
+		return "a bool"
+	case string:
+		return "a string"
+	case time.Time:
+		return "a time"
+	}
+	return reflect.TypeOf(value).String()
+}
+
+// paramTypeError reports a parameter with a value of the wrong type.
+func paramTypeError(name string, expected string, value interface{}) ParamError {
+	return ParamError{name, "expected " + expected + ", got " + describeParam(value)}
+}
+
+// bindParamStruct fills in the tagged fields of a struct from a map of parameters, adding to errs for every parameter which is missing or of the wrong type.
+// Fields are tagged `rosparam:"name"`, or `rosparam:"name,optional"` if they may be left unset; untagged fields are left alone.
+func bindParamStruct(name string, value interface{}, out reflect.Value, errs *ParamBindError) {
+	entries, ok := value.(map[string]interface{})
+	if !ok {
+		*errs = append(*errs, paramTypeError(name, "a map", value))
+		return
+	}
+	for i := 0; i < out.NumField(); i++ {
+		field := out.Type().Field(i)
+		tag, ok := field.Tag.Lookup("rosparam")
+		if !ok || tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		key, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			key, options = tag[:comma], tag[comma+1:]
+		}
+		entryName := strings.TrimSuffix(name, Sep) + Sep + key
+		entry, ok := entries[key]
+		if !ok {
+			if options != "optional" {
+				*errs = append(*errs, ParamError{entryName, "missing"})
+			}
+			continue
+		}
+		bindParam(entryName, entry, out.Field(i), errs)
+	}
+}
+
+// bindParam sets a value from a parameter, converting numbers as it goes and adding to errs if the parameter can't be converted.
+func bindParam(name string, value interface{}, out reflect.Value, errs *ParamBindError) {
+	fail := func(expected string) {
+		*errs = append(*errs, paramTypeError(name, expected, value))
+	}
+
+	// Durations are given in seconds, as elsewhere in ROS.
+	if out.Type() == durationType {
+		seconds, ok := paramFloat(value)
+		if !ok {
+			fail("a duration in seconds")
+			return
+		}
+		out.SetInt(int64(seconds * float64(time.Second)))
+		return
+	}
+
+	// Times are only set over XML-RPC, as dateTime.iso8601 values.
+	if out.Type() == timeType {
+		t, ok := value.(time.Time)
+		if !ok {
+			fail("a time")
+			return
+		}
+		out.Set(reflect.ValueOf(t))
+		return
+	}
+
+	switch out.Kind() {
+	case reflect.Struct:
+		bindParamStruct(name, value, out, errs)
+	case reflect.Ptr:
+		elem := reflect.New(out.Type().Elem())
+		before := len(*errs)
+		bindParam(name, value, elem.Elem(), errs)
+		if len(*errs) == before {
+			out.Set(elem)
+		}
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			fail("a bool")
+			return
+		}
+		out.SetBool(b)
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			fail("a string")
+			return
+		}
+		out.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := paramInt(value)
+		if !ok {
+			fail("an integer")
+			return
+		}
+		if out.OverflowInt(i) {
+			*errs = append(*errs, ParamError{name, strconv.FormatInt(i, 10) + " is out of range for " + out.Type().String()})
+			return
+		}
+		out.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := paramInt(value)
+		if !ok {
+			fail("an integer")
+			return
+		}
+		if i < 0 || out.OverflowUint(uint64(i)) {
+			*errs = append(*errs, ParamError{name, strconv.FormatInt(i, 10) + " is out of range for " + out.Type().String()})
+			return
+		}
+		out.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, ok := paramFloat(value)
+		if !ok {
+			fail("a float")
+			return
+		}
+		out.SetFloat(f)
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok {
+			fail("a list")
+			return
+		}
+		slice := reflect.MakeSlice(out.Type(), len(list), len(list))
+		for i, entry := range list {
+			bindParam(name+"["+strconv.Itoa(i)+"]", entry, slice.Index(i), errs)
+		}
+		out.Set(slice)
+	case reflect.Map:
+		entries, ok := value.(map[string]interface{})
+		if !ok || out.Type().Key().Kind() != reflect.String {
+			fail("a map")
+			return
+		}
+		m := reflect.MakeMapWithSize(out.Type(), len(entries))
+		for key, entry := range entries {
+			elem := reflect.New(out.Type().Elem()).Elem()
+			bindParam(strings.TrimSuffix(name, Sep)+Sep+key, entry, elem, errs)
+			m.SetMapIndex(reflect.ValueOf(key).Convert(out.Type().Key()), elem)
+		}
+		out.Set(m)
+	case reflect.Interface:
+		if value == nil {
+			out.Set(reflect.Zero(out.Type()))
+		} else if reflect.TypeOf(value).AssignableTo(out.Type()) {
+			out.Set(reflect.ValueOf(value))
+		} else {
+			fail(out.Type().String())
+		}
+	default:
+		*errs = append(*errs, ParamError{name, "cannot bind a parameter to " + out.Type().String()})
+	}
+}
+
+// bindParams fills in the tagged fields of the struct out points to from a map of parameters.
+func bindParams(name string, value interface{}, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("params can only be bound to a pointer to a struct, not %T", out)
+	}
+	var errs ParamBindError
+	bindParamStruct(name, value, rv.Elem(), &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package ros
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type bindTestWheel struct {
+	Radius float32 `rosparam:"radius"`
+	Driven bool    `rosparam:"driven,optional"`
+}
+
+type bindTestConfig struct {
+	Name    string             `rosparam:"name"`
+	Rate    int                `rosparam:"rate"`
+	Timeout time.Duration      `rosparam:"timeout"`
+	Joints  []string           `rosparam:"joints"`
+	Wheels  []bindTestWheel    `rosparam:"wheels"`
+	Gains   map[string]float64 `rosparam:"gains"`
+	Extra   interface{}        `rosparam:"extra,optional"`
+	Limit   *uint8             `rosparam:"limit,optional"`
+	Stamp   time.Time          `rosparam:"stamp,optional"`
+	Bytes   int64              `rosparam:"bytes,optional"`
+	Ignored string
+}
+
+func TestBindParams(t *testing.T) {
+	var config bindTestConfig
+	config.Ignored = "untouched"
+	err := bindParams("/robot", map[string]interface{}{
+		"name":    "rover",
+		"rate":    int32(20),
+		"timeout": 0.5,
+		"joints":  []interface{}{"left", "right"},
+		"wheels": []interface{}{
+			map[string]interface{}{"radius": 0.1, "driven": true},
+			map[string]interface{}{"radius": int32(1)},
+		},
+		"gains": map[string]interface{}{"p": 1.5, "i": int32(0)},
+		"limit": int32(200),
+		"stamp": time.Date(1998, 7, 17, 14, 8, 55, 0, time.UTC),
+		"bytes": int64(1) << 40,
+	}, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit := uint8(200)
+	expected := bindTestConfig{
+		Name:    "rover",
+		Rate:    20,
+		Timeout: 500 * time.Millisecond,
+		Joints:  []string{"left", "right"},
+		Wheels:  []bindTestWheel{{0.1, true}, {1, false}},
+		Gains:   map[string]float64{"p": 1.5, "i": 0},
+		Limit:   &limit,
+		Stamp:   time.Date(1998, 7, 17, 14, 8, 55, 0, time.UTC),
+		Bytes:   1 << 40,
+		Ignored: "untouched",
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, config)
+	}
+}
+
+func TestBindParams_Errors(t *testing.T) {
+	var config bindTestConfig
+	err := bindParams("/robot", map[string]interface{}{
+		"name":   int32(1),
+		"rate":   1.5,
+		"joints": []interface{}{"left", true},
+		"wheels": []interface{}{map[string]interface{}{}},
+		"gains":  map[string]interface{}{},
+		"limit":  int32(300),
+	}, &config)
+	bindErr, ok := err.(ParamBindError)
+	if !ok {
+		t.Fatalf("expected a ParamBindError, got %v", err)
+	}
+
+	var keys []string
+	for _, paramErr := range bindErr {
+		keys = append(keys, paramErr.Key)
+	}
+	sort.Strings(keys)
+	expected := []string{"/robot/joints[1]", "/robot/limit", "/robot/name", "/robot/rate", "/robot/timeout", "/robot/wheels[0]/radius"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected errors for %v, got %v", expected, err)
+	}
+
+	if err := bindParams("/robot", map[string]interface{}{}, config); err == nil {
+		t.Fatal("expected an error binding to a struct rather than a pointer")
+	}
+	if err := bindParams("/robot", "rover", &config); err == nil {
+		t.Fatal("expected an error binding a string to a struct")
+	}
+}
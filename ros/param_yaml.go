@@ -0,0 +1,160 @@
+package ros
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MarshalParamYAML writes a parameter value, as returned by Node.GetParam, as block style YAML, the format rosparam dumps and loads parameters in.  Maps are
+// written with their keys in order.
+func MarshalParamYAML(value interface{}) ([]byte, error) {
+	lines, _, err := paramYAMLLines(value)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// UnmarshalParamYAML parses YAML into a parameter value which Node.SetParam can set: maps of strings to values, lists, strings, bools, integers and floats.
+// It understands the same subset of YAML as the yaml Codec.
+func UnmarshalParamYAML(buf []byte) (interface{}, error) {
+	value, err := parseYAML(string(buf))
+	if err != nil {
+		return nil, errors.Wrap(err, "yaml")
+	}
+	return paramFromYAML("", value)
+}
+
+// paramYAMLLines writes a parameter value as lines of YAML, without any indentation of its own, and says whether they're a block map or sequence rather than
+// a single scalar or empty collection.
+func paramYAMLLines(value interface{}) ([]string, bool, error) {
+	// Timestamps set over XML-RPC are written as RFC 3339 strings, which are read back as strings.
+	if t, ok := value.(time.Time); ok {
+		return []string{paramYAMLString(t.UTC().Format(time.RFC3339Nano))}, false, nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false, errors.New("map keys must be strings, not " + rv.Type().Key().String())
+		}
+		if rv.Len() == 0 {
+			return []string{"{}"}, false, nil
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, key := range rv.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		var lines []string
+		for _, key := range keys {
+			entry, block, err := paramYAMLLines(rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())).Interface())
+			if err != nil {
+				return nil, false, errors.Wrap(err, "key: "+key)
+			}
+			name := paramYAMLString(key)
+			if block {
+				lines = append(lines, name+":")
+				for _, line := range entry {
+					lines = append(lines, "  "+line)
+				}
+			} else {
+				lines = append(lines, name+": "+entry[0])
+			}
+		}
+		return lines, true, nil
+
+	case reflect.Slice, reflect.Array:
+		if rv.Len() == 0 {
+			return []string{"[]"}, false, nil
+		}
+		var lines []string
+		for i := 0; i < rv.Len(); i++ {
+			entry, block, err := paramYAMLLines(rv.Index(i).Interface())
+			if err != nil {
+				return nil, false, errors.Wrap(err, "index: "+strconv.Itoa(i))
+			}
+			// Sequences nested directly in sequences start on the line after their dash.
+			if block && strings.HasPrefix(entry[0], "-") {
+				lines = append(lines, "-")
+				for _, line := range entry {
+					lines = append(lines, "  "+line)
+				}
+				continue
+			}
+			lines = append(lines, "- "+entry[0])
+			for _, line := range entry[1:] {
+				lines = append(lines, "  "+line)
+			}
+		}
+		return lines, true, nil
+
+	case reflect.String:
+		return []string{paramYAMLString(rv.String())}, false, nil
+	case reflect.Bool:
+		return []string{strconv.FormatBool(rv.Bool())}, false, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []string{strconv.FormatInt(rv.Int(), 10)}, false, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []string{strconv.FormatUint(rv.Uint(), 10)}, false, nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		switch {
+		case math.IsNaN(f):
+			return []string{".nan"}, false, nil
+		case math.IsInf(f, 1):
+			return []string{".inf"}, false, nil
+		case math.IsInf(f, -1):
+			return []string{"-.inf"}, false, nil
+		}
+		return []string{formatPythonFloat(f)}, false, nil
+	case reflect.Invalid:
+		return []string{"null"}, false, nil
+	}
+	return nil, false, errors.New("cannot write " + rv.Type().String() + " as a parameter")
+}
+
+// paramYAMLString writes a string as a plain scalar if it would be read back as the same string, and double quoted otherwise.
+func paramYAMLString(s string) string {
+	plain := s != "" && strings.TrimSpace(s) == s && strings.IndexAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") < 0 &&
+		!strings.Contains(s, ": ") && !strings.Contains(s, " #") && !strings.HasSuffix(s, ":") && strings.IndexAny(s, "\n\r\t") < 0
+	if plain {
+		if resolved, ok := resolveYAMLScalar(s).(string); ok && resolved == s {
+			return s
+		}
+	}
+	return strconv.Quote(s)
+}
+
+// paramFromYAML checks that a parsed YAML value can be set as a parameter.
+func paramFromYAML(path string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, entry := range v {
+			converted, err := paramFromYAML(strings.TrimPrefix(path+"."+key, "."), entry)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+	case []interface{}:
+		for i, entry := range v {
+			converted, err := paramFromYAML(path+"["+strconv.Itoa(i)+"]", entry)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+	case uint64:
+		return nil, errors.New("value out of range: " + path)
+	case nil:
+		return nil, errors.New("parameters can't be null: " + path)
+	}
+	return value, nil
+}
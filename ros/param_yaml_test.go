@@ -0,0 +1,103 @@
+package ros
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParamYAML_RoundTrip(t *testing.T) {
+	value := map[string]interface{}{
+		"robot": map[string]interface{}{
+			"name":    "rover",
+			"wheels":  int64(4),
+			"ratio":   2.5,
+			"enabled": true,
+			"mode":    "true",
+			"note":    "speed: fast # really",
+			"empty":   []interface{}{},
+			"limits":  []interface{}{1.0, -1.5},
+			"grid":    []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{}},
+			"joints": []interface{}{
+				map[string]interface{}{"name": "left", "offset": 0.25},
+				map[string]interface{}{"name": "right", "offset": -0.25},
+			},
+			"options": map[string]interface{}{},
+		},
+		"1": "one",
+	}
+
+	buf, err := MarshalParamYAML(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `"1": one
+robot:
+  empty: []
+  enabled: true
+  grid:
+    -
+      - 1
+      - 2
+    - []
+  joints:
+    - name: left
+      offset: 0.25
+    - name: right
+      offset: -0.25
+  limits:
+    - 1.0
+    - -1.5
+  mode: "true"
+  name: rover
+  note: "speed: fast # really"
+  options: {}
+  ratio: 2.5
+  wheels: 4
+`
+	if string(buf) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, buf)
+	}
+
+	parsed, err := UnmarshalParamYAML(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, value) {
+		t.Fatalf("expected %v, got %v", value, parsed)
+	}
+}
+
+func TestParamYAML_Scalars(t *testing.T) {
+	for input, expected := range map[string]interface{}{
+		"42":      int64(42),
+		"-1.5":    -1.5,
+		"hello":   "hello",
+		"'007'":   "007",
+		"[1, a]":  []interface{}{int64(1), "a"},
+		"{a: 1}":  map[string]interface{}{"a": int64(1)},
+		"false\n": false,
+	} {
+		value, err := UnmarshalParamYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+		if !reflect.DeepEqual(value, expected) {
+			t.Fatalf("%q: expected %v (%T), got %v (%T)", input, expected, expected, value, value)
+		}
+	}
+
+	if buf, err := MarshalParamYAML(math.Inf(-1)); err != nil || string(buf) != "-.inf\n" {
+		t.Fatalf("unexpected %q, %v", buf, err)
+	}
+	stamp := time.Date(1998, 7, 17, 14, 8, 55, 0, time.UTC)
+	if buf, err := MarshalParamYAML(map[string]interface{}{"stamp": stamp, "big": int64(1) << 40}); err != nil || string(buf) != "big: 1099511627776\nstamp: 1998-07-17T14:08:55Z\n" {
+		t.Fatalf("unexpected %q, %v", buf, err)
+	}
+	for _, input := range []string{"", "a: ~", "18446744073709551615"} {
+		if _, err := UnmarshalParamYAML([]byte(input)); err == nil {
+			t.Fatalf("%q: expected an error", input)
+		}
+	}
+}
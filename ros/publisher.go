@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -23,12 +24,45 @@ func (e *remoteSubscriberSessionError) Error() string {
 		e.session.callerID, e.session.topic, e.err)
 }
 
+// PublisherOption changes how a publisher made by Node.NewPublisherWithOptions behaves.
+type PublisherOption func(*publisherOptions)
+
+// WithConnectCallbacks calls connectCallback and disconnectCallback as subscribers connect and disconnect, as Node.NewPublisherWithCallbacks does.
+// Either may be nil.
+func WithConnectCallbacks(connectCallback, disconnectCallback func(SingleSubscriberPublisher)) PublisherOption {
+	return func(opts *publisherOptions) {
+		opts.connectCallback = connectCallback
+		opts.disconnectCallback = disconnectCallback
+	}
+}
+
+// WithPublisherPort makes a publisher listen for subscribers on port, rather than a port in its node's port range.
+func WithPublisherPort(port int) PublisherOption {
+	return func(opts *publisherOptions) {
+		opts.port = port
+	}
+}
+
+// publisherOptions holds the options a publisher was made with.
+type publisherOptions struct {
+	connectCallback    func(SingleSubscriberPublisher)
+	disconnectCallback func(SingleSubscriberPublisher)
+	port               int
+}
+
+// publication is a message to publish, and its serialization if it was needed.
+type publication struct {
+	msg   Message
+	bytes []byte
+}
+
 type defaultPublisher struct {
 	node               *defaultNode
 	topic              string
 	msgType            MessageType
-	msgChan            chan []byte
+	msgChan            chan publication
 	shutdownChan       chan struct{}
+	doneChan           chan struct{}
 	sesssionIDCount    int
 	sessions           map[int]*remoteSubscriberSession
 	sessionChan        chan *remoteSubscriberSession
@@ -37,29 +71,33 @@ type defaultPublisher struct {
 	listener           net.Listener
 	connectCallback    func(SingleSubscriberPublisher)
 	disconnectCallback func(SingleSubscriberPublisher)
+	numRemote          int32
+	numLocal           int32
+	localMutex         sync.Mutex
+	localSessions      []*localSubscriberSession
+	closed             bool
 }
 
-func newDefaultPublisher(node *defaultNode,
-	topic string, msgType MessageType,
-	connectCallback, disconnectCallback func(SingleSubscriberPublisher)) *defaultPublisher {
+func newDefaultPublisher(node *defaultNode, topic string, msgType MessageType, options publisherOptions) (*defaultPublisher, error) {
+	listener, err := node.listen(options.port)
+	if err != nil {
+		return nil, err
+	}
 	pub := new(defaultPublisher)
 	pub.node = node
 	pub.topic = topic
 	pub.msgType = msgType
 	pub.shutdownChan = make(chan struct{}, 10)
+	pub.doneChan = make(chan struct{})
 	pub.sessions = make(map[int]*remoteSubscriberSession)
-	pub.msgChan = make(chan []byte, 10)
+	pub.msgChan = make(chan publication, 10)
 	pub.listenerErrorChan = make(chan error, 10)
 	pub.sessionChan = make(chan *remoteSubscriberSession, 10)
 	pub.sessionErrorChan = make(chan error, 10)
-	pub.connectCallback = connectCallback
-	pub.disconnectCallback = disconnectCallback
-	if listener, err := listenRandomPort(node.listenIP, 10); err != nil {
-		panic(err)
-	} else {
-		pub.listener = listener
-	}
-	return pub
+	pub.connectCallback = options.connectCallback
+	pub.disconnectCallback = options.disconnectCallback
+	pub.listener = listener
+	return pub, nil
 }
 
 func (pub *defaultPublisher) start(wg *sync.WaitGroup) {
@@ -68,6 +106,7 @@ func (pub *defaultPublisher) start(wg *sync.WaitGroup) {
 	wg.Add(1)
 	defer func() {
 		log.Debug().Msg("defaultPublisher.start exit")
+		close(pub.doneChan)
 		wg.Done()
 	}()
 
@@ -77,18 +116,35 @@ func (pub *defaultPublisher) start(wg *sync.WaitGroup) {
 		log.Debug().Msg("defaultPublisher.start loop")
 		select {
 		case msg := <-pub.msgChan:
-			for _, s := range pub.sessions {
-				session := s
-				session.msgChan <- msg
+			serialized := msg.bytes != nil
+			if len(pub.sessions) > 0 && !serialized {
+				// A remote subscriber connected after the message was published.  If it can't be serialized, only local subscribers get it.
+				var buf bytes.Buffer
+				if err := msg.msg.Serialize(&buf); err != nil {
+					log.Error().Err(err).Str("topic", pub.topic).Msg("failed to serialize message")
+				} else {
+					msg.bytes, serialized = buf.Bytes(), true
+				}
+			}
+			if serialized {
+				for _, s := range pub.sessions {
+					session := s
+					session.msgChan <- msg.bytes
+				}
+			}
+			for _, session := range pub.liveLocalSessions(false) {
+				session.deliver(msg.msg)
 			}
 
 		case err := <-pub.listenerErrorChan:
 			log.Debug().Err(err).Msg("listener closed unexpectedly")
 			pub.listener.Close()
+			pub.liveLocalSessions(true)
 			return
 
 		case s := <-pub.sessionChan:
 			pub.sessions[s.id] = s
+			atomic.StoreInt32(&pub.numRemote, int32(len(pub.sessions)))
 			go s.start()
 
 		case err := <-pub.sessionErrorChan:
@@ -96,13 +152,14 @@ func (pub *defaultPublisher) start(wg *sync.WaitGroup) {
 			if sessionError, ok := err.(*remoteSubscriberSessionError); ok {
 				id := sessionError.session.id
 				delete(pub.sessions, id)
+				atomic.StoreInt32(&pub.numRemote, int32(len(pub.sessions)))
 			}
 
 		case <-pub.shutdownChan:
 			log.Debug().Msg("defaultPublisher.start Receive shutdownChan")
 			pub.listener.Close()
 			log.Debug().Msg("defaultPublisher.start closed listener")
-			_, err := callRosAPI(pub.node.xmlClient, pub.node.masterURI, "unregisterPublisher", pub.node.qualifiedName, pub.topic, pub.node.xmlrpcURI)
+			_, err := callRosAPI(pub.node.ctx, pub.node.xmlClient, pub.node.masterURI, "unregisterPublisher", pub.node.qualifiedName, pub.topic, pub.node.xmlrpcURI)
 			if err != nil {
 				log.Warn().Err(err).Msg("")
 			}
@@ -111,7 +168,8 @@ func (pub *defaultPublisher) start(wg *sync.WaitGroup) {
 				s.quitChan <- struct{}{}
 				delete(pub.sessions, id)
 			}
-			pub.shutdownChan <- struct{}{}
+			atomic.StoreInt32(&pub.numRemote, 0)
+			pub.liveLocalSessions(true)
 			return
 		}
 	}
@@ -143,29 +201,36 @@ func (pub *defaultPublisher) listenRemoteSubscriber() {
 	}
 }
 
+// TryPublish publishes msg, returning an error if it couldn't be serialized.  Subscribers in this process which are connected directly are passed msg
+// itself, so it mustn't be changed once it's published; it's only serialized if there are remote subscribers, or no subscribers in this process.  If a
+// remote subscriber connects before an unserialized message is sent and it then fails to serialize, the error is logged and only subscribers in this
+// process get it.
 func (pub *defaultPublisher) TryPublish(msg Message) error {
+	if atomic.LoadInt32(&pub.numRemote) == 0 && atomic.LoadInt32(&pub.numLocal) > 0 {
+		pub.msgChan <- publication{msg: msg}
+		return nil
+	}
 	var buf bytes.Buffer
 	err := msg.Serialize(&buf)
 	if err != nil {
 		return errors.Wrap(err, "failed to serialize message:")
 	}
-	pub.msgChan <- buf.Bytes()
+	pub.msgChan <- publication{msg: msg, bytes: buf.Bytes()}
 	return nil
 }
 
 func (pub *defaultPublisher) Publish(msg Message) {
-	var buf bytes.Buffer
-	_ = msg.Serialize(&buf)
-	pub.msgChan <- buf.Bytes()
+	_ = pub.TryPublish(msg)
 }
 
 func (pub *defaultPublisher) GetNumSubscribers() int {
-	return len(pub.sessions)
+	return int(atomic.LoadInt32(&pub.numRemote) + atomic.LoadInt32(&pub.numLocal))
 }
 
 func (pub *defaultPublisher) Shutdown() {
 	pub.shutdownChan <- struct{}{}
-	<-pub.shutdownChan
+	// Waiting on shutdownChan itself could take back the request before the publisher saw it.
+	<-pub.doneChan
 }
 
 func (pub *defaultPublisher) hostAndPort() (string, string, error) {
@@ -287,7 +352,10 @@ func (session *remoteSubscriberSession) start() {
 	}
 
 	if headerMap["md5sum"] != session.md5sum && headerMap["md5sum"] != "*" {
-		session.log.Error().Str("topic", session.topic).Str("session-md5", session.md5sum).Str("header-md5", headerMap["md5sum"]).Msg("incompatible message md5: does not match for topic")
+		// Say how the definitions differ, if the subscriber sent its own, so that the out of date side can be found.
+		differences := describeMessageTypeMismatch(session.typeName, session.typeText, headerMap["type"], headerMap["message_definition"])
+		session.log.Error().Str("topic", session.topic).Str("session-md5", session.md5sum).Str("header-md5", headerMap["md5sum"]).Strs("differences", differences).
+			Str("session-definition", session.typeText).Str("header-definition", headerMap["message_definition"]).Msg("incompatible message md5: does not match for topic")
 		return
 	}
 	session.callerID = headerMap["callerid"]
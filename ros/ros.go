@@ -1,12 +1,14 @@
 package ros
 
 import (
+	goContext "context"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
-//Node interface which contains functions of a ROS Node
+//Node interface which contains functions of a ROS Node.  Any number of nodes may run in one process, each with its own name resolver, slave API,
+//publishers, subscribers and services, and each shut down on its own; dynamic message types are looked up in a context they share.
 type Node interface {
 	NewPublisher(topic string, msgType MessageType) (Publisher, error)
 	// Create a publisher which gives you callbacks when subscribers
@@ -16,6 +18,9 @@ type Node interface {
 	NewPublisherWithCallbacks(topic string,
 		msgType MessageType,
 		connectCallback, disconnectCallback func(SingleSubscriberPublisher)) (Publisher, error)
+	// Options only take effect when the node first publishes the
+	// topic; later publishers of it share the first one's listener.
+	NewPublisherWithOptions(topic string, msgType MessageType, opts ...PublisherOption) (Publisher, error)
 	// callback should be a function which takes 0, 1, or 2 arguments.
 	// If it takes 0 arguments, it will simply be called without the
 	// message.  1-argument functions are the normal case, and the
@@ -25,8 +30,12 @@ type Node interface {
 	// type MessageEvent.
 	NewSubscriber(topic string, msgType MessageType, callback interface{}) (Subscriber, error)
 	NewSubscriberWithFlowControl(topic string, msgType MessageType, enable chan bool, callback interface{}) (Subscriber, error)
+	// Options only take effect when the node first subscribes to the
+	// topic; later subscribers to it share the first one's connections.
+	NewSubscriberWithOptions(topic string, msgType MessageType, callback interface{}, opts ...SubscriberOption) (Subscriber, error)
 	NewServiceClient(service string, srvType ServiceType) ServiceClient
 	NewServiceServer(service string, srvType ServiceType, callback interface{}) ServiceServer
+	NewServiceServerWithOptions(service string, srvType ServiceType, callback interface{}, opts ...ServiceServerOption) (ServiceServer, error)
 
 	RemoveSubscriber(topic string)
 	RemovePublisher(topic string)
@@ -37,12 +46,32 @@ type Node interface {
 	Shutdown()
 	Namespace() string
 	QualifiedName() string
+	// MasterURI returns the URI of the master the node registers with.
+	MasterURI() string
 
 	GetParam(name string) (interface{}, error)
 	SetParam(name string, value interface{}) error
 	HasParam(name string) (bool, error)
 	SearchParam(name string) (string, error)
 	DeleteParam(name string) error
+	// LoadParams sets the parameters in a YAML file within a namespace,
+	// as rosparam load does: nested maps are set one entry at a time,
+	// leaving other parameters in them alone.
+	LoadParams(file string, namespace string) error
+	// GetParamInt and the other typed accessors return a parameter's value,
+	// or defaultValue if it isn't set; a value of the wrong type is an error.
+	// Whole numbers may be read as ints or floats.
+	GetParamInt(name string, defaultValue int) (int, error)
+	GetParamFloat(name string, defaultValue float64) (float64, error)
+	GetParamString(name string, defaultValue string) (string, error)
+	GetParamBool(name string, defaultValue bool) (bool, error)
+	GetParamStrings(name string, defaultValue []string) ([]string, error)
+	GetParamMap(name string, defaultValue map[string]interface{}) (map[string]interface{}, error)
+	// BindParams fills in the fields of the struct out points to from the
+	// parameters under prefix, by their `rosparam:"name"` tags.  Every
+	// missing or wrongly typed parameter is listed in a ParamBindError;
+	// fields tagged `rosparam:"name,optional"` may be missing.
+	BindParams(prefix string, out interface{}) error
 
 	GetSystemState() ([]interface{}, error)
 	GetServiceList() ([]string, error)
@@ -51,6 +80,16 @@ type Node interface {
 	GetPublishedTopics(subgraph string) (map[string]string, error)
 	GetTopicTypes() []interface{}
 
+	// SetMasterCallbacks sets the functions called, from Spin or SpinOnce,
+	// when the node loses contact with its master, and when it has
+	// registered its publishers, subscribers and services again with the
+	// master or a restarted one.  Either may be nil.  They're only called
+	// if the node watches its master; see WithMasterWatchdog.
+	SetMasterCallbacks(lost func(), restored func())
+
+	// Now returns the current time from the node's clock.
+	Now() Time
+
 	Logger() zerolog.Logger
 
 	NonRosArgs() []string
@@ -58,17 +97,30 @@ type Node interface {
 }
 
 //NewNode instantiates a newDefaultNode with name and arguments
-func NewNode(name string, args []string) (Node, error) {
-	return newDefaultNode(name, args)
+func NewNode(name string, args []string, opts ...NodeOption) (Node, error) {
+	return newDefaultNode(name, append([]NodeOption{WithArgs(args)}, opts...)...)
 }
 
 //NewNodeWithLogs instantiates a newDefaultNode with a provided log
-func NewNodeWithLogs(name string, log zerolog.Logger, args []string) (Node, error) {
-	return newDefaultNodeWithLogs(name, log, args)
+func NewNodeWithLogs(name string, log zerolog.Logger, args []string, opts ...NodeOption) (Node, error) {
+	return newDefaultNodeWithLogs(name, log, append([]NodeOption{WithArgs(args)}, opts...)...)
+}
+
+//NewNodeWithContext instantiates a newDefaultNode with a provided log, whose master and slave API calls are abandoned once ctx is done.  ctx bounds
+//the node's startup, and its shutdown if it's cancelled before Shutdown is called.
+func NewNodeWithContext(ctx goContext.Context, name string, log zerolog.Logger, args []string, opts ...NodeOption) (Node, error) {
+	return newDefaultNodeWithLogs(name, log, append([]NodeOption{WithArgs(args), WithContext(ctx)}, opts...)...)
+}
+
+//NewNodeWithOptions instantiates a newDefaultNode configured by options alone; command-line arguments are only used if given by WithArgs
+func NewNodeWithOptions(name string, opts ...NodeOption) (Node, error) {
+	return newDefaultNode(name, opts...)
 }
 
 //Publisher is interface for publisher and shutdown function
 type Publisher interface {
+	// Subscribers in the same process may be passed the message itself, as
+	// WithIntraProcess describes, so it mustn't be changed once published.
 	TryPublish(msg Message) error
 	Publish(msg Message)
 	GetNumSubscribers() int
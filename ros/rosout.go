@@ -0,0 +1,300 @@
+package ros
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Levels of rosgraph_msgs/Log messages.
+const (
+	LogDebug uint8 = 1
+	LogInfo  uint8 = 2
+	LogWarn  uint8 = 4
+	LogError uint8 = 8
+	LogFatal uint8 = 16
+)
+
+// RosoutTopic is the topic nodes publish their log messages to.
+const RosoutTopic = "/rosout"
+
+// nodeLogging publishes a node's log messages to /rosout, if they're at or above a level which can be changed while it runs.
+type nodeLogging struct {
+	node    *defaultNode
+	level   int32
+	logType *DynamicMessageType
+	pub     Publisher
+	seq     uint32
+	logChan chan *DynamicMessage
+}
+
+// rosoutHook publishes log messages to /rosout, and keeps those below the level of the logger it was added to from its output.
+type rosoutHook struct {
+	logging *nodeLogging
+	level   zerolog.Level
+}
+
+// rosgraphLogDefinition is the full definition of rosgraph_msgs/Log, so that nodes can publish it without a ROS install.
+var rosgraphLogDefinition = strings.Join([]string{
+	"byte DEBUG=1",
+	"byte INFO=2",
+	"byte WARN=4",
+	"byte ERROR=8",
+	"byte FATAL=16",
+	"Header header",
+	"byte level",
+	"string name",
+	"string msg",
+	"string file",
+	"string function",
+	"uint32 line",
+	"string[] topics",
+	"================================================================================",
+	"MSG: std_msgs/Header",
+	"uint32 seq",
+	"time stamp",
+	"string frame_id",
+}, "\n")
+
+var (
+	// rosoutTypes holds the types of the messages and services for logging, which are made once.
+	rosoutTypesOnce    sync.Once
+	rosoutTypesErr     error
+	logType            *DynamicMessageType
+	getLoggersType     *DynamicServiceType
+	setLoggerLevelType *DynamicServiceType
+)
+
+// rosLevels maps the names of roscpp's logger levels to zerolog levels.
+var rosLevels = map[string]zerolog.Level{
+	"debug": zerolog.DebugLevel,
+	"info":  zerolog.InfoLevel,
+	"warn":  zerolog.WarnLevel,
+	"error": zerolog.ErrorLevel,
+	"fatal": zerolog.FatalLevel,
+}
+
+// nodeLoggerName is the name get_loggers and set_logger_level know a node's logger by.
+const nodeLoggerName = "ros"
+
+// rosoutLevel is the level messages are published to /rosout at until set_logger_level changes it, as with roscpp.
+const rosoutLevel = zerolog.InfoLevel
+
+// loadRosoutTypes makes the types of rosgraph_msgs/Log and of the roscpp logger services.
+func loadRosoutTypes() error {
+	rosoutTypesOnce.Do(func() {
+		if logType, rosoutTypesErr = NewDynamicMessageTypeFromDefinition("rosgraph_msgs/Log", rosgraphLogDefinition); rosoutTypesErr != nil {
+			return
+		}
+		loggerText := map[string]string{"roscpp/Logger": "string name\nstring level"}
+		if getLoggersType, rosoutTypesErr = newDynamicServiceTypeFromText("roscpp/GetLoggers", "---\nLogger[] loggers", loggerText); rosoutTypesErr != nil {
+			return
+		}
+		setLoggerLevelType, rosoutTypesErr = newDynamicServiceTypeFromText("roscpp/SetLoggerLevel", "string logger\nstring level\n---", nil)
+	})
+	return rosoutTypesErr
+}
+
+// rosLogLevel maps a zerolog level to the level of a rosgraph_msgs/Log message.
+func rosLogLevel(level zerolog.Level) uint8 {
+	switch {
+	case level <= zerolog.DebugLevel:
+		return LogDebug
+	case level == zerolog.InfoLevel:
+		return LogInfo
+	case level == zerolog.WarnLevel:
+		return LogWarn
+	case level == zerolog.ErrorLevel:
+		return LogError
+	default:
+		return LogFatal
+	}
+}
+
+// rosLevelName returns the roscpp name of a zerolog level.
+func rosLevelName(level zerolog.Level) string {
+	switch rosLogLevel(level) {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	}
+	return "fatal"
+}
+
+// logCaller returns the file, function and line which logged a message: the first caller outside zerolog and this file.
+func logCaller() (string, string, int) {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.Contains(frame.Function, "github.com/rs/zerolog") && !strings.HasSuffix(frame.File, "/ros/rosout.go") {
+			return frame.File, frame.Function, frame.Line
+		}
+		if !more {
+			return "", "", 0
+		}
+	}
+}
+
+// Run queues events at or above the /rosout level to be published, and discards those below the level of the logger; required for zerolog.Hook.
+func (h rosoutHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if !e.Enabled() || level == zerolog.NoLevel {
+		return
+	}
+	if level >= h.logging.Level() {
+		h.logging.publish(level, msg)
+	}
+	if level < h.level {
+		e.Discard()
+	}
+}
+
+// Level returns the level below which the node's log messages aren't published.
+func (l *nodeLogging) Level() zerolog.Level {
+	return zerolog.Level(atomic.LoadInt32(&l.level))
+}
+
+// SetLevel sets the level below which the node's log messages aren't published.
+func (l *nodeLogging) SetLevel(level zerolog.Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// logger returns log with messages at or above the /rosout level published.  zerolog drops messages below a logger's level before any hook sees them,
+// so the logger returned logs down to the lower of the two levels, and the hook keeps what's below the level of log out of its output.
+func (l *nodeLogging) logger(log zerolog.Logger) zerolog.Logger {
+	hook := rosoutHook{logging: l, level: log.GetLevel()}
+	if level := l.Level(); level < hook.level {
+		log = log.Level(level)
+	}
+	return log.Hook(hook)
+}
+
+// publish queues a log message for /rosout; messages are dropped rather than hold up the caller if the queue is full.
+func (l *nodeLogging) publish(level zerolog.Level, text string) {
+	file, function, line := logCaller()
+	msg := l.logType.NewMessage().(*DynamicMessage)
+	fields := map[string]interface{}{
+		"header.seq":   atomic.AddUint32(&l.seq, 1),
+		"header.stamp": l.node.Now(),
+		"level":        rosLogLevel(level),
+		"name":         l.node.qualifiedName,
+		"msg":          text,
+		"file":         file,
+		"function":     function,
+		"line":         line,
+		"topics":       l.node.publishedTopics(),
+	}
+	for path, value := range fields {
+		if err := msg.Set(path, value); err != nil {
+			return
+		}
+	}
+	select {
+	case l.logChan <- msg:
+	default:
+	}
+}
+
+// run publishes queued log messages until the node shuts down.
+func (l *nodeLogging) run() {
+	for {
+		select {
+		case msg := <-l.logChan:
+			l.pub.Publish(msg)
+		case <-l.node.ctx.Done():
+			return
+		}
+	}
+}
+
+// getLoggers answers the get_loggers service with the level of the node's logger on /rosout; the level of its own output isn't reported.
+func (l *nodeLogging) getLoggers(srv *DynamicService) error {
+	logger := map[string]interface{}{"name": nodeLoggerName, "level": rosLevelName(l.Level())}
+	return srv.Response.(*DynamicMessage).Set("loggers", []interface{}{logger})
+}
+
+// setLoggerLevel answers the set_logger_level service.  Unlike roscpp's, it only changes which messages are published to /rosout: the level of the
+// node's own output stays as WithLogger or __ll set it.
+func (l *nodeLogging) setLoggerLevel(srv *DynamicService) error {
+	data := srv.Request.(*DynamicMessage).Data()
+	name, _ := data["logger"].(string)
+	levelName, _ := data["level"].(string)
+	if name != nodeLoggerName {
+		return fmt.Errorf("no logger named %q", name)
+	}
+	level, ok := rosLevels[strings.ToLower(levelName)]
+	if !ok {
+		return fmt.Errorf("no logger level named %q", levelName)
+	}
+	l.SetLevel(level)
+	l.node.log.Info().Str("level", levelName).Msg("logger level changed")
+	return nil
+}
+
+// startLogging publishes messages logged through the node's Logger to /rosout, at or above a level which the set_logger_level service can change, and
+// serves the get_loggers and set_logger_level services.  Messages the node logs itself aren't published, so that publishing can't log more messages.
+// Nothing is published unless all of it can be set up.
+func (node *defaultNode) startLogging() error {
+	if err := loadRosoutTypes(); err != nil {
+		return errors.Wrap(err, "rosout")
+	}
+	logging := &nodeLogging{
+		node:    node,
+		level:   int32(rosoutLevel),
+		logType: logType,
+		logChan: make(chan *DynamicMessage, 100),
+	}
+
+	pub, err := node.NewPublisher(RosoutTopic, logType)
+	if err != nil {
+		return errors.Wrap(err, "topic: "+RosoutTopic)
+	}
+	logging.pub = pub
+	if _, err := node.NewServiceServerWithOptions("~get_loggers", getLoggersType, logging.getLoggers); err != nil {
+		node.RemovePublisher(RosoutTopic)
+		return err
+	}
+	if _, err := node.NewServiceServerWithOptions("~set_logger_level", setLoggerLevelType, logging.setLoggerLevel); err != nil {
+		node.RemovePublisher(RosoutTopic)
+		node.removeServiceServer("~get_loggers")
+		return err
+	}
+
+	node.logging = logging
+	go logging.run()
+	return nil
+}
+
+// removeServiceServer shuts down and deletes a service server, if the node has one.
+func (node *defaultNode) removeServiceServer(service string) {
+	node.serversMutex.Lock()
+	defer node.serversMutex.Unlock()
+	name := node.nameResolver.remap(service)
+	if server, ok := node.servers[name]; ok {
+		server.Shutdown()
+		delete(node.servers, name)
+	}
+}
+
+// publishedTopics returns the topics the node publishes, in order.
+func (node *defaultNode) publishedTopics() []string {
+	node.publishersMutex.RLock()
+	defer node.publishersMutex.RUnlock()
+	topics := make([]string, 0, len(node.publishers))
+	for topic := range node.publishers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
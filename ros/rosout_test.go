@@ -0,0 +1,214 @@
+package ros
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRosoutTypes(t *testing.T) {
+	if err := loadRosoutTypes(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name, md5sum, expected string
+	}{
+		{"rosgraph_msgs/Log", logType.MD5Sum(), "acffd30cd6b6de30f120938c17c593fb"},
+		{"roscpp/GetLoggers", getLoggersType.MD5Sum(), "32e97e85527d4678a8f9279894bb64b0"},
+		{"roscpp/SetLoggerLevel", setLoggerLevelType.MD5Sum(), "51da076440d78ca1684d36c868df61ea"},
+	} {
+		if c.md5sum != c.expected {
+			t.Errorf("%s: expected md5sum %s, got %s", c.name, c.expected, c.md5sum)
+		}
+	}
+}
+
+func TestRosout(t *testing.T) {
+	writeTestPackage(t)
+	master := newFakeMaster()
+	defer master.server.Close()
+
+	newNode := func(name string, opts ...NodeOption) Node {
+		opts = append([]NodeOption{WithMasterURI(master.server.URL), WithHostname("localhost"), WithSignalHandling(false)}, opts...)
+		node, err := NewNodeWithOptions(name, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for node.OK() {
+				node.SpinOnce()
+			}
+		}()
+		return node
+	}
+	talker := newNode("talker", WithRosout(true), WithLogger(zerolog.New(io.Discard).Level(zerolog.InfoLevel)))
+	defer talker.Shutdown()
+	listener := newNode("listener")
+	defer listener.Shutdown()
+
+	statusType, err := NewDynamicMessageType("rosgo_test_msgs/Status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := talker.NewPublisher("status", statusType); err != nil {
+		t.Fatal(err)
+	}
+	logChan := make(chan *DynamicMessage, 100)
+	if _, err := listener.NewSubscriber(RosoutTopic, logType, func(msg *DynamicMessage) { logChan <- msg }); err != nil {
+		t.Fatal(err)
+	}
+
+	// receive logs text at the given level until it arrives on /rosout, and returns every message which arrived.
+	receive := func(log func(text string), text string) []*DynamicMessage {
+		var received []*DynamicMessage
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			log(text)
+			time.Sleep(20 * time.Millisecond)
+			for len(logChan) > 0 {
+				msg := <-logChan
+				received = append(received, msg)
+				if msg.Data()["msg"] == text {
+					return received
+				}
+			}
+		}
+		t.Fatalf("%q never arrived on %s", text, RosoutTopic)
+		return nil
+	}
+	logger := talker.Logger()
+	received := receive(func(text string) { logger.Info().Msg(text) }, "hello")
+	msg := received[len(received)-1].Data()
+	if msg["level"] != LogInfo || msg["name"] != "/talker" || msg["line"] == uint32(0) {
+		t.Errorf("unexpected log message %v", msg)
+	}
+	if !strings.HasSuffix(msg["file"].(string), "rosout_test.go") || !strings.Contains(msg["function"].(string), "TestRosout") {
+		t.Errorf("unexpected caller %v %v", msg["file"], msg["function"])
+	}
+	if topics, ok := msg["topics"].([]string); !ok || strings.Join(topics, ",") != RosoutTopic+",/status" {
+		t.Errorf("unexpected topics %v", msg["topics"])
+	}
+
+	// Debug messages are discarded until the level is lowered.
+	call := func(srvType *DynamicServiceType, service string, request map[string]interface{}) (*DynamicService, error) {
+		srv := srvType.NewService().(*DynamicService)
+		for k, v := range request {
+			srv.Request.(*DynamicMessage).Data()[k] = v
+		}
+		return srv, listener.NewServiceClient(service, srvType).Call(srv)
+	}
+	if _, err := call(setLoggerLevelType, "/talker/set_logger_level", map[string]interface{}{"logger": nodeLoggerName, "level": "DEBUG"}); err != nil {
+		t.Fatal(err)
+	}
+	// A logger taken before the level was lowered still logs no lower than it did then.
+	logger = talker.Logger()
+	for _, msg := range receive(func(text string) { logger.Debug().Msg(text) }, "debug") {
+		if msg.Data()["level"] != LogDebug {
+			t.Errorf("unexpected log message %v", msg.Data())
+		}
+	}
+	srv, err := call(getLoggersType, "/talker/get_loggers", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loggers := srv.Response.(*DynamicMessage).Data()["loggers"].([]Message)
+	if len(loggers) != 1 || loggers[0].(*DynamicMessage).Data()["level"] != "debug" {
+		t.Errorf("unexpected loggers %v", loggers)
+	}
+
+	// Raising the level discards info messages again.
+	if _, err := call(setLoggerLevelType, "/talker/set_logger_level", map[string]interface{}{"logger": nodeLoggerName, "level": "warn"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range receive(func(text string) {
+		logger.Info().Msg("discarded")
+		logger.Warn().Msg(text)
+	}, "warning") {
+		if msg.Data()["msg"] == "discarded" {
+			t.Error("info message published below the logger level")
+		}
+	}
+	if _, err := call(setLoggerLevelType, "/talker/set_logger_level", map[string]interface{}{"logger": "other", "level": "info"}); err == nil {
+		t.Error("expected an error setting the level of an unknown logger")
+	}
+	if _, err := call(setLoggerLevelType, "/talker/set_logger_level", map[string]interface{}{"logger": nodeLoggerName, "level": "verbose"}); err == nil {
+		t.Error("expected an error setting an unknown level")
+	}
+}
+
+func TestRosoutDefaultLogger(t *testing.T) {
+	master := newFakeMaster()
+	defer master.server.Close()
+	newNode := func(name string, opts ...NodeOption) Node {
+		opts = append([]NodeOption{WithMasterURI(master.server.URL), WithHostname("localhost"), WithSignalHandling(false)}, opts...)
+		node, err := NewNodeWithOptions(name, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return node
+	}
+	listener := newNode("listener")
+	defer listener.Shutdown()
+	logChan := make(chan *DynamicMessage, 100)
+	if _, err := listener.NewSubscriber(RosoutTopic, logType, func(msg *DynamicMessage) { logChan <- msg }); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	for name, opts := range map[string][]NodeOption{
+		"default": {WithRosout(true)},
+		"quiet":   {WithRosout(true), WithLogger(zerolog.New(&output).Level(zerolog.FatalLevel))},
+	} {
+		talker := newNode(name, opts...)
+
+		// Info messages are published however quiet the logger's own output is, and debug messages aren't built at all.
+		logger := talker.Logger()
+		if logger.GetLevel() != zerolog.InfoLevel {
+			t.Fatalf("%s: expected the logger to log from info, got %v", name, logger.GetLevel())
+		}
+		var msg *DynamicMessage
+		deadline := time.Now().Add(5 * time.Second)
+		for msg == nil && time.Now().Before(deadline) {
+			logger.Debug().Msg("debug")
+			logger.Info().Msg("info")
+			listener.SpinOnce()
+			for len(logChan) > 0 {
+				if received := <-logChan; received.Data()["name"] == "/"+name {
+					msg = received
+				}
+			}
+		}
+		talker.Shutdown()
+		if msg == nil || msg.Data()["msg"] != "info" || msg.Data()["level"] != LogInfo {
+			t.Fatalf("%s: expected an info message on %s, got %v", name, RosoutTopic, msg)
+		}
+	}
+	if output.Len() != 0 {
+		t.Fatalf("expected nothing below fatal in the logger's output, got %q", output.String())
+	}
+}
+
+func TestRosoutSetupFailure(t *testing.T) {
+	master := newFakeMaster()
+	defer master.server.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	// The slave API and /rosout take both ports, leaving none for the services.
+	if _, err := NewNodeWithOptions("cramped", WithMasterURI(master.server.URL), WithHostname("localhost"), WithSignalHandling(false),
+		WithPortRange(port, port+1), WithRosout(true)); err == nil {
+		t.Fatal("expected an error starting a node without ports for its services")
+	}
+	if master.registered(master.publishers, RosoutTopic) != 0 {
+		t.Fatalf("expected %s to be unregistered", RosoutTopic)
+	}
+}
@@ -2,6 +2,7 @@ package ros
 
 import (
 	"bytes"
+	goContext "context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -27,9 +28,10 @@ type defaultServiceClient struct {
 	masterURI string
 	nodeID    string
 	xmlClient *xmlrpc.XMLClient
+	ctx       goContext.Context
 }
 
-func newDefaultServiceClient(log zerolog.Logger, nodeID string, masterURI string, service string, srvType ServiceType) *defaultServiceClient {
+func newDefaultServiceClient(ctx goContext.Context, log zerolog.Logger, nodeID string, masterURI string, service string, srvType ServiceType) *defaultServiceClient {
 	client := new(defaultServiceClient)
 	client.logger = log
 	client.service = service
@@ -38,12 +40,13 @@ func newDefaultServiceClient(log zerolog.Logger, nodeID string, masterURI string
 	client.nodeID = nodeID
 	client.xmlClient = xmlrpc.NewXMLClient()
 	client.xmlClient.Timeout = masterAPITimeout
+	client.ctx = ctx
 	return client
 }
 
 func (c *defaultServiceClient) Call(srv Service) error {
 
-	result, err := callRosAPI(c.xmlClient, c.masterURI, "lookupService", c.nodeID, c.service)
+	result, err := callRosAPI(c.ctx, c.xmlClient, c.masterURI, "lookupService", c.nodeID, c.service)
 	if err != nil {
 		return err
 	}
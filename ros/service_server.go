@@ -9,6 +9,8 @@ import (
 	"net"
 	"reflect"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 type serviceResult struct {
@@ -21,6 +23,21 @@ type remoteClientSessionCloseEvent struct {
 	err     error
 }
 
+// ServiceServerOption changes how a service server made by Node.NewServiceServerWithOptions behaves.
+type ServiceServerOption func(*serviceServerOptions)
+
+// WithServicePort makes a service server listen for clients on port, rather than a port in its node's port range.
+func WithServicePort(port int) ServiceServerOption {
+	return func(opts *serviceServerOptions) {
+		opts.port = port
+	}
+}
+
+// serviceServerOptions holds the options a service server was made with.
+type serviceServerOptions struct {
+	port int
+}
+
 type defaultServiceServer struct {
 	node             *defaultNode
 	service          string
@@ -33,18 +50,19 @@ type defaultServiceServer struct {
 	sessionCloseChan chan *remoteClientSessionCloseEvent
 }
 
-func newDefaultServiceServer(node *defaultNode, service string, srvType ServiceType, handler interface{}) *defaultServiceServer {
+func newDefaultServiceServer(node *defaultNode, service string, srvType ServiceType, handler interface{}, options serviceServerOptions) (*defaultServiceServer, error) {
 	logger := node.log
 	server := new(defaultServiceServer)
-	if listener, err := listenRandomPort(node.listenIP, 10); err != nil {
+	if listener, err := node.listen(options.port); err != nil {
 		logger.Error().Err(err).Msg("failed to listen to random port")
-		return nil
+		return nil, err
 	} else {
 		if tcpListener, ok := listener.(*net.TCPListener); ok {
 			server.listener = tcpListener
 		} else {
 			logger.Error().Msg("server listener is not TCPListener")
-			return nil
+			listener.Close()
+			return nil, errors.New("server listener is not TCPListener")
 		}
 	}
 	server.node = node
@@ -54,26 +72,27 @@ func newDefaultServiceServer(node *defaultNode, service string, srvType ServiceT
 	server.sessions = list.New()
 	server.shutdownChan = make(chan struct{}, 10)
 	server.sessionCloseChan = make(chan *remoteClientSessionCloseEvent, 10)
-	_, port, err := net.SplitHostPort(server.listener.Addr().String())
+	var err error
+	server.rosrpcAddr, err = node.endpointURI("rosrpc", server.listener)
 	if err != nil {
 		// Not reached
 		logger.Error().Err(err).Msg("failed to split host port")
-		return nil
+		server.listener.Close()
+		return nil, err
 	}
-	server.rosrpcAddr = fmt.Sprintf("rosrpc://%s:%s", node.hostname, port)
 	logger.Debug().Str("address", server.rosrpcAddr).Msg("ServiceServer listen")
-	_, err = callRosAPI(node.xmlClient, node.masterURI, "registerService",
+	_, err = callRosAPI(node.ctx, node.xmlClient, node.masterURI, "registerService",
 		node.qualifiedName,
 		service,
 		server.rosrpcAddr,
 		node.xmlrpcURI)
-	if err != nil {
+	if err != nil && !node.queueRegistration(err) {
 		logger.Error().Str("service", service).Msg("failed to register service")
 		server.listener.Close()
-		return nil
+		return nil, err
 	}
 	go server.start()
-	return server
+	return server, nil
 }
 
 func (s *defaultServiceServer) Shutdown() {
@@ -123,7 +142,7 @@ func (s *defaultServiceServer) start() {
 			logger.Debug().Msg("defaultServiceServer.start Receive shutdownChan")
 			s.listener.Close()
 			logger.Debug().Msg("defaultServiceServer.start closed listener")
-			_, err := callRosAPI(s.node.xmlClient, s.node.masterURI, "unregisterService",
+			_, err := callRosAPI(s.node.ctx, s.node.xmlClient, s.node.masterURI, "unregisterService",
 				s.node.qualifiedName, s.service, s.rosrpcAddr)
 			if err != nil {
 				logger.Warn().Str("service", s.service).Err(err).Msg("failed unregisterService")
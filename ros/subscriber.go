@@ -4,6 +4,7 @@ import (
 	"bytes"
 	goContext "context"
 	"fmt"
+	"net"
 	"reflect"
 	"sync"
 
@@ -15,6 +16,32 @@ import (
 type messageEvent struct {
 	bytes []byte
 	event MessageEvent
+	// msg is set, rather than bytes, when a publisher in this process passes its message on directly.
+	msg Message
+}
+
+// SubscriberOption changes how a subscriber made by Node.NewSubscriberWithOptions behaves.
+type SubscriberOption func(*subscriberOptions)
+
+// WithFlowControl passes messages to the callback only while the last value sent on enable was true, as Node.NewSubscriberWithFlowControl does.
+func WithFlowControl(enable chan bool) SubscriberOption {
+	return func(opts *subscriberOptions) {
+		opts.enableChan = enable
+	}
+}
+
+// WithMessageMigrator accepts publishers of older definitions of the message type, as long as migrator can migrate them to it, and migrates their messages
+// before they're passed to the callback.  The message type must be a *DynamicMessageType.
+func WithMessageMigrator(migrator *MessageMigrator) SubscriberOption {
+	return func(opts *subscriberOptions) {
+		opts.migrator = migrator
+	}
+}
+
+// subscriberOptions holds the options a subscriber was made with.
+type subscriberOptions struct {
+	enableChan chan bool
+	migrator   *MessageMigrator
 }
 
 type subscriptionChannels struct {
@@ -34,12 +61,13 @@ type SubscriberRosAPI struct {
 	nodeAPIURI string
 	masterURI  string
 	xmlClient  *xmlrpc.XMLClient
+	ctx        goContext.Context
 }
 
 // RequestTopicURI requests the URI of a given topic from a publisher.
 func (a *SubscriberRosAPI) RequestTopicURI(pub string) (string, error) {
 	protocols := []interface{}{[]interface{}{"TCPROS"}}
-	result, err := callRosAPI(a.xmlClient, pub, "requestTopic", a.nodeID, a.topic, protocols)
+	result, err := callRosAPI(a.ctx, a.xmlClient, pub, "requestTopic", a.nodeID, a.topic, protocols)
 
 	if err != nil {
 		return "", err
@@ -65,13 +93,13 @@ func (a *SubscriberRosAPI) RequestTopicURI(pub string) (string, error) {
 		return "", errors.New("failed to extract port from requestTopic result")
 	}
 
-	uri := fmt.Sprintf("%s:%d", addr, port)
+	uri := net.JoinHostPort(addr, fmt.Sprint(port))
 	return uri, nil
 }
 
 // Unregister removes a subscriber from a topic.
 func (a *SubscriberRosAPI) Unregister() error {
-	_, err := callRosAPI(a.xmlClient, a.masterURI, "unregisterSubscriber", a.nodeID, a.topic, a.nodeAPIURI)
+	_, err := callRosAPI(a.ctx, a.xmlClient, a.masterURI, "unregisterSubscriber", a.nodeID, a.topic, a.nodeAPIURI)
 	return err
 }
 
@@ -100,6 +128,10 @@ type defaultSubscriber struct {
 	cancel           map[string]goContext.CancelFunc
 	uri2pub          map[string]string
 	disconnectedChan chan string
+	migrator         *MessageMigrator
+	intraProcess     bool
+	// localConnector connects the subscriber directly to a publisher in this process, if it can; nil if it can't.
+	localConnector func(ctx goContext.Context, pubURI string) bool
 }
 
 func newDefaultSubscriber(topic string, msgType MessageType, callback interface{}) *defaultSubscriber {
@@ -115,8 +147,8 @@ func newDefaultSubscriber(topic string, msgType MessageType, callback interface{
 	return sub
 }
 
-func (sub *defaultSubscriber) start(wg *sync.WaitGroup, nodeID string, nodeAPIURI string, masterURI string, jobChan chan func(), enableChan chan bool, log zerolog.Logger) {
-	ctx, cancel := goContext.WithCancel(goContext.Background())
+func (sub *defaultSubscriber) start(nodeCtx goContext.Context, wg *sync.WaitGroup, nodeID string, nodeAPIURI string, masterURI string, jobChan chan func(), enableChan chan bool, log zerolog.Logger) {
+	ctx, cancel := goContext.WithCancel(nodeCtx)
 	defer cancel()
 
 	log.Debug().Str("topic", sub.topic).Msg("subscriber goroutine for topic started")
@@ -133,13 +165,20 @@ func (sub *defaultSubscriber) start(wg *sync.WaitGroup, nodeID string, nodeAPIUR
 		nodeID:     nodeID,
 		masterURI:  masterURI,
 		nodeAPIURI: nodeAPIURI,
+		ctx:        nodeCtx,
 	}
 	rosAPI.xmlClient = xmlrpc.NewXMLClient()
 	rosAPI.xmlClient.Timeout = masterAPITimeout
 
 	// Decouples the implementation details of starting a subscription from the run loop.
 	startSubscription := func(ctx goContext.Context, pubURI string, log zerolog.Logger) {
-		startRemotePublisherConn(ctx, &TCPRosNetDialer{}, pubURI, sub.topic, sub.msgType, nodeID, sub.msgChan, sub.disconnectedChan, log)
+		startRemotePublisherConn(ctx, &TCPRosNetDialer{}, pubURI, sub.topic, sub.msgType, sub.migrator, nodeID, sub.msgChan, sub.disconnectedChan, log)
+	}
+
+	if sub.intraProcess {
+		sub.localConnector = func(ctx goContext.Context, pubURI string) bool {
+			return sub.connectLocal(ctx, pubURI, nodeID)
+		}
 	}
 
 	// Setup is complete, run the subscriber.
@@ -180,6 +219,23 @@ func (sub *defaultSubscriber) run(ctx goContext.Context, jobChan chan func(), en
 				}
 			}
 
+			// Publishers in this process are connected to directly; the rest are asked for their TCPROS address.
+			if sub.localConnector != nil {
+				remotePubs := make([]string, 0, len(newPubs))
+				for _, pub := range newPubs {
+					localCtx, cancel := goContext.WithCancel(ctx)
+					if !sub.localConnector(localCtx, pub) {
+						cancel()
+						remotePubs = append(remotePubs, pub)
+						continue
+					}
+					log.Debug().Str("topic", sub.topic).Str("publisher", pub).Msg("connected to publisher in this process")
+					sub.pubList = append(sub.pubList, pub)
+					cancelMap[pub] = cancel
+				}
+				newPubs = remotePubs
+			}
+
 			// Make a new request topic channel - meaning pending old requests will get ignored.
 			requestTopicChan = make(chan requestTopicResult)
 
@@ -245,10 +301,27 @@ func (sub *defaultSubscriber) run(ctx goContext.Context, jobChan chan func(), en
 			// Prepare the latest job to be passed on.
 			latestJob = func() {
 				m := sub.msgType.NewMessage()
-				reader := bytes.NewReader(msgEvent.bytes)
-				if err := m.Deserialize(reader); err != nil {
-					log.Error().Str("topic", sub.topic).Err(err).Msg("")
-					return
+				header := msgEvent.event.ConnectionHeader
+				if msgEvent.msg != nil {
+					// Publishers in this process pass their messages on as they are.
+					m = msgEvent.msg
+				} else if sub.migrator != nil && (header["type"] != sub.msgType.Name() || header["md5sum"] != sub.msgType.MD5Sum()) {
+					// The publisher has an older definition of the message type, which its messages are migrated from.
+					migrated, err := sub.migrator.MigrateSerialized(header["type"], header["md5sum"], msgEvent.bytes, sub.msgType.(*DynamicMessageType))
+					if err != nil {
+						log.Error().Str("topic", sub.topic).Err(err).Msg("failed to migrate message")
+						return
+					}
+					m = migrated
+				} else if view, ok := m.(*DynamicMessageView); ok {
+					// Views decode lazily, so they can hold on to the received bytes as they are.
+					view.reset(msgEvent.bytes)
+				} else {
+					reader := bytes.NewReader(msgEvent.bytes)
+					if err := m.Deserialize(reader); err != nil {
+						log.Error().Str("topic", sub.topic).Err(err).Msg("")
+						return
+					}
 				}
 				// TODO: Investigate this
 				args := []reflect.Value{reflect.ValueOf(m), reflect.ValueOf(msgEvent.event)}
@@ -288,12 +361,13 @@ func (sub *defaultSubscriber) run(ctx goContext.Context, jobChan chan func(), en
 
 // startRemotePublisherConn creates a subscription to a remote publisher and runs it.
 func startRemotePublisherConn(ctx goContext.Context, dialer TCPRosDialer,
-	pubURI string, topic string, msgType MessageType, nodeID string,
+	pubURI string, topic string, msgType MessageType, migrator *MessageMigrator, nodeID string,
 	msgChan chan messageEvent,
 	disconnectedChan chan string,
 	log zerolog.Logger) {
 	sub := newDefaultSubscription(pubURI, topic, msgType, nodeID, msgChan, disconnectedChan)
 	sub.dialer = dialer
+	sub.migrator = migrator
 	sub.startWithContext(ctx, log)
 }
 
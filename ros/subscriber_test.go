@@ -429,6 +429,51 @@ func TestSubscriber_Run_JobCallbacks_BadDeserialization(t *testing.T) {
 	}
 }
 
+func TestSubscriber_Run_JobCallbacks_View(t *testing.T) {
+	var view *DynamicMessageView
+	sub := makeTestSubscriberWithJobCallback(func(v *DynamicMessageView, e MessageEvent) {
+		view = v
+	})
+	sub.msgType = sub.msgType.(*DynamicMessageType).ViewType()
+	ctx := newFakeContext()
+	jobChan := make(chan func())
+	enableChan := make(chan bool)
+	rosAPI := newFakeSubscriberRos()
+	log := makeTestLogger()
+	startSubscription := func(ctx goContext.Context, pubURI string, log zerolog.Logger) {}
+
+	go sub.run(ctx, jobChan, enableChan, rosAPI, startSubscription, log)
+	defer sub.Shutdown()
+
+	bPayload := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07}
+	sub.msgChan <- messageEvent{
+		bytes: bPayload,
+		event: MessageEvent{"TestPublisher", time.Now(), make(map[string]string)},
+	}
+
+	select {
+	case job := <-jobChan:
+		job()
+	case <-time.After(time.Second):
+		t.Fatalf("expected to receive job")
+	}
+
+	if view == nil {
+		t.Fatal("callback not called with a view")
+	}
+	// The view should be over the received bytes, not a copy of them.
+	if &view.Bytes()[0] != &bPayload[0] {
+		t.Fatal("expected view of the received bytes")
+	}
+	value, err := view.Get("u8")
+	if err != nil {
+		t.Fatalf("get failed %s", err)
+	}
+	if !reflect.DeepEqual(value, bPayload) {
+		t.Fatalf("expected %v, got %v", bPayload, value)
+	}
+}
+
 func TestSubscriber_Run_JobPrioritization(t *testing.T) {
 	var msg Message
 	sub := makeTestSubscriberWithJobCallback(func(m Message, e MessageEvent) {
@@ -737,7 +782,7 @@ func setupRemotePublisherConnTest(t *testing.T) (*fakeContext, net.Conn, chan me
 	msgType := testMessageType{}
 	log := makeTestLogger()
 
-	startRemotePublisherConn(ctx, testDialer, pubURI, topic, msgType, nodeID, msgChan, disconnectedChan, log)
+	startRemotePublisherConn(ctx, testDialer, pubURI, topic, msgType, nil, nodeID, msgChan, disconnectedChan, log)
 
 	return ctx, pubConn, msgChan, disconnectedChan
 }
@@ -20,6 +20,7 @@ type defaultSubscription struct {
 	remoteDisconnectedChan chan string // Outbound signal to indicate a disconnected channel.
 	event                  MessageEvent
 	dialer                 TCPRosDialer
+	migrator               *MessageMigrator // Accepts publishers of older definitions of msgType, if it's set.
 }
 
 // newDefaultSubscription populates a subscription struct from the instantiation fields and fills in default data for the operational fields.
@@ -120,8 +121,14 @@ func (s *defaultSubscription) connectToPublisher(ctx goContext.Context, conn *ne
 
 	var subscriberHeaders []header
 	subscriberHeaders = append(subscriberHeaders, header{"topic", s.topic})
-	subscriberHeaders = append(subscriberHeaders, header{"md5sum", s.msgType.MD5Sum()})
+	if s.migrator != nil {
+		// Let the publisher send us any definition; we check it can be migrated once it tells us which it has.
+		subscriberHeaders = append(subscriberHeaders, header{"md5sum", "*"})
+	} else {
+		subscriberHeaders = append(subscriberHeaders, header{"md5sum", s.msgType.MD5Sum()})
+	}
 	subscriberHeaders = append(subscriberHeaders, header{"type", s.msgType.Name()})
+	subscriberHeaders = append(subscriberHeaders, header{"message_definition", s.msgType.Text()})
 	subscriberHeaders = append(subscriberHeaders, header{"callerid", s.nodeID})
 
 	ctx, cancel := goContext.WithCancel(ctx)
@@ -161,8 +168,9 @@ func (s *defaultSubscription) connectToPublisher(ctx goContext.Context, conn *ne
 	}
 
 	// 4. Verify the publisher's response header.
-	if resHeaderMap["type"] != s.msgType.Name() || resHeaderMap["md5sum"] != s.msgType.MD5Sum() {
-		logger.Error().Interface("pubs", resHeaderMap).Interface("subs", subscriberHeaders).Msg("publisher provided incompatable message header")
+	if (resHeaderMap["type"] != s.msgType.Name() || resHeaderMap["md5sum"] != s.msgType.MD5Sum()) && s.msgType.MD5Sum() != "*" && !s.canMigrate(resHeaderMap) {
+		differences := describeMessageTypeMismatch(s.msgType.Name(), s.msgType.Text(), resHeaderMap["type"], resHeaderMap["message_definition"])
+		logger.Error().Interface("pubs", resHeaderMap).Interface("subs", subscriberHeaders).Strs("differences", differences).Msg("publisher provided incompatable message header")
 		return false
 	}
 
@@ -179,6 +187,12 @@ func (s *defaultSubscription) connectToPublisher(ctx goContext.Context, conn *ne
 	return true
 }
 
+// canMigrate returns whether messages of the type in the publisher's response header can be migrated to ours.
+func (s *defaultSubscription) canMigrate(resHeaderMap map[string]string) bool {
+	msgType, ok := s.msgType.(*DynamicMessageType)
+	return ok && s.migrator != nil && s.migrator.CanMigrate(resHeaderMap["type"], resHeaderMap["md5sum"], msgType)
+}
+
 func (s *defaultSubscription) writeHeader(ctx goContext.Context, conn *net.Conn, log zerolog.Logger, subscriberHeaders []header) (err error) {
 	logger := log
 	logger.Debug().Interface("sub-headers", subscriberHeaders).Msg("writing TCPROS connection header")
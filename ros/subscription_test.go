@@ -422,6 +422,28 @@ func writeAndVerifyPublisherHeader(t *testing.T, conn net.Conn, subscription *de
 	}
 }
 
+// writeAndConfirmPublisherHeader writes a header to the subscriber, then a message; the header the subscriber captured arrives with the message, so it is
+// checked without racing the subscription.
+func writeAndConfirmPublisherHeader(t *testing.T, conn net.Conn, msgChan chan messageEvent, replyHeader []header) {
+	if err := writeConnectionHeader(replyHeader, conn); err != nil {
+		t.Fatalf("Failed to write header: %s", replyHeader)
+	}
+	sendMessageBytes(t, conn, []byte{0x00})
+
+	select {
+	case message := <-msgChan:
+		for _, expected := range replyHeader {
+			if result, ok := message.event.ConnectionHeader[expected.key]; !ok {
+				t.Fatalf("subscription did not store header data for %s", expected.key)
+			} else if expected.value != result {
+				t.Fatalf("expected header[%s] = %s, but got %s", expected.key, expected.value, result)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive message from channel")
+	}
+}
+
 // sendMessageAndReceiveInChannel sends a message which we expect is passed on by the subscription.
 func sendMessageAndReceiveInChannel(t *testing.T, conn net.Conn, msgChan chan messageEvent, buffer []byte) {
 	sendMessageBytes(t, conn, buffer)
@@ -0,0 +1,133 @@
+// rosgo is a command line tool for looking into ROS message types, using the ROS install on ROS_PACKAGE_PATH, and into a running ROS system, without
+// needing ROS's Python tools.  Arguments of the form name:=value, such as __master:=http://robot:11311, are passed on to the nodes it starts.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asimovsecurity/rosgo/ros"
+	"github.com/rs/zerolog"
+)
+
+// command is one of rosgo's commands: msg, and so on.
+type command struct {
+	usage string                           // The arguments the command takes, one form to a line, then a blank line and notes on them.
+	run   func(args []string) (int, error) // Runs the command, returning the exit status.
+}
+
+var commands = map[string]command{
+	"msg":     {msgUsage, msgCommand},
+	"node":    {nodeUsage, nodeCommand},
+	"param":   {paramUsage, paramCommand},
+	"service": {serviceUsage, serviceCommand},
+	"topic":   {topicUsage, topicCommand},
+}
+
+// rosArgs are the remapping and special arguments given to rosgo, for the nodes it starts.
+var rosArgs []string
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "USAGE:")
+	for _, name := range names {
+		forms, notes, _ := cut(commands[name].usage, "\n\n")
+		for _, line := range strings.Split(forms, "\n") {
+			fmt.Fprintln(os.Stderr, "  rosgo "+name+" "+line)
+		}
+		if notes != "" {
+			fmt.Fprintln(os.Stderr, "    "+strings.ReplaceAll(notes, "\n", "\n    "))
+		}
+	}
+}
+
+// cut splits s around the first sep, as strings.Cut does in later versions of Go.
+func cut(s string, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// newNode starts an anonymous node for a command, logging only warnings and errors.
+func newNode(command string) (ros.Node, error) {
+	name := fmt.Sprintf("rosgo_%s_%d_%d", command, os.Getpid(), time.Now().UnixNano()/int64(time.Millisecond))
+	return ros.NewNodeWithLogs(name, zerolog.New(os.Stderr).Level(zerolog.WarnLevel), rosArgs)
+}
+
+// spin runs the node's callbacks until it's interrupted, calling tick every interval, and stopping early once tick returns false.
+func spin(node ros.Node, interval time.Duration, tick func() bool) {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	next := time.Now().Add(interval)
+	for node.OK() {
+		select {
+		case <-interrupts:
+			return
+		default:
+		}
+		node.SpinOnce()
+		if now := time.Now(); !now.Before(next) {
+			next = now.Add(interval)
+			if !tick() {
+				return
+			}
+		}
+	}
+}
+
+// resolveName makes a name global, relative to the node's namespace.
+func resolveName(node ros.Node, name string) string {
+	if strings.HasPrefix(name, ros.GlobalNS) {
+		return name
+	}
+	return strings.TrimSuffix(node.Namespace(), ros.Sep) + ros.Sep + name
+}
+
+// errUsage is returned by commands given the wrong arguments.
+var errUsage = fmt.Errorf("wrong arguments")
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	var args []string
+	for _, arg := range flag.Args()[1:] {
+		if strings.Contains(arg, ros.Remap) {
+			rosArgs = append(rosArgs, arg)
+		} else {
+			args = append(args, arg)
+		}
+	}
+
+	status, err := cmd.run(args)
+	if err == errUsage {
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(status)
+}
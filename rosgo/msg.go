@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/asimovsecurity/rosgo/ros"
+)
+
+const msgUsage = `show TYPE...
+md5 TYPE...
+diff TYPE TYPE
+
+A TYPE is a message type name, such as geometry_msgs/Pose, looked up on ROS_PACKAGE_PATH; or a name and a
+file holding its definition, such as geometry_msgs/Pose=pose.txt.  The file may hold a .msg file, or a full
+message definition as sent in the message_definition field of a connection header.  diff exits with status 1
+if the message types differ.`
+
+func msgCommand(args []string) (int, error) {
+	if len(args) < 2 {
+		return 0, errUsage
+	}
+	types := make([]*ros.DynamicMessageType, len(args)-1)
+	for i, arg := range args[1:] {
+		var err error
+		if types[i], err = loadMessageType(arg); err != nil {
+			return 0, fmt.Errorf("%s: %v", arg, err)
+		}
+	}
+
+	switch args[0] {
+	case "show":
+		for i, msgType := range types {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s (md5sum %s)\n%s", msgType.Name(), msgType.MD5Sum(), msgType.Outline())
+		}
+	case "md5":
+		for _, msgType := range types {
+			fmt.Println(msgType.MD5Sum())
+		}
+	case "diff":
+		if len(types) != 2 {
+			return 0, errUsage
+		}
+		differences := ros.DiffMessageTypes(types[0], types[1])
+		if len(differences) == 0 {
+			return 0, nil
+		}
+		fmt.Printf("--- %s (md5sum %s)\n+++ %s (md5sum %s)\n", args[1], types[0].MD5Sum(), args[2], types[1].MD5Sum())
+		for _, difference := range differences {
+			fmt.Println(difference)
+		}
+		return 1, nil
+	default:
+		return 0, errUsage
+	}
+	return 0, nil
+}
+
+// loadMessageType loads a message type given as TYPE or TYPE=FILE.
+func loadMessageType(arg string) (*ros.DynamicMessageType, error) {
+	i := strings.Index(arg, "=")
+	if i < 0 {
+		return ros.NewDynamicMessageType(arg)
+	}
+	definition, err := ioutil.ReadFile(arg[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	return ros.NewDynamicMessageTypeFromDefinition(arg[:i], string(definition))
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asimovsecurity/rosgo/ros"
+	"github.com/asimovsecurity/rosgo/xmlrpc"
+)
+
+const nodeUsage = `list
+info NODE...
+ping [-c COUNT] NODE
+kill NODE...
+
+info asks each node for its publications, subscriptions, process ID and connections.  ping calls a node once a second until interrupted, or COUNT
+times; it exits with status 1 if the node can't be reached.`
+
+// callerID is the name rosgo calls the master and other nodes by, when it hasn't started a node of its own.
+const callerID = "/rosgo"
+
+// nodeCommand runs the rosgo node subcommands.
+func nodeCommand(args []string) (int, error) {
+	if len(args) < 1 {
+		return 0, errUsage
+	}
+	flags := flag.NewFlagSet("node "+args[0], flag.ContinueOnError)
+	count := flags.Int("c", 0, "the number of times to ping; 0 pings until interrupted")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 0, errUsage
+	}
+
+	node, err := newNode("node")
+	if err != nil {
+		return 0, err
+	}
+	defer node.Shutdown()
+
+	switch args[0] {
+	case "list":
+		if flags.NArg() != 0 {
+			return 0, errUsage
+		}
+		nodes, err := getNodes(node)
+		if err != nil {
+			return 0, err
+		}
+		for _, name := range nodes {
+			fmt.Println(name)
+		}
+		return 0, nil
+	case "info":
+		if flags.NArg() < 1 {
+			return 0, errUsage
+		}
+		for _, name := range flags.Args() {
+			if err := nodeInfo(node, resolveName(node, name)); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	case "ping":
+		if flags.NArg() != 1 {
+			return 0, errUsage
+		}
+		return nodePing(node, resolveName(node, flags.Arg(0)), *count)
+	case "kill":
+		if flags.NArg() < 1 {
+			return 0, errUsage
+		}
+		for _, name := range flags.Args() {
+			name = resolveName(node, name)
+			uri, err := lookupNode(node, name)
+			if err != nil {
+				return 0, err
+			}
+			if _, err := callAPI(uri, "shutdown", callerID, "user request"); err != nil {
+				return 0, fmt.Errorf("%s: %v", name, err)
+			}
+			fmt.Println("killed " + name)
+		}
+		return 0, nil
+	}
+	return 0, errUsage
+}
+
+// nodeInfo prints what a node publishes, subscribes to and provides, and its connections, as rosnode info does.
+func nodeInfo(node ros.Node, name string) error {
+	uri, err := lookupNode(node, name)
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.Repeat("-", 80))
+	fmt.Printf("Node [%s]\n", name)
+
+	for _, section := range []struct {
+		title  string
+		method string
+	}{{"Publications:", "getPublications"}, {"Subscriptions:", "getSubscriptions"}} {
+		result, err := callAPI(uri, section.method, callerID)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		var lines []string
+		list, _ := result.([]interface{})
+		for _, entry := range list {
+			if pair, ok := entry.([]interface{}); ok && len(pair) == 2 {
+				lines = append(lines, fmt.Sprintf(" * %v [%v]", pair[0], pair[1]))
+			}
+		}
+		printSection(section.title, lines)
+	}
+
+	state, err := node.GetSystemState()
+	if err != nil {
+		return err
+	}
+	var services []string
+	if len(state) > 2 {
+		for service, providers := range parseSystemStateList(state[2]) {
+			for _, provider := range providers {
+				if provider == name {
+					services = append(services, " * "+service)
+				}
+			}
+		}
+	}
+	sort.Strings(services)
+	printSection("Services:", services)
+
+	fmt.Printf("contacting node %s ...\n", uri)
+	if pid, err := callAPI(uri, "getPid", callerID); err == nil {
+		fmt.Printf("Pid: %v\n", pid)
+	}
+	if info, err := callAPI(uri, "getBusInfo", callerID); err == nil {
+		fmt.Println("Connections:")
+		connections, _ := info.([]interface{})
+		for _, entry := range connections {
+			// Each connection is its ID, the node at the other end, its direction, transport and topic.
+			connection, ok := entry.([]interface{})
+			if !ok || len(connection) < 5 {
+				continue
+			}
+			direction := "inbound"
+			if connection[2] == "o" {
+				direction = "outbound"
+			}
+			fmt.Printf(" * topic: %v\n    * to: %v\n    * direction: %s\n    * transport: %v\n", connection[4], connection[1], direction, connection[3])
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// nodePing calls a node's getPid until it's interrupted, or count times.
+func nodePing(node ros.Node, name string, count int) (int, error) {
+	uri, err := lookupNode(node, name)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Printf("pinging %s with a timeout of 3.0s\n", name)
+	status := 0
+	pings := 0
+	ping := func() bool {
+		start := time.Now()
+		if _, err := callAPI(uri, "getPid", callerID); err != nil {
+			fmt.Fprintf(os.Stderr, "connection to [%s] timed out: %v\n", uri, err)
+			status = 1
+			return false
+		}
+		fmt.Printf("xmlrpc reply from %s\ttime=%.6fms\n", uri, float64(time.Since(start))/float64(time.Millisecond))
+		pings++
+		return count == 0 || pings < count
+	}
+	if ping() {
+		spin(node, time.Second, ping)
+	}
+	return status, nil
+}
+
+// getNodes returns the nodes the master knows of, from its system state.
+func getNodes(node ros.Node) ([]string, error) {
+	state, err := node.GetSystemState()
+	if err != nil {
+		return nil, err
+	}
+	nodes := map[string]struct{}{}
+	for _, list := range state {
+		for _, names := range parseSystemStateList(list) {
+			for _, name := range names {
+				nodes[name] = struct{}{}
+			}
+		}
+	}
+	return sortedKeys(nodes), nil
+}
+
+// printSection prints a titled list of lines, as rosnode info does.
+func printSection(title string, lines []string) {
+	if len(lines) == 0 {
+		fmt.Println(title + " None")
+		fmt.Println()
+		return
+	}
+	fmt.Println(title)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
+
+// lookupNode returns the URI of a node's slave API.
+func lookupNode(node ros.Node, name string) (string, error) {
+	result, err := callAPI(node.MasterURI(), "lookupNode", callerID, name)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	uri, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: lookupNode returned %v", name, result)
+	}
+	return uri, nil
+}
+
+// callAPI calls a method of the master or slave API at uri, returning the value of its result.
+func callAPI(uri string, method string, args ...interface{}) (interface{}, error) {
+	client := xmlrpc.NewXMLClient()
+	client.Timeout = 3 * time.Second
+	result, err := client.Call(uri, method, args...)
+	if err != nil {
+		return nil, err
+	}
+	triple, ok := result.([]interface{})
+	if !ok || len(triple) != 3 {
+		return nil, fmt.Errorf("malformed result from %s", method)
+	}
+	if code, _ := triple[0].(int32); code != ros.APIStatusSuccess {
+		message, _ := triple[1].(string)
+		return nil, &ros.APIError{Code: code, Message: message}
+	}
+	return triple[2], nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/asimovsecurity/rosgo/ros"
+)
+
+const paramUsage = `get NAME
+set NAME VALUE
+list [NAMESPACE]
+dump FILE [NAMESPACE]
+load FILE [NAMESPACE]
+
+Values are written and read as YAML.  A FILE of - is standard output or input.  load sets each entry of the file's maps within the namespace,
+which is / unless given, leaving other parameters alone.`
+
+// paramCommand runs the rosgo param subcommands.
+func paramCommand(args []string) (int, error) {
+	if len(args) < 1 {
+		return 0, errUsage
+	}
+	node, err := newNode("param")
+	if err != nil {
+		return 0, err
+	}
+	defer node.Shutdown()
+
+	switch args[0] {
+	case "get":
+		if len(args) != 2 {
+			return 0, errUsage
+		}
+		value, err := node.GetParam(resolveName(node, args[1]))
+		if err != nil {
+			return 0, err
+		}
+		buf, err := ros.MarshalParamYAML(value)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Print(string(buf))
+		return 0, nil
+	case "set":
+		if len(args) != 3 {
+			return 0, errUsage
+		}
+		value, err := ros.UnmarshalParamYAML([]byte(args[2]))
+		if err != nil {
+			return 0, err
+		}
+		return 0, node.SetParam(resolveName(node, args[1]), value)
+	case "list":
+		if len(args) > 2 {
+			return 0, errUsage
+		}
+		result, err := callAPI(node.MasterURI(), "getParamNames", callerID)
+		if err != nil {
+			return 0, err
+		}
+		namespace := ros.GlobalNS
+		if len(args) == 2 {
+			namespace = strings.TrimSuffix(resolveName(node, args[1]), ros.Sep) + ros.Sep
+		}
+		names, _ := result.([]interface{})
+		var list []string
+		for _, name := range names {
+			if s, ok := name.(string); ok && strings.HasPrefix(s, namespace) {
+				list = append(list, s)
+			}
+		}
+		sort.Strings(list)
+		for _, name := range list {
+			fmt.Println(name)
+		}
+		return 0, nil
+	case "dump", "load":
+		if len(args) < 2 || len(args) > 3 {
+			return 0, errUsage
+		}
+		namespace := ros.GlobalNS
+		if len(args) == 3 {
+			namespace = resolveName(node, args[2])
+		}
+		if args[0] == "dump" {
+			return 0, paramDump(node, args[1], namespace)
+		}
+		return 0, paramLoad(node, args[1], namespace)
+	}
+	return 0, errUsage
+}
+
+// paramDump writes the parameters in a namespace to a YAML file.
+func paramDump(node ros.Node, file string, namespace string) error {
+	value, err := node.GetParam(namespace)
+	if err != nil {
+		return err
+	}
+	buf, err := ros.MarshalParamYAML(value)
+	if err != nil {
+		return err
+	}
+	if file == "-" {
+		_, err = os.Stdout.Write(buf)
+		return err
+	}
+	return ioutil.WriteFile(file, buf, 0644)
+}
+
+// paramLoad sets the parameters in a YAML file within a namespace.
+func paramLoad(node ros.Node, file string, namespace string) error {
+	if file == "-" {
+		file = "/dev/stdin"
+	}
+	return node.LoadParams(file, namespace)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/asimovsecurity/rosgo/ros"
+)
+
+const serviceUsage = `list
+type SERVICE
+call [-format FORMAT] SERVICE [VALUES]
+
+call fills in the request from VALUES, and prints the response, in the given format: yaml, the default, json, or any other codec.  The service
+type is looked up on ROS_PACKAGE_PATH.`
+
+// serviceCommand runs the rosgo service subcommands.
+func serviceCommand(args []string) (int, error) {
+	if len(args) < 1 {
+		return 0, errUsage
+	}
+	flags := flag.NewFlagSet("service "+args[0], flag.ContinueOnError)
+	format := flags.String("format", "yaml", "how requests and responses are written")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 0, errUsage
+	}
+
+	node, err := newNode("service")
+	if err != nil {
+		return 0, err
+	}
+	defer node.Shutdown()
+
+	switch args[0] {
+	case "list":
+		if flags.NArg() != 0 {
+			return 0, errUsage
+		}
+		services, err := node.GetServiceList()
+		if err != nil {
+			return 0, err
+		}
+		sort.Strings(services)
+		for _, service := range services {
+			fmt.Println(service)
+		}
+		return 0, nil
+	case "type":
+		if flags.NArg() != 1 {
+			return 0, errUsage
+		}
+		header, err := node.GetServiceType(resolveName(node, flags.Arg(0)))
+		if err != nil {
+			return 0, err
+		}
+		fmt.Println(header.ServiceType)
+		return 0, nil
+	case "call":
+		if flags.NArg() < 1 || flags.NArg() > 2 {
+			return 0, errUsage
+		}
+		return 0, serviceCall(node, resolveName(node, flags.Arg(0)), flags.Arg(1), *format)
+	}
+	return 0, errUsage
+}
+
+// serviceCall calls a service with a request filled in from values, and prints the response.
+func serviceCall(node ros.Node, service string, values string, format string) error {
+	codec, err := ros.GetCodec(format)
+	if err != nil {
+		return err
+	}
+	header, err := node.GetServiceType(service)
+	if err != nil {
+		return err
+	}
+	srvType, err := ros.NewDynamicServiceType(header.ServiceType)
+	if err != nil {
+		return fmt.Errorf("%s: %v", header.ServiceType, err)
+	}
+	srv := srvType.NewService().(*ros.DynamicService)
+	request, ok := srv.Request.(*ros.DynamicMessage)
+	if !ok {
+		return fmt.Errorf("%s has no request type", header.ServiceType)
+	}
+	if values != "" {
+		if err := codec.Unmarshal([]byte(values), request); err != nil {
+			return err
+		}
+	}
+
+	client := node.NewServiceClient(service, srvType)
+	defer client.Shutdown()
+	if err := client.Call(srv); err != nil {
+		return err
+	}
+	response, ok := srv.Response.(*ros.DynamicMessage)
+	if !ok {
+		return fmt.Errorf("%s has no response type", header.ServiceType)
+	}
+	buf, err := codec.Marshal(response)
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.TrimSuffix(string(buf), "\n"))
+	return nil
+}
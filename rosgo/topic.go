@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asimovsecurity/rosgo/ros"
+)
+
+const topicUsage = `list [-v]
+info TOPIC
+type TOPIC
+echo [-format FORMAT] [-n COUNT] TOPIC
+pub [-format FORMAT] [-r RATE] [-1] TOPIC TYPE [VALUES]
+hz [-window N] TOPIC
+bw [-window N] TOPIC
+delay [-window N] TOPIC
+
+echo prints messages, and pub reads their values, in the given format: yaml, the default, json, or any other codec.  pub sends its message to
+each subscriber as it connects, unless given a rate to publish it at; with -1 it exits after three seconds.  delay needs messages with a header.`
+
+// topicCommand runs the rosgo topic subcommands.
+func topicCommand(args []string) (int, error) {
+	if len(args) < 1 {
+		return 0, errUsage
+	}
+	flags := flag.NewFlagSet("topic "+args[0], flag.ContinueOnError)
+	verbose := flags.Bool("v", false, "list the types of topics, and how many nodes publish and subscribe to them")
+	format := flags.String("format", "yaml", "how messages are written")
+	count := flags.Int("n", 0, "the number of messages to print; 0 prints them all")
+	rate := flags.Float64("r", 0, "the rate to publish at, in Hz")
+	once := flags.Bool("1", false, "exit after three seconds")
+	window := flags.Int("window", 10000, "the number of messages to base statistics on")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 0, errUsage
+	}
+
+	node, err := newNode("topic")
+	if err != nil {
+		return 0, err
+	}
+	defer node.Shutdown()
+
+	switch args[0] {
+	case "list":
+		if flags.NArg() != 0 {
+			return 0, errUsage
+		}
+		return 0, topicList(node, *verbose)
+	}
+
+	if flags.NArg() < 1 {
+		return 0, errUsage
+	}
+	topic := resolveName(node, flags.Arg(0))
+	switch args[0] {
+	case "info":
+		return 0, topicInfo(node, topic)
+	case "type":
+		topicType, err := getTopicType(node, topic)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Println(topicType)
+		return 0, nil
+	case "echo":
+		return 0, topicEcho(node, topic, *format, *count)
+	case "pub":
+		if flags.NArg() < 2 || flags.NArg() > 3 {
+			return 0, errUsage
+		}
+		return 0, topicPub(node, topic, flags.Arg(1), flags.Arg(2), *format, *rate, *once)
+	case "hz", "bw", "delay":
+		if *window < 1 {
+			return 0, errUsage
+		}
+		return 0, topicStatistics(node, topic, args[0], *window)
+	}
+	return 0, errUsage
+}
+
+// topicList prints the topics which are published or subscribed to.
+func topicList(node ros.Node, verbose bool) error {
+	publishers, subscribers, err := getTopicNodes(node)
+	if err != nil {
+		return err
+	}
+	if !verbose {
+		topics := map[string]struct{}{}
+		for topic := range publishers {
+			topics[topic] = struct{}{}
+		}
+		for topic := range subscribers {
+			topics[topic] = struct{}{}
+		}
+		for _, topic := range sortedKeys(topics) {
+			fmt.Println(topic)
+		}
+		return nil
+	}
+
+	types := getTopicTypes(node)
+	for _, section := range []struct {
+		title string
+		nodes map[string][]string
+		noun  string
+	}{{"Published topics:", publishers, "publisher"}, {"Subscribed topics:", subscribers, "subscriber"}} {
+		fmt.Println()
+		fmt.Println(section.title)
+		topics := map[string]struct{}{}
+		for topic := range section.nodes {
+			topics[topic] = struct{}{}
+		}
+		for _, topic := range sortedKeys(topics) {
+			n := len(section.nodes[topic])
+			plural := "s"
+			if n == 1 {
+				plural = ""
+			}
+			fmt.Printf(" * %s [%s] %d %s%s\n", topic, types[topic], n, section.noun, plural)
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// topicInfo prints the type of a topic, and the nodes publishing and subscribing to it.
+func topicInfo(node ros.Node, topic string) error {
+	topicType, err := getTopicType(node, topic)
+	if err != nil {
+		return err
+	}
+	publishers, subscribers, err := getTopicNodes(node)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Type: %s\n\n", topicType)
+	for _, section := range []struct {
+		title string
+		nodes []string
+	}{{"Publishers:", publishers[topic]}, {"Subscribers:", subscribers[topic]}} {
+		fmt.Println(section.title)
+		if len(section.nodes) == 0 {
+			fmt.Println(" None")
+		}
+		for _, name := range section.nodes {
+			fmt.Println(" * " + name)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// topicEcho prints the messages published on a topic, decoding them with the definitions their publishers send.
+func topicEcho(node ros.Node, topic string, format string, count int) error {
+	codec, err := ros.GetCodec(format)
+	if err != nil {
+		return err
+	}
+	decoder := newMessageDecoder()
+	printed := 0
+	var failure error
+	_, err = node.NewSubscriber(topic, ros.AnyMessageType{}, func(msg *ros.AnyMessage, event ros.MessageEvent) {
+		if failure != nil || (count > 0 && printed >= count) {
+			return
+		}
+		decoded, err := decoder.decode(msg, event)
+		if err == nil {
+			var buf []byte
+			if buf, err = codec.Marshal(decoded); err == nil {
+				fmt.Print(strings.TrimSuffix(string(buf), "\n") + "\n")
+				if format == "yaml" {
+					fmt.Println("---")
+				}
+				printed++
+				return
+			}
+		}
+		failure = err
+	})
+	if err != nil {
+		return err
+	}
+	spin(node, 100*time.Millisecond, func() bool {
+		return failure == nil && (count == 0 || printed < count)
+	})
+	return failure
+}
+
+// topicPub publishes a message on a topic.
+func topicPub(node ros.Node, topic string, typeName string, values string, format string, rate float64, once bool) error {
+	codec, err := ros.GetCodec(format)
+	if err != nil {
+		return err
+	}
+	msgType, err := loadMessageType(typeName)
+	if err != nil {
+		return fmt.Errorf("%s: %v", typeName, err)
+	}
+	msg := msgType.NewDynamicMessage()
+	if values != "" {
+		if err := codec.Unmarshal([]byte(values), msg); err != nil {
+			return err
+		}
+	}
+	if errs := msg.Validate(); len(errs) > 0 {
+		return errs[0]
+	}
+
+	// Without a rate, each subscriber gets the message once, as it connects, as if it were latched.
+	pub, err := node.NewPublisherWithCallbacks(topic, msgType, func(subscriber ros.SingleSubscriberPublisher) {
+		if rate <= 0 {
+			subscriber.Publish(msg)
+		}
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	interval := time.Second
+	if rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+		fmt.Printf("publishing at %g Hz\n", rate)
+	} else if once {
+		fmt.Println("publishing and latching message for 3.0 seconds")
+	} else {
+		fmt.Println("publishing and latching message. Press ctrl-C to terminate")
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	spin(node, interval, func() bool {
+		if rate > 0 {
+			pub.Publish(msg)
+		}
+		return !once || time.Now().Before(deadline)
+	})
+	return nil
+}
+
+// topicStatistics prints the rate, bandwidth or delay of the messages on a topic each second.
+func topicStatistics(node ros.Node, topic string, statistic string, window int) error {
+	decoder := newMessageDecoder()
+	var times, sizes, delays []float64
+	received := 0
+	var failure error
+	_, err := node.NewSubscriber(topic, ros.AnyMessageType{}, func(msg *ros.AnyMessage, event ros.MessageEvent) {
+		receipt := event.ReceiptTime
+		if receipt.IsZero() {
+			receipt = time.Now()
+		}
+		if statistic == "delay" {
+			delay, err := messageDelay(decoder, msg, event, receipt)
+			if err != nil {
+				failure = err
+				return
+			}
+			delays = appendWindow(delays, delay, window)
+		}
+		// One more time than messages is needed, to get the gaps between them.
+		times = appendWindow(times, float64(receipt.UnixNano())/1e9, window+1)
+		sizes = appendWindow(sizes, float64(len(msg.Bytes)), window)
+		received++
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("subscribed to [%s]\n", topic)
+	reported := 0
+	spin(node, time.Second, func() bool {
+		if failure != nil {
+			return false
+		}
+		if received == reported || (statistic == "hz" && len(times) < 2) {
+			fmt.Println("no new messages")
+			return true
+		}
+		reported = received
+		switch statistic {
+		case "hz":
+			gaps := make([]float64, len(times)-1)
+			for i := range gaps {
+				gaps[i] = times[i+1] - times[i]
+			}
+			mean, min, max, stddev := windowStatistics(gaps)
+			fmt.Printf("average rate: %.3f\n\tmin: %.3fs max: %.3fs std dev: %.5fs window: %d\n", 1/mean, min, max, stddev, len(gaps))
+		case "bw":
+			total := 0.0
+			for _, size := range sizes {
+				total += size
+			}
+			mean, min, max, _ := windowStatistics(sizes)
+			elapsed := float64(time.Now().UnixNano())/1e9 - times[len(times)-len(sizes)]
+			fmt.Printf("average: %s/s\n\tmean: %s min: %s max: %s window: %d\n", formatBytes(total/elapsed), formatBytes(mean), formatBytes(min), formatBytes(max), len(sizes))
+		case "delay":
+			mean, min, max, stddev := windowStatistics(delays)
+			fmt.Printf("average delay: %.3f\n\tmin: %.3fs max: %.3fs std dev: %.5fs window: %d\n", mean, min, max, stddev, len(delays))
+		}
+		return true
+	})
+	return failure
+}
+
+// messageDelay returns how long after the stamp in its header a message was received, in seconds.
+func messageDelay(decoder *messageDecoder, msg *ros.AnyMessage, event ros.MessageEvent, receipt time.Time) (float64, error) {
+	decoded, err := decoder.decode(msg, event)
+	if err != nil {
+		return 0, err
+	}
+	value, err := decoded.Get("header.stamp")
+	if err != nil {
+		return 0, fmt.Errorf("%s has no header", decoded.Type().Name())
+	}
+	stamp, ok := value.(ros.Time)
+	if !ok {
+		return 0, fmt.Errorf("%s has no header stamp", decoded.Type().Name())
+	}
+	return float64(receipt.UnixNano())/1e9 - stamp.ToSec(), nil
+}
+
+// messageDecoder decodes AnyMessages, keeping the message types it makes from their publishers' definitions.
+type messageDecoder struct {
+	types map[string]*ros.DynamicMessageType
+}
+
+func newMessageDecoder() *messageDecoder {
+	return &messageDecoder{types: map[string]*ros.DynamicMessageType{}}
+}
+
+// decode decodes a message with the definition from its connection header.
+func (d *messageDecoder) decode(msg *ros.AnyMessage, event ros.MessageEvent) (*ros.DynamicMessage, error) {
+	key := event.ConnectionHeader["type"] + " " + event.ConnectionHeader["md5sum"]
+	msgType, ok := d.types[key]
+	if !ok {
+		var err error
+		if msgType, err = ros.NewDynamicMessageTypeFromHeader(event.ConnectionHeader); err != nil {
+			return nil, err
+		}
+		d.types[key] = msgType
+	}
+	decoded := msgType.NewDynamicMessage()
+	if err := decoded.Deserialize(bytes.NewReader(msg.Bytes)); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// getTopicNodes returns the nodes publishing and subscribing to each topic, from the master's system state.
+func getTopicNodes(node ros.Node) (map[string][]string, map[string][]string, error) {
+	state, err := node.GetSystemState()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(state) < 2 {
+		return nil, nil, fmt.Errorf("system state has %d parts, rather than 3", len(state))
+	}
+	return parseSystemStateList(state[0]), parseSystemStateList(state[1]), nil
+}
+
+// parseSystemStateList parses one of the lists of the system state, of names and the nodes using them.
+func parseSystemStateList(list interface{}) map[string][]string {
+	result := map[string][]string{}
+	entries, _ := list.([]interface{})
+	for _, entry := range entries {
+		pair, ok := entry.([]interface{})
+		if !ok || len(pair) != 2 {
+			continue
+		}
+		name, _ := pair[0].(string)
+		nodes, _ := pair[1].([]interface{})
+		for _, n := range nodes {
+			if s, ok := n.(string); ok {
+				result[name] = append(result[name], s)
+			}
+		}
+		sort.Strings(result[name])
+	}
+	return result
+}
+
+// getTopicTypes returns the type of each topic known to the master.
+func getTopicTypes(node ros.Node) map[string]string {
+	types := map[string]string{}
+	for _, entry := range node.GetTopicTypes() {
+		pair, ok := entry.([]interface{})
+		if !ok || len(pair) != 2 {
+			continue
+		}
+		topic, _ := pair[0].(string)
+		topicType, _ := pair[1].(string)
+		types[topic] = topicType
+	}
+	return types
+}
+
+// getTopicType returns the type of a topic.
+func getTopicType(node ros.Node, topic string) (string, error) {
+	topicType, ok := getTopicTypes(node)[topic]
+	if !ok {
+		return "", fmt.Errorf("unknown topic %s", topic)
+	}
+	return topicType, nil
+}
+
+// sortedKeys returns the keys of a set in order.
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendWindow appends a value to a window of values, dropping the oldest to keep it to size.
+func appendWindow(values []float64, value float64, size int) []float64 {
+	values = append(values, value)
+	if len(values) > size {
+		values = values[len(values)-size:]
+	}
+	return values
+}
+
+// windowStatistics returns the mean, minimum, maximum and standard deviation of some values.
+func windowStatistics(values []float64) (float64, float64, float64, float64) {
+	if len(values) == 0 {
+		return 0, 0, 0, 0
+	}
+	min, max, total := math.Inf(1), math.Inf(-1), 0.0
+	for _, value := range values {
+		min = math.Min(min, value)
+		max = math.Max(max, value)
+		total += value
+	}
+	mean := total / float64(len(values))
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	return mean, min, max, math.Sqrt(variance / float64(len(values)))
+}
+
+// formatBytes formats a number of bytes as rostopic bw does, as in 1.50KB.
+func formatBytes(n float64) string {
+	switch {
+	case n < 1000:
+		return fmt.Sprintf("%.2fB", n)
+	case n < 1000000:
+		return fmt.Sprintf("%.2fKB", n/1000)
+	}
+	return fmt.Sprintf("%.2fMB", n/1000000)
+}
@@ -0,0 +1,182 @@
+package xmlrpc
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Unmarshal stores a value returned by Call, or passed to a Method, in the
+// value pointed to by v, as encoding/json does.  XMLRPC structs are decoded
+// into Go structs by the `xmlrpc:"name"` tags of their fields, or by their
+// field names if they aren't tagged; fields tagged `xmlrpc:"-"` are skipped.
+// Members without a matching field are ignored, and fields without a
+// matching member are left alone.  Arrays are decoded into slices and
+// arrays, structs into maps with string keys, and <nil/> into the zero value.
+func Unmarshal(data interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Unmarshal needs a non-nil pointer, not %T", v)
+	}
+	return unmarshalValue("", data, rv.Elem())
+}
+
+// The name of a struct field's member, and whether it has one.
+func fieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag := field.Tag.Get("xmlrpc")
+	if comma := strings.Index(tag, ","); comma >= 0 {
+		tag = tag[:comma]
+	}
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	}
+	return tag, true
+}
+
+func unmarshalError(path string, data interface{}, out reflect.Value) error {
+	if path == "" {
+		path = "value"
+	}
+	return fmt.Errorf("xmlrpc: cannot unmarshal %T into %v at %s", data, out.Type(), path)
+}
+
+func unmarshalValue(path string, data interface{}, out reflect.Value) error {
+	if data == nil {
+		out.Set(reflect.Zero(out.Type()))
+		return nil
+	}
+
+	switch out.Kind() {
+	case reflect.Interface:
+		if !reflect.TypeOf(data).AssignableTo(out.Type()) {
+			return unmarshalError(path, data, out)
+		}
+		out.Set(reflect.ValueOf(data))
+	case reflect.Ptr:
+		elem := reflect.New(out.Type().Elem())
+		if e := unmarshalValue(path, data, elem.Elem()); e != nil {
+			return e
+		}
+		out.Set(elem)
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return unmarshalError(path, data, out)
+		}
+		out.SetBool(b)
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return unmarshalError(path, data, out)
+		}
+		out.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := unmarshalInt(data)
+		if !ok || out.OverflowInt(i) {
+			return unmarshalError(path, data, out)
+		}
+		out.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := unmarshalInt(data)
+		if !ok || i < 0 || out.OverflowUint(uint64(i)) {
+			return unmarshalError(path, data, out)
+		}
+		out.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, ok := data.(float64)
+		if i, isInt := unmarshalInt(data); isInt {
+			f, ok = float64(i), true
+		}
+		if !ok {
+			return unmarshalError(path, data, out)
+		}
+		out.SetFloat(f)
+	case reflect.Slice:
+		if bs, ok := data.([]byte); ok && out.Type().Elem().Kind() == reflect.Uint8 {
+			out.SetBytes(append([]byte(nil), bs...))
+			return nil
+		}
+		list, ok := data.([]interface{})
+		if !ok {
+			return unmarshalError(path, data, out)
+		}
+		slice := reflect.MakeSlice(out.Type(), len(list), len(list))
+		for i, entry := range list {
+			if e := unmarshalValue(path+"["+strconv.Itoa(i)+"]", entry, slice.Index(i)); e != nil {
+				return e
+			}
+		}
+		out.Set(slice)
+	case reflect.Array:
+		list, ok := data.([]interface{})
+		if !ok || len(list) != out.Len() {
+			return unmarshalError(path, data, out)
+		}
+		for i, entry := range list {
+			if e := unmarshalValue(path+"["+strconv.Itoa(i)+"]", entry, out.Index(i)); e != nil {
+				return e
+			}
+		}
+	case reflect.Map:
+		members, ok := data.(map[string]interface{})
+		if !ok || out.Type().Key().Kind() != reflect.String {
+			return unmarshalError(path, data, out)
+		}
+		m := reflect.MakeMapWithSize(out.Type(), len(members))
+		for name, member := range members {
+			elem := reflect.New(out.Type().Elem()).Elem()
+			if e := unmarshalValue(strings.TrimPrefix(path+"."+name, "."), member, elem); e != nil {
+				return e
+			}
+			m.SetMapIndex(reflect.ValueOf(name).Convert(out.Type().Key()), elem)
+		}
+		out.Set(m)
+	case reflect.Struct:
+		if out.Type() == timeType {
+			t, ok := data.(time.Time)
+			if !ok {
+				return unmarshalError(path, data, out)
+			}
+			out.Set(reflect.ValueOf(t))
+			return nil
+		}
+		members, ok := data.(map[string]interface{})
+		if !ok {
+			return unmarshalError(path, data, out)
+		}
+		for i := 0; i < out.NumField(); i++ {
+			name, ok := fieldName(out.Type().Field(i))
+			if !ok {
+				continue
+			}
+			if member, ok := members[name]; ok {
+				if e := unmarshalValue(strings.TrimPrefix(path+"."+name, "."), member, out.Field(i)); e != nil {
+					return e
+				}
+			}
+		}
+	default:
+		return unmarshalError(path, data, out)
+	}
+	return nil
+}
+
+func unmarshalInt(data interface{}) (int64, bool) {
+	switch i := data.(type) {
+	case int32:
+		return int64(i), true
+	case int64:
+		return i, true
+	}
+	return 0, false
+}
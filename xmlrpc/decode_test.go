@@ -0,0 +1,68 @@
+package xmlrpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testBusInfo struct {
+	ID        int32  `xmlrpc:"id"`
+	Node      string `xmlrpc:"node"`
+	Bytes     uint64 `xmlrpc:"bytes"`
+	Connected *bool  `xmlrpc:"connected"`
+	Ignored   string `xmlrpc:"-"`
+	Started   time.Time
+}
+
+func TestUnmarshal(t *testing.T) {
+	started := time.Date(1998, 7, 17, 14, 8, 55, 0, time.UTC)
+	data := []interface{}{
+		map[string]interface{}{
+			"id":        int32(1),
+			"node":      "/talker",
+			"bytes":     int64(1) << 40,
+			"connected": true,
+			"Ignored":   "x",
+			"Started":   started,
+			"extra":     "unused",
+		},
+		map[string]interface{}{"id": int32(2), "connected": nil},
+	}
+	var infos []testBusInfo
+	if e := Unmarshal(data, &infos); e != nil {
+		t.Fatal(e)
+	}
+	connected := true
+	expected := []testBusInfo{
+		{ID: 1, Node: "/talker", Bytes: 1 << 40, Connected: &connected, Started: started},
+		{ID: 2},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Errorf("expected %+v, got %+v", expected, infos)
+	}
+
+	var pair [2]float64
+	if e := Unmarshal([]interface{}{int32(1), 2.5}, &pair); e != nil || pair != [2]float64{1, 2.5} {
+		t.Error(pair, e)
+	}
+	var m map[string]int
+	if e := Unmarshal(map[string]interface{}{"a": int32(1)}, &m); e != nil || m["a"] != 1 {
+		t.Error(m, e)
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	var small int8
+	if e := Unmarshal(int32(300), &small); e == nil {
+		t.Error("expected an overflow error")
+	}
+	var infos []testBusInfo
+	e := Unmarshal([]interface{}{map[string]interface{}{"node": int32(1)}}, &infos)
+	if e == nil || e.Error() != "xmlrpc: cannot unmarshal int32 into string at [0].node" {
+		t.Error(e)
+	}
+	if e := Unmarshal(int32(1), small); e == nil {
+		t.Error("expected an error unmarshalling into a non-pointer")
+	}
+}
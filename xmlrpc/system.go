@@ -0,0 +1,128 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+var systemMethods = []string{"system.listMethods", "system.methodSignature", "system.multicall"}
+
+// system.multicall takes a list of calls, each a struct with methodName and
+// params members, and returns a list with each call's result in a list of
+// its own, or a fault struct if the call failed.
+func (self *Handler) multicall(args []interface{}) (interface{}, *Fault) {
+	if len(args) != 1 {
+		return nil, &Fault{FaultInvalidParams, fmt.Sprintf("system.multicall: expected 1 argument, got %d", len(args))}
+	}
+	var calls []struct {
+		MethodName string        `xmlrpc:"methodName"`
+		Params     []interface{} `xmlrpc:"params"`
+	}
+	if e := Unmarshal(args[0], &calls); e != nil {
+		return nil, &Fault{FaultInvalidParams, fmt.Sprintf("system.multicall: %v", e)}
+	}
+
+	results := make([]interface{}, len(calls))
+	for i, call := range calls {
+		var result interface{}
+		var fault *Fault
+		if call.MethodName == "system.multicall" {
+			fault = &Fault{FaultInvalidParams, "system.multicall can't be called recursively"}
+		} else {
+			result, fault = self.dispatch(call.MethodName, call.Params)
+		}
+		// Check the result can be written, so that one bad result doesn't spoil the others.
+		if fault == nil {
+			if e := emitValue(&bytes.Buffer{}, result); e != nil {
+				fault = &Fault{FaultInternalError, fmt.Sprintf("Method '%v' returned an invalid result: %v", call.MethodName, e)}
+			}
+		}
+		if fault != nil {
+			results[i] = map[string]interface{}{"faultCode": fault.Code, "faultString": fault.String}
+		} else {
+			results[i] = []interface{}{result}
+		}
+	}
+	return results, nil
+}
+
+// system.listMethods returns the names of the handler's methods, in order.
+func (self *Handler) listMethods(args []interface{}) (interface{}, *Fault) {
+	if len(args) != 0 {
+		return nil, &Fault{FaultInvalidParams, fmt.Sprintf("system.listMethods: expected no arguments, got %d", len(args))}
+	}
+	names := append([]string{}, systemMethods...)
+	for name := range self.mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// system.methodSignature returns a list of a method's signatures, each a
+// list of the XMLRPC types of its result and then its parameters.  Values
+// which can have any type are described as "undef".
+func (self *Handler) methodSignature(args []interface{}) (interface{}, *Fault) {
+	if len(args) != 1 {
+		return nil, &Fault{FaultInvalidParams, fmt.Sprintf("system.methodSignature: expected 1 argument, got %d", len(args))}
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, &Fault{FaultInvalidParams, fmt.Sprintf("system.methodSignature: argument 1 must be string, not %T", args[0])}
+	}
+
+	switch name {
+	case "system.multicall":
+		return [][]string{{"array", "array"}}, nil
+	case "system.listMethods":
+		return [][]string{{"array"}}, nil
+	case "system.methodSignature":
+		return [][]string{{"array", "string"}}, nil
+	}
+	method, ok := self.mapping[name]
+	if !ok {
+		return nil, &Fault{FaultMethodNotFound, fmt.Sprintf("No method named '%v'.", name)}
+	}
+	t := reflect.TypeOf(method)
+	if t.Kind() != reflect.Func || t.NumOut() != 2 {
+		return "undef", nil
+	}
+	signature := []string{typeName(t.Out(0))}
+	for i := 0; i < t.NumIn(); i++ {
+		signature = append(signature, typeName(t.In(i)))
+	}
+	return [][]string{signature}, nil
+}
+
+// The XMLRPC type a Go type is written as.
+func typeName(t reflect.Type) string {
+	if t == timeType {
+		return "dateTime.iso8601"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return "int"
+	case reflect.Int64, reflect.Uint32, reflect.Uint64:
+		return "i8"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "base64"
+		}
+		return "array"
+	case reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "struct"
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	}
+	return "undef"
+}
@@ -0,0 +1,89 @@
+package xmlrpc
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newSystemTestServer() *httptest.Server {
+	return httptest.NewServer(NewHandler(map[string]Method{
+		"add": func(a int32, b int32) (int32, error) { return a + b, nil },
+		"getBusInfo": func(callerID string) (interface{}, error) {
+			return nil, &Fault{Code: 3, String: "no connections for " + callerID}
+		},
+		"panic": func() (interface{}, error) { panic("oops") },
+	}))
+}
+
+func TestHandler_Multicall(t *testing.T) {
+	server := newSystemTestServer()
+	defer server.Close()
+
+	result, e := NewXMLClient().Call(server.URL, "system.multicall", []interface{}{
+		map[string]interface{}{"methodName": "add", "params": []interface{}{1, 2}},
+		map[string]interface{}{"methodName": "getBusInfo", "params": []interface{}{"/rosgo"}},
+		map[string]interface{}{"methodName": "missing", "params": []interface{}{}},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	expected := []interface{}{
+		[]interface{}{int32(3)},
+		map[string]interface{}{"faultCode": int32(3), "faultString": "no connections for /rosgo"},
+		map[string]interface{}{"faultCode": int32(FaultMethodNotFound), "faultString": "No method named 'missing'."},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestHandler_Introspection(t *testing.T) {
+	server := newSystemTestServer()
+	defer server.Close()
+	client := NewXMLClient()
+
+	var names []string
+	result, e := client.Call(server.URL, "system.listMethods")
+	if e == nil {
+		e = Unmarshal(result, &names)
+	}
+	expected := []string{"add", "getBusInfo", "panic", "system.listMethods", "system.methodSignature", "system.multicall"}
+	if e != nil || !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v, %v", expected, names, e)
+	}
+
+	var signatures [][]string
+	result, e = client.Call(server.URL, "system.methodSignature", "add")
+	if e == nil {
+		e = Unmarshal(result, &signatures)
+	}
+	if e != nil || !reflect.DeepEqual(signatures, [][]string{{"int", "int", "int"}}) {
+		t.Errorf("unexpected signatures %v, %v", signatures, e)
+	}
+}
+
+func TestHandler_Faults(t *testing.T) {
+	server := newSystemTestServer()
+	defer server.Close()
+	client := NewXMLClient()
+
+	for _, test := range []struct {
+		method string
+		args   []interface{}
+		code   int
+		str    string
+	}{
+		{"add", []interface{}{1}, FaultInvalidParams, "Method 'add': expected 2 arguments, got 1"},
+		{"add", []interface{}{1, "two"}, FaultInvalidParams, "Method 'add': argument 2 must be int32, not string"},
+		{"getBusInfo", []interface{}{"/rosgo"}, 3, "no connections for /rosgo"},
+		{"panic", nil, FaultInternalError, "Method 'panic' panicked: oops"},
+	} {
+		_, e := client.Call(server.URL, test.method, test.args...)
+		var fault *Fault
+		if !errors.As(e, &fault) || fault.Code != test.code || fault.String != test.str {
+			t.Errorf("%s%v: expected fault %d %q, got %v", test.method, test.args, test.code, test.str, e)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package xmlrpc
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	//	"io"
@@ -20,10 +22,32 @@ import (
 
 const DefaultOperationTimeout time.Duration = 1 * time.Second
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// dateTime.iso8601 values are written in the basic format Python's xmlrpc uses, without a zone.
+const iso8601Layout = "20060102T15:04:05"
+
+var dateTimeLayouts = []string{
+	iso8601Layout,
+	"20060102T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	time.RFC3339Nano,
+}
+
 type XMLClient struct {
 	http.Client
 }
 
+// Fault is the error returned by a call when the remote host responds with an XMLRPC fault.
+type Fault struct {
+	Code   int
+	String string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("XMLRPC Fault: code=%v string=%v", f.Code, f.String)
+}
+
 func NewXMLClient() *XMLClient {
 	client := &XMLClient{
 		Client: http.Client{
@@ -47,6 +71,13 @@ func emitValue(buf *bytes.Buffer, value interface{}) error {
 	} else {
 		val := reflect.ValueOf(value)
 		if !val.IsValid() {
+			buf.WriteString("<nil/>")
+			return nil
+		}
+		if t, ok := value.(time.Time); ok {
+			buf.WriteString("<dateTime.iso8601>")
+			buf.WriteString(t.UTC().Format(iso8601Layout))
+			buf.WriteString("</dateTime.iso8601>")
 			return nil
 		}
 
@@ -65,15 +96,13 @@ func emitValue(buf *bytes.Buffer, value interface{}) error {
 			buf.WriteString(fmt.Sprint(i))
 			buf.WriteString("</boolean>")
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			i := val.Int()
-			buf.WriteString("<int>")
-			buf.WriteString(strconv.FormatInt(i, 10))
-			buf.WriteString("</int>")
+			emitInt(buf, val.Int())
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 			u := val.Uint()
-			buf.WriteString("<int>")
-			buf.WriteString(strconv.FormatInt(int64(u), 10))
-			buf.WriteString("</int>")
+			if u > math.MaxInt64 {
+				return fmt.Errorf("%v overflows i8", u)
+			}
+			emitInt(buf, int64(u))
 		case reflect.Float32, reflect.Float64:
 			f := val.Float()
 			buf.WriteString("<double>")
@@ -110,6 +139,29 @@ func emitValue(buf *bytes.Buffer, value interface{}) error {
 				buf.WriteString("</value></member>")
 			}
 			buf.WriteString("</struct>")
+		case reflect.Struct:
+			buf.WriteString("<struct>")
+			for i := 0; i < t.NumField(); i++ {
+				name, ok := fieldName(t.Field(i))
+				if !ok {
+					continue
+				}
+				buf.WriteString("<member><name>")
+				buf.WriteString(xmlEscape(name))
+				buf.WriteString("</name><value>")
+				e := emitValue(buf, val.Field(i).Interface())
+				if e != nil {
+					return e
+				}
+				buf.WriteString("</value></member>")
+			}
+			buf.WriteString("</struct>")
+		case reflect.Ptr, reflect.Interface:
+			if val.IsNil() {
+				buf.WriteString("<nil/>")
+				return nil
+			}
+			return emitValue(buf, val.Elem().Interface())
 		case reflect.String:
 			s := val.String()
 			buf.WriteString("<string>")
@@ -122,6 +174,17 @@ func emitValue(buf *bytes.Buffer, value interface{}) error {
 	return nil
 }
 
+// Integers which fit in 32 bits are written as <int>, and larger ones as <i8>.
+func emitInt(buf *bytes.Buffer, i int64) {
+	tag := "int"
+	if i < math.MinInt32 || i > math.MaxInt32 {
+		tag = "i8"
+	}
+	buf.WriteString("<" + tag + ">")
+	buf.WriteString(strconv.FormatInt(i, 10))
+	buf.WriteString("</" + tag + ">")
+}
+
 func emitRequest(buf *bytes.Buffer, method string, args ...interface{}) error {
 	buf.WriteString(xml.Header)
 	buf.WriteString("<methodCall><methodName>")
@@ -244,6 +307,27 @@ func parseValue(d *xml.Decoder) (interface{}, error) {
 			d.Skip() // </i4> or </int>
 			d.Skip() // </value>
 			return int32(i), nil
+		case "i8":
+			token, e := d.Token()
+			if e != nil {
+				return nil, e
+			}
+			data, ok := token.(xml.CharData)
+			if !ok {
+				return nil, errors.New("i8: Not a CharData")
+			}
+			var i int64
+			i, e = strconv.ParseInt(strings.TrimSpace(string(data)), 0, 64)
+			if e != nil {
+				return nil, e
+			}
+			d.Skip() // </i8>
+			d.Skip() // </value>
+			return i, nil
+		case "nil":
+			d.Skip() // </nil>
+			d.Skip() // </value>
+			return nil, nil
 		case "double":
 			token, e := d.Token()
 			if e != nil {
@@ -283,7 +367,21 @@ func parseValue(d *xml.Decoder) (interface{}, error) {
 				}
 			}
 		case "dateTime.iso8601":
-			return nil, errors.New("Not supported1")
+			token, e := d.Token()
+			if e != nil {
+				return nil, e
+			}
+			data, ok := token.(xml.CharData)
+			if !ok {
+				return nil, errors.New("dateTime.iso8601: Not a CharData")
+			}
+			t, e := parseDateTime(strings.TrimSpace(string(data)))
+			if e != nil {
+				return nil, e
+			}
+			d.Skip() // </dateTime.iso8601>
+			d.Skip() // </value>
+			return t, nil
 		case "base64":
 			token, e := d.Token()
 			if e != nil {
@@ -396,6 +494,16 @@ func parseValue(d *xml.Decoder) (interface{}, error) {
 	return nil, errors.New("Invalid data type")
 }
 
+// Times without a zone are taken to be in UTC.
+func parseDateTime(s string) (time.Time, error) {
+	for _, layout := range dateTimeLayouts {
+		if t, e := time.Parse(layout, s); e == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("dateTime.iso8601: invalid time %q", s)
+}
+
 func parseRequest(d *xml.Decoder) (name string, args []interface{}, e error) {
 	_, e = expectNextTag(d, "methodCall")
 	if e != nil {
@@ -495,6 +603,12 @@ func parseResponse(d *xml.Decoder) (ok bool, result interface{}, e error) {
 // Args:
 //   url string: URL of the remote host
 func (client *XMLClient) Call(url string, method string, args ...interface{}) (res interface{}, e error) {
+	return client.CallContext(context.Background(), url, method, args...)
+}
+
+// Call a XMLRPC API in a remote host, giving up when ctx is done.
+// Faults are returned as *Fault errors.
+func (client *XMLClient) CallContext(ctx context.Context, url string, method string, args ...interface{}) (res interface{}, e error) {
 
 	var buffer bytes.Buffer
 	e = emitRequest(&buffer, method, args...)
@@ -502,10 +616,17 @@ func (client *XMLClient) Call(url string, method string, args ...interface{}) (r
 		e = fmt.Errorf("Building request failed for %v", e)
 		return
 	}
+	var req *http.Request
+	req, e = http.NewRequestWithContext(ctx, http.MethodPost, url, &buffer)
+	if e != nil {
+		e = fmt.Errorf("Building request failed for %w", e)
+		return
+	}
+	req.Header.Set("Content-Type", "text/xml")
 	var r *http.Response
-	r, e = client.Post(url, "text/xml", &buffer)
+	r, e = client.Do(req)
 	if e != nil {
-		e = fmt.Errorf("Sending request failed for %v", e)
+		e = fmt.Errorf("Sending request failed for %w", e)
 		return
 	}
 	defer r.Body.Close()
@@ -535,7 +656,7 @@ func (client *XMLClient) Call(url string, method string, args ...interface{}) (r
 				var s string
 				s, ok = m["faultString"].(string)
 				if ok {
-					e = fmt.Errorf("XMLRPC Fault: code=%v string=%v", c, s)
+					e = &Fault{Code: int(c), String: s}
 					return
 				}
 			}
@@ -548,7 +669,19 @@ func (client *XMLClient) Call(url string, method string, args ...interface{}) (r
 //type Method func (args ...interface{}) (interface{}, error)
 type Method interface{}
 
-//
+// Fault codes returned by Handler, from the specification for fault code
+// interoperability.  Methods can return a *Fault error to choose their own.
+const (
+	FaultParseError     = -32700
+	FaultMethodNotFound = -32601
+	FaultInvalidParams  = -32602
+	FaultInternalError  = -32603
+	FaultApplication    = -32500
+)
+
+// Handler serves XMLRPC requests by calling its methods, which must return
+// a value and an error.  It also serves system.multicall,
+// system.listMethods and system.methodSignature.
 type Handler struct {
 	mapping map[string]Method
 	wait    sync.WaitGroup
@@ -576,47 +709,107 @@ func (self *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	name, args, err := parseRequest(decoder)
 	if err != nil {
-		err = emitFault(&buffer, 1, "Invalid request.")
+		err = emitFault(&buffer, FaultParseError, fmt.Sprintf("Invalid request: %v", err))
 		_, err = buffer.WriteTo(w)
 		return
 	}
 
+	result, fault := self.dispatch(name, args)
+	if fault == nil {
+		err = emitResponse(&buffer, result)
+		if err != nil {
+			buffer.Reset()
+			fault = &Fault{FaultInternalError, fmt.Sprintf("Method '%v' returned an invalid result: %v", name, err)}
+		}
+	}
+	if fault != nil {
+		err = emitFault(&buffer, fault.Code, fault.String)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(buffer.Len()))
+	_, err = buffer.WriteTo(w)
+	w.(http.Flusher).Flush()
+}
+
+// Call a method, returning its result or the fault to respond with.
+func (self *Handler) dispatch(name string, args []interface{}) (result interface{}, fault *Fault) {
+	switch name {
+	case "system.multicall":
+		return self.multicall(args)
+	case "system.listMethods":
+		return self.listMethods(args)
+	case "system.methodSignature":
+		return self.methodSignature(args)
+	}
+
 	method, ok := self.mapping[name]
 	if !ok {
-		err = emitFault(&buffer, 1, fmt.Sprintf("No method named '%v'.", name))
-		_, err = buffer.WriteTo(w)
-		return
+		return nil, &Fault{FaultMethodNotFound, fmt.Sprintf("No method named '%v'.", name)}
 	}
-
-	argValues := []reflect.Value{}
-	for _, v := range args {
-		argValues = append(argValues, reflect.ValueOf(v))
+	f := reflect.ValueOf(method)
+	if f.Kind() != reflect.Func || f.Type().NumOut() != 2 || !f.Type().Out(1).Implements(errorType) {
+		return nil, &Fault{FaultInternalError, fmt.Sprintf("Method '%v' must return a value and an error.", name)}
 	}
-	resultValues := reflect.ValueOf(method).Call(argValues)
-	if len(resultValues) != 2 {
-		err = emitFault(&buffer, 1, fmt.Sprintf("Method '%v' return invalid results.", name))
-		return
+	argValues, err := methodArgs(f.Type(), args)
+	if err != nil {
+		return nil, &Fault{FaultInvalidParams, fmt.Sprintf("Method '%v': %v", name, err)}
 	}
-	errValue := resultValues[1]
-	if !errValue.IsNil() {
-		err, ok = errValue.Interface().(error)
-		if !ok {
-			err = emitFault(&buffer, 1, fmt.Sprintf("Method '%v' return an invalid error.", name))
-			_, err = buffer.WriteTo(w)
-		} else {
-			err = emitFault(&buffer, 1, fmt.Sprintf("Method '%v' call failed.", name))
-			_, err = buffer.WriteTo(w)
+
+	defer func() {
+		if r := recover(); r != nil {
+			result, fault = nil, &Fault{FaultInternalError, fmt.Sprintf("Method '%v' panicked: %v", name, r)}
 		}
-		return
+	}()
+	resultValues := f.Call(argValues)
+	if errValue := resultValues[1]; !errValue.IsNil() {
+		err := errValue.Interface().(error)
+		var methodFault *Fault
+		if errors.As(err, &methodFault) {
+			return nil, methodFault
+		}
+		return nil, &Fault{FaultApplication, err.Error()}
 	}
+	return resultValues[0].Interface(), nil
+}
 
-	err = emitResponse(&buffer, resultValues[0].Interface())
-	if err != nil {
-		err = emitFault(&buffer, 1, fmt.Sprintf("Method '%v' return an invalid result type.", name))
-		_, err = buffer.WriteTo(w)
-		return
+// Check a request's arguments against a method's parameters, converting them to the parameters' types.
+func methodArgs(t reflect.Type, args []interface{}) ([]reflect.Value, error) {
+	numIn := t.NumIn()
+	if t.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, fmt.Errorf("expected at least %d arguments, got %d", numIn-1, len(args))
+		}
+	} else if len(args) != numIn {
+		return nil, fmt.Errorf("expected %d arguments, got %d", numIn, len(args))
 	}
-	w.Header().Set("Content-Length", strconv.Itoa(buffer.Len()))
-	_, err = buffer.WriteTo(w)
-	w.(http.Flusher).Flush()
+
+	argValues := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var param reflect.Type
+		if t.IsVariadic() && i >= numIn-1 {
+			param = t.In(numIn - 1).Elem()
+		} else {
+			param = t.In(i)
+		}
+		switch {
+		case arg == nil:
+			switch param.Kind() {
+			case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map:
+				argValues[i] = reflect.Zero(param)
+				continue
+			}
+		case reflect.TypeOf(arg).AssignableTo(param):
+			argValues[i] = reflect.ValueOf(arg)
+			continue
+		default:
+			// Arguments which are decoded as maps and lists can be decoded further, into the method's own types.
+			value := reflect.New(param)
+			if Unmarshal(arg, value.Interface()) == nil {
+				argValues[i] = value.Elem()
+				continue
+			}
+		}
+		return nil, fmt.Errorf("argument %d must be %v, not %T", i+1, param, arg)
+	}
+	return argValues, nil
 }
+
@@ -2,10 +2,13 @@ package xmlrpc
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"testing"
@@ -18,6 +21,10 @@ func TestEmitNil(t *testing.T) {
 	if e != nil {
 		t.Error(e)
 	}
+	s := buffer.String()
+	if s != "<nil/>" {
+		t.Error(s)
+	}
 }
 
 func TestEmitBoolean(t *testing.T) {
@@ -48,6 +55,52 @@ func TestEmitInt(t *testing.T) {
 	}
 }
 
+func TestEmitI8(t *testing.T) {
+	var buffer bytes.Buffer
+	for _, value := range []interface{}{int64(1) << 40, uint64(1) << 63, int32(-7)} {
+		e := emitValue(&buffer, value)
+		if value == uint64(1)<<63 {
+			if e == nil {
+				t.Error("expected an error emitting an unsigned value larger than an i8")
+			}
+		} else if e != nil {
+			t.Error(e)
+		}
+	}
+	s := buffer.String()
+	if s != "<i8>1099511627776</i8><int>-7</int>" {
+		t.Error(s)
+	}
+}
+
+func TestEmitDateTime(t *testing.T) {
+	var buffer bytes.Buffer
+	e := emitValue(&buffer, time.Date(1998, 7, 17, 14, 8, 55, 0, time.UTC))
+	if e != nil {
+		t.Error(e)
+	}
+	s := buffer.String()
+	if s != "<dateTime.iso8601>19980717T14:08:55</dateTime.iso8601>" {
+		t.Error(s)
+	}
+}
+
+func TestEmitGoStruct(t *testing.T) {
+	var buffer bytes.Buffer
+	e := emitValue(&buffer, &struct {
+		Name   string `xmlrpc:"name"`
+		Hidden int    `xmlrpc:"-"`
+		Count  int
+	}{"a", 1, 2})
+	if e != nil {
+		t.Error(e)
+	}
+	s := buffer.String()
+	if s != "<struct><member><name>name</name><value><string>a</string></value></member><member><name>Count</name><value><int>2</int></value></member></struct>" {
+		t.Error(s)
+	}
+}
+
 func TestEmitDouble(t *testing.T) {
 	var buffer bytes.Buffer
 	e := emitValue(&buffer, 3.14)
@@ -274,6 +327,28 @@ func TestParseInt(t *testing.T) {
 	}
 }
 
+func TestParseI8NilDateTime(t *testing.T) {
+	buffer := bytes.NewBufferString("<value><i8>-1099511627776</i8></value><value><nil/></value><value><dateTime.iso8601>19980717T14:08:55</dateTime.iso8601></value>")
+	decoder := xml.NewDecoder(buffer)
+	_, _ = decoder.Token() // <value>
+	value, e := parseValue(decoder)
+	if e != nil || value != int64(-1099511627776) {
+		t.Error(value, e)
+	}
+
+	_, _ = decoder.Token() // <value>
+	value, e = parseValue(decoder)
+	if e != nil || value != nil {
+		t.Error(value, e)
+	}
+
+	_, _ = decoder.Token() // <value>
+	value, e = parseValue(decoder)
+	if e != nil || value != time.Date(1998, 7, 17, 14, 8, 55, 0, time.UTC) {
+		t.Error(value, e)
+	}
+}
+
 func TestParseDouble(t *testing.T) {
 	buffer := bytes.NewBufferString("<value><double>-273.5</double></value><value><double>3.14</double></value>")
 	decoder := xml.NewDecoder(buffer)
@@ -672,6 +747,38 @@ func TestClient_Timeout(t *testing.T) {
 	}
 }
 
+func TestClient_Fault(t *testing.T) {
+	server := httptest.NewServer(NewHandler(map[string]Method{
+		"fail": func() (interface{}, error) { return nil, errors.New("failed") },
+	}))
+	defer server.Close()
+
+	_, e := NewXMLClient().Call(server.URL, "fail")
+	var fault *Fault
+	if !errors.As(e, &fault) || fault.Code != FaultApplication || fault.String != "failed" {
+		t.Errorf("expected a Fault, got %v", e)
+	}
+}
+
+func TestClient_CallContext(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, e := NewXMLClient().CallContext(ctx, server.URL, "getPid", "not_a_node")
+	if !errors.Is(e, context.Canceled) {
+		t.Errorf("expected the call to be cancelled, got %v", e)
+	}
+}
+
 type myDispatcher struct {
 	X int32
 }